@@ -30,6 +30,7 @@ import (
 
 	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
 	"github.com/vmware-tanzu/vm-operator/pkg/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/garbagecollector"
 	"github.com/vmware-tanzu/vm-operator/pkg/lib"
 	"github.com/vmware-tanzu/vm-operator/pkg/patch"
 	"github.com/vmware-tanzu/vm-operator/pkg/prober"
@@ -49,11 +50,20 @@ func AddToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) er
 		controllerNameLong  = fmt.Sprintf("%s/%s/%s", ctx.Namespace, ctx.Name, controllerNameShort)
 	)
 
-	proberManager, err := prober.AddToManager(mgr, ctx.VmProvider)
+	proberManager, err := prober.AddToManager(mgr, ctx.VmProvider, ctx.MaxConcurrentProbes)
 	if err != nil {
 		return err
 	}
 
+	gcOpts := garbagecollector.Options{
+		Period:      ctx.OrphanedVMGCPeriod,
+		GracePeriod: ctx.OrphanedVMGCGracePeriod,
+		Delete:      ctx.OrphanedVMGCDelete,
+	}
+	if err := garbagecollector.AddToManager(mgr, ctx.VmProvider, gcOpts); err != nil {
+		return err
+	}
+
 	r := NewReconciler(
 		mgr.GetClient(),
 		ctx.MaxConcurrentReconciles,
@@ -228,6 +238,7 @@ type VirtualMachineReconciler struct {
 // +kubebuilder:rbac:groups=vmware.com,resources=virtualnetworkinterfaces;virtualnetworkinterfaces/status,verbs=create;get;list;patch;delete;watch;update
 // +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=events;configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
 // +kubebuilder:rbac:groups="",resources=resourcequotas;namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups=vmoperator.vmware.com,resources=virtualmachineclassbindings,verbs=get;list;watch
 // +kubebuilder:rbac:groups=vmoperator.vmware.com,resources=contentsources,verbs=get;list;watch
@@ -263,6 +274,10 @@ func (r *VirtualMachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, r
 
 	if !vm.DeletionTimestamp.IsZero() {
 		err = r.ReconcileDelete(vmCtx)
+		if err == nil && vmprovider.IsPowerOffInProgress(vm) {
+			// Delete the VM once its guest has shut down, or hard power it off at the deadline.
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		}
 		return ctrl.Result{}, err
 	}
 
@@ -292,28 +307,70 @@ func requeueDelay(ctx *context.VirtualMachineContext) time.Duration {
 		return 10 * time.Second
 	}
 
+	// Poll the progress of the migration of the VM.
+	if vmprovider.IsMigrationInProgress(ctx.VM) {
+		return 10 * time.Second
+	}
+
+	// Adopt the imported VM once its back-filled spec has been persisted.
+	if vmprovider.IsImportPending(ctx.VM) {
+		return 10 * time.Second
+	}
+
+	// Poll the shutdown of the guest, and hard power off the VM once the deadline has passed.
+	if vmprovider.IsPowerOffInProgress(ctx.VM) {
+		return 10 * time.Second
+	}
+
 	return 0
 }
 
 func (r *VirtualMachineReconciler) deleteVm(ctx *context.VirtualMachineContext) (err error) {
 	defer func() {
-		r.Recorder.EmitEvent(ctx.VM, "Delete", err, false)
+		if !vmprovider.IsPowerOffInProgress(ctx.VM) {
+			r.Recorder.EmitEvent(ctx.VM, "Delete", err, false)
+		}
 	}()
 
 	err = r.VmProvider.DeleteVirtualMachine(ctx, ctx.VM)
 	if err != nil {
 		if apiErrors.IsNotFound(err) {
 			ctx.Logger.Info("To be deleted VirtualMachine was not found")
+			vmprovider.ClearPowerOffDeadline(ctx.VM)
 			return nil
 		}
 		ctx.Logger.Error(err, "Failed to delete VirtualMachine")
 		return err
 	}
 
+	if vmprovider.IsPowerOffInProgress(ctx.VM) {
+		ctx.Logger.Info("Waiting for the guest to shut down before deleting VirtualMachine")
+		return nil
+	}
+
 	ctx.Logger.V(4).Info("Deleted VirtualMachine")
 	return nil
 }
 
+func (r *VirtualMachineReconciler) retainVm(ctx *context.VirtualMachineContext) (err error) {
+	defer func() {
+		r.Recorder.EmitEvent(ctx.VM, "Retain", err, false)
+	}()
+
+	err = r.VmProvider.RetainVirtualMachine(ctx, ctx.VM)
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			ctx.Logger.Info("To be retained VirtualMachine was not found")
+			return nil
+		}
+		ctx.Logger.Error(err, "Failed to retain VirtualMachine")
+		return err
+	}
+
+	ctx.Logger.V(4).Info("Retained VirtualMachine")
+	return nil
+}
+
 func (r *VirtualMachineReconciler) ReconcileDelete(ctx *context.VirtualMachineContext) error {
 	vm := ctx.VM
 
@@ -325,10 +382,27 @@ func (r *VirtualMachineReconciler) ReconcileDelete(ctx *context.VirtualMachineCo
 	if controllerutil.ContainsFinalizer(vm, finalizerName) {
 		vm.Status.Phase = vmopv1alpha1.Deleting
 
-		if err := r.deleteVm(ctx); err != nil {
+		policy, err := vmprovider.GetDeletionPolicy(vm)
+		if err != nil {
+			// Do not guess: deleting a VM that was meant to be retained cannot be undone.
+			ctx.Logger.Error(err, "Invalid deletion policy, not deleting the VM")
+			r.Recorder.EmitEvent(vm, "Delete", err, false)
 			return err
 		}
 
+		if policy == vmprovider.DeletionPolicyRetain {
+			err = r.retainVm(ctx)
+		} else {
+			err = r.deleteVm(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if vmprovider.IsPowerOffInProgress(vm) {
+			// Keep the finalizer until the VM is deleted once its guest has shut down.
+			return nil
+		}
+
 		vm.Status.Phase = vmopv1alpha1.Deleted
 		controllerutil.RemoveFinalizer(vm, finalizerName)
 	}
@@ -554,6 +628,22 @@ func (r *VirtualMachineReconciler) getVMMetadata(ctx *context.VirtualMachineCont
 		Data:      vmMetadataConfigMap.Data,
 	}
 
+	if secretName, ok := ctx.VM.Annotations[vmprovider.MetadataSecretAnnotationKey]; ok {
+		vmMetadataSecret := &v1.Secret{}
+		err := r.Get(ctx, client.ObjectKey{Name: secretName, Namespace: ctx.VM.Namespace}, vmMetadataSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		outMetadata.Data = make(map[string]string, len(vmMetadataConfigMap.Data)+len(vmMetadataSecret.Data))
+		for k, v := range vmMetadataConfigMap.Data {
+			outMetadata.Data[k] = v
+		}
+		for k, v := range vmMetadataSecret.Data {
+			outMetadata.Data[k] = string(v)
+		}
+	}
+
 	return outMetadata, nil
 }
 
@@ -624,6 +714,21 @@ func (r *VirtualMachineReconciler) createOrUpdateVm(ctx *context.VirtualMachineC
 		ContentLibraryUUID: clUUID,
 	}
 
+	// An imported VM already exists, but is only found once it has been adopted.
+	if vmprovider.IsImportPending(vm) {
+		err = r.VmProvider.ImportVirtualMachine(ctx, vm, vmConfigArgs)
+		if err != nil {
+			ctx.Logger.Error(err, "Provider failed to import VirtualMachine")
+			r.Recorder.EmitEvent(vm, "Import", err, false)
+			return err
+		}
+		if vmprovider.IsImportPending(vm) {
+			// Let the patch helper persist the back-filled spec before the VM is adopted.
+			return nil
+		}
+		r.Recorder.EmitEvent(vm, "Import", nil, false)
+	}
+
 	exists, err := r.VmProvider.DoesVirtualMachineExist(ctx, vm)
 	if err != nil {
 		ctx.Logger.Error(err, "Failed to check if VirtualMachine exists from provider")
@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -509,6 +510,58 @@ func unitTestsReconcile() {
 			Expect(vmCtx.VM.Status.Phase).To(Equal(vmopv1alpha1.Created))
 		})
 
+		When("the VM imports an existing VM", func() {
+			BeforeEach(func() {
+				vm.Annotations = map[string]string{
+					vmprovider.ImportMoIDAnnotationKey: "vm-42",
+				}
+			})
+
+			It("will import the VM instead of creating it", func() {
+				var createCalled bool
+				fakeVmProvider.CreateVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error {
+					createCalled = true
+					return nil
+				}
+
+				err := reconciler.ReconcileNormal(vmCtx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(createCalled).To(BeFalse())
+
+				expectEvent(ctx, "ImportSuccess")
+				Expect(vmCtx.VM.Status.UniqueID).To(Equal("vm-42"))
+			})
+
+			It("will not create the VM while the import is pending", func() {
+				var createCalled bool
+				fakeVmProvider.CreateVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error {
+					createCalled = true
+					return nil
+				}
+				fakeVmProvider.ImportVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error {
+					vmprovider.SetImportedMoID(vm, "vm-42")
+					return nil
+				}
+
+				err := reconciler.ReconcileNormal(vmCtx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(createCalled).To(BeFalse())
+				Expect(vmCtx.VM.Status.UniqueID).To(BeEmpty())
+				Expect(vmprovider.GetImportedMoID(vmCtx.VM)).To(Equal("vm-42"))
+				Expect(ctx.Events).ToNot(Receive())
+			})
+
+			It("will return error when provider fails to import VM", func() {
+				fakeVmProvider.ImportVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error {
+					return errors.New(providerError)
+				}
+
+				err := reconciler.ReconcileNormal(vmCtx)
+				Expect(err).To(MatchError(providerError))
+				expectEvent(ctx, "ImportFailure")
+			})
+		})
+
 		It("can be called multiple times", func() {
 			err := reconciler.ReconcileNormal(vmCtx)
 			Expect(err).ToNot(HaveOccurred())
@@ -556,6 +609,50 @@ func unitTestsReconcile() {
 					Expect(err).ToNot(HaveOccurred())
 				})
 			})
+
+			When("VM Metadata Secret is specified", func() {
+				BeforeEach(func() {
+					vm.Annotations = map[string]string{
+						vmprovider.MetadataSecretAnnotationKey: "dummy-vm-metadata-secret",
+					}
+					initObjects = append(initObjects, vmMetaData)
+				})
+
+				When("VM Metadata Secret does not exist", func() {
+					It("return an error", func() {
+						err := reconciler.ReconcileNormal(vmCtx)
+						Expect(err).To(HaveOccurred())
+					})
+				})
+
+				When("VM Metadata Secret exists", func() {
+					BeforeEach(func() {
+						initObjects = append(initObjects, &corev1.Secret{
+							ObjectMeta: metav1.ObjectMeta{
+								Name:      "dummy-vm-metadata-secret",
+								Namespace: vm.Namespace,
+							},
+							Data: map[string][]byte{
+								"secret": []byte("value"),
+							},
+						})
+					})
+
+					It("adds the Secret data to the VM Metadata", func() {
+						var vmMetadata *vmprovider.VmMetadata
+						fakeVmProvider.CreateVirtualMachineFn = func(_ context.Context, _ *vmopv1alpha1.VirtualMachine, args vmprovider.VmConfigArgs) error {
+							vmMetadata = args.VmMetadata
+							return nil
+						}
+
+						err := reconciler.ReconcileNormal(vmCtx)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(vmMetadata).ToNot(BeNil())
+						Expect(vmMetadata.Data).To(HaveKeyWithValue("foo", "bar"))
+						Expect(vmMetadata.Data).To(HaveKeyWithValue("secret", "value"))
+					})
+				})
+			})
 		})
 
 		When("VM ResourcePolicy is specified", func() {
@@ -703,6 +800,84 @@ func unitTestsReconcile() {
 			Expect(vmCtx.VM.Status.Phase).To(Equal(vmopv1alpha1.Deleting))
 		})
 
+		It("will keep the finalizer while the guest is shutting down", func() {
+			fakeVmProvider.DeleteVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine) error {
+				vmprovider.SetPowerOffDeadline(vm, time.Now().Add(time.Minute))
+				return nil
+			}
+
+			err := reconciler.ReconcileDelete(vmCtx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vmCtx.VM.Status.Phase).To(Equal(vmopv1alpha1.Deleting))
+			Expect(vmCtx.VM.Finalizers).ToNot(BeEmpty())
+			Expect(fakeProbeManager.IsRemoveFromProberManagerCalled).Should(BeFalse())
+		})
+
+		When("the VM has the Retain deletion policy", func() {
+			BeforeEach(func() {
+				vm.Annotations = map[string]string{
+					vmprovider.DeletionPolicyAnnotationKey: string(vmprovider.DeletionPolicyRetain),
+				}
+			})
+
+			It("will retain the VM and emit corresponding event", func() {
+				var deleteCalled bool
+				fakeVmProvider.DeleteVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine) error {
+					deleteCalled = true
+					return nil
+				}
+
+				err := reconciler.ReconcileDelete(vmCtx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleteCalled).To(BeFalse())
+
+				expectEvent(ctx, "RetainSuccess")
+				Expect(vmCtx.VM.Status.Phase).To(Equal(vmopv1alpha1.Deleted))
+				Expect(vmCtx.VM.Finalizers).To(BeEmpty())
+			})
+
+			It("will emit corresponding event during retain failure", func() {
+				fakeVmProvider.RetainVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine) error {
+					return errors.New(providerError)
+				}
+
+				err := reconciler.ReconcileDelete(vmCtx)
+				Expect(err).To(HaveOccurred())
+
+				expectEvent(ctx, "RetainFailure")
+				Expect(vmCtx.VM.Status.Phase).To(Equal(vmopv1alpha1.Deleting))
+			})
+		})
+
+		When("the VM has an invalid deletion policy", func() {
+			BeforeEach(func() {
+				vm.Annotations = map[string]string{
+					vmprovider.DeletionPolicyAnnotationKey: "Orphan",
+				}
+			})
+
+			It("will neither delete nor retain the VM", func() {
+				var deleteCalled, retainCalled bool
+				fakeVmProvider.DeleteVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine) error {
+					deleteCalled = true
+					return nil
+				}
+				fakeVmProvider.RetainVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine) error {
+					retainCalled = true
+					return nil
+				}
+
+				err := reconciler.ReconcileDelete(vmCtx)
+				Expect(err).To(HaveOccurred())
+				Expect(deleteCalled).To(BeFalse())
+				Expect(retainCalled).To(BeFalse())
+
+				expectEvent(ctx, "DeleteFailure")
+				Expect(vmCtx.VM.Status.Phase).To(Equal(vmopv1alpha1.Deleting))
+				Expect(vmCtx.VM.Finalizers).ToNot(BeEmpty())
+			})
+		})
+
 		It("Should not remove from Prober Manager if ReconcileDelete fails", func() {
 			// Simulate delete failure
 			fakeVmProvider.DeleteVirtualMachineFn = func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine) error {
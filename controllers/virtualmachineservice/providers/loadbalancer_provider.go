@@ -1,4 +1,4 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package providers
@@ -11,13 +11,18 @@ import (
 
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin"
 	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/simplelb"
 	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/utils"
+	"github.com/vmware-tanzu/vm-operator/pkg/lib"
 )
 
 const (
 	NSXTLoadBalancer   = "nsx-t-lb"
 	SimpleLoadBalancer = "simple-lb"
+	// PluginLoadBalancer is an out-of-tree provider that is called over the gRPC
+	// plugin protocol at the LB_PROVIDER_PLUGIN_ENDPOINT endpoint.
+	PluginLoadBalancer = "plugin"
 
 	ServiceLoadBalancerHealthCheckNodePortTagKey = "ncp/healthCheckNodePort"
 	NSXTServiceProxy                             = "nsx-t"
@@ -66,12 +71,22 @@ type LoadbalancerProvider interface {
 	GetToBeRemovedServiceAnnotations(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error)
 }
 
+// Any LoadbalancerProvider can be served to VM Operator as a plugin.
+var _ plugin.Provider = LoadbalancerProvider(nil)
+
 func GetLoadbalancerProviderByType(mgr manager.Manager, providerType string) (LoadbalancerProvider, error) {
 	if providerType == NSXTLoadBalancer {
 		return NsxtLoadBalancerProvider(), nil
 	}
 	if providerType == SimpleLoadBalancer {
-		return simplelb.New(mgr), nil
+		lbProvider, err := simplelb.New(mgr)
+		if err != nil {
+			return nil, err
+		}
+		return lbProvider, nil
+	}
+	if providerType == PluginLoadBalancer {
+		return plugin.Dial(lib.LBProviderPluginEndpoint())
 	}
 	return NoopLoadbalancerProvider{}, nil
 }
@@ -161,5 +176,8 @@ func (nl *NsxtLoadbalancerProvider) GetToBeRemovedServiceAnnotations(ctx context
 		res[ServiceLoadBalancerHealthCheckNodePortTagKey] = ""
 	}
 
+	// The load balancer conditions are reported on the VirtualMachineService only
+	res[LoadBalancerConditionsAnnotationKey] = ""
+
 	return res, nil
 }
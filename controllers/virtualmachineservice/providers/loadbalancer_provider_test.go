@@ -1,18 +1,24 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package providers
 
 import (
 	"context"
+	"os"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"google.golang.org/grpc"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin"
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin/conformance"
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin/fake"
 	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/utils"
+	"github.com/vmware-tanzu/vm-operator/pkg/lib"
 
 	vmoperatorv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 )
@@ -39,6 +45,20 @@ var _ = Describe("Loadbalancer Provider", func() {
 			Expect(lbProvider).ToNot(BeNil())
 		})
 
+		It("should dial the plugin load balancer provider", func() {
+			os.Setenv(lib.LBProviderPluginEndpointEnv, "unix:///var/run/lb-plugin.sock")
+			defer os.Unsetenv(lib.LBProviderPluginEndpointEnv)
+
+			lbProvider, err := GetLoadbalancerProviderByType(nil, PluginLoadBalancer)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lbProvider).To(BeAssignableToTypeOf(&plugin.Client{}))
+		})
+
+		It("should fail to get the plugin load balancer provider without an endpoint", func() {
+			_, err := GetLoadbalancerProviderByType(nil, PluginLoadBalancer)
+			Expect(err).To(HaveOccurred())
+		})
+
 		It("should successfully get a noop loadbalancer provider", func() {
 			lbProvider, err := GetLoadbalancerProviderByType(nil, "")
 			Expect(err).NotTo(HaveOccurred())
@@ -233,3 +253,24 @@ var _ = Describe("Loadbalancer Provider", func() {
 		})
 	})
 })
+
+var _ = Describe("NSX-T load balancer provider served as a plugin", func() {
+	var (
+		conn *grpc.ClientConn
+		stop func()
+	)
+
+	BeforeEach(func() {
+		var err error
+		conn, stop, err = fake.Serve(NsxtLoadBalancerProvider())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	conformance.DescribeConformance(func() grpc.ClientConnInterface {
+		return conn
+	})
+})
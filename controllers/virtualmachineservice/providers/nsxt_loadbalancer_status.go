@@ -0,0 +1,219 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	ncpv1alpha1 "github.com/vmware-tanzu/vm-operator/external/ncp/api/v1alpha1"
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere"
+)
+
+const (
+	// LoadBalancerConditionsAnnotationKey is the VirtualMachineService annotation with the JSON encoded
+	// conditions of its load balancer. The VirtualMachineService status does not have conditions.
+	LoadBalancerConditionsAnnotationKey = "vmoperator.vmware.com/loadbalancer-conditions"
+
+	// LoadBalancerReadyCondition is True when the load balancer of the VirtualMachineService has an ingress IP.
+	LoadBalancerReadyCondition vmopv1alpha1.ConditionType = "LoadBalancerReady"
+
+	// LoadBalancerPendingReason (Severity=Info) documents that NCP has not yet allocated the load balancer.
+	LoadBalancerPendingReason = "LoadBalancerPending"
+	// LoadBalancerIPPoolExhaustedReason (Severity=Error) documents that NCP has no free IP for the load balancer VIP.
+	LoadBalancerIPPoolExhaustedReason = "IPPoolExhausted"
+	// LoadBalancerAllocationFailedReason (Severity=Error) documents that NCP failed to allocate the load balancer.
+	LoadBalancerAllocationFailedReason = "AllocationFailed"
+	// VirtualNetworkNotReadyReason (Severity=Warning) documents that a VirtualNetwork of the selected VMs is not ready.
+	VirtualNetworkNotReadyReason = "VirtualNetworkNotReady"
+	// LoadBalancerTimedOutReason (Severity=Error) documents that NCP did not allocate the load balancer in time.
+	LoadBalancerTimedOutReason = "LoadBalancerTimedOut"
+
+	// NCPLoadBalancerErrorAnnotationKey is the Service annotation NCP sets when it fails to allocate the load balancer.
+	NCPLoadBalancerErrorAnnotationKey = "ncp/error.loadbalancer"
+	ncpIPPoolExhausted                = "IP_POOL_EXHAUSTED"
+)
+
+// LoadBalancerAllocationTimeout is how long NCP has to allocate the load balancer before the
+// LoadBalancerReadyCondition reports LoadBalancerTimedOutReason.
+var LoadBalancerAllocationTimeout = 5 * time.Minute
+
+// LoadBalancerStatusReconciler is implemented by providers that report the progress of the load
+// balancer of a VirtualMachineService after its Service has been reconciled. It returns how long
+// to wait before the status needs to be reconciled again, or zero.
+type LoadBalancerStatusReconciler interface {
+	ReconcileLoadBalancerStatus(
+		ctx context.Context,
+		c client.Client,
+		recorder record.Recorder,
+		vmService *vmopv1alpha1.VirtualMachineService,
+		service *corev1.Service) (time.Duration, error)
+}
+
+var _ LoadBalancerStatusReconciler = &NsxtLoadbalancerProvider{}
+
+// vmServiceConditions stores the load balancer conditions of a VirtualMachineService in the
+// LoadBalancerConditionsAnnotationKey annotation.
+type vmServiceConditions struct {
+	*vmopv1alpha1.VirtualMachineService
+}
+
+// VirtualMachineServiceConditions returns the load balancer conditions of the VirtualMachineService.
+func VirtualMachineServiceConditions(vmService *vmopv1alpha1.VirtualMachineService) conditions.Setter {
+	return vmServiceConditions{vmService}
+}
+
+func (v vmServiceConditions) GetConditions() vmopv1alpha1.Conditions {
+	data, ok := v.Annotations[LoadBalancerConditionsAnnotationKey]
+	if !ok {
+		return nil
+	}
+
+	var c vmopv1alpha1.Conditions
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		// The annotation is overwritten with valid conditions.
+		return nil
+	}
+	return c
+}
+
+func (v vmServiceConditions) SetConditions(c vmopv1alpha1.Conditions) {
+	data, _ := json.Marshal(c)
+	if v.Annotations == nil {
+		v.Annotations = make(map[string]string)
+	}
+	v.Annotations[LoadBalancerConditionsAnnotationKey] = string(data)
+}
+
+// ReconcileLoadBalancerStatus sets the LoadBalancerReadyCondition of the VirtualMachineService from
+// the Service that NCP allocates the load balancer for, and from the VirtualNetworks of the VMs
+// selected by the VirtualMachineService. Changes of the condition are recorded as events.
+func (nl *NsxtLoadbalancerProvider) ReconcileLoadBalancerStatus(
+	ctx context.Context,
+	c client.Client,
+	recorder record.Recorder,
+	vmService *vmopv1alpha1.VirtualMachineService,
+	service *corev1.Service) (time.Duration, error) {
+
+	newVMService := vmService.DeepCopy()
+	newConditions := VirtualMachineServiceConditions(newVMService)
+	old := conditions.Get(newConditions, LoadBalancerReadyCondition)
+
+	var requeueAfter time.Duration
+	if len(service.Status.LoadBalancer.Ingress) > 0 {
+		conditions.MarkTrue(newConditions, LoadBalancerReadyCondition)
+	} else if errCode := service.Annotations[NCPLoadBalancerErrorAnnotationKey]; errCode != "" {
+		reason := LoadBalancerAllocationFailedReason
+		if errCode == ncpIPPoolExhausted {
+			reason = LoadBalancerIPPoolExhaustedReason
+		}
+		conditions.MarkFalse(newConditions, LoadBalancerReadyCondition, reason, vmopv1alpha1.ConditionSeverityError,
+			"NCP failed to allocate the load balancer: %s", errCode)
+	} else {
+		vnet, err := notReadyVirtualNetwork(ctx, c, vmService)
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case vnet != nil:
+			conditions.MarkFalse(newConditions, LoadBalancerReadyCondition, VirtualNetworkNotReadyReason, vmopv1alpha1.ConditionSeverityWarning,
+				"VirtualNetwork %s is not ready", vnet.Name)
+		case old != nil && old.Reason == LoadBalancerTimedOutReason:
+			// Stay timed out until NCP allocates the load balancer or reports an error.
+		case old != nil && old.Reason == LoadBalancerPendingReason && time.Since(old.LastTransitionTime.Time) >= LoadBalancerAllocationTimeout:
+			conditions.MarkFalse(newConditions, LoadBalancerReadyCondition, LoadBalancerTimedOutReason, vmopv1alpha1.ConditionSeverityError,
+				"NCP did not allocate the load balancer within %s", LoadBalancerAllocationTimeout)
+		default:
+			conditions.MarkFalse(newConditions, LoadBalancerReadyCondition, LoadBalancerPendingReason, vmopv1alpha1.ConditionSeverityInfo,
+				"Waiting for NCP to allocate the load balancer")
+			pending := conditions.Get(newConditions, LoadBalancerReadyCondition)
+			requeueAfter = LoadBalancerAllocationTimeout - time.Since(pending.LastTransitionTime.Time)
+			if requeueAfter <= 0 {
+				requeueAfter = time.Second
+			}
+		}
+	}
+
+	if cond := conditions.Get(newConditions, LoadBalancerReadyCondition); old == nil || old.Status != cond.Status || old.Reason != cond.Reason {
+		recordLoadBalancerEvent(recorder, vmService, cond)
+	}
+
+	if newVMService.Annotations[LoadBalancerConditionsAnnotationKey] != vmService.Annotations[LoadBalancerConditionsAnnotationKey] {
+		if err := c.Patch(ctx, newVMService, client.MergeFrom(vmService)); err != nil {
+			return 0, err
+		}
+		vmService.Annotations = newVMService.Annotations
+		vmService.ResourceVersion = newVMService.ResourceVersion
+	}
+
+	return requeueAfter, nil
+}
+
+func recordLoadBalancerEvent(recorder record.Recorder, vmService *vmopv1alpha1.VirtualMachineService, cond *vmopv1alpha1.Condition) {
+	switch {
+	case cond.Status == corev1.ConditionTrue:
+		recorder.Event(vmService, string(LoadBalancerReadyCondition), "load balancer is ready")
+	case cond.Severity == vmopv1alpha1.ConditionSeverityInfo:
+		recorder.Event(vmService, cond.Reason, cond.Message)
+	default:
+		recorder.Warn(vmService, cond.Reason, cond.Message)
+	}
+}
+
+// notReadyVirtualNetwork returns the first VirtualNetwork of the NSX-T network interfaces of the
+// VMs selected by the VirtualMachineService that is not ready, or nil.
+func notReadyVirtualNetwork(ctx context.Context, c client.Client, vmService *vmopv1alpha1.VirtualMachineService) (*ncpv1alpha1.VirtualNetwork, error) {
+	if len(vmService.Spec.Selector) == 0 {
+		return nil, nil
+	}
+
+	vmList := &vmopv1alpha1.VirtualMachineList{}
+	if err := c.List(ctx, vmList, client.InNamespace(vmService.Namespace), client.MatchingLabels(vmService.Spec.Selector)); err != nil {
+		return nil, err
+	}
+
+	checked := map[string]bool{}
+	for _, vm := range vmList.Items {
+		for _, nif := range vm.Spec.NetworkInterfaces {
+			if nif.NetworkType != vsphere.NsxtNetworkType || nif.NetworkName == "" || checked[nif.NetworkName] {
+				continue
+			}
+			checked[nif.NetworkName] = true
+
+			vnet := &ncpv1alpha1.VirtualNetwork{}
+			if err := c.Get(ctx, types.NamespacedName{Namespace: vmService.Namespace, Name: nif.NetworkName}, vnet); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			if !isVirtualNetworkReady(vnet) {
+				return vnet, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func isVirtualNetworkReady(vnet *ncpv1alpha1.VirtualNetwork) bool {
+	for _, condition := range vnet.Status.Conditions {
+		if strings.Contains(condition.Type, "Ready") && strings.Contains(condition.Status, "True") {
+			return true
+		}
+	}
+	return false
+}
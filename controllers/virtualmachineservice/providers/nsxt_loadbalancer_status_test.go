@@ -0,0 +1,183 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package providers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmoperatorv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	ncpv1alpha1 "github.com/vmware-tanzu/vm-operator/external/ncp/api/v1alpha1"
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere"
+	"github.com/vmware-tanzu/vm-operator/test/builder"
+)
+
+var _ = Describe("NSX-T load balancer status", func() {
+	const (
+		testNs   = "test-ns"
+		testSvc  = "test-svc"
+		vnetName = "test-vnet"
+	)
+
+	var (
+		ctx         context.Context
+		initObjects []runtime.Object
+		c           client.Client
+		recorder    record.Recorder
+		events      chan string
+		vmService   *vmoperatorv1alpha1.VirtualMachineService
+		service     *corev1.Service
+		lbProvider  *NsxtLoadbalancerProvider
+	)
+
+	readyCondition := func() *vmoperatorv1alpha1.Condition {
+		latest := &vmoperatorv1alpha1.VirtualMachineService{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: testNs, Name: testSvc}, latest)).To(Succeed())
+		return conditions.Get(VirtualMachineServiceConditions(latest), LoadBalancerReadyCondition)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		vmService = &vmoperatorv1alpha1.VirtualMachineService{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: testSvc},
+			Spec: vmoperatorv1alpha1.VirtualMachineServiceSpec{
+				Type:     vmoperatorv1alpha1.VirtualMachineServiceTypeLoadBalancer,
+				Selector: map[string]string{"app": "test"},
+			},
+		}
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: testSvc},
+		}
+		initObjects = []runtime.Object{vmService}
+		lbProvider = NsxtLoadBalancerProvider()
+	})
+
+	JustBeforeEach(func() {
+		c, _ = builder.NewFakeClient(initObjects...)
+		recorder, events = builder.NewFakeRecorder()
+	})
+
+	It("marks the load balancer ready when the Service has an ingress IP", func() {
+		service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.20.30.40"}}
+
+		requeueAfter, err := lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requeueAfter).To(BeZero())
+
+		cond := readyCondition()
+		Expect(cond).ToNot(BeNil())
+		Expect(cond.Status).To(Equal(corev1.ConditionTrue))
+		Expect(events).To(Receive(ContainSubstring(string(LoadBalancerReadyCondition))))
+	})
+
+	It("waits for NCP and requeues before the allocation times out", func() {
+		requeueAfter, err := lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requeueAfter).To(BeNumerically(">", 0))
+		Expect(requeueAfter).To(BeNumerically("<=", LoadBalancerAllocationTimeout))
+
+		cond := readyCondition()
+		Expect(cond.Status).To(Equal(corev1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(LoadBalancerPendingReason))
+	})
+
+	It("reports IP pool exhaustion", func() {
+		service.Annotations = map[string]string{NCPLoadBalancerErrorAnnotationKey: ncpIPPoolExhausted}
+
+		_, err := lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+		Expect(err).ToNot(HaveOccurred())
+
+		cond := readyCondition()
+		Expect(cond.Reason).To(Equal(LoadBalancerIPPoolExhaustedReason))
+		Expect(cond.Severity).To(Equal(vmoperatorv1alpha1.ConditionSeverityError))
+		Expect(events).To(Receive(And(ContainSubstring("Warning"), ContainSubstring(ncpIPPoolExhausted))))
+	})
+
+	It("reports other allocation failures", func() {
+		service.Annotations = map[string]string{NCPLoadBalancerErrorAnnotationKey: "LB_SERVICE_NOT_FOUND"}
+
+		_, err := lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readyCondition().Reason).To(Equal(LoadBalancerAllocationFailedReason))
+	})
+
+	It("only records an event when the condition changes", func() {
+		service.Annotations = map[string]string{NCPLoadBalancerErrorAnnotationKey: ncpIPPoolExhausted}
+
+		_, err := lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+	})
+
+	Context("when the allocation times out", func() {
+		BeforeEach(func() {
+			pending := conditions.FalseCondition(LoadBalancerReadyCondition, LoadBalancerPendingReason,
+				vmoperatorv1alpha1.ConditionSeverityInfo, "Waiting for NCP to allocate the load balancer")
+			pending.LastTransitionTime = metav1.NewTime(time.Now().Add(-2 * LoadBalancerAllocationTimeout))
+			conditions.Set(VirtualMachineServiceConditions(vmService), pending)
+		})
+
+		It("reports a timeout and stays timed out", func() {
+			requeueAfter, err := lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requeueAfter).To(BeZero())
+			Expect(readyCondition().Reason).To(Equal(LoadBalancerTimedOutReason))
+			Expect(events).To(Receive(ContainSubstring(LoadBalancerTimedOutReason)))
+
+			_, err = lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readyCondition().Reason).To(Equal(LoadBalancerTimedOutReason))
+			Expect(events).To(BeEmpty())
+		})
+	})
+
+	Context("when a VirtualNetwork of the selected VMs is not ready", func() {
+		BeforeEach(func() {
+			vm := &vmoperatorv1alpha1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: "test-vm", Labels: vmService.Spec.Selector},
+				Spec: vmoperatorv1alpha1.VirtualMachineSpec{
+					NetworkInterfaces: []vmoperatorv1alpha1.VirtualMachineNetworkInterface{{
+						NetworkType: vsphere.NsxtNetworkType,
+						NetworkName: vnetName,
+					}},
+				},
+			}
+			vnet := &ncpv1alpha1.VirtualNetwork{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: vnetName},
+				Status: ncpv1alpha1.VirtualNetworkStatus{
+					Conditions: []ncpv1alpha1.VirtualNetworkCondition{{Type: "Ready", Status: "False"}},
+				},
+			}
+			initObjects = append(initObjects, vm, vnet)
+		})
+
+		It("reports the VirtualNetwork", func() {
+			_, err := lbProvider.ReconcileLoadBalancerStatus(ctx, c, recorder, vmService, service)
+			Expect(err).ToNot(HaveOccurred())
+
+			cond := readyCondition()
+			Expect(cond.Reason).To(Equal(VirtualNetworkNotReadyReason))
+			Expect(cond.Message).To(ContainSubstring(vnetName))
+		})
+	})
+
+	It("does not copy the conditions to the Service", func() {
+		annotations, err := lbProvider.GetToBeRemovedServiceAnnotations(ctx, vmService)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(annotations).To(HaveKey(LoadBalancerConditionsAnnotationKey))
+	})
+})
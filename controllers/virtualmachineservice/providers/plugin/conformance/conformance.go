@@ -0,0 +1,142 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package conformance has the tests that a load balancer plugin must pass.
+// A plugin in any language can run them with
+//
+//	LB_PROVIDER_PLUGIN_CONFORMANCE_ENDPOINT=unix:///path/to/plugin.sock \
+//	  go test ./controllers/virtualmachineservice/providers/plugin/conformance/...
+//
+// and a plugin written in Go can also call DescribeConformance from its own
+// Ginkgo suite.
+package conformance
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin"
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/utils"
+)
+
+// EndpointEnv names the endpoint of the plugin the conformance suite runs against.
+const EndpointEnv = "LB_PROVIDER_PLUGIN_CONFORMANCE_ENDPOINT"
+
+// vmServices are the VirtualMachineServices the plugin is exercised with.
+func vmServices() []*vmopv1alpha1.VirtualMachineService {
+	ports := []vmopv1alpha1.VirtualMachineServicePort{{
+		Name:       "apiserver",
+		Protocol:   "TCP",
+		Port:       6443,
+		TargetPort: 6443,
+	}}
+
+	return []*vmopv1alpha1.VirtualMachineService{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "conformance-ns", Name: "lb"},
+			Spec: vmopv1alpha1.VirtualMachineServiceSpec{
+				Type:     vmopv1alpha1.VirtualMachineServiceTypeLoadBalancer,
+				Ports:    ports,
+				Selector: map[string]string{"app": "conformance"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "conformance-ns",
+				Name:      "lb-with-annotations",
+				Annotations: map[string]string{
+					utils.AnnotationServiceExternalTrafficPolicyKey: "Local",
+					utils.AnnotationServiceHealthCheckNodePortKey:   "30012",
+				},
+			},
+			Spec: vmopv1alpha1.VirtualMachineServiceSpec{
+				Type:           vmopv1alpha1.VirtualMachineServiceTypeLoadBalancer,
+				Ports:          ports,
+				Selector:       map[string]string{"app": "conformance"},
+				LoadBalancerIP: "10.20.30.40",
+			},
+		},
+	}
+}
+
+// DescribeConformance defines the Ginkgo specs of the plugin protocol. newConn
+// returns the connection to the plugin under test.
+func DescribeConformance(newConn func() grpc.ClientConnInterface) bool {
+	return Describe("Load balancer plugin conformance", func() {
+		var (
+			ctx    context.Context
+			conn   grpc.ClientConnInterface
+			client *plugin.Client
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			conn = newConn()
+			client = plugin.NewClient(conn)
+		})
+
+		It("implements EnsureLoadBalancer", func() {
+			for _, vmService := range vmServices() {
+				err := client.EnsureLoadBalancer(ctx, vmService)
+				Expect(status.Code(err)).ToNot(Equal(codes.Unimplemented), vmService.Name)
+				Expect(status.Code(err)).ToNot(Equal(codes.InvalidArgument), vmService.Name)
+			}
+		})
+
+		It("returns deterministic labels that are not both added and removed", func() {
+			for _, vmService := range vmServices() {
+				labels, err := client.GetServiceLabels(ctx, vmService)
+				Expect(err).ToNot(HaveOccurred(), vmService.Name)
+				removed, err := client.GetToBeRemovedServiceLabels(ctx, vmService)
+				Expect(err).ToNot(HaveOccurred(), vmService.Name)
+				for k := range labels {
+					Expect(removed).ToNot(HaveKey(k), vmService.Name)
+				}
+
+				again, err := client.GetServiceLabels(ctx, vmService)
+				Expect(err).ToNot(HaveOccurred(), vmService.Name)
+				Expect(again).To(Equal(labels), vmService.Name)
+			}
+		})
+
+		It("returns deterministic annotations that are not both added and removed", func() {
+			for _, vmService := range vmServices() {
+				annotations, err := client.GetServiceAnnotations(ctx, vmService)
+				Expect(err).ToNot(HaveOccurred(), vmService.Name)
+				removed, err := client.GetToBeRemovedServiceAnnotations(ctx, vmService)
+				Expect(err).ToNot(HaveOccurred(), vmService.Name)
+				for k := range annotations {
+					Expect(removed).ToNot(HaveKey(k), vmService.Name)
+				}
+
+				again, err := client.GetServiceAnnotations(ctx, vmService)
+				Expect(err).ToNot(HaveOccurred(), vmService.Name)
+				Expect(again).To(Equal(annotations), vmService.Name)
+			}
+		})
+
+		It("rejects a malformed VirtualMachineService with InvalidArgument", func() {
+			for _, method := range []string{
+				"EnsureLoadBalancer",
+				"GetServiceLabels",
+				"GetToBeRemovedServiceLabels",
+				"GetServiceAnnotations",
+				"GetToBeRemovedServiceAnnotations",
+			} {
+				in := &wrappers.BytesValue{Value: []byte("{")}
+				err := conn.Invoke(ctx, "/"+plugin.ServiceName+"/"+method, in, &structpb.Struct{})
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument), method)
+			}
+		})
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package conformance_test
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin"
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin/conformance"
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin/fake"
+)
+
+func TestConformance(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Load Balancer Plugin Conformance Suite")
+}
+
+var (
+	conn *grpc.ClientConn
+	stop func()
+)
+
+var _ = BeforeSuite(func() {
+	var err error
+	if endpoint := os.Getenv(conformance.EndpointEnv); endpoint != "" {
+		conn, err = plugin.DialConn(endpoint)
+		stop = func() { _ = conn.Close() }
+	} else {
+		conn, stop, err = fake.Serve(fake.NewFakeProvider())
+	}
+	Expect(err).ToNot(HaveOccurred())
+})
+
+var _ = AfterSuite(func() {
+	stop()
+})
+
+var _ = conformance.DescribeConformance(func() grpc.ClientConnInterface {
+	return conn
+})
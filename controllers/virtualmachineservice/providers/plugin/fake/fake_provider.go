@@ -0,0 +1,139 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package fake
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin"
+)
+
+type funcs struct {
+	EnsureLoadBalancerFn func(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error
+}
+
+// FakeProvider is an in-process load balancer plugin. It records the
+// VirtualMachineServices it is asked to load balance and returns the labels
+// and annotations it is configured with. The function variables override
+// these behaviors to simulate other scenarios.
+type FakeProvider struct {
+	sync.Mutex
+	funcs
+
+	// LoadBalancers are the keys of the VirtualMachineServices passed to EnsureLoadBalancer.
+	LoadBalancers map[string]*vmopv1alpha1.VirtualMachineService
+
+	ServiceLabels                 map[string]string
+	ToBeRemovedServiceLabels      map[string]string
+	ServiceAnnotations            map[string]string
+	ToBeRemovedServiceAnnotations map[string]string
+}
+
+var _ plugin.Provider = &FakeProvider{}
+
+func NewFakeProvider() *FakeProvider {
+	provider := &FakeProvider{}
+	provider.Reset()
+	return provider
+}
+
+func (p *FakeProvider) Reset() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.funcs = funcs{}
+	p.LoadBalancers = make(map[string]*vmopv1alpha1.VirtualMachineService)
+	p.ServiceLabels = nil
+	p.ToBeRemovedServiceLabels = nil
+	p.ServiceAnnotations = nil
+	p.ToBeRemovedServiceAnnotations = nil
+}
+
+func (p *FakeProvider) EnsureLoadBalancer(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error {
+	p.Lock()
+	fn := p.EnsureLoadBalancerFn
+	p.Unlock()
+
+	// The function is called without holding the lock so that it can call back into the provider.
+	if fn != nil {
+		return fn(ctx, vmService)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.LoadBalancers[vmService.NamespacedName()] = vmService.DeepCopy()
+	return nil
+}
+
+func (p *FakeProvider) GetServiceLabels(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	return p.get(&p.ServiceLabels), nil
+}
+
+func (p *FakeProvider) GetToBeRemovedServiceLabels(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	return p.get(&p.ToBeRemovedServiceLabels), nil
+}
+
+func (p *FakeProvider) GetServiceAnnotations(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	return p.get(&p.ServiceAnnotations), nil
+}
+
+func (p *FakeProvider) GetToBeRemovedServiceAnnotations(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	return p.get(&p.ToBeRemovedServiceAnnotations), nil
+}
+
+func (p *FakeProvider) SetEnsureLoadBalancerFn(fn func(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error) {
+	p.Lock()
+	defer p.Unlock()
+	p.EnsureLoadBalancerFn = fn
+}
+
+func (p *FakeProvider) get(m *map[string]string) map[string]string {
+	p.Lock()
+	defer p.Unlock()
+
+	if *m == nil {
+		return nil
+	}
+	res := make(map[string]string, len(*m))
+	for k, v := range *m {
+		res[k] = v
+	}
+	return res
+}
+
+const bufSize = 1024 * 1024
+
+// Serve serves the Provider over an in-memory gRPC connection and returns the
+// connection to it, and a function that closes the connection and stops the server.
+func Serve(provider plugin.Provider) (*grpc.ClientConn, func(), error) {
+	listener := bufconn.Listen(bufSize)
+	server := grpc.NewServer()
+	plugin.RegisterProviderServer(server, provider)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.Dial()
+		}))
+	if err != nil {
+		server.Stop()
+		return nil, nil, err
+	}
+
+	stop := func() {
+		_ = conn.Close()
+		server.Stop()
+	}
+	return conn, stop, nil
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package plugin implements the gRPC protocol of out-of-tree load balancer
+// providers that is described in loadbalancer_provider.proto.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// ProtocolVersion is the version of the plugin protocol. It is part of the
+	// gRPC service name, so a plugin that implements another version of the
+	// protocol fails every call with codes.Unimplemented.
+	ProtocolVersion = "v1alpha1"
+
+	// ServiceName is the fully qualified name of the gRPC service of the plugin.
+	ServiceName = "vmoperator.loadbalancer." + ProtocolVersion + ".LoadBalancerProvider"
+
+	unixScheme = "unix://"
+
+	// callTimeout bounds each call to the plugin so a hung plugin does not
+	// block the VirtualMachineService reconciler.
+	callTimeout = 30 * time.Second
+)
+
+// Provider is implemented by load balancer providers that are served over the
+// plugin protocol. It has the methods of providers.LoadbalancerProvider.
+type Provider interface {
+	EnsureLoadBalancer(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error
+	GetServiceLabels(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error)
+	GetToBeRemovedServiceLabels(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error)
+	GetServiceAnnotations(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error)
+	GetToBeRemovedServiceAnnotations(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error)
+}
+
+type mapMethod func(Provider, context.Context, *vmopv1alpha1.VirtualMachineService) (map[string]string, error)
+
+var mapMethods = map[string]mapMethod{
+	"GetServiceLabels":                 Provider.GetServiceLabels,
+	"GetToBeRemovedServiceLabels":      Provider.GetToBeRemovedServiceLabels,
+	"GetServiceAnnotations":            Provider.GetServiceAnnotations,
+	"GetToBeRemovedServiceAnnotations": Provider.GetToBeRemovedServiceAnnotations,
+}
+
+// RegisterProviderServer registers the Provider as the plugin service of the
+// gRPC server.
+func RegisterProviderServer(s *grpc.Server, provider Provider) {
+	desc := grpc.ServiceDesc{
+		ServiceName: ServiceName,
+		HandlerType: (*Provider)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "EnsureLoadBalancer",
+			Handler:    ensureLoadBalancerHandler,
+		}},
+		Metadata: "loadbalancer_provider.proto",
+	}
+	for name, method := range mapMethods {
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: name,
+			Handler:    mapMethodHandler(name, method),
+		})
+	}
+	s.RegisterService(&desc, provider)
+}
+
+func ensureLoadBalancerHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := &wrappers.BytesValue{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		vmService, err := decodeVMService(req.(*wrappers.BytesValue))
+		if err != nil {
+			return nil, err
+		}
+		if err := srv.(Provider).EnsureLoadBalancer(ctx, vmService); err != nil {
+			return nil, err
+		}
+		return &empty.Empty{}, nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod("EnsureLoadBalancer")}
+	return interceptor(ctx, in, info, handler)
+}
+
+func mapMethodHandler(name string, method mapMethod) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := &wrappers.BytesValue{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			vmService, err := decodeVMService(req.(*wrappers.BytesValue))
+			if err != nil {
+				return nil, err
+			}
+			m, err := method(srv.(Provider), ctx, vmService)
+			if err != nil {
+				return nil, err
+			}
+			return mapToStruct(m), nil
+		}
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod(name)}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+// Client is a Provider that calls a plugin over gRPC.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+var _ Provider = &Client{}
+
+// NewClient returns a Client that calls the plugin over the connection.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+// Dial returns a Client of the plugin at the endpoint.
+func Dial(endpoint string) (*Client, error) {
+	conn, err := DialConn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// DialConn returns a connection to the plugin at the endpoint, which is either
+// a "unix://" socket path or a host:port. The connection is not encrypted, so
+// the plugin is expected to run next to VM Operator.
+func DialConn(endpoint string) (*grpc.ClientConn, error) {
+	if endpoint == "" {
+		return nil, errors.New("load balancer plugin endpoint is not set")
+	}
+
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if strings.HasPrefix(endpoint, unixScheme) {
+		path := strings.TrimPrefix(endpoint, unixScheme)
+		opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		}))
+	}
+
+	conn, err := grpc.Dial(endpoint, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial load balancer plugin %s", endpoint)
+	}
+	return conn, nil
+}
+
+func (c *Client) EnsureLoadBalancer(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error {
+	return c.invoke(ctx, "EnsureLoadBalancer", vmService, &empty.Empty{})
+}
+
+func (c *Client) GetServiceLabels(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	return c.invokeMapMethod(ctx, "GetServiceLabels", vmService)
+}
+
+func (c *Client) GetToBeRemovedServiceLabels(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	return c.invokeMapMethod(ctx, "GetToBeRemovedServiceLabels", vmService)
+}
+
+func (c *Client) GetServiceAnnotations(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	return c.invokeMapMethod(ctx, "GetServiceAnnotations", vmService)
+}
+
+func (c *Client) GetToBeRemovedServiceAnnotations(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	return c.invokeMapMethod(ctx, "GetToBeRemovedServiceAnnotations", vmService)
+}
+
+func (c *Client) invokeMapMethod(ctx context.Context, method string, vmService *vmopv1alpha1.VirtualMachineService) (map[string]string, error) {
+	out := &structpb.Struct{}
+	if err := c.invoke(ctx, method, vmService, out); err != nil {
+		return nil, err
+	}
+	return structToMap(out)
+}
+
+func (c *Client) invoke(ctx context.Context, method string, vmService *vmopv1alpha1.VirtualMachineService, out interface{}) error {
+	in, err := encodeVMService(vmService)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	return c.conn.Invoke(ctx, fullMethod(method), in, out)
+}
+
+func fullMethod(method string) string {
+	return fmt.Sprintf("/%s/%s", ServiceName, method)
+}
+
+func encodeVMService(vmService *vmopv1alpha1.VirtualMachineService) (*wrappers.BytesValue, error) {
+	if vmService == nil {
+		return nil, errors.New("VirtualMachineService is required")
+	}
+	data, err := json.Marshal(vmService)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappers.BytesValue{Value: data}, nil
+}
+
+func decodeVMService(in *wrappers.BytesValue) (*vmopv1alpha1.VirtualMachineService, error) {
+	vmService := &vmopv1alpha1.VirtualMachineService{}
+	if err := json.Unmarshal(in.GetValue(), vmService); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid VirtualMachineService: %v", err)
+	}
+	return vmService, nil
+}
+
+func mapToStruct(m map[string]string) *structpb.Struct {
+	s := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(m))}
+	for k, v := range m {
+		s.Fields[k] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: v}}
+	}
+	return s
+}
+
+// structToMap returns nil for an empty Struct, like the in-tree providers
+// that have nothing to add or remove.
+func structToMap(s *structpb.Struct) (map[string]string, error) {
+	if len(s.GetFields()) == 0 {
+		return nil, nil
+	}
+
+	m := make(map[string]string, len(s.Fields))
+	for k, v := range s.Fields {
+		sv, ok := v.GetKind().(*structpb.Value_StringValue)
+		if !ok {
+			return nil, errors.Errorf("load balancer plugin returned a non-string value for %q", k)
+		}
+		m[k] = sv.StringValue
+	}
+	return m, nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package plugin_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/ptypes/empty"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin"
+	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers/plugin/fake"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		ctx       context.Context
+		provider  *fake.FakeProvider
+		conn      *grpc.ClientConn
+		client    *plugin.Client
+		stop      func()
+		vmService *vmopv1alpha1.VirtualMachineService
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		provider = fake.NewFakeProvider()
+		var err error
+		conn, stop, err = fake.Serve(provider)
+		Expect(err).ToNot(HaveOccurred())
+		client = plugin.NewClient(conn)
+
+		vmService = &vmopv1alpha1.VirtualMachineService{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "test-ns",
+				Name:        "test-svc",
+				Annotations: map[string]string{"foo": "bar"},
+			},
+			Spec: vmopv1alpha1.VirtualMachineServiceSpec{
+				Type:           vmopv1alpha1.VirtualMachineServiceTypeLoadBalancer,
+				LoadBalancerIP: "10.20.30.40",
+				Ports: []vmopv1alpha1.VirtualMachineServicePort{{
+					Name:       "apiserver",
+					Protocol:   "TCP",
+					Port:       6443,
+					TargetPort: 6443,
+				}},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		stop()
+	})
+
+	Context("EnsureLoadBalancer", func() {
+		It("passes the VirtualMachineService to the plugin", func() {
+			Expect(client.EnsureLoadBalancer(ctx, vmService)).To(Succeed())
+			Expect(provider.LoadBalancers).To(HaveKey(vmService.NamespacedName()))
+			Expect(provider.LoadBalancers[vmService.NamespacedName()]).To(Equal(vmService))
+		})
+
+		It("returns the error of the plugin", func() {
+			provider.SetEnsureLoadBalancerFn(func(context.Context, *vmopv1alpha1.VirtualMachineService) error {
+				return errors.New("appliance is not ready")
+			})
+
+			err := client.EnsureLoadBalancer(ctx, vmService)
+			Expect(err).To(HaveOccurred())
+			Expect(status.Convert(err).Message()).To(Equal("appliance is not ready"))
+		})
+
+		It("requires a VirtualMachineService", func() {
+			Expect(client.EnsureLoadBalancer(ctx, nil)).ToNot(Succeed())
+		})
+	})
+
+	Context("labels and annotations", func() {
+		It("returns the maps of the plugin", func() {
+			provider.ServiceLabels = map[string]string{"label": "value"}
+			provider.ToBeRemovedServiceLabels = map[string]string{"old-label": ""}
+			provider.ServiceAnnotations = map[string]string{"annotation": "value"}
+			provider.ToBeRemovedServiceAnnotations = map[string]string{"old-annotation": ""}
+
+			Expect(client.GetServiceLabels(ctx, vmService)).To(Equal(provider.ServiceLabels))
+			Expect(client.GetToBeRemovedServiceLabels(ctx, vmService)).To(Equal(provider.ToBeRemovedServiceLabels))
+			Expect(client.GetServiceAnnotations(ctx, vmService)).To(Equal(provider.ServiceAnnotations))
+			Expect(client.GetToBeRemovedServiceAnnotations(ctx, vmService)).To(Equal(provider.ToBeRemovedServiceAnnotations))
+		})
+
+		It("returns nil when the plugin has nothing to add", func() {
+			labels, err := client.GetServiceLabels(ctx, vmService)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(labels).To(BeNil())
+		})
+	})
+
+	Context("another protocol version", func() {
+		It("fails with Unimplemented", func() {
+			err := conn.Invoke(ctx, "/vmoperator.loadbalancer.v0.LoadBalancerProvider/EnsureLoadBalancer", &empty.Empty{}, &empty.Empty{})
+			Expect(status.Code(err)).To(Equal(codes.Unimplemented))
+		})
+	})
+})
+
+var _ = Describe("Dial", func() {
+	It("requires an endpoint", func() {
+		_, err := plugin.Dial("")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("connects to a plugin on a unix socket", func() {
+		dir, err := ioutil.TempDir("", "lb-plugin")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		socket := filepath.Join(dir, "plugin.sock")
+		listener, err := net.Listen("unix", socket)
+		Expect(err).ToNot(HaveOccurred())
+		server := grpc.NewServer()
+		provider := fake.NewFakeProvider()
+		plugin.RegisterProviderServer(server, provider)
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		defer server.Stop()
+
+		client, err := plugin.Dial("unix://" + socket)
+		Expect(err).ToNot(HaveOccurred())
+
+		vmService := &vmopv1alpha1.VirtualMachineService{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "test-ns", Name: "test-svc"},
+		}
+		Expect(client.EnsureLoadBalancer(context.Background(), vmService)).To(Succeed())
+		Expect(provider.LoadBalancers).To(HaveLen(1))
+	})
+})
@@ -1,63 +1,102 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package simplelb
 
 import (
 	"encoding/base64"
+	"fmt"
+	"hash/fnv"
 	"strings"
 	"text/template"
+	"time"
 
 	"sigs.k8s.io/yaml"
-
-	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 )
 
 const XdsNodePort = 31799
 
+const (
+	// envoyAdminPort is the port of the Envoy admin endpoint of envoyBootstrapConfig.
+	envoyAdminPort = 9901
+	// envoyReadyTimeout is how long to wait for the Envoy admin endpoint of an LB VM to respond.
+	envoyReadyTimeout = 2 * time.Second
+)
+
 var envoyBootstrapConfigTemplate, _ = template.New("envoyBootstrapConfig").Parse(envoyBootstrapConfig)
 
+var keepalivedConfigTemplate, _ = template.New("keepalivedConfig").Parse(keepalivedConfig)
+
+const (
+	envoyConfigPath      = "/etc/envoy/envoy.yaml"
+	keepalivedConfigPath = "/etc/keepalived/keepalived.conf"
+	xdsCACertPath        = "/etc/envoy/tls/ca.crt"
+	xdsClientCertPath    = "/etc/envoy/tls/client.crt"
+	xdsClientKeyPath     = "/etc/envoy/tls/client.key"
+	privateFilePerms     = "0600"
+	xdsTLSTransportName  = "envoy.transport_sockets.tls"
+)
+
 type lbConfigParams struct {
 	NodeID      string
-	Ports       []vmopv1alpha1.VirtualMachineServicePort
 	CPNodes     []string
 	XdsNodePort int
+
+	// CACert, ClientCert and ClientKey are the PEM encoded credentials the LB VM uses to
+	// establish the mutual TLS connection to the xDS server.
+	CACert     string
+	ClientCert string
+	ClientKey  string
+
+	// Replica is the index of the LB VM among the Replicas LB VMs of the VirtualMachineService.
+	// When there is more than one replica, keepalived moves the VIP between the LB VMs.
+	Replica  int
+	Replicas int
+	VIP      string
 }
 
+// keepalivedTemplateParams are the values of the keepalived VRRP instance of an LB VM replica.
+type keepalivedTemplateParams struct {
+	VIP             string
+	State           string
+	Priority        int
+	VirtualRouterID uint32
+	Interface       string
+}
+
+// envoyBootstrapTemplateParams adds the xDS TLS settings to the lbConfigParams. The settings are
+// constants, but are passed to the template so the paths are only defined once.
+type envoyBootstrapTemplateParams struct {
+	lbConfigParams
+	TransportSocketName string
+	ServerName          string
+	CACertPath          string
+	ClientCertPath      string
+	ClientKeyPath       string
+}
+
+// envoyBootstrapConfig only tells Envoy how to reach the xDS server: the listeners, clusters
+// and endpoints are all served dynamically over ADS so they can change without re-rendering
+// the LB VM cloud-config.
 const envoyBootstrapConfig = `node:
   id: {{.NodeID}}
   cluster: vmop-simple-lb
-static_resources:
-  listeners:
-  # {{- range .Ports}}
-  - name: {{.Name}}
-    address:
-      socket_address:
-        address: 0.0.0.0
-        port_value: {{.Port}}
-    filter_chains:
-    - filters:
-      - name: envoy.tcp_proxy
-        config:
-          stat_prefix: ingress_tcp
-          cluster: {{.Name}}
-  # {{- end}}
+dynamic_resources:
+  ads_config:
+    api_type: GRPC
+    transport_api_version: V3
+    grpc_services:
+    - envoy_grpc:
+        cluster_name: xds_cluster
+  lds_config:
+    resource_api_version: V3
+    ads: {}
+  cds_config:
+    resource_api_version: V3
+    ads: {}
 
+static_resources:
   clusters:
-  # {{- range .Ports}}
-  - name: {{.Name}}
-    connect_timeout: 0.25s
-    type: EDS
-    lb_policy: ROUND_ROBIN
-    eds_cluster_config:
-      eds_config:
-        api_config_source:
-          api_type: GRPC
-          grpc_services:
-            envoy_grpc:
-              cluster_name: xds_cluster
-  # {{- end}}
-
   - name: xds_cluster
     connect_timeout: 0.25s
     type: STATIC
@@ -65,6 +104,22 @@ static_resources:
     http2_protocol_options: {}
     upstream_connection_options:
       tcp_keepalive: {}
+    transport_socket:
+      name: {{.TransportSocketName}}
+      typed_config:
+        "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+        sni: {{.ServerName}}
+        common_tls_context:
+          tls_certificates:
+          - certificate_chain:
+              filename: {{.ClientCertPath}}
+            private_key:
+              filename: {{.ClientKeyPath}}
+          validation_context:
+            trusted_ca:
+              filename: {{.CACertPath}}
+            match_subject_alt_names:
+            - exact: {{.ServerName}}
     load_assignment:
       cluster_name: xds_cluster
       endpoints:
@@ -86,27 +141,139 @@ admin:
       port_value: 9901
 `
 
+// keepalivedConfig assigns the VIP to the first replica whose Envoy reports ready. The replica with
+// the lowest index has the highest priority. The LB VM image must have keepalived installed: the
+// cloud-config only writes its config and then enables and restarts it with keepalivedRunCmd.
+const keepalivedConfig = `vrrp_script chk_envoy {
+    script "/usr/bin/curl -sf http://127.0.0.1:9901/ready"
+    interval 2
+    fall 2
+    rise 2
+}
+
+vrrp_instance simple_lb {
+    state {{.State}}
+    interface {{.Interface}}
+    virtual_router_id {{.VirtualRouterID}}
+    priority {{.Priority}}
+    advert_int 1
+    virtual_ipaddress {
+        {{.VIP}}
+    }
+    track_script {
+        chk_envoy
+    }
+}
+`
+
+const (
+	keepalivedInterface   = "eth0"
+	keepalivedMaxPriority = 200
+)
+
+// keepalivedRunCmd enables keepalived, so it also runs after a reboot, and restarts it so it picks up
+// the config written by the cloud-config. cloud-init fails, and the LB VM never holds the VIP, when
+// the image has no keepalived.
+var keepalivedRunCmd = [][]string{
+	{"systemctl", "enable", "keepalived"},
+	{"systemctl", "restart", "keepalived"},
+}
+
+func newKeepalivedTemplateParams(params lbConfigParams) keepalivedTemplateParams {
+	state := "BACKUP"
+	if params.Replica == 0 {
+		state = "MASTER"
+	}
+
+	return keepalivedTemplateParams{
+		VIP:             params.VIP,
+		State:           state,
+		Priority:        keepalivedMaxPriority - params.Replica,
+		VirtualRouterID: virtualRouterID(params.NodeID),
+		Interface:       keepalivedInterface,
+	}
+}
+
+// virtualRouterID derives the VRRP virtual router ID, which must be in [1, 255], from the node ID
+// so that LB VMs of different VirtualMachineServices on the same network use different IDs.
+func virtualRouterID(nodeID string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(nodeID))
+	return h.Sum32()%255 + 1
+}
+
 const cloudConfigPrefix = `#cloud-config
 `
 
 type cloudConfig struct {
 	WriteFiles []writeFile `json:"write_files,omitempty"`
+	RunCmd     [][]string  `json:"runcmd,omitempty"`
 }
 
 type writeFile struct {
-	Path    string `json:"path"`
-	Content string `json:"content"`
+	Path        string `json:"path"`
+	Content     string `json:"content"`
+	Permissions string `json:"permissions,omitempty"`
+}
+
+func newEnvoyBootstrapTemplateParams(params lbConfigParams) envoyBootstrapTemplateParams {
+	return envoyBootstrapTemplateParams{
+		lbConfigParams:      params,
+		TransportSocketName: xdsTLSTransportName,
+		ServerName:          xdsServerName,
+		CACertPath:          xdsCACertPath,
+		ClientCertPath:      xdsClientCertPath,
+		ClientKeyPath:       xdsClientKeyPath,
+	}
+}
+
+// bootstrapHash returns the hash of the cloud-config rendered for the params without their
+// credentials, which are issued again whenever the cloud-config is rendered. The hash changes when
+// the params or the templates change.
+func bootstrapHash(params lbConfigParams) string {
+	params.CACert = ""
+	params.ClientCert = ""
+	params.ClientKey = ""
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(renderAndBase64EncodeLBCloudConfig(params)))
+	return fmt.Sprintf("%016x", h.Sum64())
 }
 
 func renderAndBase64EncodeLBCloudConfig(params lbConfigParams) string {
 	envoyConfigStringBuilder := &strings.Builder{}
-	_ = envoyBootstrapConfigTemplate.Execute(envoyConfigStringBuilder, params)
+	_ = envoyBootstrapConfigTemplate.Execute(envoyConfigStringBuilder, newEnvoyBootstrapTemplateParams(params))
 
 	cc := &cloudConfig{
-		WriteFiles: []writeFile{{
-			Path:    "/etc/envoy/envoy.yaml",
-			Content: envoyConfigStringBuilder.String(),
-		}},
+		WriteFiles: []writeFile{
+			{
+				Path:    envoyConfigPath,
+				Content: envoyConfigStringBuilder.String(),
+			},
+			{
+				Path:    xdsCACertPath,
+				Content: params.CACert,
+			},
+			{
+				Path:    xdsClientCertPath,
+				Content: params.ClientCert,
+			},
+			{
+				Path:        xdsClientKeyPath,
+				Content:     params.ClientKey,
+				Permissions: privateFilePerms,
+			},
+		},
+	}
+
+	if params.Replicas > 1 {
+		keepalivedConfigStringBuilder := &strings.Builder{}
+		_ = keepalivedConfigTemplate.Execute(keepalivedConfigStringBuilder, newKeepalivedTemplateParams(params))
+		cc.WriteFiles = append(cc.WriteFiles, writeFile{
+			Path:    keepalivedConfigPath,
+			Content: keepalivedConfigStringBuilder.String(),
+		})
+		cc.RunCmd = keepalivedRunCmd
 	}
 	ccYamlBytes, _ := yaml.Marshal(cc)
 
@@ -1,4 +1,4 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package simplelb
@@ -38,13 +38,15 @@ var _ = Describe("lbCloudConfig", func() {
 			}
 
 			params := lbConfigParams{
-				NodeID:      vmService.NamespacedName(),
-				Ports:       vmService.Spec.Ports,
+				NodeID:      nodeID(vmService),
 				CPNodes:     []string{"10.10.00.3"},
 				XdsNodePort: XdsNodePort,
+				CACert:      "ca-cert",
+				ClientCert:  "client-cert",
+				ClientKey:   "client-key",
 			}
 			sb := &strings.Builder{}
-			err := envoyBootstrapConfigTemplate.Execute(sb, params)
+			err := envoyBootstrapConfigTemplate.Execute(sb, newEnvoyBootstrapTemplateParams(params))
 			s := sb.String()
 
 			It("should render without an error", func() {
@@ -53,6 +55,20 @@ var _ = Describe("lbCloudConfig", func() {
 				Expect(s).ToNot(ContainSubstring("\t"))
 			})
 
+			It("should not contain static listeners or service clusters", func() {
+				Expect(s).To(ContainSubstring("ads_config"))
+				Expect(s).ToNot(ContainSubstring("listeners"))
+				Expect(s).ToNot(ContainSubstring("apiserver"))
+			})
+
+			It("should connect to the xDS server with mutual TLS", func() {
+				Expect(s).To(ContainSubstring(xdsTLSTransportName))
+				Expect(s).To(ContainSubstring("exact: " + xdsServerName))
+				Expect(s).To(ContainSubstring(xdsCACertPath))
+				Expect(s).To(ContainSubstring(xdsClientCertPath))
+				Expect(s).To(ContainSubstring(xdsClientKeyPath))
+			})
+
 			Context("renderAndBase64EncodeLBCloudConfig()", func() {
 				It("should encode into valid base64 cloud-config", func() {
 					b64s := renderAndBase64EncodeLBCloudConfig(params)
@@ -65,11 +81,63 @@ var _ = Describe("lbCloudConfig", func() {
 					cc := cloudConfig{}
 					err = yaml.Unmarshal(ccBytes, &cc)
 					Expect(err).NotTo(HaveOccurred())
-					Expect(cc.WriteFiles).To(HaveLen(1))
-					Expect(cc.WriteFiles[0].Path).To(Equal("/etc/envoy/envoy.yaml"))
+					Expect(cc.WriteFiles).To(HaveLen(4))
+					Expect(cc.WriteFiles[0].Path).To(Equal(envoyConfigPath))
 					Expect(cc.WriteFiles[0].Content).To(Equal(s))
+					Expect(cc.WriteFiles[1].Path).To(Equal(xdsCACertPath))
+					Expect(cc.WriteFiles[1].Content).To(Equal(params.CACert))
+					Expect(cc.WriteFiles[2].Path).To(Equal(xdsClientCertPath))
+					Expect(cc.WriteFiles[2].Content).To(Equal(params.ClientCert))
+					Expect(cc.WriteFiles[3].Path).To(Equal(xdsClientKeyPath))
+					Expect(cc.WriteFiles[3].Content).To(Equal(params.ClientKey))
+					Expect(cc.WriteFiles[3].Permissions).To(Equal(privateFilePerms))
+					Expect(cc.RunCmd).To(BeEmpty())
+				})
+
+				It("should configure keepalived when there are multiple replicas", func() {
+					haParams := params
+					haParams.Replica = 1
+					haParams.Replicas = 3
+					haParams.VIP = "10.20.30.40"
+
+					ccBytes, err := base64.StdEncoding.DecodeString(renderAndBase64EncodeLBCloudConfig(haParams))
+					Expect(err).NotTo(HaveOccurred())
+					cc := cloudConfig{}
+					Expect(yaml.Unmarshal(ccBytes, &cc)).To(Succeed())
+					Expect(cc.WriteFiles).To(HaveLen(5))
+					Expect(cc.WriteFiles[4].Path).To(Equal(keepalivedConfigPath))
+
+					keepalived := cc.WriteFiles[4].Content
+					Expect(keepalived).To(ContainSubstring("state BACKUP"))
+					Expect(keepalived).To(ContainSubstring("priority 199"))
+					Expect(keepalived).To(ContainSubstring(haParams.VIP))
+
+					Expect(cc.RunCmd).To(Equal([][]string{
+						{"systemctl", "enable", "keepalived"},
+						{"systemctl", "restart", "keepalived"},
+					}))
 				})
 			})
 		})
 	})
+
+	Context("keepalivedConfigTemplate", func() {
+		It("should make the first replica the MASTER", func() {
+			p := newKeepalivedTemplateParams(lbConfigParams{NodeID: "ns/svc", Replicas: 2, VIP: "10.20.30.40"})
+			Expect(p.State).To(Equal("MASTER"))
+			Expect(p.Priority).To(Equal(keepalivedMaxPriority))
+
+			sb := &strings.Builder{}
+			Expect(keepalivedConfigTemplate.Execute(sb, p)).To(Succeed())
+			Expect(sb.String()).To(ContainSubstring("state MASTER"))
+		})
+
+		It("should derive a valid virtual router ID", func() {
+			for _, id := range []string{"", "ns/svc", "other-ns/other-svc"} {
+				Expect(virtualRouterID(id)).To(BeNumerically(">=", 1))
+				Expect(virtualRouterID(id)).To(BeNumerically("<=", 255))
+			}
+			Expect(virtualRouterID("ns/svc")).To(Equal(virtualRouterID("ns/svc")))
+		})
+	})
 })
@@ -0,0 +1,238 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package simplelb
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// XdsCASecretName is the name of the Secret, in the VM Operator namespace, that holds the CA
+	// used to secure the connection between the xDS server and the LB VMs.
+	XdsCASecretName = "vmware-system-vmop-simple-lb-xds-ca"
+
+	// xdsServerName is the subject alternative name of the xDS server certificate that the LB VMs
+	// verify when connecting to the xDS server.
+	xdsServerName = "vmop-simple-lb-xds-server"
+
+	// caValidity is the lifetime of the CA, whose certificate the LB VM only reads on first boot.
+	caValidity = 10 * 365 * 24 * time.Hour
+
+	// certValidity is the lifetime of the xDS server certificate, which is renewed certRenewBefore
+	// its expiry and picked up on the next TLS handshake. An LB VM only reads its client certificate
+	// on first boot, so client certificates are valid as long as the CA instead of being renewed.
+	certValidity    = 90 * 24 * time.Hour
+	certRenewBefore = 30 * 24 * time.Hour
+)
+
+// certificateAuthority issues the xDS server and LB VM client certificates.
+type certificateAuthority struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+func newCertificateAuthority() (*certificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: "vmop-simple-lb-xds-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificateAuthority{
+		cert:    cert,
+		key:     key,
+		certPEM: encodePEM("CERTIFICATE", der),
+	}, nil
+}
+
+func certificateAuthorityFromSecret(secret *corev1.Secret) (*certificateAuthority, error) {
+	certBlock, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if certBlock == nil {
+		return nil, errors.Errorf("secret %s/%s has no CA certificate", secret.Namespace, secret.Name)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse CA certificate from secret %s/%s", secret.Namespace, secret.Name)
+	}
+
+	keyBlock, _ := pem.Decode(secret.Data[corev1.TLSPrivateKeyKey])
+	if keyBlock == nil {
+		return nil, errors.Errorf("secret %s/%s has no CA private key", secret.Namespace, secret.Name)
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse CA private key from secret %s/%s", secret.Namespace, secret.Name)
+	}
+
+	return &certificateAuthority{
+		cert:    cert,
+		key:     key,
+		certPEM: secret.Data[corev1.TLSCertKey],
+	}, nil
+}
+
+func (ca *certificateAuthority) secret(namespace string) (*corev1.Secret, error) {
+	keyDER, err := x509.MarshalECPrivateKey(ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      XdsCASecretName,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       ca.certPEM,
+			corev1.TLSPrivateKeyKey: encodePEM("EC PRIVATE KEY", keyDER),
+		},
+	}, nil
+}
+
+// issue returns the PEM encoded certificate and private key signed by the CA for the given
+// identity. Server certificates carry the identity as a DNS SAN and are valid for certValidity,
+// client certificates carry it as the common name, which the xDS server matches against the
+// requested node ID, and are valid until the CA expires.
+func (ca *certificateAuthority) issue(identity string, usage x509.ExtKeyUsage) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(certValidity)
+	if usage == x509.ExtKeyUsageClientAuth || notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: identity},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if usage == x509.ExtKeyUsageServerAuth {
+		template.DNSNames = []string{identity}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodePEM("CERTIFICATE", der), encodePEM("EC PRIVATE KEY", keyDER), nil
+}
+
+// needsRenewal returns true when a certificate expiring at notAfter is due for renewal. A
+// certificate that already expires with the CA is not renewed since the CA cannot issue one
+// that lasts longer.
+func (ca *certificateAuthority) needsRenewal(notAfter time.Time) bool {
+	return time.Until(notAfter) < certRenewBefore && notAfter.Before(ca.cert.NotAfter)
+}
+
+// certificateNotAfter returns the expiry of the PEM encoded certificate.
+func certificateNotAfter(certPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return time.Time{}, errors.New("no PEM encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// ensureCertificateAuthority returns the CA stored in the xDS CA Secret, creating the CA and
+// the Secret if it does not exist yet.
+func ensureCertificateAuthority(ctx context.Context, c client.Client, namespace string) (*certificateAuthority, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: namespace, Name: XdsCASecretName}
+
+	err := c.Get(ctx, key, secret)
+	if err == nil {
+		return certificateAuthorityFromSecret(secret)
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	ca, err := newCertificateAuthority()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create xDS CA")
+	}
+	secret, err = ca.secret(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Create(ctx, secret); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, errors.Wrap(err, "failed to create xDS CA Secret")
+		}
+		// Lost the race with another creator so use the CA that it stored.
+		if err := c.Get(ctx, key, secret); err != nil {
+			return nil, err
+		}
+		return certificateAuthorityFromSecret(secret)
+	}
+
+	return ca, nil
+}
+
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+func encodePEM(blockType string, der []byte) []byte {
+	buf := &bytes.Buffer{}
+	_ = pem.Encode(buf, &pem.Block{Type: blockType, Bytes: der})
+	return buf.Bytes()
+}
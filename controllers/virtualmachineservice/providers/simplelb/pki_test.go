@@ -0,0 +1,156 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package simplelb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/vmware-tanzu/vm-operator/test/builder"
+)
+
+var _ = Describe("certificateAuthority", func() {
+	const vmopNs = "vmop-ns"
+
+	parseCert := func(certPEM []byte) *x509.Certificate {
+		block, _ := pem.Decode(certPEM)
+		Expect(block).ToNot(BeNil())
+		cert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).ToNot(HaveOccurred())
+		return cert
+	}
+
+	Context("issue()", func() {
+		var ca *certificateAuthority
+
+		BeforeEach(func() {
+			var err error
+			ca, err = newCertificateAuthority()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("issues client certificates identified by their common name", func() {
+			certPEM, keyPEM, err := ca.issue("test-ns/test-svc", x509.ExtKeyUsageClientAuth)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tls.X509KeyPair(certPEM, keyPEM)
+			Expect(err).ToNot(HaveOccurred())
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			cert := parseCert(certPEM)
+			Expect(cert.Subject.CommonName).To(Equal("test-ns/test-svc"))
+			_, err = cert.Verify(x509.VerifyOptions{
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("issues server certificates for the xDS server name", func() {
+			certPEM, _, err := ca.issue(xdsServerName, x509.ExtKeyUsageServerAuth)
+			Expect(err).ToNot(HaveOccurred())
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			_, err = parseCert(certPEM).Verify(x509.VerifyOptions{
+				Roots:   roots,
+				DNSName: xdsServerName,
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("does not issue certificates trusted by another CA", func() {
+			otherCA, err := newCertificateAuthority()
+			Expect(err).ToNot(HaveOccurred())
+			certPEM, _, err := otherCA.issue("test-ns/test-svc", x509.ExtKeyUsageClientAuth)
+			Expect(err).ToNot(HaveOccurred())
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			_, err = parseCert(certPEM).Verify(x509.VerifyOptions{
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("issues short-lived server certificates", func() {
+			certPEM, _, err := ca.issue(xdsServerName, x509.ExtKeyUsageServerAuth)
+			Expect(err).ToNot(HaveOccurred())
+
+			notAfter, err := certificateNotAfter(certPEM)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(notAfter).To(Equal(parseCert(certPEM).NotAfter))
+			Expect(notAfter).To(BeTemporally("~", time.Now().Add(certValidity), time.Minute))
+			Expect(ca.needsRenewal(notAfter)).To(BeFalse())
+		})
+
+		It("issues client certificates that expire with the CA", func() {
+			certPEM, _, err := ca.issue("test-ns/test-svc", x509.ExtKeyUsageClientAuth)
+			Expect(err).ToNot(HaveOccurred())
+
+			notAfter, err := certificateNotAfter(certPEM)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(notAfter).To(BeTemporally("==", ca.cert.NotAfter))
+			Expect(ca.needsRenewal(notAfter)).To(BeFalse())
+		})
+	})
+
+	Context("needsRenewal()", func() {
+		var ca *certificateAuthority
+
+		BeforeEach(func() {
+			var err error
+			ca, err = newCertificateAuthority()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("renews certificates about to expire", func() {
+			Expect(ca.needsRenewal(time.Now().Add(certRenewBefore - time.Hour))).To(BeTrue())
+			Expect(ca.needsRenewal(time.Now().Add(-time.Hour))).To(BeTrue())
+		})
+
+		It("does not renew certificates that expire with the CA", func() {
+			Expect(ca.needsRenewal(ca.cert.NotAfter)).To(BeFalse())
+		})
+	})
+
+	Context("ensureCertificateAuthority()", func() {
+		It("creates the CA Secret once and then reuses it", func() {
+			client, _ := builder.NewFakeClient()
+
+			ca, err := ensureCertificateAuthority(context.TODO(), client, vmopNs)
+			Expect(err).ToNot(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			err = client.Get(context.TODO(), types.NamespacedName{Namespace: vmopNs, Name: XdsCASecretName}, secret)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+			Expect(secret.Data[corev1.TLSCertKey]).To(Equal(ca.certPEM))
+
+			ca2, err := ensureCertificateAuthority(context.TODO(), client, vmopNs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ca2.cert.Equal(ca.cert)).To(BeTrue())
+			Expect(ca2.key.Equal(ca.key)).To(BeTrue())
+		})
+
+		It("returns an error when the CA Secret is invalid", func() {
+			secret := &corev1.Secret{}
+			secret.Namespace = vmopNs
+			secret.Name = XdsCASecretName
+			client, _ := builder.NewFakeClient(secret)
+
+			_, err := ensureCertificateAuthority(context.TODO(), client, vmopNs)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -1,15 +1,21 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package simplelb
 
 import (
 	"context"
-	"errors"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -20,44 +26,140 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg"
+	"github.com/vmware-tanzu/vm-operator/pkg/lib"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere"
+)
+
+const (
+	// ReplicasAnnotationKey is the VirtualMachineService annotation with the number of LB VMs to
+	// create. More than one replica requires a LoadBalancerIP for their VIP, which keepalived moves
+	// between them, so the LB VM image must have keepalived installed. Changing the number of
+	// replicas changes the bootstrap config of the existing LB VMs, which are then replaced one at a
+	// time so that they are all part of the anti-affinity cluster module of the replicas.
+	ReplicasAnnotationKey = "simplelb.vmoperator.vmware.com/replicas"
+
+	// ReplicaStatusAnnotationKey is the VirtualMachineService annotation that reports the health of
+	// each LB VM replica.
+	ReplicaStatusAnnotationKey = "simplelb.vmoperator.vmware.com/replica-status"
+
+	// ServiceLabelKey and ReplicaLabelKey are the labels identifying the VirtualMachineService and
+	// the replica index of an LB VM.
+	ServiceLabelKey = "simplelb.vmoperator.vmware.com/service"
+	ReplicaLabelKey = "simplelb.vmoperator.vmware.com/replica"
+
+	// BootstrapHashAnnotationKey is the annotation of the LB VM, and of its metadata Secret, with
+	// the hash of the bootstrap config it was created with. Cloud-init only applies the bootstrap
+	// on the first boot of the LB VM, so an LB VM whose hash differs from the current one is
+	// replaced.
+	BootstrapHashAnnotationKey = "simplelb.vmoperator.vmware.com/bootstrap-hash"
+
+	// CertificateNotAfterAnnotationKey is the annotation of the LB VM metadata Secret with the
+	// expiry, in RFC 3339 format, of the xDS client certificate in its bootstrap config.
+	CertificateNotAfterAnnotationKey = "simplelb.vmoperator.vmware.com/certificate-not-after"
 )
 
 type simpleLoadBalancerProvider struct {
 	client       client.Client
 	controlPlane loadbalancerControlPlane
-	log          logr.Logger
+	// namespace is the VM Operator namespace where the xDS CA Secret is kept.
+	namespace string
+	// envoyReady returns true when the Envoy of the LB VM with the given IP is ready.
+	envoyReady func(ctx context.Context, ip string) bool
+	log        logr.Logger
 }
 
 type loadbalancerControlPlane interface {
-	UpdateEndpoints(*corev1.Service, *corev1.Endpoints) error
+	UpdateConfig(*vmopv1alpha1.VirtualMachineService, *corev1.Endpoints) error
 }
 
-func New(mgr manager.Manager) *simpleLoadBalancerProvider {
+func New(mgr manager.Manager) (*simpleLoadBalancerProvider, error) {
+	namespace, err := lib.GetVmOpNamespaceFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	log := ctrl.Log.WithName("controllers").WithName("simple-lb")
 	return &simpleLoadBalancerProvider{
 		client:       mgr.GetClient(),
-		controlPlane: NewXdsServer(mgr, log),
+		controlPlane: NewXdsServer(mgr, namespace, log),
+		namespace:    namespace,
+		envoyReady:   envoyReady,
 		log:          log,
-	}
+	}, nil
 }
 
 func (s *simpleLoadBalancerProvider) EnsureLoadBalancer(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error {
 	s.log.Info("ensure load balancer", "VMService", vmService.Name)
-	xdsNodes, err := s.getXDSNodes(ctx)
+	replicas, err := s.lbReplicas(vmService)
 	if err != nil {
 		return err
 	}
-	lbParams := getLBConfigParams(vmService, xdsNodes)
-	vm := loadbalancerVM(vmService)
-	cm := loadbalancerCM(vmService, lbParams)
-	if err := s.ensureLBVM(ctx, vm, cm); err != nil {
+	if replicas > 1 {
+		if vmService.Spec.LoadBalancerIP == "" {
+			return errors.Errorf("a LoadBalancerIP is required for the VIP of %d LB VM replicas", replicas)
+		}
+		if err := s.ensureLBResourcePolicy(ctx, vmService); err != nil {
+			return err
+		}
+	}
+
+	vms := make([]*vmopv1alpha1.VirtualMachine, replicas)
+	outdated := make([]bool, replicas)
+	for i := range vms {
+		hash, err := s.ensureLBVMMetadata(ctx, vmService, i, replicas)
+		if err != nil {
+			return err
+		}
+		vms[i], err = s.ensureLBVM(ctx, loadbalancerVM(vmService, i, replicas, hash))
+		if err != nil {
+			return err
+		}
+		outdated[i] = vms[i].Annotations[BootstrapHashAnnotationKey] != hash
+	}
+	if err := s.deleteExtraLBVMs(ctx, vmService, replicas); err != nil {
+		return err
+	}
+	statuses := s.lbReplicaStatuses(ctx, vms)
+	rolling, err := s.replaceOutdatedLBVM(ctx, vmService, vms, outdated, statuses)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureLBIP(ctx, vmService, vms, statuses); err != nil {
 		return err
 	}
-	if err := s.ensureLBIP(ctx, vmService, vm); err != nil {
+	if err := s.updateLBConfig(ctx, vmService); err != nil {
 		return err
 	}
 
-	return s.updateLBConfig(ctx, vmService)
+	if rolling {
+		return errors.New("LB VMs are being replaced with an updated bootstrap")
+	}
+	return nil
+}
+
+// lbReplicas returns the number of LB VMs from the VirtualMachineService annotation, or the
+// configured default when the annotation is not present. The default falls back to a single LB VM
+// for a VirtualMachineService without the LoadBalancerIP the VIP of multiple replicas requires.
+func (s *simpleLoadBalancerProvider) lbReplicas(vmService *vmopv1alpha1.VirtualMachineService) (int, error) {
+	v, ok := vmService.Annotations[ReplicasAnnotationKey]
+	if !ok {
+		replicas := lib.SimpleLBReplicas()
+		if replicas > 1 && vmService.Spec.LoadBalancerIP == "" {
+			s.log.V(4).Info("using a single LB VM since the VMService has no LoadBalancerIP for a VIP",
+				"VMService", vmService.Name, "defaultReplicas", replicas)
+			return 1, nil
+		}
+		return replicas, nil
+	}
+
+	replicas, err := strconv.Atoi(v)
+	if err != nil || replicas < 1 {
+		return 0, errors.Errorf("invalid %s annotation value %q: must be a positive integer", ReplicasAnnotationKey, v)
+	}
+	return replicas, nil
 }
 
 // No labels is added for simple LoadBalancer
@@ -80,20 +182,190 @@ func (s *simpleLoadBalancerProvider) GetToBeRemovedServiceAnnotations(ctx contex
 	return nil, nil
 }
 
-func (s *simpleLoadBalancerProvider) ensureLBVM(ctx context.Context, vm *vmopv1alpha1.VirtualMachine, cm *corev1.ConfigMap) error {
-	if err := s.client.Get(ctx, types.NamespacedName{Namespace: cm.Namespace, Name: cm.Name}, cm); err != nil {
+// ensureLBVMMetadata ensures the LB VM cloud-init metadata has the current bootstrap config, and
+// returns the hash of that config. The bootstrap config holds the private key of the client
+// certificate the LB VM uses to authenticate to the xDS server, so it is kept in a Secret while the
+// ConfigMap of the LB VM metadata only has the non-sensitive keys. The Secret is updated in place
+// when the bootstrap config changed, in which case the LB VM needs to be replaced for the new
+// config to take effect. The client certificate is valid as long as the CA, so it is not renewed.
+func (s *simpleLoadBalancerProvider) ensureLBVMMetadata(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService, replica, replicas int) (string, error) {
+	xdsNodes, err := s.getXDSNodes(ctx)
+	if err != nil {
+		return "", err
+	}
+	lbParams := getLBConfigParams(vmService, xdsNodes)
+	lbParams.Replica = replica
+	lbParams.Replicas = replicas
+	lbParams.VIP = vmService.Spec.LoadBalancerIP
+
+	ca, err := ensureCertificateAuthority(ctx, s.client, s.namespace)
+	if err != nil {
+		return "", err
+	}
+
+	secret := &corev1.Secret{}
+	err = s.client.Get(ctx, types.NamespacedName{Namespace: vmService.Namespace, Name: metadataName(vmService, replica)}, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	exists := err == nil
+
+	hash := bootstrapHash(lbParams)
+	if exists && secret.Annotations[BootstrapHashAnnotationKey] == hash {
+		return hash, s.ensureLBVMMetadataConfigMap(ctx, vmService, replica)
+	}
+
+	certPEM, keyPEM, err := ca.issue(lbParams.NodeID, x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to issue xDS client certificate for %s", lbParams.NodeID)
+	}
+	notAfter, err := certificateNotAfter(certPEM)
+	if err != nil {
+		return "", err
+	}
+	lbParams.CACert = string(ca.certPEM)
+	lbParams.ClientCert = string(certPEM)
+	lbParams.ClientKey = string(keyPEM)
+
+	newSecret := loadbalancerMetadataSecret(vmService, replica, lbParams, hash, notAfter)
+	if !exists {
+		err = s.client.Create(ctx, newSecret)
+	} else {
+		s.log.Info("updating LB VM bootstrap config", "VMService", vmService.Name, "Secret", secret.Name)
+		secret.Annotations = newSecret.Annotations
+		secret.Data = newSecret.Data
+		err = s.client.Update(ctx, secret)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return hash, s.ensureLBVMMetadataConfigMap(ctx, vmService, replica)
+}
+
+// ensureLBVMMetadataConfigMap ensures the ConfigMap of the LB VM metadata only has the
+// non-sensitive keys, removing the bootstrap config that LB VMs created before the Secret
+// existed had in it.
+func (s *simpleLoadBalancerProvider) ensureLBVMMetadataConfigMap(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService, replica int) error {
+	newCM := loadbalancerCM(vmService, replica)
+
+	cm := &corev1.ConfigMap{}
+	err := s.client.Get(ctx, types.NamespacedName{Namespace: newCM.Namespace, Name: newCM.Name}, cm)
+	if err != nil {
 		if !apierrors.IsNotFound(err) {
 			return err
 		}
-		if err := s.client.Create(ctx, cm); err != nil {
-			return err
-		}
+		return s.client.Create(ctx, newCM)
 	}
-	if err := s.client.Get(ctx, types.NamespacedName{Namespace: vm.Namespace, Name: vm.Name}, vm); err != nil {
+
+	if reflect.DeepEqual(cm.Data, newCM.Data) {
+		return nil
+	}
+	cm.Data = newCM.Data
+	return s.client.Update(ctx, cm)
+}
+
+// ensureLBVM creates the LB VM if it does not exist, and returns the existing or created LB VM.
+func (s *simpleLoadBalancerProvider) ensureLBVM(ctx context.Context, vm *vmopv1alpha1.VirtualMachine) (*vmopv1alpha1.VirtualMachine, error) {
+	existing := &vmopv1alpha1.VirtualMachine{}
+	if err := s.client.Get(ctx, types.NamespacedName{Namespace: vm.Namespace, Name: vm.Name}, existing); err != nil {
 		if !apierrors.IsNotFound(err) {
-			return err
+			return nil, err
 		}
 		if err := s.client.Create(ctx, vm); err != nil {
+			return nil, err
+		}
+		return vm, nil
+	}
+	return existing, nil
+}
+
+// replaceOutdatedLBVM deletes an LB VM whose bootstrap config is outdated so that it is created
+// again, with the current bootstrap config, on a later reconcile. Only one LB VM is replaced at a
+// time, and only once all the other replicas are ready, so that the VIP remains available. The last
+// ready LB VM is never replaced, so an outdated single replica is kept while it is ready. It returns
+// true while LB VMs are being replaced.
+func (s *simpleLoadBalancerProvider) replaceOutdatedLBVM(
+	ctx context.Context,
+	vmService *vmopv1alpha1.VirtualMachineService,
+	vms []*vmopv1alpha1.VirtualMachine,
+	outdated []bool,
+	statuses []lbReplicaStatus) (bool, error) {
+
+	candidate := -1
+	for i, vm := range vms {
+		if !vm.DeletionTimestamp.IsZero() {
+			// An LB VM is already being replaced.
+			return true, nil
+		}
+		if outdated[i] && candidate < 0 {
+			candidate = i
+		}
+	}
+	if candidate < 0 {
+		return false, nil
+	}
+
+	for i, status := range statuses {
+		if i != candidate && !status.Ready {
+			s.log.Info("waiting for the LB VM replicas to be ready before replacing an outdated LB VM",
+				"VMService", vmService.Name, "VM", vms[candidate].Name)
+			return true, nil
+		}
+	}
+	if len(vms) == 1 && statuses[candidate].Ready {
+		s.log.Info("keeping the only ready LB VM with an outdated bootstrap config",
+			"VMService", vmService.Name, "VM", vms[candidate].Name)
+		return false, nil
+	}
+
+	s.log.Info("replacing LB VM with an outdated bootstrap config", "VMService", vmService.Name, "VM", vms[candidate].Name)
+	if err := s.client.Delete(ctx, vms[candidate]); err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// ensureLBResourcePolicy creates the resource policy whose cluster module spreads the LB VM
+// replicas of the VirtualMachineService across hosts.
+func (s *simpleLoadBalancerProvider) ensureLBResourcePolicy(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error {
+	policy := &vmopv1alpha1.VirtualMachineSetResourcePolicy{}
+	err := s.client.Get(ctx, types.NamespacedName{Namespace: vmService.Namespace, Name: lbResourcePolicyName(vmService)}, policy)
+	if err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	return s.client.Create(ctx, loadbalancerResourcePolicy(vmService))
+}
+
+// deleteExtraLBVMs deletes the LB VMs, and their metadata, of replicas that are no longer desired.
+func (s *simpleLoadBalancerProvider) deleteExtraLBVMs(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService, replicas int) error {
+	vmList := &vmopv1alpha1.VirtualMachineList{}
+	if err := s.client.List(ctx, vmList, client.InNamespace(vmService.Namespace), client.MatchingLabels{ServiceLabelKey: vmService.Name}); err != nil {
+		return err
+	}
+
+	for i := range vmList.Items {
+		vm := &vmList.Items[i]
+		replica, err := strconv.Atoi(vm.Labels[ReplicaLabelKey])
+		if err != nil || replica < replicas {
+			continue
+		}
+
+		s.log.Info("deleting LB VM replica", "VMService", vmService.Name, "VM", vm.Name)
+		if err := s.client.Delete(ctx, vm); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		cm := &corev1.ConfigMap{}
+		cm.Namespace = vmService.Namespace
+		cm.Name = metadataName(vmService, replica)
+		if err := s.client.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		secret := &corev1.Secret{}
+		secret.Namespace = vmService.Namespace
+		secret.Name = metadataName(vmService, replica)
+		if err := s.client.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
 			return err
 		}
 	}
@@ -114,11 +386,19 @@ func makeVMServiceOwnerRef(vmService *vmopv1alpha1.VirtualMachineService) metav1
 	}
 }
 
-func loadbalancerVM(vmService *vmopv1alpha1.VirtualMachineService) *vmopv1alpha1.VirtualMachine {
-	return &vmopv1alpha1.VirtualMachine{
+func loadbalancerVM(vmService *vmopv1alpha1.VirtualMachineService, replica, replicas int, hash string) *vmopv1alpha1.VirtualMachine {
+	vm := &vmopv1alpha1.VirtualMachine{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:            vmService.Name + "-lb",
-			Namespace:       vmService.Namespace,
+			Name:      lbVMName(vmService, replica),
+			Namespace: vmService.Namespace,
+			Labels: map[string]string{
+				ServiceLabelKey: vmService.Name,
+				ReplicaLabelKey: strconv.Itoa(replica),
+			},
+			Annotations: map[string]string{
+				BootstrapHashAnnotationKey:             hash,
+				vmprovider.MetadataSecretAnnotationKey: metadataName(vmService, replica),
+			},
 			OwnerReferences: []metav1.OwnerReference{makeVMServiceOwnerRef(vmService)},
 		},
 		Spec: vmopv1alpha1.VirtualMachineSpec{
@@ -126,39 +406,165 @@ func loadbalancerVM(vmService *vmopv1alpha1.VirtualMachineService) *vmopv1alpha1
 			ClassName:  "best-effort-xsmall",
 			PowerState: "poweredOn",
 			VmMetadata: &vmopv1alpha1.VirtualMachineMetadata{
-				ConfigMapName: metadataCMName(vmService),
+				ConfigMapName: metadataName(vmService, replica),
 				Transport:     vmopv1alpha1.VirtualMachineMetadataExtraConfigTransport,
 			},
 		},
 	}
+
+	if replicas > 1 {
+		vm.Spec.ResourcePolicyName = lbResourcePolicyName(vmService)
+		vm.Annotations[pkg.ClusterModuleNameKey] = lbResourcePolicyName(vmService)
+		vm.Annotations[pkg.ProviderTagsAnnotationKey] = vsphere.WorkerVmVmAntiAffinityTagKey
+	}
+
+	return vm
 }
 
-func loadbalancerCM(vmService *vmopv1alpha1.VirtualMachineService, params lbConfigParams) *corev1.ConfigMap {
+func loadbalancerCM(vmService *vmopv1alpha1.VirtualMachineService, replica int) *corev1.ConfigMap {
 	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:            metadataCMName(vmService),
+			Name:            metadataName(vmService, replica),
 			Namespace:       vmService.Namespace,
 			OwnerReferences: []metav1.OwnerReference{makeVMServiceOwnerRef(vmService)},
 		},
 		Data: map[string]string{
-			"guestinfo.userdata":          renderAndBase64EncodeLBCloudConfig(params),
 			"guestinfo.userdata.encoding": "base64",
 		},
 	}
 }
 
-func metadataCMName(vmService *vmopv1alpha1.VirtualMachineService) string {
-	return vmService.Name + "-lb" + "-cloud-init"
+func loadbalancerMetadataSecret(
+	vmService *vmopv1alpha1.VirtualMachineService,
+	replica int,
+	params lbConfigParams,
+	hash string,
+	certNotAfter time.Time) *corev1.Secret {
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      metadataName(vmService, replica),
+			Namespace: vmService.Namespace,
+			Annotations: map[string]string{
+				BootstrapHashAnnotationKey:       hash,
+				CertificateNotAfterAnnotationKey: certNotAfter.UTC().Format(time.RFC3339),
+			},
+			OwnerReferences: []metav1.OwnerReference{makeVMServiceOwnerRef(vmService)},
+		},
+		Data: map[string][]byte{
+			"guestinfo.userdata": []byte(renderAndBase64EncodeLBCloudConfig(params)),
+		},
+	}
+}
+
+func loadbalancerResourcePolicy(vmService *vmopv1alpha1.VirtualMachineService) *vmopv1alpha1.VirtualMachineSetResourcePolicy {
+	name := lbResourcePolicyName(vmService)
+	return &vmopv1alpha1.VirtualMachineSetResourcePolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       vmService.Namespace,
+			OwnerReferences: []metav1.OwnerReference{makeVMServiceOwnerRef(vmService)},
+		},
+		Spec: vmopv1alpha1.VirtualMachineSetResourcePolicySpec{
+			ResourcePool:   vmopv1alpha1.ResourcePoolSpec{Name: name},
+			Folder:         vmopv1alpha1.FolderSpec{Name: name},
+			ClusterModules: []vmopv1alpha1.ClusterModuleSpec{{GroupName: name}},
+		},
+	}
+}
+
+// lbVMName returns the name of an LB VM replica. The first replica keeps the name used before
+// there could be more than one LB VM so existing LB VMs are adopted as the first replica.
+func lbVMName(vmService *vmopv1alpha1.VirtualMachineService, replica int) string {
+	if replica == 0 {
+		return vmService.Name + "-lb"
+	}
+	return fmt.Sprintf("%s-lb-%d", vmService.Name, replica)
+}
+
+// metadataName returns the name of the ConfigMap and of the Secret of the LB VM metadata.
+func metadataName(vmService *vmopv1alpha1.VirtualMachineService, replica int) string {
+	return lbVMName(vmService, replica) + "-cloud-init"
 }
 
-func (s *simpleLoadBalancerProvider) ensureLBIP(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService, vm *vmopv1alpha1.VirtualMachine) error {
-	if len(vmService.Status.LoadBalancer.Ingress) == 0 || vmService.Status.LoadBalancer.Ingress[0].IP == "" {
-		if vm.Status.VmIp == "" {
-			return errors.New("LB VM IP is not ready yet")
+func lbResourcePolicyName(vmService *vmopv1alpha1.VirtualMachineService) string {
+	return vmService.Name + "-lb"
+}
+
+// lbReplicaStatus is the health of an LB VM replica that is reported in the
+// ReplicaStatusAnnotationKey annotation of the VirtualMachineService.
+type lbReplicaStatus struct {
+	Name  string `json:"name"`
+	IP    string `json:"ip,omitempty"`
+	Ready bool   `json:"ready"`
+}
+
+// lbReplicaStatuses returns the health of the LB VM replicas. A replica is ready when it is powered
+// on, has an IP and its Envoy reports ready, which is also what keepalived checks before holding
+// the VIP.
+func (s *simpleLoadBalancerProvider) lbReplicaStatuses(ctx context.Context, vms []*vmopv1alpha1.VirtualMachine) []lbReplicaStatus {
+	statuses := make([]lbReplicaStatus, len(vms))
+	for i, vm := range vms {
+		statuses[i] = lbReplicaStatus{
+			Name: vm.Name,
+			IP:   vm.Status.VmIp,
+		}
+		if vm.Status.PowerState == vmopv1alpha1.VirtualMachinePoweredOn && vm.Status.VmIp != "" {
+			statuses[i].Ready = s.envoyReady(ctx, vm.Status.VmIp)
 		}
+	}
+	return statuses
+}
+
+// envoyReady returns true when the Envoy admin endpoint of the LB VM with the given IP reports
+// that Envoy is ready to serve.
+func envoyReady(ctx context.Context, ip string) bool {
+	ctx, cancel := context.WithTimeout(ctx, envoyReadyTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/ready", net.JoinHostPort(ip, strconv.Itoa(envoyAdminPort)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// ensureLBIP reports the health of the LB VM replicas and sets the VirtualMachineService ingress
+// to the LB VM IP, or to the VIP when there are multiple replicas.
+func (s *simpleLoadBalancerProvider) ensureLBIP(
+	ctx context.Context,
+	vmService *vmopv1alpha1.VirtualMachineService,
+	vms []*vmopv1alpha1.VirtualMachine,
+	statuses []lbReplicaStatus) error {
+
+	if err := s.updateReplicaStatus(ctx, vmService, statuses); err != nil {
+		return err
+	}
+
+	ip := vms[0].Status.VmIp
+	if len(vms) > 1 {
+		ip = ""
+		for _, status := range statuses {
+			if status.Ready {
+				ip = vmService.Spec.LoadBalancerIP
+				break
+			}
+		}
+	}
+	if ip == "" {
+		return errors.New("LB VM IP is not ready yet")
+	}
+
+	if len(vmService.Status.LoadBalancer.Ingress) == 0 || vmService.Status.LoadBalancer.Ingress[0].IP != ip {
 		vmService = vmService.DeepCopy()
 		vmService.Status.LoadBalancer.Ingress = []vmopv1alpha1.LoadBalancerIngress{{
-			IP: vm.Status.VmIp,
+			IP: ip,
 		}}
 		err := s.client.Status().Update(ctx, vmService)
 		return err
@@ -166,18 +572,22 @@ func (s *simpleLoadBalancerProvider) ensureLBIP(ctx context.Context, vmService *
 	return nil
 }
 
-func (s *simpleLoadBalancerProvider) updateLBConfig(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error {
-	service := &corev1.Service{}
-	endpoints := &corev1.Endpoints{}
-	if err := s.client.Get(ctx, types.NamespacedName{
-		Namespace: vmService.Namespace,
-		Name:      vmService.Name,
-	}, service); err != nil {
-		if apierrors.IsNotFound(err) {
-			return nil // service is not ready yet
-		}
+func (s *simpleLoadBalancerProvider) updateReplicaStatus(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService, statuses []lbReplicaStatus) error {
+	data, err := json.Marshal(statuses)
+	if err != nil {
 		return err
 	}
+	if vmService.Annotations[ReplicaStatusAnnotationKey] == string(data) {
+		return nil
+	}
+
+	patch := client.MergeFrom(vmService.DeepCopy())
+	metav1.SetMetaDataAnnotation(&vmService.ObjectMeta, ReplicaStatusAnnotationKey, string(data))
+	return s.client.Patch(ctx, vmService, patch)
+}
+
+func (s *simpleLoadBalancerProvider) updateLBConfig(ctx context.Context, vmService *vmopv1alpha1.VirtualMachineService) error {
+	endpoints := &corev1.Endpoints{}
 	if err := s.client.Get(ctx, types.NamespacedName{
 		Namespace: vmService.Namespace,
 		Name:      vmService.Name,
@@ -187,7 +597,7 @@ func (s *simpleLoadBalancerProvider) updateLBConfig(ctx context.Context, vmServi
 		}
 		return err
 	}
-	return s.controlPlane.UpdateEndpoints(service, endpoints)
+	return s.controlPlane.UpdateConfig(vmService, endpoints)
 }
 
 func (s *simpleLoadBalancerProvider) getXDSNodes(ctx context.Context) ([]corev1.Node, error) {
@@ -214,14 +624,8 @@ func getLBConfigParams(vmService *vmopv1alpha1.VirtualMachineService, nodes []co
 	for i, node := range nodes {
 		cpNodes[i] = node.Status.Addresses[0].Address
 	}
-	ports := make([]vmopv1alpha1.VirtualMachineServicePort, len(vmService.Spec.Ports))
-	for i, port := range vmService.Spec.Ports {
-		port.Name = portName(port)
-		ports[i] = port
-	}
 	return lbConfigParams{
-		NodeID:      vmService.NamespacedName(),
-		Ports:       ports,
+		NodeID:      nodeID(vmService),
 		CPNodes:     cpNodes,
 		XdsNodePort: XdsNodePort,
 	}
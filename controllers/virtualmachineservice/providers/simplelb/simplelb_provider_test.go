@@ -1,26 +1,38 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package simplelb
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
 
 	logr_testing "github.com/go-logr/logr/testing"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
+	"github.com/vmware-tanzu/vm-operator/pkg"
+	"github.com/vmware-tanzu/vm-operator/pkg/lib"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	"github.com/vmware-tanzu/vm-operator/test/builder"
 )
 
 type cpArgs struct {
-	service   *corev1.Service
+	vmService *vmopv1alpha1.VirtualMachineService
 	endpoints *corev1.Endpoints
 }
 
@@ -28,19 +40,34 @@ type fakeControlPlane struct {
 	calls []cpArgs
 }
 
-func (cp *fakeControlPlane) UpdateEndpoints(service *corev1.Service, endpoints *corev1.Endpoints) error {
+func (cp *fakeControlPlane) UpdateConfig(vmService *vmopv1alpha1.VirtualMachineService, endpoints *corev1.Endpoints) error {
 	cp.calls = append(cp.calls, cpArgs{
-		service:   service,
+		vmService: vmService,
 		endpoints: endpoints,
 	})
 	return nil
 }
 
+// fakeEnvoyReady is the envoyReady func of the provider in tests, where the LB VMs do not run Envoy.
+func fakeEnvoyReady(notReadyIPs ...string) func(context.Context, string) bool {
+	return func(_ context.Context, ip string) bool {
+		for _, notReadyIP := range notReadyIPs {
+			if ip == notReadyIP {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 var _ = Describe("", func() {
 	const (
-		testNs  = "test-ns"
-		testSvc = "test-svc"
-		lbVMIP  = "11.12.13.14"
+		testNs   = "test-ns"
+		testSvc  = "test-svc"
+		lbVMIP   = "11.12.13.14"
+		vmopNs   = "vmop-ns"
+		nodeIP   = "192.168.1.10"
+		nodeName = "node-1"
 	)
 	vmService := &vmopv1alpha1.VirtualMachineService{
 		ObjectMeta: metav1.ObjectMeta{
@@ -58,11 +85,21 @@ var _ = Describe("", func() {
 	}
 	vmKey := types.NamespacedName{Namespace: testNs, Name: testSvc + "-lb"}
 	vm := &vmopv1alpha1.VirtualMachine{}
-	client, _ := builder.NewFakeClient(vmService)
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nodeName,
+		},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: nodeIP}},
+		},
+	}
+	client, _ := builder.NewFakeClient(vmService, node)
 	controlPlane := &fakeControlPlane{}
 	simpleLbProvider := simpleLoadBalancerProvider{
 		client:       client,
 		controlPlane: controlPlane,
+		namespace:    vmopNs,
+		envoyReady:   fakeEnvoyReady(),
 		log:          logr_testing.NullLogger{},
 	}
 
@@ -78,6 +115,47 @@ var _ = Describe("", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("should issue the LB VM an xDS client certificate", func() {
+			secret := &corev1.Secret{}
+			err := client.Get(context.TODO(), types.NamespacedName{Namespace: vmopNs, Name: XdsCASecretName}, secret)
+			Expect(err).ToNot(HaveOccurred())
+			ca, err := certificateAuthorityFromSecret(secret)
+			Expect(err).ToNot(HaveOccurred())
+
+			cm := &corev1.ConfigMap{}
+			err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: metadataName(vmService, 0)}, cm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cm.Data).ToNot(HaveKey("guestinfo.userdata"))
+
+			Expect(client.Get(context.TODO(), vmKey, vm)).To(Succeed())
+			Expect(vm.Annotations).To(HaveKeyWithValue(vmprovider.MetadataSecretAnnotationKey, metadataName(vmService, 0)))
+			metadataSecret := &corev1.Secret{}
+			err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: metadataName(vmService, 0)}, metadataSecret)
+			Expect(err).ToNot(HaveOccurred())
+
+			ccBytes, err := base64.StdEncoding.DecodeString(string(metadataSecret.Data["guestinfo.userdata"]))
+			Expect(err).ToNot(HaveOccurred())
+			cc := cloudConfig{}
+			Expect(yaml.Unmarshal(ccBytes, &cc)).To(Succeed())
+
+			files := map[string]string{}
+			for _, f := range cc.WriteFiles {
+				files[f.Path] = f.Content
+			}
+			Expect(files).To(HaveKeyWithValue(xdsCACertPath, string(ca.certPEM)))
+			Expect(files).To(HaveKey(xdsClientKeyPath))
+			Expect(files[envoyConfigPath]).To(ContainSubstring(nodeIP))
+
+			block, _ := pem.Decode([]byte(files[xdsClientCertPath]))
+			Expect(block).ToNot(BeNil())
+			cert, err := x509.ParseCertificate(block.Bytes)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cert.Subject.CommonName).To(Equal(nodeID(vmService)))
+			Expect(cert.CheckSignatureFrom(ca.cert)).To(Succeed())
+			Expect(cert.NotAfter).To(BeTemporally("==", ca.cert.NotAfter))
+			Expect(metadataSecret.Annotations).To(HaveKeyWithValue(CertificateNotAfterAnnotationKey, cert.NotAfter.UTC().Format(time.RFC3339)))
+		})
+
 		When("the LB VM has an IP address", func() {
 			It("should update the VMService Loadbalancer IP", func() {
 				vm.Status.VmIp = lbVMIP
@@ -145,9 +223,353 @@ var _ = Describe("", func() {
 				Expect(err).ToNot(HaveOccurred())
 
 				Expect(controlPlane.calls).To(HaveLen(1))
-				Expect(controlPlane.calls[0].service.Name).To(Equal(svc.Name))
+				Expect(controlPlane.calls[0].vmService.Name).To(Equal(vmService.Name))
 				Expect(controlPlane.calls[0].endpoints.Name).To(Equal(eps.Name))
 			})
 		})
 	})
 })
+
+var _ = Describe("EnsureLoadBalancer() with multiple LB VM replicas", func() {
+	const (
+		testNs = "test-ns"
+		vip    = "10.20.30.40"
+	)
+
+	var (
+		client           ctrlclient.Client
+		vmService        *vmopv1alpha1.VirtualMachineService
+		simpleLbProvider simpleLoadBalancerProvider
+	)
+
+	listLBVMs := func() []vmopv1alpha1.VirtualMachine {
+		vmList := &vmopv1alpha1.VirtualMachineList{}
+		err := client.List(context.TODO(), vmList, ctrlclient.InNamespace(testNs), ctrlclient.MatchingLabels{ServiceLabelKey: vmService.Name})
+		Expect(err).ToNot(HaveOccurred())
+		return vmList.Items
+	}
+
+	BeforeEach(func() {
+		vmService = &vmopv1alpha1.VirtualMachineService{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   testNs,
+				Name:        "ha-svc",
+				Annotations: map[string]string{ReplicasAnnotationKey: "3"},
+			},
+			Spec: vmopv1alpha1.VirtualMachineServiceSpec{
+				LoadBalancerIP: vip,
+				Ports: []vmopv1alpha1.VirtualMachineServicePort{{
+					Name:       "apiserver",
+					Port:       6443,
+					Protocol:   "TCP",
+					TargetPort: 6443,
+				}},
+			},
+		}
+		client, _ = builder.NewFakeClient(vmService)
+		simpleLbProvider = simpleLoadBalancerProvider{
+			client:       client,
+			controlPlane: &fakeControlPlane{},
+			namespace:    "vmop-ns",
+			envoyReady:   fakeEnvoyReady(),
+			log:          logr_testing.NullLogger{},
+		}
+	})
+
+	It("should create an LB VM per replica in an anti-affinity cluster module", func() {
+		err := simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(MatchError("LB VM IP is not ready yet"))
+
+		policy := &vmopv1alpha1.VirtualMachineSetResourcePolicy{}
+		err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: lbResourcePolicyName(vmService)}, policy)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(policy.Spec.ClusterModules).To(HaveLen(1))
+
+		vms := listLBVMs()
+		Expect(vms).To(HaveLen(3))
+		for _, vm := range vms {
+			Expect(vm.Spec.ResourcePolicyName).To(Equal(policy.Name))
+			Expect(vm.Annotations).To(HaveKeyWithValue(pkg.ClusterModuleNameKey, policy.Spec.ClusterModules[0].GroupName))
+			Expect(vm.Annotations).To(HaveKey(pkg.ProviderTagsAnnotationKey))
+
+			cm := &corev1.ConfigMap{}
+			err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: vm.Name + "-cloud-init"}, cm)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(vmService.Annotations).To(HaveKey(ReplicaStatusAnnotationKey))
+	})
+
+	It("should set the ingress to the VIP once a replica is ready", func() {
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).ToNot(Succeed())
+
+		vm := &vmopv1alpha1.VirtualMachine{}
+		err := client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: lbVMName(vmService, 1)}, vm)
+		Expect(err).ToNot(HaveOccurred())
+		vm.Status.VmIp = "11.12.13.14"
+		vm.Status.PowerState = vmopv1alpha1.VirtualMachinePoweredOn
+		Expect(client.Status().Update(context.TODO(), vm)).To(Succeed())
+
+		err = simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: vmService.Name}, vmService)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vmService.Status.LoadBalancer.Ingress).To(HaveLen(1))
+		Expect(vmService.Status.LoadBalancer.Ingress[0].IP).To(Equal(vip))
+
+		var statuses []lbReplicaStatus
+		Expect(json.Unmarshal([]byte(vmService.Annotations[ReplicaStatusAnnotationKey]), &statuses)).To(Succeed())
+		Expect(statuses).To(HaveLen(3))
+		Expect(statuses[0].Ready).To(BeFalse())
+		Expect(statuses[1].Ready).To(BeTrue())
+		Expect(statuses[2].Ready).To(BeFalse())
+	})
+
+	It("should delete the extra LB VMs when scaled down", func() {
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).ToNot(Succeed())
+		Expect(listLBVMs()).To(HaveLen(3))
+
+		vmService.Annotations[ReplicasAnnotationKey] = "2"
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).ToNot(Succeed())
+		Expect(listLBVMs()).To(HaveLen(2))
+
+		cm := &corev1.ConfigMap{}
+		err := client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: metadataName(vmService, 2)}, cm)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should require a LoadBalancerIP", func() {
+		vmService.Spec.LoadBalancerIP = ""
+		err := simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(HaveOccurred())
+		Expect(listLBVMs()).To(BeEmpty())
+	})
+
+	It("should reject an invalid replicas annotation", func() {
+		vmService.Annotations[ReplicasAnnotationKey] = "-1"
+		err := simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(HaveOccurred())
+		Expect(listLBVMs()).To(BeEmpty())
+	})
+
+	It("should not report a replica whose Envoy is not ready", func() {
+		simpleLbProvider.envoyReady = fakeEnvoyReady("11.12.13.14")
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).ToNot(Succeed())
+
+		vm := &vmopv1alpha1.VirtualMachine{}
+		err := client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: lbVMName(vmService, 1)}, vm)
+		Expect(err).ToNot(HaveOccurred())
+		vm.Status.VmIp = "11.12.13.14"
+		vm.Status.PowerState = vmopv1alpha1.VirtualMachinePoweredOn
+		Expect(client.Status().Update(context.TODO(), vm)).To(Succeed())
+
+		err = simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(MatchError("LB VM IP is not ready yet"))
+
+		err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: vmService.Name}, vmService)
+		Expect(err).ToNot(HaveOccurred())
+		var statuses []lbReplicaStatus
+		Expect(json.Unmarshal([]byte(vmService.Annotations[ReplicaStatusAnnotationKey]), &statuses)).To(Succeed())
+		Expect(statuses).To(HaveLen(3))
+		Expect(statuses[1].IP).To(Equal("11.12.13.14"))
+		Expect(statuses[1].Ready).To(BeFalse())
+	})
+
+	It("should replace the first LB VM when scaled up", func() {
+		setReady := func(replica int) {
+			vm := &vmopv1alpha1.VirtualMachine{}
+			err := client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: lbVMName(vmService, replica)}, vm)
+			Expect(err).ToNot(HaveOccurred())
+			vm.Status.VmIp = fmt.Sprintf("11.12.13.%d", replica)
+			vm.Status.PowerState = vmopv1alpha1.VirtualMachinePoweredOn
+			Expect(client.Status().Update(context.TODO(), vm)).To(Succeed())
+		}
+		setReplicas := func(replicas string) {
+			vmService.Annotations[ReplicasAnnotationKey] = replicas
+			Expect(client.Update(context.TODO(), vmService)).To(Succeed())
+		}
+
+		setReplicas("1")
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).ToNot(Succeed())
+		setReady(0)
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).To(Succeed())
+		Expect(listLBVMs()).To(HaveLen(1))
+
+		setReplicas("3")
+		err := simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(MatchError("LB VMs are being replaced with an updated bootstrap"))
+		Expect(listLBVMs()).To(HaveLen(3), "the first LB VM is only replaced once the new replicas are ready")
+
+		setReady(1)
+		setReady(2)
+		err = simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(MatchError("LB VMs are being replaced with an updated bootstrap"))
+		Expect(listLBVMs()).To(HaveLen(2))
+
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).To(Succeed())
+		vm := &vmopv1alpha1.VirtualMachine{}
+		err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: lbVMName(vmService, 0)}, vm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(vm.Spec.ResourcePolicyName).To(Equal(lbResourcePolicyName(vmService)))
+		Expect(vm.Annotations).To(HaveKey(pkg.ClusterModuleNameKey))
+	})
+})
+
+var _ = Describe("EnsureLoadBalancer() with a default of multiple LB VM replicas", func() {
+	const testNs = "test-ns"
+
+	var (
+		client           ctrlclient.Client
+		vmService        *vmopv1alpha1.VirtualMachineService
+		simpleLbProvider simpleLoadBalancerProvider
+		savedReplicas    func() int
+	)
+
+	BeforeEach(func() {
+		savedReplicas = lib.SimpleLBReplicas
+		lib.SimpleLBReplicas = func() int { return 3 }
+
+		vmService = &vmopv1alpha1.VirtualMachineService{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testNs,
+				Name:      "default-svc",
+			},
+		}
+		client, _ = builder.NewFakeClient(vmService)
+		simpleLbProvider = simpleLoadBalancerProvider{
+			client:       client,
+			controlPlane: &fakeControlPlane{},
+			namespace:    "vmop-ns",
+			envoyReady:   fakeEnvoyReady(),
+			log:          logr_testing.NullLogger{},
+		}
+	})
+
+	AfterEach(func() {
+		lib.SimpleLBReplicas = savedReplicas
+	})
+
+	It("should create a single LB VM without a LoadBalancerIP", func() {
+		err := simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(MatchError("LB VM IP is not ready yet"))
+
+		vmList := &vmopv1alpha1.VirtualMachineList{}
+		Expect(client.List(context.TODO(), vmList, ctrlclient.InNamespace(testNs))).To(Succeed())
+		Expect(vmList.Items).To(HaveLen(1))
+		Expect(vmList.Items[0].Spec.ResourcePolicyName).To(BeEmpty())
+	})
+
+	It("should create the default LB VM replicas with a LoadBalancerIP", func() {
+		vmService.Spec.LoadBalancerIP = "10.20.30.40"
+		err := simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(MatchError("LB VM IP is not ready yet"))
+
+		vmList := &vmopv1alpha1.VirtualMachineList{}
+		Expect(client.List(context.TODO(), vmList, ctrlclient.InNamespace(testNs))).To(Succeed())
+		Expect(vmList.Items).To(HaveLen(3))
+	})
+})
+
+var _ = Describe("EnsureLoadBalancer() with an outdated LB VM bootstrap", func() {
+	const testNs = "test-ns"
+
+	var (
+		client           ctrlclient.Client
+		vmService        *vmopv1alpha1.VirtualMachineService
+		simpleLbProvider simpleLoadBalancerProvider
+	)
+
+	BeforeEach(func() {
+		vmService = &vmopv1alpha1.VirtualMachineService{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testNs,
+				Name:      "old-svc",
+			},
+		}
+
+		// An LB VM, and its metadata, created before the bootstrap config changed.
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: metadataName(vmService, 0)},
+			Data:       map[string]string{"guestinfo.userdata": "old-bootstrap"},
+		}
+		vm := &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testNs,
+				Name:      lbVMName(vmService, 0),
+				Labels:    map[string]string{ServiceLabelKey: vmService.Name, ReplicaLabelKey: "0"},
+			},
+			Status: vmopv1alpha1.VirtualMachineStatus{
+				PowerState: vmopv1alpha1.VirtualMachinePoweredOn,
+				VmIp:       "11.12.13.14",
+			},
+		}
+
+		client, _ = builder.NewFakeClient(vmService, cm, vm)
+		simpleLbProvider = simpleLoadBalancerProvider{
+			client:       client,
+			controlPlane: &fakeControlPlane{},
+			namespace:    "vmop-ns",
+			envoyReady:   fakeEnvoyReady(),
+			log:          logr_testing.NullLogger{},
+		}
+	})
+
+	It("should update the metadata in place and replace the LB VM that is not ready", func() {
+		simpleLbProvider.envoyReady = fakeEnvoyReady("11.12.13.14")
+		err := simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+		Expect(err).To(MatchError("LB VMs are being replaced with an updated bootstrap"))
+
+		cm := &corev1.ConfigMap{}
+		err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: metadataName(vmService, 0)}, cm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cm.Data).ToNot(HaveKey("guestinfo.userdata"))
+
+		secret := &corev1.Secret{}
+		err = client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: metadataName(vmService, 0)}, secret)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Annotations).To(HaveKey(BootstrapHashAnnotationKey))
+		Expect(secret.Data).To(HaveKey("guestinfo.userdata"))
+
+		vm := &vmopv1alpha1.VirtualMachine{}
+		vmKey := types.NamespacedName{Namespace: testNs, Name: lbVMName(vmService, 0)}
+		Expect(apierrors.IsNotFound(client.Get(context.TODO(), vmKey, vm))).To(BeTrue())
+
+		By("creating the LB VM again with the current bootstrap", func() {
+			err := simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)
+			Expect(err).To(MatchError("LB VM IP is not ready yet"))
+			Expect(client.Get(context.TODO(), vmKey, vm)).To(Succeed())
+			Expect(vm.Annotations).To(HaveKeyWithValue(BootstrapHashAnnotationKey, secret.Annotations[BootstrapHashAnnotationKey]))
+		})
+	})
+
+	It("should update the metadata in place and keep the only ready LB VM", func() {
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).To(Succeed())
+
+		secret := &corev1.Secret{}
+		err := client.Get(context.TODO(), types.NamespacedName{Namespace: testNs, Name: metadataName(vmService, 0)}, secret)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Annotations).To(HaveKey(BootstrapHashAnnotationKey))
+
+		vm := &vmopv1alpha1.VirtualMachine{}
+		vmKey := types.NamespacedName{Namespace: testNs, Name: lbVMName(vmService, 0)}
+		Expect(client.Get(context.TODO(), vmKey, vm)).To(Succeed())
+		Expect(vm.DeletionTimestamp.IsZero()).To(BeTrue())
+		Expect(vm.Annotations).ToNot(HaveKey(BootstrapHashAnnotationKey))
+	})
+
+	It("should not issue the client certificate again while the bootstrap config is current", func() {
+		simpleLbProvider.envoyReady = fakeEnvoyReady("11.12.13.14")
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).ToNot(Succeed())
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).To(MatchError("LB VM IP is not ready yet"))
+
+		secretKey := types.NamespacedName{Namespace: testNs, Name: metadataName(vmService, 0)}
+		secret := &corev1.Secret{}
+		Expect(client.Get(context.TODO(), secretKey, secret)).To(Succeed())
+
+		Expect(simpleLbProvider.EnsureLoadBalancer(context.TODO(), vmService)).To(MatchError("LB VM IP is not ready yet"))
+		current := &corev1.Secret{}
+		Expect(client.Get(context.TODO(), secretKey, current)).To(Succeed())
+		Expect(current.Data).To(Equal(secret.Data))
+		Expect(current.Annotations).To(Equal(secret.Annotations))
+	})
+})
@@ -1,33 +1,65 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package simplelb
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
-	envoy_api_v2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
-	envoy_api_v2_core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
-	envoy_api_v2_endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
-	"github.com/envoyproxy/go-control-plane/pkg/cache"
-	xds "github.com/envoyproxy/go-control-plane/pkg/server"
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_config_endpoint_v3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	envoy_config_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	envoy_extensions_tcp_proxy_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
+	envoy_service_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
+	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	envoy_service_endpoint_v3 "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	envoy_service_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/service/listener/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	xds "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	"github.com/go-logr/logr"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 )
 
+const clusterConnectTimeout = 250 * time.Millisecond
+
 type xdsServer struct {
 	snapshotCache cache.SnapshotCache
+	client        client.Client
+	namespace     string
 	log           logr.Logger
+
+	// certMu protects the server certificate, which is renewed before it expires.
+	certMu       sync.Mutex
+	ca           *certificateAuthority
+	cert         *tls.Certificate
+	certNotAfter time.Time
 }
 
-func NewXdsServer(mgr manager.Manager, logger logr.Logger) *xdsServer {
+// NewXdsServer returns an xDS server that is started by the manager. The CA Secret used to
+// secure the server is looked up in, or created in, the given namespace.
+func NewXdsServer(mgr manager.Manager, namespace string, logger logr.Logger) *xdsServer {
 	x := &xdsServer{
-		snapshotCache: cache.NewSnapshotCache(false, cache.IDHash{}, nil),
+		snapshotCache: cache.NewSnapshotCache(true, cache.IDHash{}, nil),
+		client:        mgr.GetClient(),
+		namespace:     namespace,
 		log:           logger,
 	}
 	_ = mgr.Add(x) // nothing can go wrong (we don't inject stuff)
@@ -38,15 +70,25 @@ func (x *xdsServer) Start(stop <-chan struct{}) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	server := xds.NewServer(ctx, x.snapshotCache, nil)
-	grpcServer := grpc.NewServer()
+	tlsConfig, err := x.tlsConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	server := xds.NewServer(ctx, x.snapshotCache, newNodeAuthorizer(x.log))
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%v", XdsNodePort))
 	if err != nil {
 		return err
 	}
 
-	envoy_api_v2.RegisterEndpointDiscoveryServiceServer(grpcServer, server)
+	// The LB VM bootstrap only points at ADS, but the individual services are registered
+	// as well so that clients not using ADS are still able to discover the config.
+	envoy_service_discovery_v3.RegisterAggregatedDiscoveryServiceServer(grpcServer, server)
+	envoy_service_listener_v3.RegisterListenerDiscoveryServiceServer(grpcServer, server)
+	envoy_service_cluster_v3.RegisterClusterDiscoveryServiceServer(grpcServer, server)
+	envoy_service_endpoint_v3.RegisterEndpointDiscoveryServiceServer(grpcServer, server)
 
 	go func() {
 		for range stop {
@@ -57,54 +99,237 @@ func (x *xdsServer) Start(stop <-chan struct{}) error {
 	return grpcServer.Serve(lis)
 }
 
-func (x *xdsServer) UpdateEndpoints(svc *corev1.Service, eps *corev1.Endpoints) error {
-	clusters := make([]cache.Resource, len(svc.Spec.Ports))
-	endpoints := make([]cache.Resource, len(svc.Spec.Ports))
-	for i, svcPort := range svc.Spec.Ports {
-		clusters[i] = cluster(svcPort)
-		endpoints[i] = clusterEndpoints(svcPort, eps.Subsets)
+// UpdateConfig sets the listeners, clusters and endpoints served to the LB VM of the
+// VirtualMachineService. The listeners and clusters are derived from the VirtualMachineService
+// ports so port changes are picked up by the running LB VM without a new bootstrap.
+func (x *xdsServer) UpdateConfig(vmService *vmopv1alpha1.VirtualMachineService, eps *corev1.Endpoints) error {
+	listeners := make([]types.Resource, len(vmService.Spec.Ports))
+	clusters := make([]types.Resource, len(vmService.Spec.Ports))
+	endpoints := make([]types.Resource, len(vmService.Spec.Ports))
+	for i, port := range vmService.Spec.Ports {
+		l, err := listener(port)
+		if err != nil {
+			return err
+		}
+		listeners[i] = l
+		clusters[i] = cluster(port)
+		endpoints[i] = clusterEndpoints(port, eps.Subsets)
 	}
 
-	nodeID := nodeID(svc)
-	snapshot := cache.NewSnapshot(eps.ResourceVersion, endpoints, clusters, nil, nil, nil)
+	nodeID := nodeID(vmService)
+	snapshot := cache.NewSnapshot(snapshotVersion(vmService, eps), endpoints, clusters, nil, listeners, nil, nil)
 
 	x.log.V(5).Info("setting xds snapshot", "nodeID", nodeID, "snapshot", snapshot)
 	return x.snapshotCache.SetSnapshot(nodeID, snapshot)
 }
 
-func nodeID(svc *corev1.Service) string {
-	return types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}.String()
+// tlsConfig returns the server side TLS config that requires every client to present a
+// certificate issued by the xDS CA.
+func (x *xdsServer) tlsConfig(ctx context.Context) (*tls.Config, error) {
+	ca, err := ensureCertificateAuthority(ctx, x.client, x.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	x.certMu.Lock()
+	x.ca = ca
+	x.certMu.Unlock()
+
+	// Issue the first certificate now so that the server fails to start if it cannot.
+	if _, err := x.serverCertificate(nil); err != nil {
+		return nil, err
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	return &tls.Config{
+		GetCertificate: x.serverCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      clientCAs,
+		MinVersion:     tls.VersionTLS12,
+	}, nil
 }
 
-func clusterName(svcPort corev1.ServicePort) string {
-	if svcPort.Name == "" {
-		protocol := string(svcPort.Protocol)
-		if protocol == "" {
-			protocol = string(corev1.ProtocolTCP)
-		}
-		return fmt.Sprintf("%s-%v", protocol, svcPort.Port)
+// serverCertificate returns the xDS server certificate, issuing a new one when the current one is
+// due for renewal.
+func (x *xdsServer) serverCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	x.certMu.Lock()
+	defer x.certMu.Unlock()
+
+	if x.cert != nil && !x.ca.needsRenewal(x.certNotAfter) {
+		return x.cert, nil
+	}
+
+	certPEM, keyPEM, err := x.ca.issue(xdsServerName, x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to issue xDS server certificate")
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	notAfter, err := certificateNotAfter(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if x.cert != nil {
+		x.log.Info("renewed xDS server certificate", "notAfter", notAfter)
+	}
+	x.cert = &cert
+	x.certNotAfter = notAfter
+	return x.cert, nil
+}
+
+// nodeAuthorizer is the xDS server callbacks that only allows a client to request the config
+// of the node ID that is the common name of its certificate.
+type nodeAuthorizer struct {
+	mu         sync.Mutex
+	identities map[int64]string
+	log        logr.Logger
+}
+
+var _ xds.Callbacks = &nodeAuthorizer{}
+
+func newNodeAuthorizer(logger logr.Logger) *nodeAuthorizer {
+	return &nodeAuthorizer{
+		identities: map[int64]string{},
+		log:        logger,
+	}
+}
+
+func (a *nodeAuthorizer) OnStreamOpen(ctx context.Context, streamID int64, _ string) error {
+	identity, err := peerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.identities[streamID] = identity
+	return nil
+}
+
+func (a *nodeAuthorizer) OnStreamClosed(streamID int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.identities, streamID)
+}
+
+func (a *nodeAuthorizer) OnStreamRequest(streamID int64, req *envoy_service_discovery_v3.DiscoveryRequest) error {
+	a.mu.Lock()
+	identity, ok := a.identities[streamID]
+	a.mu.Unlock()
+	if !ok {
+		return errors.Errorf("xDS stream %d has no client identity", streamID)
+	}
+
+	return a.authorize(identity, req)
+}
+
+func (a *nodeAuthorizer) OnStreamResponse(int64, *envoy_service_discovery_v3.DiscoveryRequest, *envoy_service_discovery_v3.DiscoveryResponse) {
+}
+
+func (a *nodeAuthorizer) OnFetchRequest(ctx context.Context, req *envoy_service_discovery_v3.DiscoveryRequest) error {
+	identity, err := peerIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	return a.authorize(identity, req)
+}
+
+func (a *nodeAuthorizer) OnFetchResponse(*envoy_service_discovery_v3.DiscoveryRequest, *envoy_service_discovery_v3.DiscoveryResponse) {
+}
+
+func (a *nodeAuthorizer) authorize(identity string, req *envoy_service_discovery_v3.DiscoveryRequest) error {
+	if req.GetNode().GetId() != identity {
+		a.log.Info("rejecting xDS request for another node", "identity", identity, "nodeID", req.GetNode().GetId())
+		return errors.Errorf("client %q is not allowed to request config for node %q", identity, req.GetNode().GetId())
 	}
-	return svcPort.Name
+	return nil
 }
 
-func clusterEndpoints(svcPort corev1.ServicePort, subsets []corev1.EndpointSubset) *envoy_api_v2.ClusterLoadAssignment {
-	var lbEndpoints []*envoy_api_v2_endpoint.LbEndpoint
+// peerIdentity returns the common name of the verified client certificate of the gRPC peer.
+func peerIdentity(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("no gRPC peer in context")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return "", errors.New("gRPC peer is not using TLS")
+	}
+	chains := tlsInfo.State.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return "", errors.New("gRPC peer has no verified client certificate")
+	}
+	return chains[0][0].Subject.CommonName, nil
+}
+
+func nodeID(vmService *vmopv1alpha1.VirtualMachineService) string {
+	return vmService.NamespacedName()
+}
+
+// snapshotVersion changes whenever either the VirtualMachineService spec or its Endpoints change.
+func snapshotVersion(vmService *vmopv1alpha1.VirtualMachineService, eps *corev1.Endpoints) string {
+	return fmt.Sprintf("%d-%s", vmService.Generation, eps.ResourceVersion)
+}
+
+func listener(port vmopv1alpha1.VirtualMachineServicePort) (*envoy_config_listener_v3.Listener, error) {
+	tcpProxy, err := ptypes.MarshalAny(&envoy_extensions_tcp_proxy_v3.TcpProxy{
+		StatPrefix: "ingress_tcp",
+		ClusterSpecifier: &envoy_extensions_tcp_proxy_v3.TcpProxy_Cluster{
+			Cluster: portName(port),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoy_config_listener_v3.Listener{
+		Name: portName(port),
+		Address: &envoy_config_core_v3.Address{
+			Address: &envoy_config_core_v3.Address_SocketAddress{
+				SocketAddress: &envoy_config_core_v3.SocketAddress{
+					Protocol: envoy_config_core_v3.SocketAddress_TCP,
+					Address:  "0.0.0.0",
+					PortSpecifier: &envoy_config_core_v3.SocketAddress_PortValue{
+						PortValue: uint32(port.Port),
+					},
+				},
+			},
+		},
+		FilterChains: []*envoy_config_listener_v3.FilterChain{{
+			Filters: []*envoy_config_listener_v3.Filter{{
+				Name: wellknown.TCPProxy,
+				ConfigType: &envoy_config_listener_v3.Filter_TypedConfig{
+					TypedConfig: tcpProxy,
+				},
+			}},
+		}},
+	}, nil
+}
+
+func clusterEndpoints(port vmopv1alpha1.VirtualMachineServicePort, subsets []corev1.EndpointSubset) *envoy_config_endpoint_v3.ClusterLoadAssignment {
+	var lbEndpoints []*envoy_config_endpoint_v3.LbEndpoint
 
 	for _, subset := range subsets {
 		for _, endpointPort := range subset.Ports {
-			if endpointPort.Port != svcPort.TargetPort.IntVal {
+			if endpointPort.Port != port.TargetPort {
 				continue
 			}
 			for _, endpointAddress := range subset.Addresses {
-				lbEndpoints = append(lbEndpoints, &envoy_api_v2_endpoint.LbEndpoint{
-					HostIdentifier: &envoy_api_v2_endpoint.LbEndpoint_Endpoint{
-						Endpoint: &envoy_api_v2_endpoint.Endpoint{
-							Address: &envoy_api_v2_core.Address{
-								Address: &envoy_api_v2_core.Address_SocketAddress{
-									SocketAddress: &envoy_api_v2_core.SocketAddress{
-										Protocol: envoy_api_v2_core.SocketAddress_TCP,
+				lbEndpoints = append(lbEndpoints, &envoy_config_endpoint_v3.LbEndpoint{
+					HostIdentifier: &envoy_config_endpoint_v3.LbEndpoint_Endpoint{
+						Endpoint: &envoy_config_endpoint_v3.Endpoint{
+							Address: &envoy_config_core_v3.Address{
+								Address: &envoy_config_core_v3.Address_SocketAddress{
+									SocketAddress: &envoy_config_core_v3.SocketAddress{
+										Protocol: envoy_config_core_v3.SocketAddress_TCP,
 										Address:  endpointAddress.IP,
-										PortSpecifier: &envoy_api_v2_core.SocketAddress_PortValue{
+										PortSpecifier: &envoy_config_core_v3.SocketAddress_PortValue{
 											PortValue: uint32(endpointPort.Port),
 										},
 									},
@@ -117,19 +342,29 @@ func clusterEndpoints(svcPort corev1.ServicePort, subsets []corev1.EndpointSubse
 		}
 	}
 
-	return &envoy_api_v2.ClusterLoadAssignment{
-		ClusterName: clusterName(svcPort),
-		Endpoints: []*envoy_api_v2_endpoint.LocalityLbEndpoints{{
+	return &envoy_config_endpoint_v3.ClusterLoadAssignment{
+		ClusterName: portName(port),
+		Endpoints: []*envoy_config_endpoint_v3.LocalityLbEndpoints{{
 			LbEndpoints: lbEndpoints,
 		}},
 	}
 }
 
-func cluster(svcPort corev1.ServicePort) *envoy_api_v2.Cluster {
-	return &envoy_api_v2.Cluster{
-		Name: clusterName(svcPort),
-		ClusterDiscoveryType: &envoy_api_v2.Cluster_Type{
-			Type: envoy_api_v2.Cluster_EDS,
+func cluster(port vmopv1alpha1.VirtualMachineServicePort) *envoy_config_cluster_v3.Cluster {
+	return &envoy_config_cluster_v3.Cluster{
+		Name:           portName(port),
+		ConnectTimeout: ptypes.DurationProto(clusterConnectTimeout),
+		ClusterDiscoveryType: &envoy_config_cluster_v3.Cluster_Type{
+			Type: envoy_config_cluster_v3.Cluster_EDS,
+		},
+		LbPolicy: envoy_config_cluster_v3.Cluster_ROUND_ROBIN,
+		EdsClusterConfig: &envoy_config_cluster_v3.Cluster_EdsClusterConfig{
+			EdsConfig: &envoy_config_core_v3.ConfigSource{
+				ResourceApiVersion: envoy_config_core_v3.ApiVersion_V3,
+				ConfigSourceSpecifier: &envoy_config_core_v3.ConfigSource_Ads{
+					Ads: &envoy_config_core_v3.AggregatedConfigSource{},
+				},
+			},
 		},
 	}
 }
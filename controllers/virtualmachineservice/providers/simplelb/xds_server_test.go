@@ -1,16 +1,30 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package simplelb
 
 import (
-	"github.com/envoyproxy/go-control-plane/pkg/cache"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"time"
+
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	resource "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	logr_testing "github.com/go-logr/logr/testing"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/test/builder"
 )
 
 var _ = Describe("xdsServer", func() {
@@ -24,62 +38,177 @@ var _ = Describe("xdsServer", func() {
 		ip2          = "21.22.23.24"
 	)
 
-	x := &xdsServer{
-		snapshotCache: cache.NewSnapshotCache(false, cache.IDHash{}, nil),
-		log:           logr_testing.NullLogger{},
-	}
-
-	svc := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace: testNs,
-			Name:      testSvc,
-		},
-		Spec: corev1.ServiceSpec{
-			Ports: []corev1.ServicePort{{
-				Name:     portName,
-				Protocol: "TCP",
-				Port:     port,
-				TargetPort: intstr.IntOrString{
-					Type:   intstr.Int,
-					IntVal: port,
-				},
-			}},
-		},
-	}
-	eps := &corev1.Endpoints{
-		ObjectMeta: metav1.ObjectMeta{
-			Namespace:       testNs,
-			Name:            testSvc,
-			ResourceVersion: epResVersion,
-		},
-		Subsets: []corev1.EndpointSubset{{
-			Addresses: []corev1.EndpointAddress{{IP: ip1}, {IP: ip2}},
-			Ports: []corev1.EndpointPort{{
-				Name: portName,
-				Port: port,
+	var (
+		x         *xdsServer
+		vmService *vmopv1alpha1.VirtualMachineService
+		eps       *corev1.Endpoints
+	)
+
+	BeforeEach(func() {
+		x = &xdsServer{
+			snapshotCache: cache.NewSnapshotCache(true, cache.IDHash{}, nil),
+			log:           logr_testing.NullLogger{},
+		}
+
+		vmService = &vmopv1alpha1.VirtualMachineService{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:  testNs,
+				Name:       testSvc,
+				Generation: 1,
+			},
+			Spec: vmopv1alpha1.VirtualMachineServiceSpec{
+				Ports: []vmopv1alpha1.VirtualMachineServicePort{{
+					Name:       portName,
+					Protocol:   "TCP",
+					Port:       port,
+					TargetPort: port,
+				}},
+			},
+		}
+		eps = &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       testNs,
+				Name:            testSvc,
+				ResourceVersion: epResVersion,
+			},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: ip1}, {IP: ip2}},
+				Ports: []corev1.EndpointPort{{
+					Name: portName,
+					Port: port,
+				}},
 			}},
-		}},
-	}
+		}
+	})
 
-	It("UpdateEndpoints()", func() {
-		err := x.UpdateEndpoints(svc, eps)
+	It("UpdateConfig()", func() {
+		err := x.UpdateConfig(vmService, eps)
 		Expect(err).ToNot(HaveOccurred())
 
-		snapshot, err := x.snapshotCache.GetSnapshot(nodeID(svc))
+		snapshot, err := x.snapshotCache.GetSnapshot(nodeID(vmService))
 		Expect(err).ToNot(HaveOccurred())
 
 		err = snapshot.Consistent()
 		Expect(err).ToNot(HaveOccurred())
 
-		Expect(snapshot.GetVersion(cache.EndpointType)).To(Equal(epResVersion))
-		Expect(snapshot.GetVersion(cache.ClusterType)).To(Equal(epResVersion))
+		version := snapshotVersion(vmService, eps)
+		Expect(snapshot.GetVersion(resource.ListenerType)).To(Equal(version))
+		Expect(snapshot.GetVersion(resource.ClusterType)).To(Equal(version))
+		Expect(snapshot.GetVersion(resource.EndpointType)).To(Equal(version))
 
-		clusters := snapshot.GetResources(cache.ClusterType)
-		endpoints := snapshot.GetResources(cache.EndpointType)
+		listeners := snapshot.GetResources(resource.ListenerType)
+		clusters := snapshot.GetResources(resource.ClusterType)
+		endpoints := snapshot.GetResources(resource.EndpointType)
+		Expect(listeners).To(HaveLen(1))
 		Expect(clusters).To(HaveLen(1))
 		Expect(endpoints).To(HaveLen(1))
+		Expect(listeners[portName]).ToNot(BeNil())
+		Expect(clusters[portName]).ToNot(BeNil())
 		Expect(endpoints[portName]).ToNot(BeNil())
 		Expect(endpoints[portName].String()).To(ContainSubstring(ip1))
 		Expect(endpoints[portName].String()).To(ContainSubstring(ip2))
 	})
+
+	When("the VirtualMachineService ports change", func() {
+		It("serves the new listeners with a new version", func() {
+			err := x.UpdateConfig(vmService, eps)
+			Expect(err).ToNot(HaveOccurred())
+			oldVersion := snapshotVersion(vmService, eps)
+
+			vmService.Generation++
+			vmService.Spec.Ports = append(vmService.Spec.Ports, vmopv1alpha1.VirtualMachineServicePort{
+				Protocol:   "TCP",
+				Port:       443,
+				TargetPort: 8443,
+			})
+
+			err = x.UpdateConfig(vmService, eps)
+			Expect(err).ToNot(HaveOccurred())
+
+			snapshot, err := x.snapshotCache.GetSnapshot(nodeID(vmService))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(snapshot.Consistent()).To(Succeed())
+			Expect(snapshot.GetVersion(resource.ListenerType)).ToNot(Equal(oldVersion))
+
+			listeners := snapshot.GetResources(resource.ListenerType)
+			Expect(listeners).To(HaveLen(2))
+			Expect(listeners).To(HaveKey("TCP-443"))
+		})
+	})
+
+	Context("tlsConfig()", func() {
+		It("renews the server certificate before it expires", func() {
+			x.client, _ = builder.NewFakeClient()
+			x.namespace = "vmop-ns"
+
+			config, err := x.tlsConfig(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+
+			cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+			Expect(err).ToNot(HaveOccurred())
+			sameCert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sameCert).To(BeIdenticalTo(cert))
+
+			// Pretend the server certificate is about to expire.
+			x.certNotAfter = time.Now().Add(time.Hour)
+			renewedCert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(renewedCert).ToNot(BeIdenticalTo(cert))
+			Expect(x.certNotAfter).To(BeTemporally(">", time.Now().Add(certRenewBefore)))
+		})
+	})
+
+	Context("nodeAuthorizer", func() {
+		var authorizer *nodeAuthorizer
+
+		peerContext := func(commonName string) context.Context {
+			return peer.NewContext(context.Background(), &peer.Peer{
+				AuthInfo: credentials.TLSInfo{
+					State: tls.ConnectionState{
+						VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}},
+					},
+				},
+			})
+		}
+		request := func(nodeID string) *envoy_service_discovery_v3.DiscoveryRequest {
+			return &envoy_service_discovery_v3.DiscoveryRequest{
+				Node: &envoy_config_core_v3.Node{Id: nodeID},
+			}
+		}
+
+		BeforeEach(func() {
+			authorizer = newNodeAuthorizer(logr_testing.NullLogger{})
+			vmService = &vmopv1alpha1.VirtualMachineService{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNs, Name: testSvc},
+			}
+		})
+
+		It("allows streams requesting the node ID of the client certificate", func() {
+			Expect(authorizer.OnStreamOpen(peerContext(nodeID(vmService)), 1, "")).To(Succeed())
+			Expect(authorizer.OnStreamRequest(1, request(nodeID(vmService)))).To(Succeed())
+		})
+
+		It("rejects streams requesting another node ID", func() {
+			Expect(authorizer.OnStreamOpen(peerContext("other-ns/other-svc"), 1, "")).To(Succeed())
+			Expect(authorizer.OnStreamRequest(1, request(nodeID(vmService)))).ToNot(Succeed())
+		})
+
+		It("rejects streams without a verified client certificate", func() {
+			Expect(authorizer.OnStreamOpen(context.Background(), 1, "")).ToNot(Succeed())
+			Expect(authorizer.OnStreamRequest(1, request(nodeID(vmService)))).ToNot(Succeed())
+		})
+
+		It("forgets the identity of closed streams", func() {
+			Expect(authorizer.OnStreamOpen(peerContext(nodeID(vmService)), 1, "")).To(Succeed())
+			authorizer.OnStreamClosed(1)
+			Expect(authorizer.OnStreamRequest(1, request(nodeID(vmService)))).ToNot(Succeed())
+		})
+
+		It("checks the node ID of fetch requests", func() {
+			Expect(authorizer.OnFetchRequest(peerContext(nodeID(vmService)), request(nodeID(vmService)))).To(Succeed())
+			Expect(authorizer.OnFetchRequest(peerContext("other-ns/other-svc"), request(nodeID(vmService)))).ToNot(Succeed())
+		})
+	})
 })
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2018-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package virtualmachineservice
@@ -32,6 +32,7 @@ import (
 
 	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/providers"
 	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachineservice/utils"
+	ncpv1alpha1 "github.com/vmware-tanzu/vm-operator/external/ncp/api/v1alpha1"
 	"github.com/vmware-tanzu/vm-operator/pkg"
 	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
 	"github.com/vmware-tanzu/vm-operator/pkg/context"
@@ -79,7 +80,7 @@ func AddToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) er
 		lbProvider,
 	)
 
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(controlledType).
 		WithOptions(controller.Options{MaxConcurrentReconciles: ctx.MaxConcurrentReconciles}).
 		Watches(&source.Kind{Type: &corev1.Service{}},
@@ -88,7 +89,19 @@ func AddToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) er
 			&handler.EnqueueRequestForOwner{OwnerType: &vmopv1alpha1.VirtualMachineService{}}).
 		Watches(&source.Kind{Type: &vmopv1alpha1.VirtualMachine{}},
 			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.virtualMachineToVirtualMachineServiceMapper)}).
-		Complete(r)
+		// Load balancer providers may create VirtualMachines, like the simple-lb VMs, that are owned
+		// by the VirtualMachineService and whose status is reported in the VirtualMachineService.
+		Watches(&source.Kind{Type: &vmopv1alpha1.VirtualMachine{}},
+			&handler.EnqueueRequestForOwner{OwnerType: &vmopv1alpha1.VirtualMachineService{}})
+
+	// The NSX-T load balancer is not ready while the VirtualNetworks of the selected VMs are not.
+	// The VirtualNetwork type only exists when NCP is installed.
+	if lbProviderType == providers.NSXTLoadBalancer {
+		builder = builder.Watches(&source.Kind{Type: &ncpv1alpha1.VirtualNetwork{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.virtualNetworkToVirtualMachineServiceMapper)})
+	}
+
+	return builder.Complete(r)
 }
 
 func NewReconciler(
@@ -125,6 +138,8 @@ type ReconcileVirtualMachineService struct {
 // +kubebuilder:rbac:groups=vmoperator.vmware.com,resources=virtualmachineservices/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=endpoints,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;create;update;delete
+// +kubebuilder:rbac:groups=vmware.com,resources=virtualnetworks,verbs=get;list;watch
 
 func (r *ReconcileVirtualMachineService) Reconcile(request reconcile.Request) (reconcile.Result, error) {
 	ctx := goctx.Background()
@@ -144,7 +159,7 @@ func (r *ReconcileVirtualMachineService) Reconcile(request reconcile.Request) (r
 		return reconcile.Result{}, r.ReconcileDelete(vmServiceCtx)
 	}
 
-	return reconcile.Result{}, r.ReconcileNormal(vmServiceCtx)
+	return r.ReconcileNormal(vmServiceCtx)
 }
 
 func (r *ReconcileVirtualMachineService) ReconcileDelete(ctx *context.VirtualMachineServiceContext) error {
@@ -161,23 +176,24 @@ func (r *ReconcileVirtualMachineService) ReconcileDelete(ctx *context.VirtualMac
 	return nil
 }
 
-func (r *ReconcileVirtualMachineService) ReconcileNormal(ctx *context.VirtualMachineServiceContext) error {
+func (r *ReconcileVirtualMachineService) ReconcileNormal(ctx *context.VirtualMachineServiceContext) (reconcile.Result, error) {
 	if !controllerutil.ContainsFinalizer(ctx.VMService, finalizerName) {
 		controllerutil.AddFinalizer(ctx.VMService, finalizerName)
 		if err := r.Update(ctx, ctx.VMService); err != nil {
-			return err
+			return reconcile.Result{}, err
 		}
 	}
 
-	if err := r.reconcileVmService(ctx); err != nil {
+	result, err := r.reconcileVmService(ctx)
+	if err != nil {
 		ctx.Logger.Error(err, "Failed to reconcile VirtualMachineService")
-		return err
+		return reconcile.Result{}, err
 	}
 
-	return nil
+	return result, nil
 }
 
-func (r *ReconcileVirtualMachineService) reconcileVmService(ctx *context.VirtualMachineServiceContext) error {
+func (r *ReconcileVirtualMachineService) reconcileVmService(ctx *context.VirtualMachineServiceContext) (reconcile.Result, error) {
 	ctx.Logger.Info("Reconcile VirtualMachineService")
 	defer ctx.Logger.Info("Finished Reconcile VirtualMachineService")
 
@@ -188,7 +204,7 @@ func (r *ReconcileVirtualMachineService) reconcileVmService(ctx *context.Virtual
 		err := r.loadbalancerProvider.EnsureLoadBalancer(ctx, vmService)
 		if err != nil {
 			ctx.Logger.Error(err, "Failed to create or get load balancer for VM Service")
-			return err
+			return reconcile.Result{}, err
 		}
 
 		// Get the provider specific annotations for service and add them to the VMService as
@@ -196,7 +212,7 @@ func (r *ReconcileVirtualMachineService) reconcileVmService(ctx *context.Virtual
 		annotations, err := r.loadbalancerProvider.GetServiceAnnotations(ctx, ctx.VMService)
 		if err != nil {
 			ctx.Logger.Error(err, "Failed to get loadbalancer annotations for service")
-			return err
+			return reconcile.Result{}, err
 		}
 
 		if vmService.Annotations == nil {
@@ -217,7 +233,7 @@ func (r *ReconcileVirtualMachineService) reconcileVmService(ctx *context.Virtual
 		labels, err := r.loadbalancerProvider.GetServiceLabels(ctx, ctx.VMService)
 		if err != nil {
 			ctx.Logger.Error(err, "Failed to get loadbalancer labels for service")
-			return err
+			return reconcile.Result{}, err
 		}
 
 		if vmService.Labels == nil {
@@ -237,24 +253,55 @@ func (r *ReconcileVirtualMachineService) reconcileVmService(ctx *context.Virtual
 	newService, err := r.CreateOrUpdateService(ctx)
 	if err != nil {
 		ctx.Logger.Error(err, "Failed to update k8s Service for VirtualMachineService")
-		return err
+		return reconcile.Result{}, err
 	}
 
 	// Update VirtualMachineService endpoints
 	err = r.UpdateEndpoints(ctx, newService)
 	if err != nil {
 		ctx.Logger.Error(err, "Failed to update VirtualMachineService endpoints")
-		return err
+		return reconcile.Result{}, err
 	}
 
 	// Update VirtualMachineService resource
 	err = r.UpdateVmService(ctx, newService)
 	if err != nil {
 		ctx.Logger.Error(err, "Failed to update VirtualMachineService Status")
-		return err
+		return reconcile.Result{}, err
 	}
 
-	return nil
+	// Report the progress of the load balancer, if the provider can
+	if statusReconciler, ok := r.loadbalancerProvider.(providers.LoadBalancerStatusReconciler); ok &&
+		vmService.Spec.Type == vmopv1alpha1.VirtualMachineServiceTypeLoadBalancer {
+		requeueAfter, err := statusReconciler.ReconcileLoadBalancerStatus(ctx, r.Client, r.recorder, vmService, newService)
+		if err != nil {
+			ctx.Logger.Error(err, "Failed to reconcile load balancer status")
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// For a given VirtualNetwork, return reconcile requests for the LoadBalancer VirtualMachineServices in its namespace.
+func (r *ReconcileVirtualMachineService) virtualNetworkToVirtualMachineServiceMapper(o handler.MapObject) []reconcile.Request {
+	var reconcileRequests []reconcile.Request
+
+	vmServiceList := &vmopv1alpha1.VirtualMachineServiceList{}
+	if err := r.List(goctx.Background(), vmServiceList, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		return reconcileRequests
+	}
+
+	for _, vmService := range vmServiceList.Items {
+		if vmService.Spec.Type != vmopv1alpha1.VirtualMachineServiceTypeLoadBalancer {
+			continue
+		}
+		reconcileRequests = append(reconcileRequests,
+			reconcile.Request{NamespacedName: types.NamespacedName{Namespace: vmService.Namespace, Name: vmService.Name}})
+	}
+
+	return reconcileRequests
 }
 
 // For a given VM, determine which vmServices select that VM via label selector and return a set of reconcile requests
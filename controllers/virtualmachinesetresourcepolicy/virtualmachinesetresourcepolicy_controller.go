@@ -170,5 +170,15 @@ func (r *VirtualMachineSetResourcePolicyReconciler) Reconcile(req ctrl.Request)
 		return ctrl.Result{}, r.ReconcileDelete(rpCtx)
 	}
 
-	return ctrl.Result{}, r.ReconcileNormal(rpCtx)
+	if err := r.ReconcileNormal(rpCtx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The hosts of the VM groups with a host policy depend on the vSphere host tags, which are not
+	// watched.
+	if vmprovider.HasVMHostGroups(rp) {
+		return ctrl.Result{RequeueAfter: vmprovider.VMHostGroupsRefreshPeriod}, nil
+	}
+
+	return ctrl.Result{}, nil
 }
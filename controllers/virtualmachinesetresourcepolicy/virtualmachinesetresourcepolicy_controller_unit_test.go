@@ -12,11 +12,14 @@ import (
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
 
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
 	"github.com/vmware-tanzu/vm-operator/controllers/virtualmachinesetresourcepolicy"
 	"github.com/vmware-tanzu/vm-operator/pkg/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	providerfake "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/fake"
 	"github.com/vmware-tanzu/vm-operator/test/builder"
 )
@@ -92,6 +95,38 @@ func unitTestsReconcile() {
 		})
 	})
 
+	Context("Reconcile", func() {
+		BeforeEach(func() {
+			resourcePolicy.Finalizers = []string{finalizer}
+			initObjects = append(initObjects, resourcePolicy)
+		})
+
+		reconcile := func() ctrl.Result {
+			result, err := reconciler.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{
+				Namespace: resourcePolicy.Namespace,
+				Name:      resourcePolicy.Name,
+			}})
+			Expect(err).NotTo(HaveOccurred())
+			return result
+		}
+
+		It("will not requeue the ResourcePolicy", func() {
+			Expect(reconcile().RequeueAfter).To(BeZero())
+		})
+
+		When("the ResourcePolicy has a VM group with a host policy", func() {
+			BeforeEach(func() {
+				resourcePolicy.Annotations = map[string]string{
+					vmprovider.VMGroupsAnnotationKey: `[{"name": "licensed", "policy": "HostAffinity", "hostTag": "licensed"}]`,
+				}
+			})
+
+			It("will requeue the ResourcePolicy to refresh the hosts of the group", func() {
+				Expect(reconcile().RequeueAfter).To(Equal(vmprovider.VMHostGroupsRefreshPeriod))
+			})
+		})
+	})
+
 	Context("ReconcileDelete", func() {
 		BeforeEach(func() {
 			initObjects = append(initObjects, resourcePolicy)
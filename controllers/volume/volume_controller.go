@@ -11,9 +11,11 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	k8serrors "k8s.io/apimachinery/pkg/util/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -27,15 +29,21 @@ import (
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
 	cnsv1alpha1 "github.com/vmware-tanzu/vm-operator/external/vsphere-csi-driver/pkg/syncer/cnsoperator/apis/cnsnodevmattachment/v1alpha1"
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
 	"github.com/vmware-tanzu/vm-operator/pkg/context"
 	"github.com/vmware-tanzu/vm-operator/pkg/patch"
 	"github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 )
 
 const (
 	AttributeFirstClassDiskUUID = "diskUUID"
 )
 
+// persistentVolumeClaimNameField is the field index of the VirtualMachines by the names of the PersistentVolumeClaims
+// of their volumes.
+const persistentVolumeClaimNameField = "spec.volumes.persistentVolumeClaim.claimName"
+
 // AddToManager adds this package's controller to the provided manager.
 func AddToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) error {
 	var (
@@ -49,8 +57,17 @@ func AddToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) er
 		ctrl.Log.WithName("controllers").WithName("volume"),
 		record.New(mgr.GetEventRecorderFor(controllerNameLong)),
 		mgr.GetScheme(),
+		ctx.VmProvider,
 	)
 
+	// Index the VirtualMachines by the claims of their volumes, so that the VirtualMachines of a
+	// PersistentVolumeClaim are listed without listing every VirtualMachine of its namespace.
+	err := mgr.GetFieldIndexer().IndexField(&vmopv1alpha1.VirtualMachine{}, persistentVolumeClaimNameField,
+		virtualMachinePersistentVolumeClaimNames)
+	if err != nil {
+		return err
+	}
+
 	c, err := controller.New(controllerName, mgr, controller.Options{
 		Reconciler:              r,
 		MaxConcurrentReconciles: ctx.MaxConcurrentReconciles,
@@ -74,6 +91,15 @@ func AddToManager(ctx *context.ControllerManagerContext, mgr manager.Manager) er
 		return err
 	}
 
+	// Watch for changes for PersistentVolumeClaim, and enqueue the VirtualMachines with a volume backed by it, so
+	// that the progress of its resize is reported.
+	err = c.Watch(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(r.persistentVolumeClaimToVirtualMachineMapper),
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -81,13 +107,15 @@ func NewReconciler(
 	client client.Client,
 	logger logr.Logger,
 	recorder record.Recorder,
-	scheme *runtime.Scheme) *VolumeReconciler {
+	scheme *runtime.Scheme,
+	vmProvider vmprovider.VirtualMachineProviderInterface) *VolumeReconciler {
 
 	return &VolumeReconciler{
-		Client:   client,
-		logger:   logger,
-		recorder: recorder,
-		scheme:   scheme,
+		Client:     client,
+		logger:     logger,
+		recorder:   recorder,
+		scheme:     scheme,
+		vmProvider: vmProvider,
 	}
 }
 
@@ -95,15 +123,17 @@ var _ reconcile.Reconciler = &VolumeReconciler{}
 
 type VolumeReconciler struct {
 	client.Client
-	logger   logr.Logger
-	recorder record.Recorder
-	scheme   *runtime.Scheme
+	logger     logr.Logger
+	recorder   record.Recorder
+	scheme     *runtime.Scheme
+	vmProvider vmprovider.VirtualMachineProviderInterface
 }
 
 // +kubebuilder:rbac:groups=vmoperator.vmware.com,resources=virtualmachines,verbs=get;list;watch;
 // +kubebuilder:rbac:groups=vmoperator.vmware.com,resources=virtualmachines/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=cns.vmware.com,resources=cnsnodevmattachments,verbs=create;delete;get;list;watch;patch;update
 // +kubebuilder:rbac:groups=cns.vmware.com,resources=cnsnodevmattachments/status,verbs=get;list
+// +kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch
 
 // Reconcile reconciles a VirtualMachine object and processes the volumes for attach/detach.
 // Longer term, this should be folded back into the VirtualMachine controller, but exists as
@@ -189,7 +219,13 @@ func (r *VolumeReconciler) ReconcileNormal(ctx *context.VolumeContext) error {
 		// Keep going to return aggregated error below.
 	}
 
-	return k8serrors.NewAggregate([]error{deleteErr, processErr})
+	// The devices of the volumes are recorded once their attachments are processed.
+	devicesErr := r.updateVolumeDevices(ctx)
+	if devicesErr != nil {
+		ctx.Logger.Error(devicesErr, "Error getting the devices of the attached volumes")
+	}
+
+	return k8serrors.NewAggregate([]error{deleteErr, processErr, devicesErr})
 }
 
 // Return the existing CnsNodeVmAttachments that are for this VM.
@@ -226,14 +262,26 @@ func (r *VolumeReconciler) processAttachments(
 	orphanedAttachments []cnsv1alpha1.CnsNodeVmAttachment) error {
 
 	var volumeStatus []vmopv1alpha1.VirtualMachineVolumeStatus
+	var resizeStatus []vmprovider.VolumeResizeStatus
 	var createErrs []error
 
+	ordered, err := vmprovider.IsOrderedVolumeAttachment(ctx.VM)
+	if err != nil {
+		// The webhook validates the annotation so this is not expected.
+		ctx.Logger.Error(err, "Ignoring invalid ordered volume attachment annotation")
+	}
+
 	// Use Spec.Volumes order when attaching as a best effort to preserve spec order. There
 	// is no guarantee order will be preserved however, as the CNS attachment controller may
 	// not receive/process the requests in order. The nuclear option would be for us to only
-	// have one pending volume attachment outstanding per VM at a time.
+	// have one pending volume attachment outstanding per VM at a time: this is what the
+	// ordered mode does, for the VMs that opt in.
 	// Create() errors below may also result in attachments being out of the original spec
 	// order.
+	attachmentPending := false
+	// The first volume that is not attached yet, and the error of its attachment if any: in ordered mode, the next
+	// volumes wait for it.
+	var pendingVolume, pendingError string
 	for _, volume := range ctx.VM.Spec.Volumes {
 		if volume.PersistentVolumeClaim == nil {
 			// Don't process VsphereVolumes here. Note that we don't have Volume status
@@ -249,11 +297,36 @@ func (r *VolumeReconciler) processAttachments(
 			// Also, the CNS attachment controller doesn't reconcile Spec changes once the volume
 			// is attached.
 			volumeStatus = append(volumeStatus, attachmentToVolumeStatus(volume.Name, attachment))
+			if status := r.attachmentResizeStatus(ctx, volume.Name, attachment); status != nil {
+				resizeStatus = append(resizeStatus, *status)
+			}
+			if !attachment.Status.Attached {
+				if !attachmentPending {
+					pendingVolume, pendingError = volume.Name, sanitizeCNSErrorMessage(attachment.Status.Error)
+				}
+				attachmentPending = true
+			}
+			continue
+		}
+
+		if ordered && attachmentPending {
+			// Wait for the previous volumes to be attached before attaching this one. We'll create its
+			// attachment on a later reconcile after the CNS attachment controller updates theirs.
+			ctx.Logger.V(4).Info("Deferring volume attachment until the previous volumes are attached", "volume", volume.Name)
+			volumeStatus = append(volumeStatus, vmopv1alpha1.VirtualMachineVolumeStatus{Name: volume.Name})
 			continue
 		}
 
+		if !attachmentPending {
+			pendingVolume = volume.Name
+		}
+		attachmentPending = true
 		if err := r.createCNSAttachment(ctx, attachmentName, volume); err != nil {
-			createErrs = append(createErrs, errors.Wrap(err, "Cannot create CnsNodeVmAttachment"))
+			err = errors.Wrap(err, "Cannot create CnsNodeVmAttachment")
+			createErrs = append(createErrs, err)
+			if pendingVolume == volume.Name {
+				pendingError = err.Error()
+			}
 		} else {
 			// Add a placeholder Status entry for this volume. We'll populate it fully on a later
 			// reconcile after the CNS attachment controller updates it.
@@ -265,15 +338,156 @@ func (r *VolumeReconciler) processAttachments(
 	// still exist are included in the Status. This is more than a little odd.
 	volumeStatus = append(volumeStatus, r.preserveOrphanedAttachmentStatus(ctx, orphanedAttachments)...)
 
-	// This is how the previous code sorted, but IMO keeping in Spec order makes more sense.
-	sort.Slice(volumeStatus, func(i, j int) bool {
-		return volumeStatus[i].DiskUuid < volumeStatus[j].DiskUuid
-	})
+	// This is how the previous code sorted, but IMO keeping in Spec order makes more sense: the
+	// ordered mode does.
+	if !ordered {
+		sort.Slice(volumeStatus, func(i, j int) bool {
+			return volumeStatus[i].DiskUuid < volumeStatus[j].DiskUuid
+		})
+	}
 	ctx.VM.Status.Volumes = volumeStatus
+	vmprovider.SetVolumeResizeStatus(ctx.VM, resizeStatus)
+
+	if ordered {
+		r.updateOrderedVolumeAttachmentCondition(ctx, pendingVolume, pendingError)
+	} else {
+		conditions.Delete(ctx.VM, vmprovider.VirtualMachineOrderedVolumeAttachmentReadyCondition)
+	}
 
 	return k8serrors.NewAggregate(createErrs)
 }
 
+// updateOrderedVolumeAttachmentCondition reports the volume the attachment of the next volumes of a VM with ordered
+// volume attachment waits for. A failed attachment blocks the next volumes until it succeeds, so it is reported as a
+// warning, and as an event the first time.
+func (r *VolumeReconciler) updateOrderedVolumeAttachmentCondition(
+	ctx *context.VolumeContext,
+	pendingVolume string,
+	pendingError string) {
+
+	condition := vmprovider.VirtualMachineOrderedVolumeAttachmentReadyCondition
+
+	switch {
+	case pendingVolume == "":
+		conditions.MarkTrue(ctx.VM, condition)
+
+	case pendingError == "":
+		conditions.MarkFalse(ctx.VM, condition, vmprovider.VolumeAttachmentPendingReason, vmopv1alpha1.ConditionSeverityInfo,
+			"volume %s is being attached, the next volumes are attached once it is", pendingVolume)
+
+	default:
+		wasBlocked := conditions.GetReason(ctx.VM, condition) == vmprovider.VolumeAttachmentBlockedReason
+		conditions.MarkFalse(ctx.VM, condition, vmprovider.VolumeAttachmentBlockedReason, vmopv1alpha1.ConditionSeverityWarning,
+			"attachment of volume %s failed, the next volumes are not attached until it succeeds: %s", pendingVolume, pendingError)
+		if !wasBlocked {
+			r.recorder.Warnf(ctx.VM, vmprovider.VolumeAttachmentBlockedReason, "%s", conditions.GetMessage(ctx.VM, condition))
+		}
+	}
+}
+
+// updateVolumeDevices records the controller and unit number of the disks of the attached volumes of the VM. The
+// devices are only fetched from the provider when the attached volumes changed, since the disk of an attached volume
+// does not move.
+func (r *VolumeReconciler) updateVolumeDevices(ctx *context.VolumeContext) error {
+	devices := vmprovider.GetVolumeDevices(ctx.VM)
+
+	numAttached := 0
+	changed := false
+	for _, volume := range ctx.VM.Status.Volumes {
+		if !volume.Attached || volume.DiskUuid == "" {
+			continue
+		}
+		numAttached++
+		if _, ok := devices[volume.Name]; !ok {
+			changed = true
+		}
+	}
+	if !changed && numAttached == len(devices) {
+		return nil
+	}
+
+	if numAttached == 0 {
+		vmprovider.SetVolumeDevices(ctx.VM, nil)
+		return nil
+	}
+
+	devices, err := r.vmProvider.GetVirtualMachineVolumeDevices(ctx, ctx.VM)
+	if err != nil {
+		return err
+	}
+	vmprovider.SetVolumeDevices(ctx.VM, devices)
+	return nil
+}
+
+// attachmentResizeStatus returns the resize status of the attached volume, or nil if it is not being resized. The
+// CnsNodeVmAttachment does not report resizes: the CSI resizer reports their progress in the conditions of the
+// PersistentVolumeClaim of the attachment.
+func (r *VolumeReconciler) attachmentResizeStatus(
+	ctx *context.VolumeContext,
+	volumeName string,
+	attachment cnsv1alpha1.CnsNodeVmAttachment) *vmprovider.VolumeResizeStatus {
+
+	if !attachment.Status.Attached {
+		return nil
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	key := client.ObjectKey{Name: attachment.Spec.VolumeName, Namespace: attachment.Namespace}
+	if err := r.Get(ctx, key, pvc); err != nil {
+		if !apiErrors.IsNotFound(err) {
+			ctx.Logger.Error(err, "Error getting PersistentVolumeClaim of CnsNodeVmAttachment",
+				"attachment", attachment.Name, "claim", attachment.Spec.VolumeName)
+		}
+		return nil
+	}
+
+	return vmprovider.GetPersistentVolumeClaimResizeStatus(volumeName, pvc)
+}
+
+// virtualMachinePersistentVolumeClaimNames returns the names of the PersistentVolumeClaims of the volumes of the
+// VirtualMachine, for the persistentVolumeClaimNameField index.
+func virtualMachinePersistentVolumeClaimNames(o runtime.Object) []string {
+	vm, ok := o.(*vmopv1alpha1.VirtualMachine)
+	if !ok {
+		return nil
+	}
+
+	var claimNames []string
+	for _, volume := range vm.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claimNames = append(claimNames, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	return claimNames
+}
+
+// persistentVolumeClaimToVirtualMachineMapper returns the reconcile requests of the VirtualMachines with a volume
+// backed by the PersistentVolumeClaim.
+func (r *VolumeReconciler) persistentVolumeClaimToVirtualMachineMapper(o handler.MapObject) []reconcile.Request {
+	var reconcileRequests []reconcile.Request
+
+	vmList := &vmopv1alpha1.VirtualMachineList{}
+	err := r.List(goctx.Background(), vmList, client.InNamespace(o.Meta.GetNamespace()),
+		client.MatchingFields{persistentVolumeClaimNameField: o.Meta.GetName()})
+	if err != nil {
+		r.logger.Error(err, "Failed to list VirtualMachines for PersistentVolumeClaim watch",
+			"namespace", o.Meta.GetNamespace(), "name", o.Meta.GetName())
+		return reconcileRequests
+	}
+
+	for _, vm := range vmList.Items {
+		for _, volume := range vm.Spec.Volumes {
+			if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == o.Meta.GetName() {
+				reconcileRequests = append(reconcileRequests,
+					reconcile.Request{NamespacedName: types.NamespacedName{Namespace: vm.Namespace, Name: vm.Name}})
+				break
+			}
+		}
+	}
+
+	return reconcileRequests
+}
+
 func (r *VolumeReconciler) createCNSAttachment(
 	ctx *context.VolumeContext,
 	attachmentName string,
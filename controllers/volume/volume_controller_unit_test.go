@@ -4,11 +4,14 @@
 package volume_test
 
 import (
+	goctx "context"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -17,7 +20,10 @@ import (
 
 	"github.com/vmware-tanzu/vm-operator/controllers/volume"
 	cnsv1alpha1 "github.com/vmware-tanzu/vm-operator/external/vsphere-csi-driver/pkg/syncer/cnsoperator/apis/cnsnodevmattachment/v1alpha1"
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
 	volContext "github.com/vmware-tanzu/vm-operator/pkg/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	providerfake "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/fake"
 	"github.com/vmware-tanzu/vm-operator/test/builder"
 )
 
@@ -86,6 +92,7 @@ func unitTestsReconcile() {
 			ctx.Logger,
 			ctx.Recorder,
 			ctx.Scheme,
+			ctx.VmProvider,
 		)
 
 		volCtx = &volContext.VolumeContext{
@@ -274,6 +281,75 @@ FaultMessage: ([]types.LocalizableMessage) \u003cnil\u003e\\n }\\n },\\n Type: (
 			})
 		})
 
+		When("VM Spec.Volumes has CNS volume being resized", func() {
+			var pvc *corev1.PersistentVolumeClaim
+
+			BeforeEach(func() {
+				vmVol = *vmVolumeWithPVC1
+				vm.Spec.Volumes = append(vm.Spec.Volumes, vmVol)
+
+				attachment = cnsAttachmentForVMVolume(vm, vmVol)
+				attachment.Status.Attached = true
+				attachment.Status.AttachmentMetadata = map[string]string{
+					volume.AttributeFirstClassDiskUUID: dummyDiskUUID,
+				}
+
+				pvc = &corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      vmVol.PersistentVolumeClaim.ClaimName,
+						Namespace: vm.Namespace,
+					},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("20Gi")},
+						},
+					},
+					Status: corev1.PersistentVolumeClaimStatus{
+						Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+						Conditions: []corev1.PersistentVolumeClaimCondition{
+							{
+								Type:    corev1.PersistentVolumeClaimResizing,
+								Status:  corev1.ConditionTrue,
+								Message: "resizing",
+							},
+						},
+					},
+				}
+				initObjects = append(initObjects, attachment, pvc)
+			})
+
+			It("returns success", func() {
+				err := reconciler.ReconcileNormal(volCtx)
+				Expect(err).ToNot(HaveOccurred())
+
+				By("Expected VM volume resize status", func() {
+					resizeStatus := vmprovider.GetVolumeResizeStatus(vm)
+					Expect(resizeStatus).To(HaveLen(1))
+					Expect(resizeStatus[0].Name).To(Equal(vmVol.Name))
+					Expect(resizeStatus[0].State).To(Equal(vmprovider.VolumeResizeInProgress))
+					Expect(resizeStatus[0].Message).To(Equal("resizing"))
+					Expect(resizeStatus[0].Capacity.String()).To(Equal("10Gi"))
+					Expect(resizeStatus[0].RequestedCapacity.String()).To(Equal("20Gi"))
+				})
+			})
+
+			When("the resize is complete", func() {
+				BeforeEach(func() {
+					pvc.Status.Capacity = pvc.Spec.Resources.Requests
+					pvc.Status.Conditions = nil
+					vmprovider.SetVolumeResizeStatus(vm, []vmprovider.VolumeResizeStatus{
+						{Name: vmVol.Name, State: vmprovider.VolumeResizeInProgress},
+					})
+				})
+
+				It("returns success", func() {
+					err := reconciler.ReconcileNormal(volCtx)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(vm.Annotations).ToNot(HaveKey(vmprovider.VolumeResizeStatusAnnotationKey))
+				})
+			})
+		})
+
 		When("VM has orphaned CNS volume in Status.Volumes", func() {
 			BeforeEach(func() {
 				vmVol = *vmVolumeWithPVC1
@@ -376,6 +452,139 @@ FaultMessage: ([]types.LocalizableMessage) \u003cnil\u003e\\n }\\n },\\n Type: (
 				})
 			})
 		})
+
+		When("VM has ordered volume attachment", func() {
+			var vmVol1 vmopv1alpha1.VirtualMachineVolume
+			var vmVol2 vmopv1alpha1.VirtualMachineVolume
+
+			BeforeEach(func() {
+				vmVol1 = *vmVolumeWithPVC1
+				vmVol2 = *vmVolumeWithPVC2
+				vm.Spec.Volumes = append(vm.Spec.Volumes, vmVol1, vmVol2)
+				vm.Annotations = map[string]string{vmprovider.OrderedVolumeAttachmentAnnotationKey: "true"}
+			})
+
+			When("no CnsNodeVmAttachments exist", func() {
+				It("only creates the CnsNodeVmAttachment of the first volume", func() {
+					err := reconciler.ReconcileNormal(volCtx)
+					Expect(err).ToNot(HaveOccurred())
+
+					attachment1 := getCNSAttachmentForVolumeName(vm, vmVol1.Name)
+					Expect(attachment1).ToNot(BeNil())
+					assertAttachmentSpecFromVmVol(vm, vmVol1, attachment1)
+					Expect(getCNSAttachmentForVolumeName(vm, vmVol2.Name)).To(BeNil())
+
+					By("VM Status.Volumes are in Spec.Volumes order", func() {
+						Expect(vm.Status.Volumes).To(HaveLen(2))
+						Expect(vm.Status.Volumes[0].Name).To(Equal(vmVol1.Name))
+						Expect(vm.Status.Volumes[1].Name).To(Equal(vmVol2.Name))
+						Expect(vm.Status.Volumes[1].Attached).To(BeFalse())
+					})
+
+					By("reporting the volume being attached", func() {
+						condition := vmprovider.VirtualMachineOrderedVolumeAttachmentReadyCondition
+						Expect(conditions.GetReason(vm, condition)).To(Equal(vmprovider.VolumeAttachmentPendingReason))
+						Expect(conditions.GetMessage(vm, condition)).To(ContainSubstring(vmVol1.Name))
+					})
+				})
+			})
+
+			When("the CnsNodeVmAttachment of the first volume failed", func() {
+				BeforeEach(func() {
+					attachment1 := cnsAttachmentForVMVolume(vm, vmVol1)
+					attachment1.Status.Error = "dummy-error"
+					initObjects = append(initObjects, attachment1)
+				})
+
+				It("reports that the first volume blocks the attachment of the second volume", func() {
+					err := reconciler.ReconcileNormal(volCtx)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(getCNSAttachmentForVolumeName(vm, vmVol2.Name)).To(BeNil())
+
+					condition := vmprovider.VirtualMachineOrderedVolumeAttachmentReadyCondition
+					Expect(conditions.GetReason(vm, condition)).To(Equal(vmprovider.VolumeAttachmentBlockedReason))
+					Expect(conditions.GetMessage(vm, condition)).To(ContainSubstring(vmVol1.Name))
+					Expect(conditions.GetMessage(vm, condition)).To(ContainSubstring("dummy-error"))
+					Expect(ctx.Events).To(Receive(HavePrefix("Warning " + vmprovider.VolumeAttachmentBlockedReason)))
+
+					By("reporting the event only once", func() {
+						Expect(reconciler.ReconcileNormal(volCtx)).To(Succeed())
+						Expect(ctx.Events).ToNot(Receive())
+					})
+				})
+			})
+
+			When("the CnsNodeVmAttachment of the first volume is attached", func() {
+				BeforeEach(func() {
+					attachment1 := cnsAttachmentForVMVolume(vm, vmVol1)
+					attachment1.Status.Attached = true
+					attachment1.Status.AttachmentMetadata = map[string]string{
+						volume.AttributeFirstClassDiskUUID: "z",
+					}
+					initObjects = append(initObjects, attachment1)
+				})
+
+				It("creates the CnsNodeVmAttachment of the second volume", func() {
+					err := reconciler.ReconcileNormal(volCtx)
+					Expect(err).ToNot(HaveOccurred())
+
+					attachment2 := getCNSAttachmentForVolumeName(vm, vmVol2.Name)
+					Expect(attachment2).ToNot(BeNil())
+					assertAttachmentSpecFromVmVol(vm, vmVol2, attachment2)
+				})
+			})
+
+			When("CnsNodeVmAttachments have DiskUUID set", func() {
+				var attachment1, attachment2 *cnsv1alpha1.CnsNodeVmAttachment
+
+				BeforeEach(func() {
+					attachment1 = cnsAttachmentForVMVolume(vm, vmVol1)
+					attachment1.Status.Attached = true
+					attachment1.Status.AttachmentMetadata = map[string]string{
+						volume.AttributeFirstClassDiskUUID: "z",
+					}
+
+					attachment2 = cnsAttachmentForVMVolume(vm, vmVol2)
+					attachment2.Status.Attached = true
+					attachment2.Status.AttachmentMetadata = map[string]string{
+						volume.AttributeFirstClassDiskUUID: "a",
+					}
+
+					initObjects = append(initObjects, attachment1, attachment2)
+				})
+
+				It("keeps VM Status.Volumes in Spec.Volumes order", func() {
+					err := reconciler.ReconcileNormal(volCtx)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(vm.Status.Volumes).To(HaveLen(2))
+					assertVmVolStatusFromAttachment(vmVol1, attachment1, vm.Status.Volumes[0])
+					assertVmVolStatusFromAttachment(vmVol2, attachment2, vm.Status.Volumes[1])
+					Expect(conditions.IsTrue(vm, vmprovider.VirtualMachineOrderedVolumeAttachmentReadyCondition)).To(BeTrue())
+				})
+
+				It("records the devices of the attached volumes", func() {
+					devices := map[string]vmprovider.VolumeDevice{
+						vmVol1.Name: {ControllerType: "SCSI", UnitNumber: 1},
+						vmVol2.Name: {ControllerType: "SCSI", UnitNumber: 2},
+					}
+					numCalls := 0
+					fakeVmProvider := ctx.VmProvider.(*providerfake.FakeVmProvider)
+					fakeVmProvider.GetVirtualMachineVolumeDevicesFn = func(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine) (map[string]vmprovider.VolumeDevice, error) {
+						numCalls++
+						return devices, nil
+					}
+
+					Expect(reconciler.ReconcileNormal(volCtx)).To(Succeed())
+					Expect(vmprovider.GetVolumeDevices(vm)).To(Equal(devices))
+
+					By("not getting the devices again while the attached volumes are the same", func() {
+						Expect(reconciler.ReconcileNormal(volCtx)).To(Succeed())
+						Expect(numCalls).To(Equal(1))
+					})
+				})
+			})
+		})
 	})
 
 	Context("ReconcileDelete", func() {
@@ -38,6 +38,10 @@ var (
 
 	defaultSyncPeriod                   = manager.DefaultSyncPeriod
 	defaultMaxConcurrentReconciles      = manager.DefaultMaxConcurrentReconciles
+	defaultMaxConcurrentProbes          = manager.DefaultMaxConcurrentProbes
+	defaultOrphanedVMGCPeriod           = manager.DefaultOrphanedVMGCPeriod
+	defaultOrphanedVMGCGracePeriod      = manager.DefaultOrphanedVMGCGracePeriod
+	defaultOrphanedVMGCDelete           = manager.DefaultOrphanedVMGCDelete
 	defaultLeaderElectionID             = manager.DefaultLeaderElectionID
 	defaultPodNamespace                 = manager.DefaultPodNamespace
 	defaultPodName                      = manager.DefaultPodName
@@ -75,6 +79,18 @@ func init() {
 	if v, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_RECONCILES")); err == nil {
 		defaultMaxConcurrentReconciles = v
 	}
+	if v, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_PROBES")); err == nil {
+		defaultMaxConcurrentProbes = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("ORPHANED_VM_GC_PERIOD")); err == nil {
+		defaultOrphanedVMGCPeriod = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("ORPHANED_VM_GC_GRACE_PERIOD")); err == nil {
+		defaultOrphanedVMGCGracePeriod = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("ORPHANED_VM_GC_DELETE")); err == nil {
+		defaultOrphanedVMGCDelete = v
+	}
 	if v := os.Getenv("LEADER_ELECTION_ID"); v != "" {
 		defaultLeaderElectionID = v
 	}
@@ -161,6 +177,26 @@ func main() {
 		"max-concurrent-reconciles",
 		defaultMaxConcurrentReconciles,
 		"The maximum number of allowed, concurrent reconciles.")
+	flag.IntVar(
+		&managerOpts.MaxConcurrentProbes,
+		"max-concurrent-probes",
+		defaultMaxConcurrentProbes,
+		"The maximum number of VirtualMachine readiness probes run concurrently.")
+	flag.DurationVar(
+		&managerOpts.OrphanedVMGCPeriod,
+		"orphaned-vm-gc-period",
+		defaultOrphanedVMGCPeriod,
+		"The interval at which VMs that are not backed by a VirtualMachine are looked for. A negative value disables the garbage collector.")
+	flag.DurationVar(
+		&managerOpts.OrphanedVMGCGracePeriod,
+		"orphaned-vm-gc-grace-period",
+		defaultOrphanedVMGCGracePeriod,
+		"How long a VM must not be backed by a VirtualMachine before it is deleted.")
+	flag.BoolVar(
+		&managerOpts.OrphanedVMGCDelete,
+		"orphaned-vm-gc-delete",
+		defaultOrphanedVMGCDelete,
+		"Delete the VMs that are not backed by a VirtualMachine after the grace period, instead of only reporting them.")
 	flag.StringVar(
 		&managerOpts.PodNamespace,
 		"pod-namespace",
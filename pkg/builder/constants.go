@@ -5,4 +5,8 @@ package builder
 
 const (
 	AdmitMesgUpdateOnDeleting = "Update is allowed during deletion in order to remove the finalizers."
+
+	// ServiceAccountName is the name of the service account that VM Operator runs as, in the
+	// namespace of the controller manager.
+	ServiceAccountName = "default"
 )
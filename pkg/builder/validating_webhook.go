@@ -50,6 +50,13 @@ type Validator interface {
 	ValidateUpdate(*context.WebhookRequestContext) admission.Response
 }
 
+// DeletingObjectValidator is implemented by the Validators that validate the updates of the
+// objects being deleted, which are allowed otherwise.
+type DeletingObjectValidator interface {
+	// ValidateUpdateOnDeleting returns nil if the update of the object being deleted is valid.
+	ValidateUpdateOnDeleting(*context.WebhookRequestContext) admission.Response
+}
+
 type ValidatorFunc func(client client.Client) Validator
 
 // NewValidatingWebhook returns a new admissions webhook for validating requests.
@@ -92,9 +99,10 @@ func NewValidatingWebhook(
 		Path: webhookPath,
 		Webhook: webhook.Admission{
 			Handler: &validatingWebhookHandler{
-				WebhookContext: webhookContext,
-				Decoder:        decoder,
-				Validator:      validator,
+				WebhookContext:     webhookContext,
+				Decoder:            decoder,
+				Validator:          validator,
+				privilegedUsername: serviceAccountUsername(ctx.Namespace, ServiceAccountName),
 			},
 		},
 	}, nil
@@ -106,6 +114,9 @@ type validatingWebhookHandler struct {
 	*context.WebhookContext
 	*admission.Decoder
 	Validator
+
+	// privilegedUsername is the username of the service account of VM Operator.
+	privilegedUsername string
 }
 
 func (h *validatingWebhookHandler) Handle(_ goctx.Context, req admission.Request) admission.Response {
@@ -149,10 +160,12 @@ func (h *validatingWebhookHandler) Handle(_ goctx.Context, req admission.Request
 
 	// Create the webhook request context.
 	webhookRequestContext := &context.WebhookRequestContext{
-		WebhookContext: h.WebhookContext,
-		Obj:            obj,
-		OldObj:         oldObj,
-		Logger:         h.WebhookContext.Logger.WithName(obj.GetNamespace()).WithName(obj.GetName()),
+		WebhookContext:      h.WebhookContext,
+		Obj:                 obj,
+		OldObj:              oldObj,
+		UserInfo:            req.UserInfo,
+		IsPrivilegedAccount: req.UserInfo.Username == h.privilegedUsername,
+		Logger:              h.WebhookContext.Logger.WithName(obj.GetNamespace()).WithName(obj.GetName()),
 	}
 
 	return h.HandleValidate(req, webhookRequestContext)
@@ -167,6 +180,9 @@ func (h *validatingWebhookHandler) HandleValidate(req admission.Request, ctx *co
 		// Allow the Patch/Update requests if the object is under deletion. This eliminates queueing objects
 		// due to reconcile failures.
 		if !ctx.Obj.GetDeletionTimestamp().IsZero() {
+			if v, ok := h.Validator.(DeletingObjectValidator); ok {
+				return v.ValidateUpdateOnDeleting(ctx)
+			}
 			return admission.Allowed(AdmitMesgUpdateOnDeleting)
 		}
 		return h.ValidateUpdate(ctx)
@@ -177,6 +193,12 @@ func (h *validatingWebhookHandler) HandleValidate(req admission.Request, ctx *co
 	}
 }
 
+// serviceAccountUsername returns the username that the API server authenticates the service
+// account as.
+func serviceAccountUsername(namespace, name string) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name)
+}
+
 func generateValidateName(webhookName string, gvk schema.GroupVersionKind) string {
 	return fmt.Sprintf("%s-validate-", webhookName) +
 		strings.Replace(gvk.Group, ".", "-", -1) + "-" +
@@ -51,6 +51,24 @@ type ControllerManagerContext struct {
 	// controller will receive concurrently.
 	MaxConcurrentReconciles int
 
+	// MaxConcurrentProbes is the maximum number of VirtualMachine readiness
+	// probes run concurrently.
+	MaxConcurrentProbes int
+
+	// OrphanedVMGCPeriod is the interval between two sweeps of the garbage
+	// collector of the VMs that are not backed by a VirtualMachine. The
+	// garbage collector is disabled if it is not positive.
+	OrphanedVMGCPeriod time.Duration
+
+	// OrphanedVMGCGracePeriod is how long a VM must not be backed by a
+	// VirtualMachine before the garbage collector deletes it.
+	OrphanedVMGCGracePeriod time.Duration
+
+	// OrphanedVMGCDelete is a flag that makes the garbage collector delete
+	// the VMs that are not backed by a VirtualMachine after the grace
+	// period. Otherwise, they are only reported.
+	OrphanedVMGCDelete bool
+
 	// WebhookServiceNamespace is the namespace in which the webhook service
 	// is located.
 	WebhookServiceNamespace string
@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/go-logr/logr"
+	authv1 "k8s.io/api/authentication/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -21,6 +22,13 @@ type WebhookRequestContext struct {
 	// OldObj is set only for Update requests.
 	OldObj *unstructured.Unstructured
 
+	// UserInfo is the user that made the webhook request.
+	UserInfo authv1.UserInfo
+
+	// IsPrivilegedAccount is true if the webhook request was made by the service account of VM
+	// Operator, which may set the annotations that VM Operator owns.
+	IsPrivilegedAccount bool
+
 	// Logger is the logger associated with the webhook request.
 	Logger logr.Logger
 }
@@ -0,0 +1,242 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package garbagecollector
+
+import (
+	goctx "context"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmgr "sigs.k8s.io/controller-runtime/pkg/manager"
+
+	vmoperatorv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	vmoprecord "github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+const (
+	garbageCollectorName = "virtualmachine-garbage-collector"
+
+	// The reasons of the events emitted on the Namespace of an orphaned VM.
+	orphanedVMReason           = "OrphanedVirtualMachine"
+	orphanedVMDeletedReason    = "OrphanedVirtualMachineDeleted"
+	orphanedVMDeleteFailReason = "OrphanedVirtualMachineDeleteFailed"
+)
+
+// Options are the options of the orphaned VM garbage collector.
+type Options struct {
+	// Period is the interval between two sweeps. The garbage collector is disabled if it is not
+	// positive.
+	Period time.Duration
+
+	// GracePeriod is how long a VM must stay orphaned before it is deleted.
+	GracePeriod time.Duration
+
+	// Delete deletes the VMs that stay orphaned for GracePeriod. Otherwise, the orphaned VMs are only
+	// reported.
+	Delete bool
+}
+
+// orphanKey identifies an orphaned VM.
+type orphanKey struct {
+	namespace string
+	uniqueID  string
+}
+
+// GarbageCollector periodically finds the VMs managed by VM Operator in the infrastructure provider
+// that are not backed by a VirtualMachine, for example because the finalizer of their VirtualMachine
+// was removed, and reports them. If Delete is set, a VM that stays orphaned for GracePeriod is
+// deleted.
+type GarbageCollector struct {
+	client     client.Client
+	vmProvider vmprovider.VirtualMachineProviderInterface
+	recorder   vmoprecord.Recorder
+	log        logr.Logger
+	opts       Options
+
+	// orphanedSince is when each orphaned VM was first found. It is only accessed by the sweeps,
+	// which do not run concurrently.
+	orphanedSince map[orphanKey]time.Time
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// New returns a new orphaned VM garbage collector.
+func New(
+	client client.Client,
+	recorder vmoprecord.Recorder,
+	vmProvider vmprovider.VirtualMachineProviderInterface,
+	opts Options) *GarbageCollector {
+
+	return &GarbageCollector{
+		client:        client,
+		vmProvider:    vmProvider,
+		recorder:      recorder,
+		log:           ctrl.Log.WithName(garbageCollectorName),
+		opts:          opts,
+		orphanedSince: map[orphanKey]time.Time{},
+		now:           time.Now,
+	}
+}
+
+// AddToManager adds the orphaned VM garbage collector to the controller manager, unless it is
+// disabled. As a runnable that does not opt out of leader election, it only runs on the leader.
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+func AddToManager(mgr ctrlmgr.Manager, vmProvider vmprovider.VirtualMachineProviderInterface, opts Options) error {
+	if opts.Period <= 0 {
+		ctrl.Log.WithName(garbageCollectorName).Info("Orphaned VM garbage collector is disabled")
+		return nil
+	}
+
+	recorder := vmoprecord.New(mgr.GetEventRecorderFor(garbageCollectorName))
+	return mgr.Add(New(mgr.GetClient(), recorder, vmProvider, opts))
+}
+
+// Start sweeps for orphaned VMs every period until the stop channel is closed.
+func (gc *GarbageCollector) Start(stopChan <-chan struct{}) error {
+	gc.log.Info("Start VirtualMachine garbage collector",
+		"period", gc.opts.Period, "gracePeriod", gc.opts.GracePeriod, "delete", gc.opts.Delete)
+	defer gc.log.Info("Stop VirtualMachine garbage collector")
+
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	defer cancel()
+	go func() {
+		<-stopChan
+		cancel()
+	}()
+
+	wait.Until(func() { gc.sweep(ctx) }, gc.opts.Period, stopChan)
+	return nil
+}
+
+// sweep finds the orphaned VMs of every namespace, and deletes the ones past their grace period.
+func (gc *GarbageCollector) sweep(ctx goctx.Context) {
+	namespaces := &corev1.NamespaceList{}
+	if err := gc.client.List(ctx, namespaces); err != nil {
+		gc.log.Error(err, "Failed to list namespaces")
+		return
+	}
+
+	found := map[orphanKey]struct{}{}
+	for i := range namespaces.Items {
+		ns := &namespaces.Items[i]
+
+		orphans, err := gc.findOrphanedVMs(ctx, ns.Name)
+		if err != nil {
+			gc.log.Error(err, "Failed to find orphaned VMs", "namespace", ns.Name)
+			// Keep the VMs found orphaned by the previous sweeps until the namespace can be swept.
+			for key := range gc.orphanedSince {
+				if key.namespace == ns.Name {
+					found[key] = struct{}{}
+				}
+			}
+			continue
+		}
+
+		for _, vm := range orphans {
+			key := orphanKey{namespace: ns.Name, uniqueID: vm.UniqueID}
+			if gc.processOrphanedVM(ctx, ns, vm, key) {
+				found[key] = struct{}{}
+			}
+		}
+	}
+
+	// Forget the VMs that are no longer orphaned, or were deleted.
+	for key := range gc.orphanedSince {
+		if _, ok := found[key]; !ok {
+			delete(gc.orphanedSince, key)
+		}
+	}
+
+	counts := map[string]int{}
+	for key := range gc.orphanedSince {
+		counts[key.namespace]++
+	}
+	observeSweep(counts)
+}
+
+// findOrphanedVMs returns the managed VMs of the namespace that are not backed by a VirtualMachine.
+// A VM is backed by a VirtualMachine with the same UniqueID or InstanceUUID, or with the same name
+// or import source when the status of a VirtualMachine being created or imported is not set yet.
+func (gc *GarbageCollector) findOrphanedVMs(ctx goctx.Context, namespace string) ([]vmprovider.ManagedVirtualMachine, error) {
+	managedVMs, err := gc.vmProvider.ListManagedVirtualMachines(ctx, namespace)
+	if err != nil || len(managedVMs) == 0 {
+		return nil, err
+	}
+
+	vmList := &vmoperatorv1alpha1.VirtualMachineList{}
+	if err := gc.client.List(ctx, vmList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	owned := map[string]struct{}{}
+	for i := range vmList.Items {
+		vm := &vmList.Items[i]
+		owned["name:"+vm.Name] = struct{}{}
+		if vm.Status.UniqueID != "" {
+			owned["id:"+vm.Status.UniqueID] = struct{}{}
+		}
+		if vm.Status.InstanceUUID != "" {
+			owned["uuid:"+vm.Status.InstanceUUID] = struct{}{}
+		}
+		if source, _ := vmprovider.GetImportSource(vm); source != nil && source.MoID != "" {
+			owned["id:"+source.MoID] = struct{}{}
+		}
+	}
+
+	var orphans []vmprovider.ManagedVirtualMachine
+	for _, vm := range managedVMs {
+		_, byName := owned["name:"+vm.Name]
+		_, byID := owned["id:"+vm.UniqueID]
+		_, byUUID := owned["uuid:"+vm.InstanceUUID]
+		if !byName && !byID && !byUUID {
+			orphans = append(orphans, vm)
+		}
+	}
+
+	return orphans, nil
+}
+
+// processOrphanedVM reports an orphaned VM the first time it is found, and deletes it once its grace
+// period has elapsed. It returns false if the VM was deleted.
+func (gc *GarbageCollector) processOrphanedVM(ctx goctx.Context, ns *corev1.Namespace, vm vmprovider.ManagedVirtualMachine, key orphanKey) bool {
+	logger := gc.log.WithValues("namespace", ns.Name, "name", vm.Name, "uniqueID", vm.UniqueID)
+	now := gc.now()
+
+	orphanedSince, ok := gc.orphanedSince[key]
+	if !ok {
+		orphanedSince = now
+		gc.orphanedSince[key] = now
+		logger.Info("Found orphaned VM")
+		gc.recorder.Warnf(ns, orphanedVMReason, "VM %s (%s) is not backed by a VirtualMachine", vm.Name, vm.UniqueID)
+	}
+
+	if now.Sub(orphanedSince) < gc.opts.GracePeriod {
+		return true
+	}
+
+	if !gc.opts.Delete {
+		logger.Info("Orphaned VM is past its grace period, not deleting it since deletion is disabled", "orphanedSince", orphanedSince)
+		return true
+	}
+
+	err := gc.vmProvider.DeleteManagedVirtualMachine(ctx, ns.Name, vm)
+	observeDeletion(err)
+	if err != nil {
+		logger.Error(err, "Failed to delete orphaned VM")
+		gc.recorder.Warnf(ns, orphanedVMDeleteFailReason, "Failed to delete VM %s (%s): %v", vm.Name, vm.UniqueID, err)
+		return true
+	}
+
+	logger.Info("Deleted orphaned VM", "orphanedSince", orphanedSince)
+	gc.recorder.Eventf(ns, orphanedVMDeletedReason, "Deleted VM %s (%s) that was not backed by a VirtualMachine since %s",
+		vm.Name, vm.UniqueID, orphanedSince.Format(time.RFC3339))
+	return false
+}
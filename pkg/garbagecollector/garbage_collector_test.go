@@ -0,0 +1,195 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package garbagecollector
+
+import (
+	goctx "context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider/fake"
+	"github.com/vmware-tanzu/vm-operator/test/builder"
+)
+
+var _ = Describe("Orphaned VM garbage collector", func() {
+	const (
+		namespace   = "dummy-ns"
+		gracePeriod = time.Hour
+	)
+
+	var (
+		initObjects []runtime.Object
+		ctx         goctx.Context
+		opts        Options
+		now         time.Time
+
+		gc             *GarbageCollector
+		events         chan string
+		fakeVmProvider *fake.FakeVmProvider
+		managedVMs     []vmprovider.ManagedVirtualMachine
+		deletedVMs     []string
+	)
+
+	orphanedVM := vmprovider.ManagedVirtualMachine{Name: "orphaned-vm", UniqueID: "vm-1", InstanceUUID: "uuid-1"}
+
+	BeforeEach(func() {
+		ctx = goctx.Background()
+		opts = Options{Period: time.Minute, GracePeriod: gracePeriod, Delete: true}
+		now = time.Now()
+		deletedVMs = nil
+
+		vm := &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "backed-vm",
+				Namespace: namespace,
+			},
+			Status: vmopv1alpha1.VirtualMachineStatus{
+				UniqueID: "vm-2",
+			},
+		}
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespace,
+			},
+		}
+		initObjects = []runtime.Object{ns, vm}
+
+		managedVMs = []vmprovider.ManagedVirtualMachine{
+			orphanedVM,
+			// Backed by the VirtualMachine with the same UniqueID.
+			{Name: "renamed-vm", UniqueID: "vm-2", InstanceUUID: "uuid-2"},
+			// Backed by the VirtualMachine with the same name, whose status is not set yet.
+			{Name: "backed-vm", UniqueID: "vm-3", InstanceUUID: "uuid-3"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		fakeClient, _ := builder.NewFakeClient(initObjects...)
+		fakeRecorder, fakeEvents := builder.NewFakeRecorder()
+		events = fakeEvents
+
+		fakeVmProvider = &fake.FakeVmProvider{}
+		fakeVmProvider.ListManagedVirtualMachinesFn = func(ctx goctx.Context, ns string) ([]vmprovider.ManagedVirtualMachine, error) {
+			if ns != namespace {
+				return nil, nil
+			}
+			return managedVMs, nil
+		}
+		fakeVmProvider.DeleteManagedVirtualMachineFn = func(ctx goctx.Context, ns string, vm vmprovider.ManagedVirtualMachine) error {
+			deletedVMs = append(deletedVMs, vm.UniqueID)
+			return nil
+		}
+
+		gc = New(fakeClient, fakeRecorder, fakeVmProvider, opts)
+		gc.now = func() time.Time { return now }
+	})
+
+	expectEvent := func(reason string) {
+		var event string
+		ExpectWithOffset(1, events).To(Receive(&event))
+		ExpectWithOffset(1, strings.Split(event, " ")[1]).To(Equal(reason))
+	}
+
+	It("reports the orphaned VMs once", func() {
+		gc.sweep(ctx)
+		Expect(gc.orphanedSince).To(HaveLen(1))
+		Expect(gc.orphanedSince).To(HaveKeyWithValue(orphanKey{namespace: namespace, uniqueID: orphanedVM.UniqueID}, now))
+		expectEvent(orphanedVMReason)
+
+		now = now.Add(time.Minute)
+		gc.sweep(ctx)
+		Expect(events).ToNot(Receive())
+		Expect(deletedVMs).To(BeEmpty())
+	})
+
+	It("deletes an orphaned VM after the grace period", func() {
+		gc.sweep(ctx)
+		expectEvent(orphanedVMReason)
+
+		now = now.Add(gracePeriod - time.Second)
+		gc.sweep(ctx)
+		Expect(deletedVMs).To(BeEmpty())
+
+		now = now.Add(time.Second)
+		gc.sweep(ctx)
+		Expect(deletedVMs).To(ConsistOf(orphanedVM.UniqueID))
+		expectEvent(orphanedVMDeletedReason)
+		Expect(gc.orphanedSince).To(BeEmpty())
+	})
+
+	It("forgets a VM that is no longer orphaned", func() {
+		gc.sweep(ctx)
+		Expect(gc.orphanedSince).To(HaveLen(1))
+
+		managedVMs = managedVMs[1:]
+		gc.sweep(ctx)
+		Expect(gc.orphanedSince).To(BeEmpty())
+	})
+
+	When("the deletion fails", func() {
+		JustBeforeEach(func() {
+			fakeVmProvider.DeleteManagedVirtualMachineFn = func(ctx goctx.Context, ns string, vm vmprovider.ManagedVirtualMachine) error {
+				return errors.New("delete failed")
+			}
+		})
+
+		It("keeps the orphaned VM and retries", func() {
+			gc.sweep(ctx)
+			expectEvent(orphanedVMReason)
+
+			now = now.Add(gracePeriod)
+			gc.sweep(ctx)
+			expectEvent(orphanedVMDeleteFailReason)
+			Expect(gc.orphanedSince).To(HaveLen(1))
+		})
+	})
+
+	When("the garbage collector does not delete the orphaned VMs", func() {
+		BeforeEach(func() {
+			opts.Delete = false
+		})
+
+		It("does not delete the orphaned VMs", func() {
+			gc.sweep(ctx)
+			expectEvent(orphanedVMReason)
+
+			now = now.Add(2 * gracePeriod)
+			gc.sweep(ctx)
+			Expect(deletedVMs).To(BeEmpty())
+			Expect(gc.orphanedSince).To(HaveLen(1))
+		})
+	})
+
+	When("the managed VMs cannot be listed", func() {
+		It("keeps the orphaned VMs found before", func() {
+			gc.sweep(ctx)
+			Expect(gc.orphanedSince).To(HaveLen(1))
+
+			fakeVmProvider.ListManagedVirtualMachinesFn = func(ctx goctx.Context, ns string) ([]vmprovider.ManagedVirtualMachine, error) {
+				return nil, errors.New("list failed")
+			}
+			now = now.Add(gracePeriod)
+			gc.sweep(ctx)
+			Expect(gc.orphanedSince).To(HaveLen(1))
+			Expect(deletedVMs).To(BeEmpty())
+		})
+	})
+})
+
+func TestGarbageCollector(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "VM Garbage Collector")
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package garbagecollector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	orphanedVMs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "vmoperator",
+		Subsystem: "garbage_collector",
+		Name:      "orphaned_vms",
+		Help:      "Number of VMs not backed by a VirtualMachine found by the last sweep.",
+	}, []string{"namespace"})
+
+	orphanedVMDeletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vmoperator",
+		Subsystem: "garbage_collector",
+		Name:      "orphaned_vm_deletions_total",
+		Help:      "Number of deletions of VMs not backed by a VirtualMachine.",
+	}, []string{"result"})
+
+	sweeps = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "vmoperator",
+		Subsystem: "garbage_collector",
+		Name:      "sweeps_total",
+		Help:      "Number of sweeps for VMs not backed by a VirtualMachine.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(orphanedVMs, orphanedVMDeletions, sweeps)
+}
+
+// observeSweep records the number of orphaned VMs of each namespace found by a sweep.
+func observeSweep(counts map[string]int) {
+	sweeps.Inc()
+	orphanedVMs.Reset()
+	for namespace, count := range counts {
+		orphanedVMs.WithLabelValues(namespace).Set(float64(count))
+	}
+}
+
+// observeDeletion records the result of the deletion of an orphaned VM.
+func observeDeletion(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	orphanedVMDeletions.WithLabelValues(result).Inc()
+}
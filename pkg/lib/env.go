@@ -1,4 +1,4 @@
-// Copyright (c) 2019-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package lib
@@ -17,6 +17,9 @@ const (
 	ThunderPciDevicesFSS          = "FSS_THUNDERPCIDEVICES"
 	MaxCreateVMsOnProviderEnv     = "MAX_CREATE_VMS_ON_PROVIDER"
 	DefaultMaxCreateVMsOnProvider = 80
+	SimpleLBReplicasEnv           = "SIMPLE_LB_REPLICAS"
+	DefaultSimpleLBReplicas       = 1
+	LBProviderPluginEndpointEnv   = "LB_PROVIDER_PLUGIN_ENDPOINT"
 )
 
 // SetVmOpNamespaceEnv sets the VM Operator pod's namespace in the environment
@@ -66,3 +69,25 @@ var MaxConcurrentCreateVMsOnProvider = func() int {
 
 	return val
 }
+
+// SimpleLBReplicas returns the default number of LB VMs the simple-lb provider creates for each
+// VirtualMachineService. The default is 1.
+var SimpleLBReplicas = func() int {
+	v := os.Getenv(SimpleLBReplicasEnv)
+	if v == "" {
+		return DefaultSimpleLBReplicas
+	}
+
+	// Return default in case of an invalid value.
+	val, err := strconv.Atoi(v)
+	if err != nil || val < 1 {
+		return DefaultSimpleLBReplicas
+	}
+
+	return val
+}
+
+// LBProviderPluginEndpoint returns the endpoint of the out-of-tree load balancer provider plugin.
+var LBProviderPluginEndpoint = func() string {
+	return os.Getenv(LBProviderPluginEndpointEnv)
+}
@@ -42,3 +42,33 @@ var _ = Describe("MaxAllowedConcurrentVMsOnProvider", func() {
 		})
 	})
 })
+
+var _ = Describe("SimpleLBReplicas", func() {
+	Context("when the SIMPLE_LB_REPLICAS env is set", func() {
+		AfterEach(func() {
+			os.Unsetenv(SimpleLBReplicasEnv)
+		})
+
+		Context("with a valid env value", func() {
+			It("returns the value from the env", func() {
+				os.Setenv(SimpleLBReplicasEnv, "3")
+
+				Expect(SimpleLBReplicas()).To(Equal(3))
+			})
+		})
+
+		Context("with an invalid env value", func() {
+			It("returns the default value", func() {
+				os.Setenv(SimpleLBReplicasEnv, "0")
+
+				Expect(SimpleLBReplicas()).To(Equal(DefaultSimpleLBReplicas))
+			})
+		})
+	})
+
+	Context("when the SIMPLE_LB_REPLICAS env is not set", func() {
+		It("returns the default value", func() {
+			Expect(SimpleLBReplicas()).To(Equal(DefaultSimpleLBReplicas))
+		})
+	})
+})
@@ -20,6 +20,22 @@ const (
 	// manager option.
 	DefaultMaxConcurrentReconciles = 1
 
+	// DefaultMaxConcurrentProbes is the default value for the eponymous
+	// manager option.
+	DefaultMaxConcurrentProbes = 5
+
+	// DefaultOrphanedVMGCPeriod is the default value for the eponymous
+	// manager option.
+	DefaultOrphanedVMGCPeriod = time.Minute * 10
+
+	// DefaultOrphanedVMGCGracePeriod is the default value for the eponymous
+	// manager option.
+	DefaultOrphanedVMGCGracePeriod = time.Hour
+
+	// DefaultOrphanedVMGCDelete is the default value for the eponymous
+	// manager option.
+	DefaultOrphanedVMGCDelete = false
+
 	// DefaultPodNamespace is the default value for the eponymous manager
 	// option.
 	DefaultPodNamespace = defaultPrefix + "system"
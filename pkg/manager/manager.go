@@ -72,6 +72,10 @@ func New(opts Options) (Manager, error) {
 		LeaderElectionID:        opts.LeaderElectionID,
 		LeaderElectionNamespace: opts.PodNamespace,
 		MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
+		MaxConcurrentProbes:     opts.MaxConcurrentProbes,
+		OrphanedVMGCPeriod:      opts.OrphanedVMGCPeriod,
+		OrphanedVMGCGracePeriod: opts.OrphanedVMGCGracePeriod,
+		OrphanedVMGCDelete:      opts.OrphanedVMGCDelete,
 		Logger:                  opts.Logger.WithName(opts.PodName),
 		Recorder:                record.New(mgr.GetEventRecorderFor(fmt.Sprintf("%s/%s", opts.PodNamespace, opts.PodName))),
 		Scheme:                  opts.Scheme,
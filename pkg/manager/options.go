@@ -56,6 +56,32 @@ type Options struct {
 	// Defaults to the eponymous constant in this package.
 	MaxConcurrentReconciles int
 
+	// MaxConcurrentProbes is the maximum number of VirtualMachine readiness
+	// probes run concurrently.
+	//
+	// Defaults to the eponymous constant in this package.
+	MaxConcurrentProbes int
+
+	// OrphanedVMGCPeriod is the interval between two sweeps of the garbage
+	// collector of the VMs that are not backed by a VirtualMachine. A
+	// negative period disables the garbage collector.
+	//
+	// Defaults to the eponymous constant in this package.
+	OrphanedVMGCPeriod time.Duration
+
+	// OrphanedVMGCGracePeriod is how long a VM must not be backed by a
+	// VirtualMachine before the garbage collector deletes it.
+	//
+	// Defaults to the eponymous constant in this package.
+	OrphanedVMGCGracePeriod time.Duration
+
+	// OrphanedVMGCDelete is a flag that makes the garbage collector delete
+	// the VMs that are not backed by a VirtualMachine after the grace
+	// period. Otherwise, they are only reported.
+	//
+	// Defaults to false, so that no VM is deleted unless asked for.
+	OrphanedVMGCDelete bool
+
 	// MetricsAddr is the net.Addr string for the metrics server.
 	MetricsAddr string
 
@@ -163,6 +189,18 @@ func (o *Options) defaults() {
 		o.MaxConcurrentReconciles = DefaultMaxConcurrentReconciles
 	}
 
+	if o.MaxConcurrentProbes == 0 {
+		o.MaxConcurrentProbes = DefaultMaxConcurrentProbes
+	}
+
+	if o.OrphanedVMGCPeriod == 0 {
+		o.OrphanedVMGCPeriod = DefaultOrphanedVMGCPeriod
+	}
+
+	if o.OrphanedVMGCGracePeriod == 0 {
+		o.OrphanedVMGCGracePeriod = DefaultOrphanedVMGCGracePeriod
+	}
+
 	if o.WebhookServiceContainerPort == 0 {
 		o.WebhookServiceContainerPort = DefaultWebhookServiceContainerPort
 	}
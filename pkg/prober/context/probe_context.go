@@ -1,4 +1,4 @@
-// Copyright (c) 2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2020-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package context
@@ -20,6 +20,16 @@ type ProbeContext struct {
 	VM          *vmopv1alpha1.VirtualMachine
 	ProbeType   string
 	ProbeSpec   *vmopv1alpha1.Probe
+	// State is the state of the probe of the VM kept by the prober manager. It is nil if the
+	// probe has no state.
+	State *ProbeState
+}
+
+// ProbeState is the consecutive results of the probe of a VM. It is kept in memory by the prober
+// manager between two probes, and is only accessed by the worker that is processing the VM.
+type ProbeState struct {
+	Successes int32
+	Failures  int32
 }
 
 // String returns probe type.
@@ -27,6 +27,9 @@ type FakeWorker struct {
 	sync.Mutex
 	funcs
 	queue workqueue.DelayingInterface
+
+	// ForgottenVMs are the names of the VMs passed to ForgetVM.
+	ForgottenVMs []string
 }
 
 func NewFakeWorker(queue workqueue.DelayingInterface) worker.Worker {
@@ -40,6 +43,7 @@ func (w *FakeWorker) Reset() {
 	defer w.Unlock()
 
 	w.funcs = funcs{}
+	w.ForgottenVMs = nil
 }
 
 func (w *FakeWorker) GetQueue() workqueue.DelayingInterface {
@@ -66,6 +70,13 @@ func (w *FakeWorker) DoProbe(ctx *context.ProbeContext) error {
 	return fmt.Errorf("unexpected method call: DoProbe")
 }
 
+func (w *FakeWorker) ForgetVM(vmName string) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.ForgottenVMs = append(w.ForgottenVMs, vmName)
+}
+
 func (w *FakeWorker) ProcessProbeResult(ctx *context.ProbeContext, res probe.Result, err error) error {
 	w.Lock()
 	defer w.Unlock()
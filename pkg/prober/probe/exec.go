@@ -0,0 +1,115 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package probe
+
+import (
+	goctx "context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+const (
+	// ExecActionAnnotationKey is the VirtualMachine annotation with the JSON encoded ExecAction of its
+	// readiness probe. The VirtualMachine readiness probe spec does not have an exec action, so the
+	// probe timeout and period are still taken from spec.readinessProbe.
+	ExecActionAnnotationKey = "readinessprobe.vmoperator.vmware.com/exec"
+
+	// ExecSecretUsernameKey and ExecSecretPasswordKey are the keys of the guest credentials in the
+	// Secret referenced by an ExecAction.
+	ExecSecretUsernameKey = "username"
+	ExecSecretPasswordKey = "password"
+)
+
+// ExecAction describes a command that is run in the guest through VMware Tools.
+type ExecAction struct {
+	// Command is the absolute path of the program followed by its arguments. The command is not run
+	// in a shell: each argument is passed to the program as is. An exit code of zero is considered
+	// successful.
+	Command []string `json:"command"`
+
+	// SecretName is the name of the Secret, in the namespace of the VirtualMachine, with the
+	// username and password the command is run as.
+	SecretName string `json:"secretName"`
+}
+
+// GetExecAction returns the ExecAction of the VirtualMachine readiness probe, or nil if the
+// VirtualMachine does not have one.
+func GetExecAction(vm *vmopv1alpha1.VirtualMachine) (*ExecAction, error) {
+	data, ok := vm.Annotations[ExecActionAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+
+	action := &ExecAction{}
+	if err := json.Unmarshal([]byte(data), action); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", ExecActionAnnotationKey, err)
+	}
+	return action, nil
+}
+
+// execProber implements the Probe interface.
+type execProber struct {
+	client client.Client
+	prober vmProviderProber
+}
+
+// NewExecProber creates a new exec prober which implements the Probe interface to run a command in the guest.
+func NewExecProber(client client.Client, vmProviderProber vmProviderProber) Probe {
+	return &execProber{
+		client: client,
+		prober: vmProviderProber,
+	}
+}
+
+func (pr execProber) Probe(ctx *context.ProbeContext) (Result, error) {
+	vm := ctx.VM
+	p := ctx.ProbeSpec
+
+	action, err := GetExecAction(vm)
+	if err != nil {
+		return Failure, err
+	}
+	if action == nil || len(action.Command) == 0 {
+		return Failure, fmt.Errorf("VM %s doesn't have an exec command", vm.NamespacedName())
+	}
+
+	secret := &corev1.Secret{}
+	if err := pr.client.Get(ctx, client.ObjectKey{Namespace: vm.Namespace, Name: action.SecretName}, secret); err != nil {
+		return Unknown, err
+	}
+
+	timeout := defaultConnectTimeout
+	if p != nil && p.TimeoutSeconds > 0 {
+		timeout = time.Duration(p.TimeoutSeconds) * time.Second
+	}
+	execCtx, cancel := goctx.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	exitCode, err := pr.prober.RunVirtualMachineGuestProgram(execCtx, vm, vmprovider.GuestProgram{
+		Command:  action.Command,
+		Username: string(secret.Data[ExecSecretUsernameKey]),
+		Password: string(secret.Data[ExecSecretPasswordKey]),
+	})
+	if err != nil {
+		if execCtx.Err() == goctx.DeadlineExceeded {
+			return Failure, fmt.Errorf("exec probe timed out after %s", timeout)
+		}
+		return Unknown, err
+	}
+
+	if exitCode != 0 {
+		return Failure, fmt.Errorf("exec probe failed with exit code %d", exitCode)
+	}
+
+	return Success, nil
+}
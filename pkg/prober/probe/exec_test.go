@@ -0,0 +1,168 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package probe
+
+import (
+	goctx "context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	fakevmprovider "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/fake"
+	"github.com/vmware-tanzu/vm-operator/test/builder"
+)
+
+var _ = Describe("Exec probe", func() {
+	const secretName = "guest-creds"
+
+	var (
+		vm            *vmopv1alpha1.VirtualMachine
+		secret        *corev1.Secret
+		fakeClient    client.Client
+		fakeProvider  *fakevmprovider.FakeVmProvider
+		testExecProbe Probe
+
+		res Result
+		err error
+	)
+
+	BeforeEach(func() {
+		vm = &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-vm",
+				Namespace: "dummy-ns",
+				Annotations: map[string]string{
+					ExecActionAnnotationKey: `{"command": ["/usr/bin/systemctl", "is-active", "nginx"], "secretName": "guest-creds"}`,
+				},
+			},
+			Spec: vmopv1alpha1.VirtualMachineSpec{
+				ClassName: "dummy-vmclass",
+				ReadinessProbe: &vmopv1alpha1.Probe{
+					TimeoutSeconds: 1,
+					PeriodSeconds:  1,
+				},
+			},
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: vm.Namespace,
+			},
+			Data: map[string][]byte{
+				ExecSecretUsernameKey: []byte("user"),
+				ExecSecretPasswordKey: []byte("pass"),
+			},
+		}
+
+		fakeProvider = &fakevmprovider.FakeVmProvider{}
+		fakeProvider.Reset()
+	})
+
+	JustBeforeEach(func() {
+		fakeClient, _ = builder.NewFakeClient(secret)
+		testExecProbe = NewExecProber(fakeClient, fakeProvider)
+
+		probeCtx := &context.ProbeContext{
+			Context:   goctx.Background(),
+			Logger:    ctrl.Log.WithName("Probe").WithValues("name", vm.NamespacedName()),
+			ProbeSpec: vm.Spec.ReadinessProbe,
+			VM:        vm,
+		}
+		res, err = testExecProbe.Probe(probeCtx)
+	})
+
+	Context("command exits with zero", func() {
+		var program vmprovider.GuestProgram
+
+		BeforeEach(func() {
+			fakeProvider.RunVirtualMachineGuestProgramFn = func(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine, p vmprovider.GuestProgram) (int32, error) {
+				program = p
+				return 0, nil
+			}
+		})
+
+		It("returns success", func() {
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(res).To(Equal(Success))
+		})
+
+		It("runs the command with the credentials of the Secret", func() {
+			Expect(program.Command).To(Equal([]string{"/usr/bin/systemctl", "is-active", "nginx"}))
+			Expect(program.Username).To(Equal("user"))
+			Expect(program.Password).To(Equal("pass"))
+		})
+	})
+
+	Context("command exits with non-zero", func() {
+		BeforeEach(func() {
+			fakeProvider.RunVirtualMachineGuestProgramFn = func(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine, _ vmprovider.GuestProgram) (int32, error) {
+				return 3, nil
+			}
+		})
+
+		It("returns failure", func() {
+			Expect(err).Should(MatchError(ContainSubstring("exit code 3")))
+			Expect(res).To(Equal(Failure))
+		})
+	})
+
+	Context("VMware Tools is not running", func() {
+		BeforeEach(func() {
+			fakeProvider.RunVirtualMachineGuestProgramFn = func(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine, _ vmprovider.GuestProgram) (int32, error) {
+				return 0, fmt.Errorf("VMware Tools is not running")
+			}
+		})
+
+		It("returns unknown", func() {
+			Expect(err).Should(HaveOccurred())
+			Expect(res).To(Equal(Unknown))
+		})
+	})
+
+	Context("command does not exit before the timeout", func() {
+		BeforeEach(func() {
+			fakeProvider.RunVirtualMachineGuestProgramFn = func(ctx goctx.Context, _ *vmopv1alpha1.VirtualMachine, _ vmprovider.GuestProgram) (int32, error) {
+				<-ctx.Done()
+				return 0, ctx.Err()
+			}
+		})
+
+		It("returns failure", func() {
+			Expect(err).Should(MatchError(ContainSubstring("timed out")))
+			Expect(res).To(Equal(Failure))
+		})
+	})
+
+	Context("Secret does not exist", func() {
+		BeforeEach(func() {
+			secret.Name = "other-creds"
+		})
+
+		It("returns unknown", func() {
+			Expect(err).Should(HaveOccurred())
+			Expect(res).To(Equal(Unknown))
+		})
+	})
+
+	Context("VM does not have an exec action", func() {
+		BeforeEach(func() {
+			vm.Annotations = nil
+		})
+
+		It("returns failure", func() {
+			Expect(err).Should(HaveOccurred())
+			Expect(res).To(Equal(Failure))
+		})
+	})
+})
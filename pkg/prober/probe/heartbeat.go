@@ -4,7 +4,10 @@
 package probe
 
 import (
+	goctx "context"
 	"fmt"
+	"sync"
+	"time"
 
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
@@ -38,13 +41,109 @@ func (hbp guestHeartbeatProber) Probe(ctx *context.ProbeContext) (Result, error)
 		return Unknown, err
 	}
 
+	return heartbeatResult(heartbeat, ctx.ProbeSpec.GuestHeartbeat.ThresholdStatus)
+}
+
+func heartbeatResult(heartbeat, threshold vmopv1alpha1.GuestHeartbeatStatus) (Result, error) {
 	if heartbeat == "" {
 		return Unknown, fmt.Errorf("no heartbeat value")
 	}
 
-	if heartbeatValue(heartbeat) < heartbeatValue(ctx.ProbeSpec.GuestHeartbeat.ThresholdStatus) {
+	if heartbeatValue(heartbeat) < heartbeatValue(threshold) {
 		return Failure, fmt.Errorf("heartbeat status %q is below threshold", heartbeat)
 	}
 
 	return Success, nil
 }
+
+// heartbeatBatch is a set of VMs in the same namespace whose guest heartbeat is fetched together.
+type heartbeatBatch struct {
+	vms        []*vmopv1alpha1.VirtualMachine
+	done       chan struct{}
+	heartbeats map[string]vmopv1alpha1.GuestHeartbeatStatus
+	err        error
+}
+
+// batchedGuestHeartbeatProber implements the Probe interface. The heartbeat probes of the VMs in
+// a namespace that are run within the batch window are fetched from the provider with one call.
+type batchedGuestHeartbeatProber struct {
+	prober       vmProviderProber
+	window       time.Duration
+	maxBatchSize int
+
+	mutex   sync.Mutex
+	batches map[string]*heartbeatBatch
+}
+
+// NewBatchedGuestHeartbeatProber creates a new guest heartbeat prober that batches the probes run
+// concurrently within the window, up to maxBatchSize VMs per batch.
+func NewBatchedGuestHeartbeatProber(vmProviderProber vmProviderProber, window time.Duration, maxBatchSize int) Probe {
+	return &batchedGuestHeartbeatProber{
+		prober:       vmProviderProber,
+		window:       window,
+		maxBatchSize: maxBatchSize,
+		batches:      make(map[string]*heartbeatBatch),
+	}
+}
+
+func (hbp *batchedGuestHeartbeatProber) Probe(ctx *context.ProbeContext) (Result, error) {
+	batch := hbp.addToBatch(ctx.VM)
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return Unknown, ctx.Err()
+	}
+
+	if batch.err != nil {
+		return Unknown, batch.err
+	}
+
+	return heartbeatResult(batch.heartbeats[ctx.VM.NamespacedName()], ctx.ProbeSpec.GuestHeartbeat.ThresholdStatus)
+}
+
+// addToBatch adds the VM to the pending batch of its namespace, and returns the batch. The batch
+// is fetched when the window ends, or as soon as it is full.
+func (hbp *batchedGuestHeartbeatProber) addToBatch(vm *vmopv1alpha1.VirtualMachine) *heartbeatBatch {
+	hbp.mutex.Lock()
+	defer hbp.mutex.Unlock()
+
+	batch, ok := hbp.batches[vm.Namespace]
+	if !ok {
+		batch = &heartbeatBatch{done: make(chan struct{})}
+		hbp.batches[vm.Namespace] = batch
+		time.AfterFunc(hbp.window, func() {
+			hbp.fetchBatch(vm.Namespace, batch)
+		})
+	}
+
+	batch.vms = append(batch.vms, vm)
+	if len(batch.vms) >= hbp.maxBatchSize {
+		delete(hbp.batches, vm.Namespace)
+		go hbp.fetch(batch)
+	}
+
+	return batch
+}
+
+// fetchBatch fetches the batch unless it has already been fetched because it was full.
+func (hbp *batchedGuestHeartbeatProber) fetchBatch(namespace string, batch *heartbeatBatch) {
+	hbp.mutex.Lock()
+	if hbp.batches[namespace] != batch {
+		hbp.mutex.Unlock()
+		return
+	}
+	delete(hbp.batches, namespace)
+	hbp.mutex.Unlock()
+
+	hbp.fetch(batch)
+}
+
+func (hbp *batchedGuestHeartbeatProber) fetch(batch *heartbeatBatch) {
+	defer close(batch.done)
+
+	ctx, cancel := goctx.WithTimeout(goctx.Background(), defaultConnectTimeout)
+	defer cancel()
+
+	batch.heartbeats, batch.err = hbp.prober.GetVirtualMachineGuestHeartbeats(ctx, batch.vms)
+}
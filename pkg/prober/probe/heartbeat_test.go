@@ -6,6 +6,8 @@ package probe
 import (
 	goctx "context"
 	"fmt"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -16,21 +18,43 @@ import (
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
 	"github.com/vmware-tanzu/vm-operator/pkg/prober/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 )
 
 type fakeVMProviderProber struct {
 	status vmopv1alpha1.GuestHeartbeatStatus
 	err    error
+
+	mutex   sync.Mutex
+	batches [][]*vmopv1alpha1.VirtualMachine
 }
 
-func (tp fakeVMProviderProber) GetVirtualMachineGuestHeartbeat(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine) (vmopv1alpha1.GuestHeartbeatStatus, error) {
+func (tp *fakeVMProviderProber) GetVirtualMachineGuestHeartbeat(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine) (vmopv1alpha1.GuestHeartbeatStatus, error) {
 	return tp.status, tp.err
 }
 
+func (tp *fakeVMProviderProber) GetVirtualMachineGuestHeartbeats(_ goctx.Context, vms []*vmopv1alpha1.VirtualMachine) (map[string]vmopv1alpha1.GuestHeartbeatStatus, error) {
+	tp.mutex.Lock()
+	defer tp.mutex.Unlock()
+	tp.batches = append(tp.batches, vms)
+
+	heartbeats := map[string]vmopv1alpha1.GuestHeartbeatStatus{}
+	for _, vm := range vms {
+		if vm.Name != "no-heartbeat-vm" {
+			heartbeats[vm.NamespacedName()] = tp.status
+		}
+	}
+	return heartbeats, tp.err
+}
+
+func (tp *fakeVMProviderProber) RunVirtualMachineGuestProgram(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine, _ vmprovider.GuestProgram) (int32, error) {
+	return 0, nil
+}
+
 var _ = Describe("Guest heartbeat probe", func() {
 	var (
 		vm                   *vmopv1alpha1.VirtualMachine
-		fakeProvider         fakeVMProviderProber
+		fakeProvider         *fakeVMProviderProber
 		testVMwareToolsProbe Probe
 
 		err error
@@ -49,8 +73,8 @@ var _ = Describe("Guest heartbeat probe", func() {
 			},
 		}
 
-		fakeProvider = fakeVMProviderProber{}
-		testVMwareToolsProbe = NewGuestHeartbeatProber(&fakeProvider)
+		fakeProvider = &fakeVMProviderProber{}
+		testVMwareToolsProbe = NewGuestHeartbeatProber(fakeProvider)
 	})
 
 	JustBeforeEach(func() {
@@ -142,6 +166,84 @@ var _ = Describe("Guest heartbeat probe", func() {
 	})
 })
 
+var _ = Describe("Batched guest heartbeat probe", func() {
+	var (
+		fakeProvider *fakeVMProviderProber
+		maxBatchSize int
+	)
+
+	BeforeEach(func() {
+		fakeProvider = &fakeVMProviderProber{status: vmopv1alpha1.GreenHeartbeatStatus}
+		maxBatchSize = 10
+	})
+
+	// probeVMs concurrently runs the heartbeat probe of the VMs, and returns their results.
+	probeVMs := func(names ...string) []Result {
+		testProbe := NewBatchedGuestHeartbeatProber(fakeProvider, 50*time.Millisecond, maxBatchSize)
+
+		results := make([]Result, len(names))
+		var wg sync.WaitGroup
+		for i, name := range names {
+			vm := &vmopv1alpha1.VirtualMachine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "dummy-ns",
+				},
+				Spec: vmopv1alpha1.VirtualMachineSpec{
+					ReadinessProbe: getVirtualMachineReadinessHeartbeatProbe(),
+				},
+			}
+			probeCtx := &context.ProbeContext{
+				Context:   goctx.Background(),
+				Logger:    ctrl.Log.WithName("Probe").WithValues("name", vm.NamespacedName()),
+				ProbeSpec: vm.Spec.ReadinessProbe,
+				VM:        vm,
+			}
+
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				results[i], _ = testProbe.Probe(probeCtx)
+			}(i)
+		}
+		wg.Wait()
+
+		return results
+	}
+
+	It("fetches the heartbeats of concurrent probes together", func() {
+		results := probeVMs("vm-1", "vm-2", "vm-3")
+		Expect(results).To(Equal([]Result{Success, Success, Success}))
+		Expect(fakeProvider.batches).To(HaveLen(1))
+		Expect(fakeProvider.batches[0]).To(HaveLen(3))
+	})
+
+	It("returns unknown for a VM without a heartbeat", func() {
+		results := probeVMs("vm-1", "no-heartbeat-vm")
+		Expect(results).To(ConsistOf(Success, Unknown))
+	})
+
+	Context("Provider returns an error", func() {
+		BeforeEach(func() { fakeProvider.err = fmt.Errorf("fake error") })
+
+		It("returns unknown for all the VMs", func() {
+			results := probeVMs("vm-1", "vm-2")
+			Expect(results).To(Equal([]Result{Unknown, Unknown}))
+		})
+	})
+
+	Context("Batch is full", func() {
+		BeforeEach(func() { maxBatchSize = 2 })
+
+		It("fetches the batch without waiting for the window", func() {
+			results := probeVMs("vm-1", "vm-2", "vm-3")
+			Expect(results).To(Equal([]Result{Success, Success, Success}))
+			Expect(fakeProvider.batches).To(HaveLen(2))
+		})
+	})
+})
+
 func getVirtualMachineReadinessHeartbeatProbe() *vmopv1alpha1.Probe {
 	return &vmopv1alpha1.Probe{
 		GuestHeartbeat: &vmopv1alpha1.GuestHeartbeatAction{
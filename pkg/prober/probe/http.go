@@ -0,0 +1,190 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package probe
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/context"
+)
+
+const (
+	// HTTPGetActionAnnotationKey is the VirtualMachine annotation with the JSON encoded HTTPGetAction of
+	// its readiness probe. The VirtualMachine readiness probe spec does not have an HTTP GET action, so
+	// the probe timeout and period are still taken from spec.readinessProbe.
+	HTTPGetActionAnnotationKey = "readinessprobe.vmoperator.vmware.com/http-get"
+
+	defaultHTTPPath          = "/"
+	defaultMinHTTPStatusCode = http.StatusOK
+	defaultMaxHTTPStatusCode = http.StatusBadRequest - 1
+	probeUserAgent           = "vm-operator-probe"
+)
+
+// URIScheme identifies the scheme used for connection to a host for an HTTPGetAction.
+type URIScheme string
+
+const (
+	URISchemeHTTP  URIScheme = "HTTP"
+	URISchemeHTTPS URIScheme = "HTTPS"
+)
+
+// HTTPGetAction describes an action based on HTTP GET requests.
+type HTTPGetAction struct {
+	// Path to access on the HTTP server. Defaults to "/".
+	Path string `json:"path,omitempty"`
+
+	// Port specifies a number or name of the port to access on the VirtualMachine.
+	Port intstr.IntOrString `json:"port"`
+
+	// Host is an optional host name to connect to. Host defaults to the VirtualMachine IP.
+	Host string `json:"host,omitempty"`
+
+	// Scheme to use for connecting to the host. Defaults to HTTP.
+	Scheme URIScheme `json:"scheme,omitempty"`
+
+	// HTTPHeaders are custom headers to set in the request.
+	HTTPHeaders []corev1.HTTPHeader `json:"httpHeaders,omitempty"`
+
+	// MinStatusCode and MaxStatusCode are the inclusive range of HTTP status codes that are
+	// considered successful. They default to 200 and 399.
+	MinStatusCode int `json:"minStatusCode,omitempty"`
+	MaxStatusCode int `json:"maxStatusCode,omitempty"`
+
+	// InsecureSkipTLSVerify skips the verification of the certificate of an HTTPS server.
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+}
+
+// GetHTTPGetAction returns the HTTPGetAction of the VirtualMachine readiness probe, or nil if the
+// VirtualMachine does not have one. Status code range defaults are applied.
+func GetHTTPGetAction(vm *vmopv1alpha1.VirtualMachine) (*HTTPGetAction, error) {
+	data, ok := vm.Annotations[HTTPGetActionAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+
+	action := &HTTPGetAction{}
+	if err := json.Unmarshal([]byte(data), action); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", HTTPGetActionAnnotationKey, err)
+	}
+	if action.MinStatusCode == 0 {
+		action.MinStatusCode = defaultMinHTTPStatusCode
+	}
+	if action.MaxStatusCode == 0 {
+		action.MaxStatusCode = defaultMaxHTTPStatusCode
+	}
+	return action, nil
+}
+
+// httpProber implements the Probe interface.
+type httpProber struct{}
+
+// NewHTTPProber creates a new http prober which implements the Probe interface to execute HTTP GET probes.
+func NewHTTPProber() Probe {
+	return &httpProber{}
+}
+
+func (pr httpProber) Probe(ctx *context.ProbeContext) (Result, error) {
+	vm := ctx.VM
+	p := ctx.ProbeSpec
+
+	action, err := GetHTTPGetAction(vm)
+	if err != nil {
+		return Failure, err
+	}
+	if action == nil {
+		return Failure, fmt.Errorf("VM %s doesn't have an HTTP GET action", vm.NamespacedName())
+	}
+
+	portNum, err := findPort(vm, action.Port, corev1.ProtocolTCP)
+	if err != nil {
+		return Failure, err
+	}
+
+	var host string
+	if action.Host != "" {
+		host = action.Host
+	} else {
+		ctx.Logger.V(4).Info("HTTPGet Host not specified, using VM IP", "probe", ctx.String())
+		if host = vm.Status.VmIp; host == "" {
+			return Failure, fmt.Errorf("VM %s doesn't have an IP assigned", vm.NamespacedName())
+		}
+	}
+
+	timeout := defaultConnectTimeout
+	if p != nil && p.TimeoutSeconds > 0 {
+		timeout = time.Duration(p.TimeoutSeconds) * time.Second
+	}
+
+	req, err := newHTTPGetRequest(action, host, portNum)
+	if err != nil {
+		return Failure, err
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: action.InsecureSkipTLSVerify}, //nolint:gosec
+			DisableKeepAlives: true,
+		},
+		// Redirects are not followed: the status code of the redirect is checked.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Failure, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < action.MinStatusCode || resp.StatusCode > action.MaxStatusCode {
+		return Failure, fmt.Errorf("HTTP probe failed with status code %d", resp.StatusCode)
+	}
+
+	return Success, nil
+}
+
+func newHTTPGetRequest(action *HTTPGetAction, host string, port int) (*http.Request, error) {
+	scheme := "http"
+	if action.Scheme == URISchemeHTTPS {
+		scheme = "https"
+	}
+	path := action.Path
+	if path == "" {
+		path = defaultHTTPPath
+	}
+	u := &url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   path,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", probeUserAgent)
+	for _, h := range action.HTTPHeaders {
+		if h.Name == "Host" {
+			req.Host = h.Value
+			continue
+		}
+		req.Header.Add(h.Name, h.Value)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package probe
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/context"
+)
+
+var _ = Describe("HTTP probe", func() {
+	var (
+		vm            *vmopv1alpha1.VirtualMachine
+		testHTTPProbe Probe
+
+		handler    http.HandlerFunc
+		testServer *httptest.Server
+		testHost   string
+		testPort   int
+	)
+
+	setHTTPGetAction := func(action HTTPGetAction) {
+		data, err := json.Marshal(action)
+		Expect(err).NotTo(HaveOccurred())
+		vm.Annotations = map[string]string{HTTPGetActionAnnotationKey: string(data)}
+	}
+
+	doProbe := func() (Result, error) {
+		probeCtx := &context.ProbeContext{
+			VM:        vm,
+			ProbeSpec: vm.Spec.ReadinessProbe,
+			Logger:    ctrl.Log.WithName("Probe").WithValues("name", vm.NamespacedName()),
+		}
+		return testHTTPProbe.Probe(probeCtx)
+	}
+
+	BeforeEach(func() {
+		vm = &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-vm",
+				Namespace: "dummy-ns",
+			},
+			Spec: vmopv1alpha1.VirtualMachineSpec{
+				ClassName: "dummy-vmclass",
+				ReadinessProbe: &vmopv1alpha1.Probe{
+					TimeoutSeconds: 1,
+					PeriodSeconds:  1,
+				},
+			},
+		}
+
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}
+		testHTTPProbe = NewHTTPProber()
+	})
+
+	JustBeforeEach(func() {
+		testServer = httptest.NewServer(handler)
+		testHost, testPort = splitHostPort(testServer.Listener.Addr().String())
+	})
+
+	AfterEach(func() {
+		testServer.Close()
+	})
+
+	It("HTTP probe succeeds", func() {
+		setHTTPGetAction(HTTPGetAction{Host: testHost, Port: intstr.FromInt(testPort)})
+
+		res, err := doProbe()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(res).To(Equal(Success))
+	})
+
+	It("HTTP probe succeeds, with empty host", func() {
+		vm.Status.VmIp = testHost
+		setHTTPGetAction(HTTPGetAction{Port: intstr.FromInt(testPort)})
+
+		res, err := doProbe()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(res).To(Equal(Success))
+	})
+
+	It("HTTP probe fails, with empty host and no VM IP", func() {
+		setHTTPGetAction(HTTPGetAction{Port: intstr.FromInt(testPort)})
+
+		res, err := doProbe()
+		Expect(err).Should(HaveOccurred())
+		Expect(res).To(Equal(Failure))
+	})
+
+	It("HTTP probe succeeds, with a named port", func() {
+		vm.Spec.Ports = []vmopv1alpha1.VirtualMachinePort{{
+			Name:     "http",
+			Port:     testPort,
+			Protocol: corev1.ProtocolTCP,
+		}}
+		setHTTPGetAction(HTTPGetAction{Host: testHost, Port: intstr.FromString("http")})
+
+		res, err := doProbe()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(res).To(Equal(Success))
+	})
+
+	It("HTTP probe fails, with an invalid annotation", func() {
+		vm.Annotations = map[string]string{HTTPGetActionAnnotationKey: "{"}
+
+		res, err := doProbe()
+		Expect(err).Should(HaveOccurred())
+		Expect(res).To(Equal(Failure))
+	})
+
+	It("HTTP probe fails, when nothing is listening", func() {
+		setHTTPGetAction(HTTPGetAction{Host: testHost, Port: intstr.FromInt(10001)})
+
+		res, err := doProbe()
+		Expect(err).Should(HaveOccurred())
+		Expect(res).To(Equal(Failure))
+	})
+
+	Context("Server responds with an error status code", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		})
+
+		It("HTTP probe fails", func() {
+			setHTTPGetAction(HTTPGetAction{Host: testHost, Port: intstr.FromInt(testPort)})
+
+			res, err := doProbe()
+			Expect(err).Should(MatchError(ContainSubstring("503")))
+			Expect(res).To(Equal(Failure))
+		})
+
+		It("HTTP probe succeeds, when the status code is in the expected range", func() {
+			setHTTPGetAction(HTTPGetAction{
+				Host:          testHost,
+				Port:          intstr.FromInt(testPort),
+				MinStatusCode: http.StatusOK,
+				MaxStatusCode: http.StatusServiceUnavailable,
+			})
+
+			res, err := doProbe()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(res).To(Equal(Success))
+		})
+	})
+
+	Context("Server redirects", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "/elsewhere", http.StatusFound)
+			}
+		})
+
+		It("HTTP probe checks the status code of the redirect", func() {
+			setHTTPGetAction(HTTPGetAction{Host: testHost, Port: intstr.FromInt(testPort)})
+
+			res, err := doProbe()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(res).To(Equal(Success))
+		})
+	})
+
+	Context("Server checks the request", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/healthz" || r.Header.Get("X-Probe") != "vm" || r.Host != "example.com" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}
+		})
+
+		It("HTTP probe sends the path and headers", func() {
+			setHTTPGetAction(HTTPGetAction{
+				Host: testHost,
+				Port: intstr.FromInt(testPort),
+				Path: "/healthz",
+				HTTPHeaders: []corev1.HTTPHeader{
+					{Name: "X-Probe", Value: "vm"},
+					{Name: "Host", Value: "example.com"},
+				},
+			})
+
+			res, err := doProbe()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(res).To(Equal(Success))
+		})
+	})
+
+	Context("HTTPS", func() {
+		var tlsServer *httptest.Server
+
+		JustBeforeEach(func() {
+			tlsServer = httptest.NewTLSServer(handler)
+			testHost, testPort = splitHostPort(tlsServer.Listener.Addr().String())
+		})
+
+		AfterEach(func() {
+			tlsServer.Close()
+		})
+
+		It("HTTP probe succeeds, when TLS verification is skipped", func() {
+			setHTTPGetAction(HTTPGetAction{
+				Host:                  testHost,
+				Port:                  intstr.FromInt(testPort),
+				Scheme:                URISchemeHTTPS,
+				InsecureSkipTLSVerify: true,
+			})
+
+			res, err := doProbe()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(res).To(Equal(Success))
+		})
+
+		It("HTTP probe fails, with an untrusted certificate", func() {
+			setHTTPGetAction(HTTPGetAction{
+				Host:   testHost,
+				Port:   intstr.FromInt(testPort),
+				Scheme: URISchemeHTTPS,
+			})
+
+			res, err := doProbe()
+			Expect(err).Should(HaveOccurred())
+			Expect(res).To(Equal(Failure))
+		})
+	})
+})
+
+var _ = Describe("GetHTTPGetAction", func() {
+	It("returns nil without the annotation", func() {
+		action, err := GetHTTPGetAction(&vmopv1alpha1.VirtualMachine{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(action).To(BeNil())
+	})
+
+	It("defaults the status code range", func() {
+		vm := &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: map[string]string{HTTPGetActionAnnotationKey: `{"port": 80}`},
+			},
+		}
+		action, err := GetHTTPGetAction(vm)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(action.MinStatusCode).To(Equal(200))
+		Expect(action.MaxStatusCode).To(Equal(399))
+	})
+})
+
+func splitHostPort(addr string) (string, int) {
+	host, port, err := net.SplitHostPort(addr)
+	Expect(err).NotTo(HaveOccurred())
+	portInt, err := strconv.Atoi(port)
+	Expect(err).NotTo(HaveOccurred())
+	return host, portInt
+}
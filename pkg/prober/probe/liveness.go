@@ -0,0 +1,77 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+const (
+	// LivenessProbeAnnotationKey is the VirtualMachine annotation with the JSON encoded LivenessProbe
+	// of the VirtualMachine. The VirtualMachine spec does not have a liveness probe.
+	LivenessProbeAnnotationKey = "vmoperator.vmware.com/liveness-probe"
+
+	defaultLivenessFailureThreshold  = 3
+	defaultRemediationBackoffSeconds = 300
+)
+
+// LivenessProbe describes a probe that remediates the VirtualMachine when it fails.
+type LivenessProbe struct {
+	// Probe is the action, timeout and period of the liveness probe.
+	vmopv1alpha1.Probe `json:",inline"`
+
+	// FailureThreshold is the number of consecutive failures after which the VirtualMachine is
+	// remediated. Defaults to 3.
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+
+	// Remediation is how the VirtualMachine is restarted. Defaults to GuestReboot.
+	Remediation vmprovider.RestartType `json:"remediation,omitempty"`
+
+	// RemediationBackoffSeconds is the minimum time between two remediations. It doubles with each
+	// remediation that does not make the probe succeed. Defaults to 300.
+	RemediationBackoffSeconds int32 `json:"remediationBackoffSeconds,omitempty"`
+}
+
+// RemediationBackoff returns how long to wait after the given number of consecutive remediations
+// before the VirtualMachine is remediated again. It is capped at maxBackoff.
+func (p *LivenessProbe) RemediationBackoff(remediations int, maxBackoff time.Duration) time.Duration {
+	backoff := time.Duration(p.RemediationBackoffSeconds) * time.Second
+	for i := 1; i < remediations && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// GetLivenessProbe returns the LivenessProbe of the VirtualMachine, or nil if the VirtualMachine
+// does not have one. Defaults are applied.
+func GetLivenessProbe(vm *vmopv1alpha1.VirtualMachine) (*LivenessProbe, error) {
+	data, ok := vm.Annotations[LivenessProbeAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+
+	p := &LivenessProbe{}
+	if err := json.Unmarshal([]byte(data), p); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", LivenessProbeAnnotationKey, err)
+	}
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = defaultLivenessFailureThreshold
+	}
+	if p.Remediation == "" {
+		p.Remediation = vmprovider.RestartTypeGuestReboot
+	}
+	if p.RemediationBackoffSeconds <= 0 {
+		p.RemediationBackoffSeconds = defaultRemediationBackoffSeconds
+	}
+	return p, nil
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2020-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package probe
@@ -7,9 +7,12 @@ import (
 	goctx "context"
 	"time"
 
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
 	"github.com/vmware-tanzu/vm-operator/pkg/prober/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 )
 
 type Result int
@@ -23,8 +26,25 @@ const (
 	Success
 
 	defaultConnectTimeout = 10 * time.Second
+
+	// heartbeatBatchWindow and maxHeartbeatBatchSize bound how long, and for how many VMs, guest
+	// heartbeat probes wait to be fetched together.
+	heartbeatBatchWindow  = 100 * time.Millisecond
+	maxHeartbeatBatchSize = 100
 )
 
+// String returns the name of the result, which is also used as the result metrics label.
+func (r Result) String() string {
+	switch r {
+	case Failure:
+		return "failure"
+	case Success:
+		return "success"
+	default:
+		return "unknown"
+	}
+}
+
 // Probe is the interface to execute VM probes.
 type Probe interface {
 	Probe(ctx *context.ProbeContext) (Result, error)
@@ -33,18 +53,24 @@ type Probe interface {
 // Probing related provider methods.
 type vmProviderProber interface {
 	GetVirtualMachineGuestHeartbeat(ctx goctx.Context, vm *vmopv1alpha1.VirtualMachine) (vmopv1alpha1.GuestHeartbeatStatus, error)
+	GetVirtualMachineGuestHeartbeats(ctx goctx.Context, vms []*vmopv1alpha1.VirtualMachine) (map[string]vmopv1alpha1.GuestHeartbeatStatus, error)
+	RunVirtualMachineGuestProgram(ctx goctx.Context, vm *vmopv1alpha1.VirtualMachine, program vmprovider.GuestProgram) (int32, error)
 }
 
 // Prober contains the different type of probes.
 type Prober struct {
 	TCPProbe       Probe
 	GuestHeartbeat Probe
+	HTTPProbe      Probe
+	ExecProbe      Probe
 }
 
 // NewProber creates a new Prober.
-func NewProber(vmProviderProber vmProviderProber) *Prober {
+func NewProber(client client.Client, vmProviderProber vmProviderProber) *Prober {
 	return &Prober{
 		TCPProbe:       NewTcpProber(),
-		GuestHeartbeat: NewGuestHeartbeatProber(vmProviderProber),
+		GuestHeartbeat: NewBatchedGuestHeartbeatProber(vmProviderProber, heartbeatBatchWindow, maxHeartbeatBatchSize),
+		HTTPProbe:      NewHTTPProber(),
+		ExecProbe:      NewExecProber(client, vmProviderProber),
 	}
 }
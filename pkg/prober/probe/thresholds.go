@@ -0,0 +1,56 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// ThresholdsAnnotationKey is the VirtualMachine annotation with the JSON encoded Thresholds of its
+	// readiness probe. The VirtualMachine readiness probe spec does not have thresholds.
+	ThresholdsAnnotationKey = "readinessprobe.vmoperator.vmware.com/thresholds"
+
+	// A single result changes the Ready condition by default, like before the thresholds could be
+	// set, so that a VirtualMachine without thresholds is not ready after its first failure.
+	defaultSuccessThreshold = 1
+	defaultFailureThreshold = 1
+)
+
+// Thresholds describes when the result of a readiness probe changes the Ready condition.
+type Thresholds struct {
+	// InitialDelaySeconds is the number of seconds after the VirtualMachine is added to the prober
+	// manager before the first probe is run. Defaults to 0.
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+
+	// SuccessThreshold is the number of consecutive successes after which a VirtualMachine that is
+	// not ready becomes ready. Defaults to 1.
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+
+	// FailureThreshold is the number of consecutive failures after which a VirtualMachine that is
+	// ready becomes not ready. Defaults to 1.
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+// GetThresholds returns the Thresholds of the VirtualMachine readiness probe. Defaults are applied,
+// so the defaults are returned if the VirtualMachine does not have the annotation.
+func GetThresholds(vm *vmopv1alpha1.VirtualMachine) (*Thresholds, error) {
+	t := &Thresholds{}
+	if data, ok := vm.Annotations[ThresholdsAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(data), t); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %v", ThresholdsAnnotationKey, err)
+		}
+	}
+
+	if t.SuccessThreshold <= 0 {
+		t.SuccessThreshold = defaultSuccessThreshold
+	}
+	if t.FailureThreshold <= 0 {
+		t.FailureThreshold = defaultFailureThreshold
+	}
+	return t, nil
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2020-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package prober
@@ -29,14 +29,18 @@ import (
 const (
 	proberManagerName       = "virtualmachine-prober-manager"
 	readinessProbeQueueName = "readinessProbeQueue"
+	livenessProbeQueueName  = "livenessProbeQueue"
 
 	// defaultPeriodSeconds represents the default value for the frequency (in seconds) to perform the probe.
 	// We use the same default value as the kubernetes container probe.
 	defaultPeriodSeconds = 10
 
-	// the number of readiness workers.
-	// TODO: find a way to calibrate it.
-	numberOfReadinessWorkers = 5
+	// the default number of readiness workers, which is the number of readiness probes run
+	// concurrently. Guest heartbeat probes run concurrently are fetched together.
+	defaultNumberOfReadinessWorkers = 5
+
+	// the number of goroutines running the liveness worker.
+	numberOfLivenessWorkers = 2
 )
 
 // Manager represents a prober manager interface.
@@ -50,17 +54,34 @@ type Manager interface {
 type manager struct {
 	client         client.Client
 	readinessQueue workqueue.DelayingInterface
+	livenessQueue  workqueue.DelayingInterface
 	prober         *probe.Prober
+	vmProvider     vmprovider.VirtualMachineProviderInterface
 	log            logr.Logger
 	recorder       vmoprecord.Recorder
 
 	workersWG sync.WaitGroup
 
+	// numberOfReadinessWorkers is the number of goroutines running the readiness probes.
+	numberOfReadinessWorkers int
+
 	// We will use AddAfter to add an item to the queue, which will insert the item to a heap first
 	// if the time duration set in the AddAfter is not zero. vmReadinessProbeList can be used to avoid
 	// adding VMs to the readiness queue when this VM is already in the heap but not in the queue.
 	readinessMutex       sync.Mutex
 	vmReadinessProbeList map[string]*vmoperatorv1alpha1.Probe
+
+	// vmReadinessProbeStates keeps the consecutive readiness probe results of the VMs in the
+	// vmReadinessProbeList. It is protected by the readinessMutex.
+	vmReadinessProbeStates map[string]*context.ProbeState
+
+	// vmLivenessProbeList is the same as vmReadinessProbeList for the liveness queue.
+	livenessMutex       sync.Mutex
+	vmLivenessProbeList map[string]*probe.LivenessProbe
+
+	// livenessWorker is shared by the liveness goroutines, and keeps the liveness state of the VMs.
+	// It is set once the manager is started and is protected by the livenessMutex.
+	livenessWorker worker.Worker
 }
 
 // NewManger initializes a prober manager.
@@ -68,20 +89,31 @@ func NewManger(client client.Client, record vmoprecord.Recorder, vmProvider vmpr
 	probeManager := &manager{
 		client:               client,
 		readinessQueue:       workqueue.NewNamedDelayingQueue(readinessProbeQueueName),
-		prober:               probe.NewProber(vmProvider),
+		livenessQueue:        workqueue.NewNamedDelayingQueue(livenessProbeQueueName),
+		prober:               probe.NewProber(client, vmProvider),
+		vmProvider:           vmProvider,
 		log:                  ctrl.Log.WithName(proberManagerName),
 		recorder:             record,
 		vmReadinessProbeList: make(map[string]*vmoperatorv1alpha1.Probe),
+		vmLivenessProbeList:  make(map[string]*probe.LivenessProbe),
+
+		vmReadinessProbeStates:   make(map[string]*context.ProbeState),
+		numberOfReadinessWorkers: defaultNumberOfReadinessWorkers,
 	}
 	return probeManager
 }
 
-// AddToManager adds the probe manager controller manager.
-func AddToManager(mgr ctrlmgr.Manager, vmProvider vmprovider.VirtualMachineProviderInterface) (Manager, error) {
+// AddToManager adds the probe manager controller manager. At most maxConcurrentProbes readiness
+// probes are run concurrently, or the default if it is not positive.
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+func AddToManager(mgr ctrlmgr.Manager, vmProvider vmprovider.VirtualMachineProviderInterface, maxConcurrentProbes int) (Manager, error) {
 	probeRecorder := vmoprecord.New(mgr.GetEventRecorderFor(proberManagerName))
 
 	// Add the probe manager explicitly as runnable in order to receive a Start() event.
 	m := NewManger(mgr.GetClient(), probeRecorder, vmProvider)
+	if maxConcurrentProbes > 0 {
+		m.(*manager).numberOfReadinessWorkers = maxConcurrentProbes
+	}
 	err := mgr.Add(m)
 	if err != nil {
 		return nil, err
@@ -94,6 +126,8 @@ func (m *manager) AddToProberManager(vm *vmoperatorv1alpha1.VirtualMachine) {
 	vmName := vm.NamespacedName()
 	m.log.V(4).Info("Add to prober manager", "vm", vmName)
 
+	m.addToLivenessProbeList(vm)
+
 	m.readinessMutex.Lock()
 	defer m.readinessMutex.Unlock()
 
@@ -101,26 +135,88 @@ func (m *manager) AddToProberManager(vm *vmoperatorv1alpha1.VirtualMachine) {
 		// if the VM is not in the list, or its readiness probe spec has been updated, immediately add it to the queue
 		// otherwise, ignore it.
 		newProbe := vm.Spec.ReadinessProbe
-		if oldProbe, ok := m.vmReadinessProbeList[vmName]; ok && reflect.DeepEqual(oldProbe, newProbe) {
+		oldProbe, ok := m.vmReadinessProbeList[vmName]
+		if ok && reflect.DeepEqual(oldProbe, newProbe) {
 			m.log.V(4).Info("VM is already in the readiness probe list and its probe spec is not updated, skip it", "vm", vmName)
 			return
 		}
 
-		m.readinessQueue.Add(client.ObjectKey{Name: vm.Name, Namespace: vm.Namespace})
+		item := client.ObjectKey{Name: vm.Name, Namespace: vm.Namespace}
+		if initialDelay := m.getInitialDelay(vm); !ok && initialDelay > 0 {
+			// The VM is new to the prober manager, so delay its first probe.
+			m.readinessQueue.AddAfter(item, initialDelay)
+		} else {
+			m.readinessQueue.Add(item)
+		}
 		m.vmReadinessProbeList[vmName] = newProbe
+		m.vmReadinessProbeStates[vmName] = &context.ProbeState{}
 	} else {
 		delete(m.vmReadinessProbeList, vmName)
+		delete(m.vmReadinessProbeStates, vmName)
 	}
 }
 
+// getInitialDelay returns the delay before the first readiness probe of a VM.
+func (m *manager) getInitialDelay(vm *vmoperatorv1alpha1.VirtualMachine) time.Duration {
+	thresholds, err := probe.GetThresholds(vm)
+	if err != nil {
+		m.log.Error(err, "Ignoring invalid readiness probe thresholds", "vm", vm.NamespacedName())
+		return 0
+	}
+	return time.Duration(thresholds.InitialDelaySeconds) * time.Second
+}
+
+// getReadinessProbeState returns the readiness probe state of a VM, or nil if the VM is not in
+// the readiness probe list.
+func (m *manager) getReadinessProbeState(vm *vmoperatorv1alpha1.VirtualMachine) *context.ProbeState {
+	m.readinessMutex.Lock()
+	defer m.readinessMutex.Unlock()
+	return m.vmReadinessProbeStates[vm.NamespacedName()]
+}
+
+// addToLivenessProbeList adds a VM with a liveness probe to the liveness queue.
+func (m *manager) addToLivenessProbeList(vm *vmoperatorv1alpha1.VirtualMachine) {
+	vmName := vm.NamespacedName()
+
+	m.livenessMutex.Lock()
+	defer m.livenessMutex.Unlock()
+
+	newProbe, err := probe.GetLivenessProbe(vm)
+	if err != nil {
+		m.log.Error(err, "Ignoring invalid liveness probe", "vm", vmName)
+	}
+	if newProbe == nil {
+		delete(m.vmLivenessProbeList, vmName)
+		return
+	}
+
+	if oldProbe, ok := m.vmLivenessProbeList[vmName]; ok && reflect.DeepEqual(oldProbe, newProbe) {
+		m.log.V(4).Info("VM is already in the liveness probe list and its probe spec is not updated, skip it", "vm", vmName)
+		return
+	}
+
+	m.livenessQueue.Add(client.ObjectKey{Name: vm.Name, Namespace: vm.Namespace})
+	m.vmLivenessProbeList[vmName] = newProbe
+}
+
 // RemoveFromProberManager removes a VM from the prober manager.
 func (m *manager) RemoveFromProberManager(vm *vmoperatorv1alpha1.VirtualMachine) {
 	vmName := vm.NamespacedName()
 	m.log.V(4).Info("Remove from prober manager", "vm", vmName)
 
 	m.readinessMutex.Lock()
-	defer m.readinessMutex.Unlock()
 	delete(m.vmReadinessProbeList, vmName)
+	delete(m.vmReadinessProbeStates, vmName)
+	m.readinessMutex.Unlock()
+
+	m.livenessMutex.Lock()
+	delete(m.vmLivenessProbeList, vmName)
+	livenessWorker := m.livenessWorker
+	m.livenessMutex.Unlock()
+
+	if livenessWorker != nil {
+		livenessWorker.ForgetVM(vmName)
+	}
 }
 
 // Start starts the probe manager
@@ -128,15 +224,26 @@ func (m *manager) Start(stopChan <-chan struct{}) error {
 	m.log.Info("Start VirtualMachine Probe Manager")
 	defer m.log.Info("Stop VirtualMachine Probe Manager")
 
-	m.log.Info("Starting readiness workers", "count", numberOfReadinessWorkers)
-	m.workersWG.Add(numberOfReadinessWorkers)
-	for i := 0; i < numberOfReadinessWorkers; i++ {
+	m.log.Info("Starting readiness workers", "count", m.numberOfReadinessWorkers)
+	m.workersWG.Add(m.numberOfReadinessWorkers)
+	for i := 0; i < m.numberOfReadinessWorkers; i++ {
 		readinessWorker := worker.NewReadinessWorker(m.readinessQueue, m.prober, m.client, m.recorder)
 		m.worker(readinessWorker)
 	}
 
+	m.log.Info("Starting liveness workers", "count", numberOfLivenessWorkers)
+	m.workersWG.Add(numberOfLivenessWorkers)
+	livenessWorker := worker.NewLivenessWorker(m.livenessQueue, m.prober, m.client, m.recorder, m.vmProvider)
+	m.livenessMutex.Lock()
+	m.livenessWorker = livenessWorker
+	m.livenessMutex.Unlock()
+	for i := 0; i < numberOfLivenessWorkers; i++ {
+		m.worker(livenessWorker)
+	}
+
 	<-stopChan
 	m.readinessQueue.ShutDown()
+	m.livenessQueue.ShutDown()
 	m.workersWG.Wait()
 	return nil
 }
@@ -169,6 +276,7 @@ func (m *manager) processItemFromQueue(w worker.Worker) bool {
 	vm := &vmoperatorv1alpha1.VirtualMachine{}
 	if err := m.client.Get(goctx.Background(), item, vm); err != nil {
 		if apierrors.IsNotFound(err) {
+			w.ForgetVM(item.String())
 			return false
 		}
 		// Get VM error, immediately re-queue the VM.
@@ -183,14 +291,20 @@ func (m *manager) processItemFromQueue(w worker.Worker) bool {
 
 	if ctx.ProbeSpec == nil {
 		ctx.Logger.V(4).Info("probe is not specified")
+		w.ForgetVM(vm.NamespacedName())
 		return false
 	}
 
 	if !vm.ObjectMeta.DeletionTimestamp.IsZero() {
 		ctx.Logger.V(4).Info("the VirtualMachine is marked for deletion, skip running the probe")
+		w.ForgetVM(vm.NamespacedName())
 		return false
 	}
 
+	if queue == m.readinessQueue {
+		ctx.State = m.getReadinessProbeState(vm)
+	}
+
 	err = m.processVMProbe(w, ctx)
 	// Immediately re-queue the request if error occurs.
 	m.addItemToQueue(queue, ctx, item, err != nil)
@@ -205,6 +319,11 @@ func (m *manager) processVMProbe(w worker.Worker, ctx *context.ProbeContext) err
 		// If a vm is not powered on, we don't run probes against it and translate probe result to failure.
 		// Populate the Condition and update the VM status.
 		ctx.Logger.V(4).Info("the VirtualMachine is not powered on")
+		// The failure threshold does not apply: a VM that is not powered on is immediately not ready.
+		if ctx.State != nil {
+			*ctx.State = context.ProbeState{}
+			ctx.State = nil
+		}
 		return w.ProcessProbeResult(ctx, probe.Failure, fmt.Errorf("virtual machine is not powered on"))
 	}
 	return w.DoProbe(ctx)
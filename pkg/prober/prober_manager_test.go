@@ -123,6 +123,7 @@ var _ = Describe("VirtualMachine probes", func() {
 				quit := testManager.processItemFromQueue(fakeWorker)
 				Expect(quit).To(BeFalse())
 				checkProbeQueueLenConsistently(2*periodSeconds, 0)
+				Expect(fakeWorker.ForgottenVMs).To(ConsistOf(vm.NamespacedName()))
 			})
 
 			It("Should set probe result as failed if the VM is powered off", func() {
@@ -225,6 +226,38 @@ var _ = Describe("VirtualMachine probes", func() {
 			})
 		})
 
+		When("VM has an initial delay", func() {
+			BeforeEach(func() {
+				vm.Annotations = map[string]string{
+					probe.ThresholdsAnnotationKey: `{"initialDelaySeconds": 1}`,
+				}
+			})
+
+			It("Should add to the queue after the initial delay", func() {
+				testManager.AddToProberManager(vm)
+
+				Expect(testManager.readinessQueue.Len()).To(Equal(0))
+				checkProbeQueueLenEventually(3, 1)
+			})
+		})
+
+		It("Should keep the probe state of the VM until it is removed", func() {
+			testManager.AddToProberManager(vm)
+			Expect(testManager.getReadinessProbeState(vm)).ToNot(BeNil())
+
+			fakeWorker.DoProbeFn = func(ctx *context.ProbeContext) error {
+				if ctx.State == nil {
+					return fmt.Errorf("probe context has no state")
+				}
+				return nil
+			}
+			Expect(testManager.processItemFromQueue(fakeWorker)).To(BeFalse())
+			Expect(testManager.readinessQueue.Len()).To(Equal(0))
+
+			testManager.RemoveFromProberManager(vm)
+			Expect(testManager.getReadinessProbeState(vm)).To(BeNil())
+		})
+
 		When("VM has already been added to the prober manager", func() {
 			var newVM *vmopv1alpha1.VirtualMachine
 			JustBeforeEach(func() {
@@ -266,6 +299,42 @@ var _ = Describe("VirtualMachine probes", func() {
 				testManager.readinessMutex.Unlock()
 			})
 		})
+
+		When("VM has a liveness probe", func() {
+			BeforeEach(func() {
+				vm.Annotations = map[string]string{
+					probe.LivenessProbeAnnotationKey: `{"guestHeartbeat": {"thresholdStatus": "green"}}`,
+				}
+			})
+
+			It("Should add to the liveness queue and list", func() {
+				testManager.AddToProberManager(vm)
+
+				Expect(testManager.livenessQueue.Len()).To(Equal(1))
+				testManager.livenessMutex.Lock()
+				Expect(testManager.vmLivenessProbeList).Should(HaveKey(vm.NamespacedName()))
+				testManager.livenessMutex.Unlock()
+			})
+
+			It("Should do nothing if the liveness probe is not updated", func() {
+				testManager.AddToProberManager(vm)
+				testManager.livenessQueue.Get()
+				testManager.AddToProberManager(vm)
+
+				Expect(testManager.livenessQueue.Len()).To(Equal(0))
+			})
+
+			It("Should remove from the liveness list when the VM is removed from the manager", func() {
+				testManager.livenessWorker = fakeWorker
+				testManager.AddToProberManager(vm)
+				testManager.RemoveFromProberManager(vm)
+
+				testManager.livenessMutex.Lock()
+				Expect(testManager.vmLivenessProbeList).ShouldNot(HaveKey(vm.NamespacedName()))
+				testManager.livenessMutex.Unlock()
+				Expect(fakeWorker.ForgottenVMs).To(ConsistOf(vm.NamespacedName()))
+			})
+		})
 	})
 })
 
@@ -0,0 +1,234 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package worker
+
+import (
+	goctx "context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/pkg/errors"
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/patch"
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/probe"
+	vmoprecord "github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+const (
+	// RemediatedCondition records the last remediation of a VM whose liveness probe failed. The
+	// reason is the remediation, and the last transition time is when the VM was remediated.
+	RemediatedCondition vmopv1alpha1.ConditionType = "Remediated"
+
+	// RemediationFailedReason (Severity=Warning) documents that the remediation of a VM failed.
+	RemediationFailedReason = "RemediationFailed"
+
+	// MaxRemediationBackoff caps the time between two remediations of a VM.
+	MaxRemediationBackoff = time.Hour
+)
+
+// Remediation related provider methods.
+type vmProviderRemediator interface {
+	RestartVirtualMachine(ctx goctx.Context, vm *vmopv1alpha1.VirtualMachine, restartType vmprovider.RestartType) error
+}
+
+// livenessState is the state of the liveness probe of a VM between two probes.
+type livenessState struct {
+	// failures is the number of consecutive failures since the last success or remediation.
+	failures int32
+	// remediations is the number of consecutive remediations since the last success.
+	remediations int
+}
+
+// livenessWorker implements Worker interface. Unlike the readinessWorker, a single livenessWorker
+// is shared by all the liveness goroutines because it keeps the state of the probes.
+type livenessWorker struct {
+	queue      workqueue.DelayingInterface
+	prober     *probe.Prober
+	client     client.Client
+	recorder   vmoprecord.Recorder
+	remediator vmProviderRemediator
+
+	mutex  sync.Mutex
+	states map[string]*livenessState
+}
+
+// NewLivenessWorker creates a new liveness worker to run liveness probes and remediate VMs whose
+// liveness probe fails.
+func NewLivenessWorker(
+	queue workqueue.DelayingInterface,
+	prober *probe.Prober,
+	client client.Client,
+	recorder vmoprecord.Recorder,
+	remediator vmProviderRemediator,
+) Worker {
+	return &livenessWorker{
+		queue:      queue,
+		prober:     prober,
+		client:     client,
+		recorder:   recorder,
+		remediator: remediator,
+		states:     make(map[string]*livenessState),
+	}
+}
+
+func (w *livenessWorker) GetQueue() workqueue.DelayingInterface {
+	return w.queue
+}
+
+// CreateProbeContext creates a probe context for liveness probe.
+func (w *livenessWorker) CreateProbeContext(vm *vmopv1alpha1.VirtualMachine) (*context.ProbeContext, error) {
+	livenessProbe, err := probe.GetLivenessProbe(vm)
+	if err != nil {
+		return nil, err
+	}
+
+	patchHelper, err := patch.NewHelper(vm, w.client)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &context.ProbeContext{
+		Context:     goctx.Background(),
+		Logger:      ctrl.Log.WithName("liveness-probe").WithValues("vmName", vm.NamespacedName()),
+		PatchHelper: patchHelper,
+		VM:          vm,
+		ProbeType:   "liveness",
+	}
+	if livenessProbe != nil {
+		ctx.ProbeSpec = &livenessProbe.Probe
+	}
+	return ctx, nil
+}
+
+func (w *livenessWorker) DoProbe(ctx *context.ProbeContext) error {
+	start := time.Now()
+	res, err := w.runProbe(ctx)
+	observeProbe(ctx.ProbeType, res, time.Since(start))
+	if err != nil {
+		ctx.Logger.V(4).Info("liveness probe fails", "result", res, "error", err.Error())
+	}
+	return w.ProcessProbeResult(ctx, res, err)
+}
+
+// ProcessProbeResult counts the consecutive failures of the liveness probe, and remediates the VM
+// once they reach the failure threshold unless the VM was remediated within the backoff.
+func (w *livenessWorker) ProcessProbeResult(ctx *context.ProbeContext, res probe.Result, resErr error) error {
+	vm := ctx.VM
+	vmName := vm.NamespacedName()
+
+	// A VM that is not powered on is not remediated: its power state is managed by its spec.
+	if vm.Status.PowerState != vmopv1alpha1.VirtualMachinePoweredOn {
+		w.ForgetVM(vmName)
+		return nil
+	}
+
+	livenessProbe, err := probe.GetLivenessProbe(vm)
+	if err != nil || livenessProbe == nil {
+		w.ForgetVM(vmName)
+		return err
+	}
+
+	w.mutex.Lock()
+	state, ok := w.states[vmName]
+	if !ok {
+		state = &livenessState{}
+		w.states[vmName] = state
+	}
+
+	switch res {
+	case probe.Success:
+		state.failures = 0
+		state.remediations = 0
+		w.mutex.Unlock()
+		return nil
+	case probe.Failure:
+		state.failures++
+	}
+
+	if state.failures < livenessProbe.FailureThreshold {
+		w.mutex.Unlock()
+		return nil
+	}
+
+	backoff := livenessProbe.RemediationBackoff(state.remediations, MaxRemediationBackoff)
+	if last := conditions.GetLastTransitionTime(vm, RemediatedCondition); last != nil && time.Since(last.Time) < backoff {
+		w.mutex.Unlock()
+		ctx.Logger.V(4).Info("liveness probe failed but the VM was recently remediated", "backoff", backoff)
+		return nil
+	}
+
+	failures := state.failures
+	state.failures = 0
+	state.remediations++
+	w.mutex.Unlock()
+
+	return w.remediate(ctx, livenessProbe.Remediation, failures, resErr)
+}
+
+// remediate restarts the VM, and records the remediation in an event and the RemediatedCondition.
+func (w *livenessWorker) remediate(ctx *context.ProbeContext, remediation vmprovider.RestartType, failures int32, resErr error) error {
+	vm := ctx.VM
+
+	msg := fmt.Sprintf("liveness probe failed %d times", failures)
+	if resErr != nil {
+		msg = fmt.Sprintf("%s: %v", msg, resErr)
+	}
+
+	ctx.Logger.Info("Remediating VM", "remediation", remediation, "reason", msg)
+	condition := &vmopv1alpha1.Condition{
+		Type:   RemediatedCondition,
+		Status: corev1.ConditionTrue,
+		Reason: string(remediation),
+	}
+	if err := w.remediator.RestartVirtualMachine(ctx, vm, remediation); err != nil {
+		w.recorder.Warnf(vm, RemediationFailedReason, "%s remediation failed: %v", remediation, err)
+		condition = conditions.FalseCondition(RemediatedCondition, RemediationFailedReason, vmopv1alpha1.ConditionSeverityWarning,
+			"%s remediation failed: %v", remediation, err)
+	} else {
+		w.recorder.Warn(vm, string(remediation), msg)
+		condition.Message = msg
+	}
+
+	// Delete the condition so that its last transition time is the time of this remediation.
+	conditions.Delete(vm, RemediatedCondition)
+	conditions.Set(vm, condition)
+
+	err := ctx.PatchHelper.Patch(ctx, vm, patch.WithOwnedConditions{
+		Conditions: []vmopv1alpha1.ConditionType{RemediatedCondition},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "patched failed")
+	}
+
+	return nil
+}
+
+// runProbe runs a specific type of probe based on the VM liveness probe spec.
+func (w *livenessWorker) runProbe(ctx *context.ProbeContext) (probe.Result, error) {
+	switch {
+	case ctx.ProbeSpec.TCPSocket != nil:
+		return w.prober.TCPProbe.Probe(ctx)
+	case ctx.ProbeSpec.GuestHeartbeat != nil:
+		return w.prober.GuestHeartbeat.Probe(ctx)
+	}
+
+	return probe.Unknown, fmt.Errorf("unknown action specified for VM %s liveness probe", ctx.VM.NamespacedName())
+}
+
+// ForgetVM drops the liveness state of the VM.
+func (w *livenessWorker) ForgetVM(vmName string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.states, vmName)
+}
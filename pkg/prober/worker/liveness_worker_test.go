@@ -0,0 +1,219 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package worker
+
+import (
+	goctx "context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/context"
+	fakeprobe "github.com/vmware-tanzu/vm-operator/pkg/prober/fake/probe"
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/probe"
+	"github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	fakevmprovider "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/fake"
+	"github.com/vmware-tanzu/vm-operator/test/builder"
+)
+
+var _ = Describe("VirtualMachine liveness probes", func() {
+	var (
+		testWorker Worker
+
+		vm    *vmopv1alpha1.VirtualMachine
+		vmKey client.ObjectKey
+
+		fakeClient         client.Client
+		fakeEvents         chan string
+		fakeHeartbeatProbe *fakeprobe.FakeProbe
+		fakeProvider       *fakevmprovider.FakeVmProvider
+		restarts           []vmprovider.RestartType
+	)
+
+	BeforeEach(func() {
+		vm = &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-vm",
+				Namespace: "dummy-ns",
+				Annotations: map[string]string{
+					probe.LivenessProbeAnnotationKey: `{"guestHeartbeat": {"thresholdStatus": "green"}, "failureThreshold": 2, "remediation": "Reset"}`,
+				},
+			},
+			Spec: vmopv1alpha1.VirtualMachineSpec{
+				ClassName: "dummy-vmclass",
+			},
+			Status: vmopv1alpha1.VirtualMachineStatus{
+				PowerState: vmopv1alpha1.VirtualMachinePoweredOn,
+			},
+		}
+		vmKey = client.ObjectKey{Name: vm.Name, Namespace: vm.Namespace}
+
+		restarts = nil
+		fakeProvider = &fakevmprovider.FakeVmProvider{}
+		fakeProvider.Reset()
+		fakeProvider.RestartVirtualMachineFn = func(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine, restartType vmprovider.RestartType) error {
+			restarts = append(restarts, restartType)
+			return nil
+		}
+
+		fakeHeartbeatProbe = fakeprobe.NewFakeProbe().(*fakeprobe.FakeProbe)
+		fakeHeartbeatProbe.ProbeFn = func(ctx *context.ProbeContext) (probe.Result, error) {
+			return probe.Failure, fmt.Errorf("heartbeat error")
+		}
+	})
+
+	JustBeforeEach(func() {
+		fakeClient, _ = builder.NewFakeClient()
+		Expect(fakeClient.Create(goctx.Background(), vm)).To(Succeed())
+		var fakeRecorder record.Recorder
+		fakeRecorder, fakeEvents = builder.NewFakeRecorder()
+
+		queue := workqueue.NewNamedDelayingQueue("test")
+		prober := &probe.Prober{
+			GuestHeartbeat: fakeHeartbeatProbe,
+		}
+		testWorker = NewLivenessWorker(queue, prober, fakeClient, fakeRecorder, fakeProvider)
+	})
+
+	// doProbe runs the liveness probe against the latest VM.
+	doProbe := func() {
+		latest := &vmopv1alpha1.VirtualMachine{}
+		Expect(fakeClient.Get(goctx.Background(), vmKey, latest)).To(Succeed())
+		ctx, err := testWorker.CreateProbeContext(latest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ctx.ProbeSpec).ToNot(BeNil())
+		Expect(testWorker.DoProbe(ctx)).To(Succeed())
+	}
+
+	remediatedCondition := func() *vmopv1alpha1.Condition {
+		latest := &vmopv1alpha1.VirtualMachine{}
+		Expect(fakeClient.Get(goctx.Background(), vmKey, latest)).To(Succeed())
+		return conditions.Get(latest, RemediatedCondition)
+	}
+
+	It("Should not remediate before the failure threshold", func() {
+		doProbe()
+		Expect(restarts).To(BeEmpty())
+		Expect(remediatedCondition()).To(BeNil())
+	})
+
+	It("Should remediate the VM at the failure threshold", func() {
+		doProbe()
+		doProbe()
+		Expect(restarts).To(Equal([]vmprovider.RestartType{vmprovider.RestartTypeReset}))
+
+		condition := remediatedCondition()
+		Expect(condition).ToNot(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Reason).To(Equal(string(vmprovider.RestartTypeReset)))
+		Expect(condition.Message).To(ContainSubstring("heartbeat error"))
+		Expect(fakeEvents).To(Receive(ContainSubstring(string(vmprovider.RestartTypeReset))))
+	})
+
+	It("Should not remediate the VM again within the backoff", func() {
+		for i := 0; i < 6; i++ {
+			doProbe()
+		}
+		Expect(restarts).To(HaveLen(1))
+	})
+
+	It("Should remediate the VM again after the backoff", func() {
+		doProbe()
+		doProbe()
+		Expect(restarts).To(HaveLen(1))
+
+		latest := &vmopv1alpha1.VirtualMachine{}
+		Expect(fakeClient.Get(goctx.Background(), vmKey, latest)).To(Succeed())
+		for i := range latest.Status.Conditions {
+			if latest.Status.Conditions[i].Type == RemediatedCondition {
+				latest.Status.Conditions[i].LastTransitionTime = metav1.NewTime(time.Now().Add(-MaxRemediationBackoff))
+			}
+		}
+		Expect(fakeClient.Status().Update(goctx.Background(), latest)).To(Succeed())
+
+		doProbe()
+		doProbe()
+		Expect(restarts).To(HaveLen(2))
+	})
+
+	It("Should reset the failures when the probe succeeds", func() {
+		doProbe()
+		fakeHeartbeatProbe.ProbeFn = func(ctx *context.ProbeContext) (probe.Result, error) {
+			return probe.Success, nil
+		}
+		doProbe()
+		fakeHeartbeatProbe.ProbeFn = func(ctx *context.ProbeContext) (probe.Result, error) {
+			return probe.Failure, nil
+		}
+		doProbe()
+		Expect(restarts).To(BeEmpty())
+	})
+
+	It("Should drop the state of a forgotten VM", func() {
+		doProbe()
+		Expect(testWorker.(*livenessWorker).states).To(HaveKey(vm.NamespacedName()))
+
+		testWorker.ForgetVM(vm.NamespacedName())
+		Expect(testWorker.(*livenessWorker).states).To(BeEmpty())
+
+		doProbe()
+		Expect(restarts).To(BeEmpty(), "the failures before the VM was forgotten are not counted")
+	})
+
+	When("the remediation fails", func() {
+		BeforeEach(func() {
+			fakeProvider.RestartVirtualMachineFn = func(_ goctx.Context, _ *vmopv1alpha1.VirtualMachine, _ vmprovider.RestartType) error {
+				return fmt.Errorf("reset error")
+			}
+		})
+
+		It("Should record the failure", func() {
+			doProbe()
+			doProbe()
+
+			condition := remediatedCondition()
+			Expect(condition).ToNot(BeNil())
+			Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			Expect(condition.Reason).To(Equal(RemediationFailedReason))
+			Expect(condition.Message).To(ContainSubstring("reset error"))
+			Expect(fakeEvents).To(Receive(ContainSubstring(RemediationFailedReason)))
+		})
+	})
+
+	When("the VM is not powered on", func() {
+		BeforeEach(func() {
+			vm.Status.PowerState = vmopv1alpha1.VirtualMachinePoweredOff
+		})
+
+		It("Should not remediate the VM", func() {
+			for i := 0; i < 3; i++ {
+				doProbe()
+			}
+			Expect(restarts).To(BeEmpty())
+		})
+	})
+
+	When("the VM does not have a liveness probe", func() {
+		BeforeEach(func() {
+			vm.Annotations = nil
+		})
+
+		It("Should not have a probe spec", func() {
+			ctx, err := testWorker.CreateProbeContext(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ctx.ProbeSpec).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,42 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package worker
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/prober/probe"
+)
+
+// The depth of the probe queues is exported by the controller-runtime workqueue metrics, as
+// workqueue_depth with the name of the queue.
+var (
+	probeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "vmoperator",
+		Subsystem: "prober",
+		Name:      "probe_duration_seconds",
+		Help:      "Duration of the VirtualMachine probes in seconds.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"probe_type"})
+
+	probeResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vmoperator",
+		Subsystem: "prober",
+		Name:      "probe_results_total",
+		Help:      "Number of VirtualMachine probe results.",
+	}, []string{"probe_type", "result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(probeDuration, probeResults)
+}
+
+// observeProbe records the duration and the result of a probe.
+func observeProbe(probeType string, res probe.Result, duration time.Duration) {
+	probeDuration.WithLabelValues(probeType).Observe(duration.Seconds())
+	probeResults.WithLabelValues(probeType, res.String()).Inc()
+}
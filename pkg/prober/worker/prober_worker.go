@@ -18,4 +18,7 @@ type Worker interface {
 	CreateProbeContext(vm *vmopv1alpha1.VirtualMachine) (*context.ProbeContext, error)
 	DoProbe(ctx *context.ProbeContext) error
 	ProcessProbeResult(ctx *context.ProbeContext, res probe.Result, resErr error) error
+	// ForgetVM drops any state the worker keeps between the probes of the VM once it is no longer
+	// probed.
+	ForgetVM(vmName string)
 }
@@ -1,4 +1,4 @@
-// Copyright (c) 2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2020-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package worker
@@ -6,6 +6,7 @@ package worker
 import (
 	goctx "context"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/util/workqueue"
@@ -79,6 +80,11 @@ func (w *readinessWorker) ProcessProbeResult(ctx *context.ProbeContext, res prob
 	vm := ctx.VM
 	condition := w.getCondition(res, resErr)
 
+	if !w.thresholdReached(ctx, res, condition) {
+		ctx.Logger.V(4).Info("readiness probe result is below the threshold, skip the transition", "result", res)
+		return nil
+	}
+
 	// We only send event when either the condition type is added or its status changes, not
 	// if either its reason, severity, or message changes.
 	if c := conditions.Get(vm, condition.Type); c == nil || c.Status != condition.Status {
@@ -101,8 +107,14 @@ func (w *readinessWorker) ProcessProbeResult(ctx *context.ProbeContext, res prob
 	return nil
 }
 
+// ForgetVM is a no-op since the readiness state of the VMs is kept by the prober manager.
+func (w *readinessWorker) ForgetVM(vmName string) {
+}
+
 func (w *readinessWorker) DoProbe(ctx *context.ProbeContext) error {
+	start := time.Now()
 	res, err := w.runProbe(ctx)
+	observeProbe(ctx.ProbeType, res, time.Since(start))
 	if err != nil {
 		ctx.Logger.Error(err, "readiness probe fails", "result", res)
 	}
@@ -110,26 +122,66 @@ func (w *readinessWorker) DoProbe(ctx *context.ProbeContext) error {
 }
 
 // getProbe returns a specific type of probe method.
-func (w *readinessWorker) getProbe(probeSpec *vmopv1alpha1.Probe) probe.Probe {
+func (w *readinessWorker) getProbe(vm *vmopv1alpha1.VirtualMachine, probeSpec *vmopv1alpha1.Probe) probe.Probe {
 	if probeSpec.TCPSocket != nil {
 		return w.prober.TCPProbe
 	}
 	if probeSpec.GuestHeartbeat != nil {
 		return w.prober.GuestHeartbeat
 	}
+	if _, ok := vm.Annotations[probe.HTTPGetActionAnnotationKey]; ok {
+		return w.prober.HTTPProbe
+	}
+	if _, ok := vm.Annotations[probe.ExecActionAnnotationKey]; ok {
+		return w.prober.ExecProbe
+	}
 
 	return nil
 }
 
 // runProbe runs a specific type of probe based on the VM probe spec.
 func (w *readinessWorker) runProbe(ctx *context.ProbeContext) (probe.Result, error) {
-	if p := w.getProbe(ctx.ProbeSpec); p != nil {
+	if p := w.getProbe(ctx.VM, ctx.ProbeSpec); p != nil {
 		return p.Probe(ctx)
 	}
 
 	return probe.Unknown, fmt.Errorf("unknown action specified for VM %s readiness probe", ctx.VM.NamespacedName())
 }
 
+// thresholdReached counts the consecutive results in the probe state, and returns whether the
+// ReadyCondition can be set to the given condition. A transition of the ReadyCondition requires
+// SuccessThreshold consecutive successes or FailureThreshold consecutive failures. The first
+// ReadyCondition of a VM is set without waiting for the thresholds.
+func (w *readinessWorker) thresholdReached(ctx *context.ProbeContext, res probe.Result, condition *vmopv1alpha1.Condition) bool {
+	state := ctx.State
+	if state == nil {
+		return true
+	}
+
+	if res == probe.Success {
+		state.Successes++
+		state.Failures = 0
+	} else {
+		state.Failures++
+		state.Successes = 0
+	}
+
+	if c := conditions.Get(ctx.VM, condition.Type); c == nil || c.Status == condition.Status {
+		return true
+	}
+
+	thresholds, err := probe.GetThresholds(ctx.VM)
+	if err != nil {
+		ctx.Logger.Error(err, "Ignoring invalid readiness probe thresholds")
+		return true
+	}
+
+	if res == probe.Success {
+		return state.Successes >= thresholds.SuccessThreshold
+	}
+	return state.Failures >= thresholds.FailureThreshold
+}
+
 // getCondition returns condition based on VM probe results.
 func (w *readinessWorker) getCondition(res probe.Result, err error) *vmopv1alpha1.Condition {
 	msg := ""
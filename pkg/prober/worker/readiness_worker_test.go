@@ -10,6 +10,7 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -41,6 +42,8 @@ var _ = Describe("VirtualMachine readiness probes", func() {
 		fakeEvents         chan string
 		fakeTCPProbe       *fakeprobe.FakeProbe
 		fakeHeartbeatProbe *fakeprobe.FakeProbe
+		fakeHTTPProbe      *fakeprobe.FakeProbe
+		fakeExecProbe      *fakeprobe.FakeProbe
 	)
 
 	BeforeEach(func() {
@@ -64,9 +67,13 @@ var _ = Describe("VirtualMachine readiness probes", func() {
 		queue := workqueue.NewNamedDelayingQueue("test")
 		fakeTCPProbe = fakeprobe.NewFakeProbe().(*fakeprobe.FakeProbe)
 		fakeHeartbeatProbe = fakeprobe.NewFakeProbe().(*fakeprobe.FakeProbe)
+		fakeHTTPProbe = fakeprobe.NewFakeProbe().(*fakeprobe.FakeProbe)
+		fakeExecProbe = fakeprobe.NewFakeProbe().(*fakeprobe.FakeProbe)
 		prober := &probe.Prober{
 			TCPProbe:       fakeTCPProbe,
 			GuestHeartbeat: fakeHeartbeatProbe,
+			HTTPProbe:      fakeHTTPProbe,
+			ExecProbe:      fakeExecProbe,
 		}
 		testWorker = NewReadinessWorker(queue, prober, fakeClient, fakeRecorder)
 	})
@@ -130,6 +137,16 @@ var _ = Describe("VirtualMachine readiness probes", func() {
 				})
 			})
 
+			It("Should record the probe result metrics", func() {
+				fakeTCPProbe.ProbeFn = func(ctx *context.ProbeContext) (probe.Result, error) {
+					return probe.Failure, nil
+				}
+				failures := testutil.ToFloat64(probeResults.WithLabelValues("readiness", probe.Failure.String()))
+
+				Expect(testWorker.DoProbe(ctx)).Should(Succeed())
+				Expect(testutil.ToFloat64(probeResults.WithLabelValues("readiness", probe.Failure.String()))).To(Equal(failures + 1))
+			})
+
 			When("new ReadyCondition isn't in a transition", func() {
 				It("Shouldn't update the Condition in status", func() {
 					vmReadyCondition := conditions.TrueCondition(vmopv1alpha1.ReadyCondition)
@@ -154,6 +171,122 @@ var _ = Describe("VirtualMachine readiness probes", func() {
 		})
 	})
 
+	Context("VM has readiness probe thresholds", func() {
+		var state *context.ProbeState
+
+		BeforeEach(func() {
+			vm.Spec.ReadinessProbe = getVirtualMachineReadinessTCPProbe(10001)
+			state = &context.ProbeState{}
+		})
+
+		JustBeforeEach(func() {
+			Expect(fakeClient.Create(goctx.Background(), vm)).Should(Succeed())
+		})
+
+		// doProbe runs the readiness probe with the given result against the latest VM.
+		doProbe := func(res probe.Result) {
+			latest := &vmopv1alpha1.VirtualMachine{}
+			Expect(fakeClient.Get(goctx.Background(), vmKey, latest)).Should(Succeed())
+			var err error
+			ctx, err = testWorker.CreateProbeContext(latest)
+			Expect(err).ShouldNot(HaveOccurred())
+			ctx.State = state
+
+			fakeTCPProbe.ProbeFn = func(ctx *context.ProbeContext) (probe.Result, error) {
+				return res, nil
+			}
+			Expect(testWorker.DoProbe(ctx)).Should(Succeed())
+		}
+
+		It("Should set the first ReadyCondition without waiting for the thresholds", func() {
+			doProbe(probe.Failure)
+			checkReadyCondition(fakeClient, vmKey, corev1.ConditionFalse)
+		})
+
+		When("VM is ready", func() {
+			JustBeforeEach(func() {
+				doProbe(probe.Success)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionTrue)
+				Expect(fakeEvents).Should(Receive(ContainSubstring(readyReason)))
+			})
+
+			It("Should become not ready after a single failure by default", func() {
+				doProbe(probe.Failure)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionFalse)
+				Expect(fakeEvents).Should(Receive(ContainSubstring(notReadyReason)))
+			})
+		})
+
+		When("VM is ready and has a failure threshold", func() {
+			BeforeEach(func() {
+				vm.Annotations = map[string]string{probe.ThresholdsAnnotationKey: `{"failureThreshold": 3}`}
+			})
+
+			JustBeforeEach(func() {
+				doProbe(probe.Success)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionTrue)
+				Expect(fakeEvents).Should(Receive(ContainSubstring(readyReason)))
+			})
+
+			It("Should stay ready until the failure threshold is reached", func() {
+				doProbe(probe.Failure)
+				doProbe(probe.Failure)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionTrue)
+				Expect(fakeEvents).ShouldNot(Receive())
+
+				doProbe(probe.Failure)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionFalse)
+				Expect(fakeEvents).Should(Receive(ContainSubstring(notReadyReason)))
+			})
+
+			It("Should stay ready when the probe flaps", func() {
+				for i := 0; i < 3; i++ {
+					doProbe(probe.Failure)
+					doProbe(probe.Failure)
+					doProbe(probe.Success)
+				}
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionTrue)
+				Expect(fakeEvents).ShouldNot(Receive())
+			})
+
+			It("Should count unknown results as failures", func() {
+				doProbe(probe.Failure)
+				doProbe(probe.Unknown)
+				doProbe(probe.Unknown)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionUnknown)
+			})
+		})
+
+		When("VM has a success threshold", func() {
+			BeforeEach(func() {
+				vm.Annotations = map[string]string{probe.ThresholdsAnnotationKey: `{"successThreshold": 2, "failureThreshold": 1}`}
+			})
+
+			JustBeforeEach(func() {
+				doProbe(probe.Failure)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionFalse)
+			})
+
+			It("Should stay not ready when the probe flaps", func() {
+				for i := 0; i < 3; i++ {
+					doProbe(probe.Success)
+					doProbe(probe.Failure)
+				}
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionFalse)
+			})
+
+			It("Should become ready after consecutive successes, and not ready after a single failure", func() {
+				doProbe(probe.Success)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionFalse)
+				doProbe(probe.Success)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionTrue)
+
+				doProbe(probe.Failure)
+				checkReadyCondition(fakeClient, vmKey, corev1.ConditionFalse)
+			})
+		})
+	})
+
 	Context("Guest heartbeat Probe", func() {
 
 		BeforeEach(func() {
@@ -178,6 +311,58 @@ var _ = Describe("VirtualMachine readiness probes", func() {
 			Expect(condition.Message).To(ContainSubstring("heartbeat error"))
 		})
 	})
+
+	Context("HTTP GET Probe", func() {
+
+		BeforeEach(func() {
+			vm.Annotations = map[string]string{probe.HTTPGetActionAnnotationKey: `{"port": 80}`}
+			vm.Spec.ReadinessProbe = &vmopv1alpha1.Probe{PeriodSeconds: 1}
+			Expect(fakeClient.Create(goctx.Background(), vm)).Should(Succeed())
+			Expect(fakeClient.Get(goctx.Background(), vmKey, vm)).Should(Succeed())
+			var err error
+			ctx, err = testWorker.CreateProbeContext(vm)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		// Just need to test for probe selection.
+		It("Should update ReadyCondition when probe fails", func() {
+			fakeHTTPProbe.ProbeFn = func(ctx *context.ProbeContext) (probe.Result, error) {
+				return probe.Failure, fmt.Errorf("http error")
+			}
+
+			Expect(testWorker.DoProbe(ctx)).Should(Succeed())
+			Expect(fakeClient.Get(ctx, vmKey, vm)).Should(Succeed())
+			condition := conditions.Get(vm, vmopv1alpha1.ReadyCondition)
+			Expect(condition).ToNot(BeNil())
+			Expect(condition.Message).To(ContainSubstring("http error"))
+		})
+	})
+
+	Context("Exec Probe", func() {
+
+		BeforeEach(func() {
+			vm.Annotations = map[string]string{probe.ExecActionAnnotationKey: `{"command": ["/bin/true"], "secretName": "creds"}`}
+			vm.Spec.ReadinessProbe = &vmopv1alpha1.Probe{PeriodSeconds: 1}
+			Expect(fakeClient.Create(goctx.Background(), vm)).Should(Succeed())
+			Expect(fakeClient.Get(goctx.Background(), vmKey, vm)).Should(Succeed())
+			var err error
+			ctx, err = testWorker.CreateProbeContext(vm)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		// Just need to test for probe selection.
+		It("Should update ReadyCondition when probe fails", func() {
+			fakeExecProbe.ProbeFn = func(ctx *context.ProbeContext) (probe.Result, error) {
+				return probe.Failure, fmt.Errorf("exec error")
+			}
+
+			Expect(testWorker.DoProbe(ctx)).Should(Succeed())
+			Expect(fakeClient.Get(ctx, vmKey, vm)).Should(Succeed())
+			condition := conditions.Get(vm, vmopv1alpha1.ReadyCondition)
+			Expect(condition).ToNot(BeNil())
+			Expect(condition.Message).To(ContainSubstring("exec error"))
+		})
+	})
 })
 
 func TestReadinessProbeWorker(t *testing.T) {
@@ -0,0 +1,60 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+// DeletionPolicy is what happens to the vSphere VM when its VirtualMachine is deleted.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the vSphere VM.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain leaves the vSphere VM in vCenter after removing the markers of VM Operator
+	// ownership: the VM annotation, the tags and the cluster module membership.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+
+	// DeletionPolicyAnnotationKey is the VirtualMachine annotation with the DeletionPolicy of the VM.
+	// Defaults to Delete. The VM is neither deleted nor retained while the policy is invalid.
+	DeletionPolicyAnnotationKey = "vmoperator.vmware.com/deletion-policy"
+
+	// DeletionProtectionAnnotationKey is the VirtualMachine annotation that, when "true", prevents the
+	// VirtualMachine from being deleted.
+	DeletionProtectionAnnotationKey = "vmoperator.vmware.com/deletion-protection"
+)
+
+// GetDeletionPolicy returns the DeletionPolicy of the VM, or an error if it is not valid.
+func GetDeletionPolicy(vm *v1alpha1.VirtualMachine) (DeletionPolicy, error) {
+	value, ok := vm.Annotations[DeletionPolicyAnnotationKey]
+	if !ok {
+		return DeletionPolicyDelete, nil
+	}
+
+	switch policy := DeletionPolicy(value); policy {
+	case DeletionPolicyDelete, DeletionPolicyRetain:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid deletion policy %q: must be %s or %s", value, DeletionPolicyDelete, DeletionPolicyRetain)
+	}
+}
+
+// IsDeletionProtected returns true if the VM must not be deleted, or an error if the deletion
+// protection annotation is not a boolean.
+func IsDeletionProtected(vm *v1alpha1.VirtualMachine) (bool, error) {
+	value, ok := vm.Annotations[DeletionProtectionAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+
+	protected, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid deletion protection %q: must be true or false", value)
+	}
+	return protected, nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// BootDiskCapacityAnnotationKey is the VirtualMachine or VirtualMachineClass annotation with the
+	// capacity, such as "40Gi", of the boot disk of the VM. The boot disk of the image is grown to
+	// this capacity when the VM is deployed; it is never shrunk. The annotation of the VirtualMachine
+	// overrides the one of its class.
+	BootDiskCapacityAnnotationKey = "vmoperator.vmware.com/boot-disk-capacity"
+)
+
+// GetBootDiskCapacity returns the boot disk capacity of the VM, nil if it keeps the capacity of
+// the image, or an error if it is not valid.
+func GetBootDiskCapacity(vm *v1alpha1.VirtualMachine, vmClass *v1alpha1.VirtualMachineClass) (*resource.Quantity, error) {
+	value, ok := vm.Annotations[BootDiskCapacityAnnotationKey]
+	if !ok && vmClass != nil {
+		value, ok = vmClass.Annotations[BootDiskCapacityAnnotationKey]
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	capacity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid boot disk capacity %q: %v", value, err)
+	}
+	if err := ValidateDiskCapacity(capacity); err != nil {
+		return nil, fmt.Errorf("invalid boot disk capacity %q: %v", value, err)
+	}
+	return &capacity, nil
+}
+
+// ValidateDiskCapacity returns an error if the capacity of a disk is not a positive multiple of MB.
+func ValidateDiskCapacity(capacity resource.Quantity) error {
+	megaByte := resource.MustParse("1Mi")
+	if capacity.Value() <= 0 || capacity.Value()%megaByte.Value() != 0 {
+		return fmt.Errorf("must be a positive multiple of MB")
+	}
+	return nil
+}
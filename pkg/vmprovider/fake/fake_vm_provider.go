@@ -1,4 +1,4 @@
-// Copyright (c) 2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2020-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package fake
@@ -27,6 +27,15 @@ type funcs struct {
 	UpdateVirtualMachineFn            func(ctx context.Context, vm *v1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error
 	DeleteVirtualMachineFn            func(ctx context.Context, vm *v1alpha1.VirtualMachine) error
 	GetVirtualMachineGuestHeartbeatFn func(ctx context.Context, vm *v1alpha1.VirtualMachine) (v1alpha1.GuestHeartbeatStatus, error)
+	RunVirtualMachineGuestProgramFn   func(ctx context.Context, vm *v1alpha1.VirtualMachine, program vmprovider.GuestProgram) (int32, error)
+	RestartVirtualMachineFn           func(ctx context.Context, vm *v1alpha1.VirtualMachine, restartType vmprovider.RestartType) error
+	GetVirtualMachineVolumeDevicesFn  func(ctx context.Context, vm *v1alpha1.VirtualMachine) (map[string]vmprovider.VolumeDevice, error)
+
+	GetVirtualMachineGuestHeartbeatsFn func(ctx context.Context, vms []*v1alpha1.VirtualMachine) (map[string]v1alpha1.GuestHeartbeatStatus, error)
+	RetainVirtualMachineFn             func(ctx context.Context, vm *v1alpha1.VirtualMachine) error
+	ImportVirtualMachineFn             func(ctx context.Context, vm *v1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error
+	ListManagedVirtualMachinesFn       func(ctx context.Context, namespace string) ([]vmprovider.ManagedVirtualMachine, error)
+	DeleteManagedVirtualMachineFn      func(ctx context.Context, namespace string, vm vmprovider.ManagedVirtualMachine) error
 
 	ListVirtualMachineImagesFromContentLibraryFn func(ctx context.Context, cl v1alpha1.ContentLibraryProvider, currentCLImages map[string]v1alpha1.VirtualMachineImage) ([]*v1alpha1.VirtualMachineImage, error)
 	DoesContentLibraryExistFn                    func(ctx context.Context, cl *v1alpha1.ContentLibraryProvider) (bool, error)
@@ -104,6 +113,27 @@ func (s *FakeVmProvider) DeleteVirtualMachine(ctx context.Context, vm *v1alpha1.
 	return nil
 }
 
+func (s *FakeVmProvider) ImportVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.ImportVirtualMachineFn != nil {
+		return s.ImportVirtualMachineFn(ctx, vm, vmConfigArgs)
+	}
+	vm.Status.UniqueID = vm.Annotations[vmprovider.ImportMoIDAnnotationKey]
+	s.addToVMMap(vm)
+	return nil
+}
+
+func (s *FakeVmProvider) RetainVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.RetainVirtualMachineFn != nil {
+		return s.RetainVirtualMachineFn(ctx, vm)
+	}
+	s.deleteFromVMMap(vm)
+	return nil
+}
+
 func (s *FakeVmProvider) GetVirtualMachineGuestHeartbeat(ctx context.Context, vm *v1alpha1.VirtualMachine) (v1alpha1.GuestHeartbeatStatus, error) {
 	s.Lock()
 	defer s.Unlock()
@@ -113,6 +143,80 @@ func (s *FakeVmProvider) GetVirtualMachineGuestHeartbeat(ctx context.Context, vm
 	return "", nil
 }
 
+func (s *FakeVmProvider) GetVirtualMachineGuestHeartbeats(ctx context.Context, vms []*v1alpha1.VirtualMachine) (map[string]v1alpha1.GuestHeartbeatStatus, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.GetVirtualMachineGuestHeartbeatsFn != nil {
+		return s.GetVirtualMachineGuestHeartbeatsFn(ctx, vms)
+	}
+
+	heartbeats := make(map[string]v1alpha1.GuestHeartbeatStatus, len(vms))
+	if s.GetVirtualMachineGuestHeartbeatFn != nil {
+		for _, vm := range vms {
+			if heartbeat, err := s.GetVirtualMachineGuestHeartbeatFn(ctx, vm); err == nil {
+				heartbeats[vm.NamespacedName()] = heartbeat
+			}
+		}
+	}
+	return heartbeats, nil
+}
+
+func (s *FakeVmProvider) RunVirtualMachineGuestProgram(ctx context.Context, vm *v1alpha1.VirtualMachine, program vmprovider.GuestProgram) (int32, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.RunVirtualMachineGuestProgramFn != nil {
+		return s.RunVirtualMachineGuestProgramFn(ctx, vm, program)
+	}
+	return 0, nil
+}
+
+func (s *FakeVmProvider) RestartVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, restartType vmprovider.RestartType) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.RestartVirtualMachineFn != nil {
+		return s.RestartVirtualMachineFn(ctx, vm, restartType)
+	}
+	return nil
+}
+
+func (s *FakeVmProvider) GetVirtualMachineVolumeDevices(ctx context.Context, vm *v1alpha1.VirtualMachine) (map[string]vmprovider.VolumeDevice, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.GetVirtualMachineVolumeDevicesFn != nil {
+		return s.GetVirtualMachineVolumeDevicesFn(ctx, vm)
+	}
+	return nil, nil
+}
+
+func (s *FakeVmProvider) ListManagedVirtualMachines(ctx context.Context, namespace string) ([]vmprovider.ManagedVirtualMachine, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.ListManagedVirtualMachinesFn != nil {
+		return s.ListManagedVirtualMachinesFn(ctx, namespace)
+	}
+
+	var vms []vmprovider.ManagedVirtualMachine
+	for key, vm := range s.vmMap {
+		if key.Namespace == namespace {
+			vms = append(vms, vmprovider.ManagedVirtualMachine{
+				Name:         vm.Name,
+				UniqueID:     vm.Status.UniqueID,
+				InstanceUUID: vm.Status.InstanceUUID,
+			})
+		}
+	}
+	return vms, nil
+}
+
+func (s *FakeVmProvider) DeleteManagedVirtualMachine(ctx context.Context, namespace string, vm vmprovider.ManagedVirtualMachine) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.DeleteManagedVirtualMachineFn != nil {
+		return s.DeleteManagedVirtualMachineFn(ctx, namespace, vm)
+	}
+	return nil
+}
+
 func (s *FakeVmProvider) Initialize(stop <-chan struct{}) {}
 
 func (s *FakeVmProvider) Name() string {
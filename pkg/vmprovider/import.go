@@ -0,0 +1,102 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// ImportMoIDAnnotationKey is the VirtualMachine annotation with the managed object ID of an
+	// existing vSphere VM that the VirtualMachine adopts instead of creating a new VM. It can only be
+	// set by the service account of VM Operator.
+	ImportMoIDAnnotationKey = "vmoperator.vmware.com/import-moid"
+
+	// ImportBiosUUIDAnnotationKey is the VirtualMachine annotation with the BIOS UUID of an existing
+	// vSphere VM that the VirtualMachine adopts instead of creating a new VM. It can only be set by
+	// the service account of VM Operator.
+	ImportBiosUUIDAnnotationKey = "vmoperator.vmware.com/import-bios-uuid"
+
+	// ImportRelocateAnnotationKey is the VirtualMachine annotation that, when "true", moves the
+	// imported VM into the resource pool and folder of the VirtualMachine. Otherwise, the VM must
+	// already be in them. It can only be set by the service account of VM Operator, and a VM is only
+	// moved from the resource pools that the namespace allows VMs to be imported from.
+	ImportRelocateAnnotationKey = "vmoperator.vmware.com/import-relocate"
+
+	// ImportedMoIDAnnotationKey is the VirtualMachine annotation with the managed object ID of the VM
+	// of the import source, once the spec of the VirtualMachine has been back-filled from it. It is
+	// set by VM Operator. The VM is only adopted once this annotation and the back-filled spec have
+	// been persisted, so that the VM is never marked as managed with a spec that does not describe it.
+	ImportedMoIDAnnotationKey = "vmoperator.vmware.com/imported-moid"
+
+	// VirtualMachineImportReadyCondition reports the adoption of the VM of the import source. It is
+	// only set once the VM has been adopted.
+	VirtualMachineImportReadyCondition v1alpha1.ConditionType = "VirtualMachineImportReady"
+
+	// ImportHardwareMismatchReason (Severity=Warning) documents that the CPUs or memory of the
+	// imported VM do not match its VirtualMachineClass. The class hardware is only applied when the
+	// VM is powered on by VM Operator.
+	ImportHardwareMismatchReason = "ImportHardwareMismatch"
+)
+
+// ImportSource is the existing vSphere VM that a VirtualMachine adopts.
+type ImportSource struct {
+	// MoID is the managed object ID of the VM.
+	MoID string
+	// BiosUUID is the BIOS UUID of the VM.
+	BiosUUID string
+	// Relocate is true if the VM is moved into the resource pool and folder of the VirtualMachine.
+	Relocate bool
+}
+
+// GetImportSource returns the ImportSource of the VM, or nil if the VM is not imported.
+func GetImportSource(vm *v1alpha1.VirtualMachine) (*ImportSource, error) {
+	moID, hasMoID := vm.Annotations[ImportMoIDAnnotationKey]
+	biosUUID, hasBiosUUID := vm.Annotations[ImportBiosUUIDAnnotationKey]
+
+	switch {
+	case !hasMoID && !hasBiosUUID:
+		return nil, nil
+	case hasMoID && hasBiosUUID:
+		return nil, fmt.Errorf("only one of %s and %s can be specified", ImportMoIDAnnotationKey, ImportBiosUUIDAnnotationKey)
+	case hasMoID && moID == "", hasBiosUUID && biosUUID == "":
+		return nil, fmt.Errorf("the VM to import must be specified")
+	}
+
+	source := &ImportSource{MoID: moID, BiosUUID: biosUUID}
+	if value, ok := vm.Annotations[ImportRelocateAnnotationKey]; ok {
+		relocate, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid import relocate %q: must be true or false", value)
+		}
+		source.Relocate = relocate
+	}
+	return source, nil
+}
+
+// IsImportPending returns true if the VM imports an existing vSphere VM that has not been adopted
+// yet.
+func IsImportPending(vm *v1alpha1.VirtualMachine) bool {
+	_, hasMoID := vm.Annotations[ImportMoIDAnnotationKey]
+	_, hasBiosUUID := vm.Annotations[ImportBiosUUIDAnnotationKey]
+	return (hasMoID || hasBiosUUID) && vm.Status.UniqueID == ""
+}
+
+// GetImportedMoID returns the managed object ID of the VM of the import source that the spec of
+// the VM has been back-filled from, or an empty string if it has not been yet.
+func GetImportedMoID(vm *v1alpha1.VirtualMachine) string {
+	return vm.Annotations[ImportedMoIDAnnotationKey]
+}
+
+// SetImportedMoID records the managed object ID of the VM of the import source that the spec of the
+// VM has been back-filled from.
+func SetImportedMoID(vm *v1alpha1.VirtualMachine, moID string) {
+	if vm.Annotations == nil {
+		vm.Annotations = map[string]string{}
+	}
+	vm.Annotations[ImportedMoIDAnnotationKey] = moID
+}
@@ -185,6 +185,78 @@ var _ = Describe("Sessions", func() {
 		})
 	})
 
+	Describe("Managed VMs", func() {
+
+		It("should list and delete a VM that is not backed by a VirtualMachine", func() {
+			imageName := "test-item"
+			vmName := "orphaned-vm"
+
+			vmConfigArgs := getVmConfigArgs(testNamespace, vmName, imageName)
+			vm := getVirtualMachineInstance(vmName, testNamespace, imageName, vmConfigArgs.VmClass.Name)
+
+			clonedVM, err := session.CloneVirtualMachine(vmContext(ctx, vm), vmConfigArgs)
+			Expect(err).NotTo(HaveOccurred())
+
+			managedVMs, err := session.ListManagedVirtualMachines(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			var managedVM *vmprovider.ManagedVirtualMachine
+			for i := range managedVMs {
+				if managedVMs[i].UniqueID == clonedVM.ReferenceValue() {
+					managedVM = &managedVMs[i]
+				}
+			}
+			Expect(managedVM).ToNot(BeNil())
+			Expect(managedVM.Name).To(Equal(vmName))
+			Expect(managedVM.InstanceUUID).ToNot(BeEmpty())
+
+			stale := *managedVM
+			stale.InstanceUUID = "stale-instance-uuid"
+			Expect(session.DeleteManagedVirtualMachine(ctx, stale)).ToNot(Succeed())
+
+			Expect(session.DeleteManagedVirtualMachine(ctx, *managedVM)).To(Succeed())
+			_, err = session.GetVirtualMachine(vmContext(ctx, vm))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Import VM", func() {
+
+		It("should adopt a retained VM by its BIOS UUID", func() {
+			imageName := "test-item"
+			vmName := "import-retained-vm"
+
+			vmConfigArgs := getVmConfigArgs(testNamespace, vmName, imageName)
+			vm := getVirtualMachineInstance(vmName, testNamespace, imageName, vmConfigArgs.VmClass.Name)
+
+			clonedVM, err := session.CloneVirtualMachine(vmContext(ctx, vm), vmConfigArgs)
+			Expect(err).NotTo(HaveOccurred())
+			moVM, err := clonedVM.GetProperties(ctx, []string{"config.uuid"})
+			Expect(err).NotTo(HaveOccurred())
+
+			importedVM := getVirtualMachineInstance(vmName+"-imported", testNamespace, imageName, vmConfigArgs.VmClass.Name)
+			importedVM.Annotations = map[string]string{
+				vmprovider.ImportBiosUUIDAnnotationKey: moVM.Config.Uuid,
+			}
+
+			// The VM is still managed by the VirtualMachine it was cloned for.
+			_, err = session.ImportVirtualMachine(vmContext(ctx, importedVM), vmConfigArgs)
+			Expect(err).To(HaveOccurred())
+
+			vm.Status.UniqueID = clonedVM.ReferenceValue()
+			Expect(session.RetainVirtualMachine(vmContext(ctx, vm))).To(Succeed())
+
+			resVM, err := session.ImportVirtualMachine(vmContext(ctx, importedVM), vmConfigArgs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resVM.ReferenceValue()).To(Equal(clonedVM.ReferenceValue()))
+			Expect(importedVM.Spec.PowerState).To(Equal(vmopv1alpha1.VirtualMachinePoweredOff))
+
+			moVM, err = resVM.GetProperties(ctx, []string{"config.annotation"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(moVM.Config.Annotation).To(Equal(vsphere.VCVMAnnotation))
+		})
+	})
+
 	Describe("Clone VM", func() {
 
 		Context("without specifying any networks in VM Spec", func() {
@@ -404,6 +476,10 @@ var _ = Describe("Sessions", func() {
 				heartbeat, err := session.GetVirtualMachineGuestHeartbeat(vmContext(ctx, vm))
 				Expect(err).ToNot(HaveOccurred())
 				Expect(heartbeat).To(BeEmpty())
+
+				vm.Status.UniqueID = clonedVM.ReferenceValue()
+				heartbeats := session.GetVirtualMachineGuestHeartbeats(ctx, []*vmopv1alpha1.VirtualMachine{vm})
+				Expect(heartbeats).To(HaveKeyWithValue(vm.NamespacedName(), vmopv1alpha1.GuestHeartbeatStatus("")))
 			})
 
 			It("should clone VM with storage policy disk provisioning", func() {
@@ -166,6 +166,37 @@ var _ = Describe("VMProvider Inventory Tests", func() {
 			err = vmProvider.DeleteVirtualMachine(ctx, vm)
 			Expect(err).ToNot(HaveOccurred())
 		})
+
+		It("should leave a retained VM in vCenter", func() {
+			vmNamespace := integration.DefaultNamespace
+			vmName := "test-vm-vmp-invt-retain"
+
+			imageName := "DC0_H0_VM0" // Default govcsim image name
+			vmClass := getVMClassInstance(vmName, vmNamespace)
+			vm := getVirtualMachineInstance(vmName, vmNamespace, imageName, vmClass.Name)
+			vm.Annotations = map[string]string{
+				vmprovider.DeletionPolicyAnnotationKey: string(vmprovider.DeletionPolicyRetain),
+			}
+
+			vmConfigArgs := vmprovider.VmConfigArgs{
+				VmClass:          *vmClass,
+				VmImage:          builder.DummyVirtualMachineImage(imageName),
+				VmMetadata:       &vmprovider.VmMetadata{Transport: vmoperatorv1alpha1.VirtualMachineMetadataOvfEnvTransport},
+				StorageProfileID: "aa6d5a82-1c88-45da-85d3-3d74b91a5bad",
+			}
+			err := vmProvider.CreateVirtualMachine(context.TODO(), vm, vmConfigArgs)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = vmProvider.RetainVirtualMachine(ctx, vm)
+			Expect(err).ToNot(HaveOccurred())
+
+			exists, err := vmProvider.DoesVirtualMachineExist(ctx, vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exists).To(BeTrue())
+
+			err = vmProvider.DeleteVirtualMachine(ctx, vm)
+			Expect(err).ToNot(HaveOccurred())
+		})
 	})
 })
 
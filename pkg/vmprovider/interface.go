@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2018-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package vmprovider
@@ -23,6 +23,37 @@ type VmConfigArgs struct {
 	ContentLibraryUUID string
 }
 
+// GuestProgram is a program that is run in the guest of a VM through VMware Tools.
+type GuestProgram struct {
+	// Command is the absolute path of the program followed by its arguments.
+	Command []string
+	// Username and Password authenticate the program in the guest.
+	Username string
+	Password string
+}
+
+// RestartType is how a VM is restarted.
+type RestartType string
+
+const (
+	// RestartTypeGuestReboot reboots the guest through VMware Tools.
+	RestartTypeGuestReboot RestartType = "GuestReboot"
+	// RestartTypeReset hard resets the VM.
+	RestartTypeReset RestartType = "Reset"
+	// RestartTypePowerCycle powers the VM off and back on.
+	RestartTypePowerCycle RestartType = "PowerCycle"
+)
+
+// ManagedVirtualMachine is a VM managed by VM Operator in the infrastructure provider.
+type ManagedVirtualMachine struct {
+	// Name is the name of the VM.
+	Name string
+	// UniqueID is the identifier of the VM that is set in the status of its VirtualMachine.
+	UniqueID string
+	// InstanceUUID is the instance UUID of the VM.
+	InstanceUUID string
+}
+
 // VirtualMachineProviderInterface is a plugable interface for VM Providers
 type VirtualMachineProviderInterface interface {
 	Name() string
@@ -34,9 +65,33 @@ type VirtualMachineProviderInterface interface {
 
 	DoesVirtualMachineExist(ctx context.Context, vm *v1alpha1.VirtualMachine) (bool, error)
 	CreateVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, vmConfigArgs VmConfigArgs) error
+	// ImportVirtualMachine back-fills the spec of the VirtualMachine from the existing VM of its
+	// import source and, once the back-filled spec has been persisted, adopts the VM. The import is
+	// pending until the VM has been adopted.
+	ImportVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, vmConfigArgs VmConfigArgs) error
 	UpdateVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, vmConfigArgs VmConfigArgs) error
 	DeleteVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine) error
+	// RetainVirtualMachine removes the markers of VM Operator ownership from the VM, and leaves the VM
+	// in the infrastructure provider.
+	RetainVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine) error
 	GetVirtualMachineGuestHeartbeat(ctx context.Context, vm *v1alpha1.VirtualMachine) (v1alpha1.GuestHeartbeatStatus, error)
+	// GetVirtualMachineGuestHeartbeats returns the guest heartbeat status of the VMs keyed by their
+	// namespaced name, fetching them with as few calls as possible. VMs whose heartbeat status cannot
+	// be fetched are not in the returned map.
+	GetVirtualMachineGuestHeartbeats(ctx context.Context, vms []*v1alpha1.VirtualMachine) (map[string]v1alpha1.GuestHeartbeatStatus, error)
+	// RunVirtualMachineGuestProgram runs the program in the guest and waits for it to exit, or for the
+	// context to be done. It returns the exit code of the program.
+	RunVirtualMachineGuestProgram(ctx context.Context, vm *v1alpha1.VirtualMachine, program GuestProgram) (int32, error)
+	RestartVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, restartType RestartType) error
+	// GetVirtualMachineVolumeDevices returns the controller and unit number of the disks of the attached
+	// volumes in the status of the VM, by volume name.
+	GetVirtualMachineVolumeDevices(ctx context.Context, vm *v1alpha1.VirtualMachine) (map[string]VolumeDevice, error)
+	// ListManagedVirtualMachines returns the VMs managed by VM Operator in the infrastructure provider
+	// for the namespace. It returns nil if the namespace has no VMs in the infrastructure provider.
+	ListManagedVirtualMachines(ctx context.Context, namespace string) ([]ManagedVirtualMachine, error)
+	// DeleteManagedVirtualMachine deletes a VM returned by ListManagedVirtualMachines that is not
+	// backed by a VirtualMachine.
+	DeleteManagedVirtualMachine(ctx context.Context, namespace string, vm ManagedVirtualMachine) error
 
 	CreateOrUpdateVirtualMachineSetResourcePolicy(ctx context.Context, resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) error
 	// Used by VirtualMachine controller to determine if entities of ResourcePolicy exist on the infrastructure provider
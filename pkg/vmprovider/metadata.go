@@ -0,0 +1,13 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+const (
+	// MetadataSecretAnnotationKey is the VirtualMachine annotation with the name of a Secret, in the
+	// namespace of the VirtualMachine, whose data is added to the VM metadata of the ConfigMap of
+	// spec.vmMetadata. It holds the metadata, such as credentials, that must not be kept in a
+	// ConfigMap. The data of the Secret overrides the data of the ConfigMap. The Secret is read by VM
+	// Operator, so the annotation can only be set by the service account of VM Operator.
+	MetadataSecretAnnotationKey = "vmoperator.vmware.com/metadata-secret"
+)
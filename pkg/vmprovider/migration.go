@@ -0,0 +1,44 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// MigrationTaskAnnotationKey is the VirtualMachine annotation with the managed object ID of the
+	// vSphere task that migrates the VM to the placement of its resource policy, zone and storage
+	// class. It is set by VM Operator while the migration is in progress.
+	MigrationTaskAnnotationKey = "vmoperator.vmware.com/migration-task"
+
+	// StorageClassAnnotationKey is the VirtualMachine annotation with the StorageClass that the VM
+	// home and disks comply with. It is set by VM Operator. When spec.storageClass differs, the VM
+	// storage is migrated to a datastore compatible with the storage policy of spec.storageClass.
+	StorageClassAnnotationKey = "vmoperator.vmware.com/storage-class"
+
+	// AttachedResourcePolicyAnnotationKey is the VirtualMachine annotation with the name of the
+	// VirtualMachineSetResourcePolicy whose cluster modules, VM groups and tag the VM is attached to.
+	// It is set by VM Operator. When spec.resourcePolicyName differs, the VM is detached from them
+	// before it is migrated to the placement of its new resource policy.
+	AttachedResourcePolicyAnnotationKey = "vmoperator.vmware.com/attached-resource-policy"
+
+	// VirtualMachineMigrationReadyCondition reports the migration of the VM after its resource policy,
+	// zone or storage class changed. It is only set once the VM has been migrated.
+	VirtualMachineMigrationReadyCondition v1alpha1.ConditionType = "VirtualMachineMigrationReady"
+
+	// MigrationInProgressReason (Severity=Info) documents that the VM is being migrated. The message
+	// has the progress of the migration.
+	MigrationInProgressReason = "MigrationInProgress"
+
+	// MigrationFailedReason (Severity=Error) documents that the migration of the VM failed. The
+	// migration is retried.
+	MigrationFailedReason = "MigrationFailed"
+)
+
+// IsMigrationInProgress returns true if the VM is being migrated.
+func IsMigrationInProgress(vm *v1alpha1.VirtualMachine) bool {
+	_, ok := vm.Annotations[MigrationTaskAnnotationKey]
+	return ok
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// ZoneLabelKey is the VirtualMachine label with the availability zone of the VM. It can be set
+	// when the VM is created to place the VM in that zone. Otherwise, the provider chooses a zone,
+	// if the namespace has any, and sets the label.
+	ZoneLabelKey = "topology.kubernetes.io/zone"
+
+	// VirtualMachinePlacementReadyCondition reports whether the VM could be placed. Its message
+	// describes where the VM was placed: its zone, if any, and the host and datastore recommended by
+	// DRS with the reason of the recommendation.
+	VirtualMachinePlacementReadyCondition v1alpha1.ConditionType = "VirtualMachinePlacementReady"
+
+	// ZoneNotFoundReason (Severity=Error) documents that the zone requested for the VM does not
+	// exist in its namespace.
+	ZoneNotFoundReason = "ZoneNotFound"
+
+	// InsufficientResourcesReason (Severity=Error) documents that no host and datastore compatible
+	// with the storage policy of the VM have the resources to run it.
+	InsufficientResourcesReason = "InsufficientResources"
+
+	// PlacementFailedReason (Severity=Error) documents that the placement of the VM could not be
+	// computed.
+	PlacementFailedReason = "PlacementFailed"
+
+	// VirtualMachineClusterModuleReadyCondition reports whether the VM is a member of the cluster
+	// module of its resource policy, which places the VMs of the policy on different hosts. It is
+	// only set for the VMs of a resource policy with a cluster module.
+	VirtualMachineClusterModuleReadyCondition v1alpha1.ConditionType = "VirtualMachineClusterModuleReady"
+
+	// ClusterModuleNotInZoneReason (Severity=Warning) documents that the VM is placed in the cluster
+	// of a zone, while the cluster module of its resource policy is in the cluster of the namespace:
+	// the anti-affinity of the VM with the other VMs of the policy is not enforced.
+	ClusterModuleNotInZoneReason = "ClusterModuleNotInZone"
+)
+
+// GetZone returns the availability zone of the VM, or an empty string if it has none.
+func GetZone(vm *v1alpha1.VirtualMachine) string {
+	return vm.Labels[ZoneLabelKey]
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+// PowerOffMode is how a VM is powered off.
+type PowerOffMode string
+
+const (
+	// PowerOffModeHard hard powers off the VM.
+	PowerOffModeHard PowerOffMode = "Hard"
+	// PowerOffModeTrySoft shuts down the guest through VMware Tools, and hard powers off the VM if it
+	// is not powered off within the power-off timeout.
+	PowerOffModeTrySoft PowerOffMode = "TrySoft"
+
+	// PowerOffModeAnnotationKey is the VirtualMachine or VirtualMachineClass annotation with the
+	// PowerOffMode used when the VM is powered off or deleted. The annotation of the VirtualMachine
+	// overrides the one of its class. Defaults to Hard.
+	PowerOffModeAnnotationKey = "vmoperator.vmware.com/power-off-mode"
+
+	// PowerOffTimeoutAnnotationKey is the VirtualMachine or VirtualMachineClass annotation with the
+	// duration, such as "90s", the guest has to shut down with the TrySoft power-off mode. The
+	// annotation of the VirtualMachine overrides the one of its class. It cannot be greater than
+	// MaxPowerOffTimeout.
+	PowerOffTimeoutAnnotationKey = "vmoperator.vmware.com/power-off-timeout"
+
+	// PowerOffDeadlineAnnotationKey is the VirtualMachine annotation with the RFC 3339 time after
+	// which the VM is hard powered off if its guest has not shut down. It is set by VM Operator
+	// while the guest is shutting down with the TrySoft power-off mode.
+	PowerOffDeadlineAnnotationKey = "vmoperator.vmware.com/power-off-deadline"
+
+	// DefaultPowerOffTimeout is the default power-off timeout.
+	DefaultPowerOffTimeout = 2 * time.Minute
+
+	// MaxPowerOffTimeout is the maximum power-off timeout.
+	MaxPowerOffTimeout = 30 * time.Minute
+)
+
+// GetPowerOffMode returns the PowerOffMode of the VM, or an error if it is not valid.
+func GetPowerOffMode(vm *v1alpha1.VirtualMachine, vmClass *v1alpha1.VirtualMachineClass) (PowerOffMode, error) {
+	value, ok := vm.Annotations[PowerOffModeAnnotationKey]
+	if !ok && vmClass != nil {
+		value, ok = vmClass.Annotations[PowerOffModeAnnotationKey]
+	}
+	if !ok {
+		return PowerOffModeHard, nil
+	}
+
+	switch mode := PowerOffMode(value); mode {
+	case PowerOffModeHard, PowerOffModeTrySoft:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid power-off mode %q: must be %s or %s", value, PowerOffModeHard, PowerOffModeTrySoft)
+	}
+}
+
+// GetPowerOffTimeout returns the power-off timeout of the VM, or an error if it is not valid.
+func GetPowerOffTimeout(vm *v1alpha1.VirtualMachine, vmClass *v1alpha1.VirtualMachineClass) (time.Duration, error) {
+	value, ok := vm.Annotations[PowerOffTimeoutAnnotationKey]
+	if !ok && vmClass != nil {
+		value, ok = vmClass.Annotations[PowerOffTimeoutAnnotationKey]
+	}
+	if !ok {
+		return DefaultPowerOffTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid power-off timeout %q: %v", value, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid power-off timeout %q: must be positive", value)
+	}
+	if timeout > MaxPowerOffTimeout {
+		return 0, fmt.Errorf("invalid power-off timeout %q: must not be greater than %s", value, MaxPowerOffTimeout)
+	}
+	return timeout, nil
+}
+
+// GetPowerOffDeadline returns the time after which the VM is hard powered off while its guest is
+// shutting down, or false if the guest is not shutting down.
+func GetPowerOffDeadline(vm *v1alpha1.VirtualMachine) (time.Time, bool) {
+	value, ok := vm.Annotations[PowerOffDeadlineAnnotationKey]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// Hard power off the VM rather than waiting forever on a deadline that cannot be parsed.
+		return time.Time{}, true
+	}
+	return deadline, true
+}
+
+// SetPowerOffDeadline records the time after which the VM is hard powered off while its guest is
+// shutting down.
+func SetPowerOffDeadline(vm *v1alpha1.VirtualMachine, deadline time.Time) {
+	if vm.Annotations == nil {
+		vm.Annotations = map[string]string{}
+	}
+	vm.Annotations[PowerOffDeadlineAnnotationKey] = deadline.UTC().Format(time.RFC3339)
+}
+
+// ClearPowerOffDeadline removes the power-off deadline of the VM once it is powered off, or no
+// longer has to be.
+func ClearPowerOffDeadline(vm *v1alpha1.VirtualMachine) {
+	delete(vm.Annotations, PowerOffDeadlineAnnotationKey)
+}
+
+// IsPowerOffInProgress returns true if the guest of the VM is shutting down.
+func IsPowerOffInProgress(vm *v1alpha1.VirtualMachine) bool {
+	_, ok := GetPowerOffDeadline(vm)
+	return ok
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// VirtualMachineSuspended is the suspended power state. It can be the desired power state of a
+	// VM that is powered on or suspended.
+	VirtualMachineSuspended v1alpha1.VirtualMachinePowerState = "suspended"
+
+	// RestartRequestedAnnotationKey is the VirtualMachine annotation with the RFC 3339 time a restart
+	// of the VM was requested at. Each new value restarts the powered on VM once.
+	RestartRequestedAnnotationKey = "vmoperator.vmware.com/restart-requested"
+
+	// RestartTypeAnnotationKey is the VirtualMachine annotation with the RestartType of a requested
+	// restart. Defaults to GuestReboot.
+	RestartTypeAnnotationKey = "vmoperator.vmware.com/restart-type"
+
+	// LastPowerOperationAnnotationKey is the VirtualMachine annotation with the JSON encoded
+	// PowerOperationStatus of the last power operation on the VM. It is set by VM Operator.
+	LastPowerOperationAnnotationKey = "vmoperator.vmware.com/last-power-operation"
+)
+
+// PowerOperation is a power operation on a VM.
+type PowerOperation string
+
+const (
+	PowerOperationPowerOn     PowerOperation = "PowerOn"
+	PowerOperationPowerOff    PowerOperation = "PowerOff"
+	PowerOperationSuspend     PowerOperation = "Suspend"
+	PowerOperationGuestReboot PowerOperation = "GuestReboot"
+	PowerOperationReset       PowerOperation = "Reset"
+	PowerOperationPowerCycle  PowerOperation = "PowerCycle"
+)
+
+// PowerOperationStatus is the status of the last power operation on a VM.
+type PowerOperationStatus struct {
+	// Operation is the last power operation.
+	Operation PowerOperation `json:"operation,omitempty"`
+	// Time is when the last power operation completed or failed.
+	Time metav1.Time `json:"time,omitempty"`
+	// Error is the error of the last power operation, if it failed.
+	Error string `json:"error,omitempty"`
+	// RestartRequested is the value of the restart-requested annotation that was last acted on.
+	RestartRequested string `json:"restartRequested,omitempty"`
+}
+
+// GetRestartRequest returns the time a restart of the VM was requested at. It is zero if no restart
+// is requested.
+func GetRestartRequest(vm *v1alpha1.VirtualMachine) (time.Time, error) {
+	value, ok := vm.Annotations[RestartRequestedAnnotationKey]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	requested, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid restart time %q: must be an RFC 3339 time", value)
+	}
+	return requested, nil
+}
+
+// GetRestartType returns the RestartType of a requested restart of the VM.
+func GetRestartType(vm *v1alpha1.VirtualMachine) (RestartType, error) {
+	value, ok := vm.Annotations[RestartTypeAnnotationKey]
+	if !ok {
+		return RestartTypeGuestReboot, nil
+	}
+
+	switch restartType := RestartType(value); restartType {
+	case RestartTypeGuestReboot, RestartTypeReset, RestartTypePowerCycle:
+		return restartType, nil
+	default:
+		return "", fmt.Errorf("invalid restart type %q: must be %s, %s or %s",
+			value, RestartTypeGuestReboot, RestartTypeReset, RestartTypePowerCycle)
+	}
+}
+
+// GetLastPowerOperation returns the status of the last power operation on the VM. It is empty if
+// the annotation is absent or cannot be decoded.
+func GetLastPowerOperation(vm *v1alpha1.VirtualMachine) PowerOperationStatus {
+	var status PowerOperationStatus
+	if value, ok := vm.Annotations[LastPowerOperationAnnotationKey]; ok {
+		_ = json.Unmarshal([]byte(value), &status)
+	}
+	return status
+}
+
+// SetLastPowerOperation records the status of the last power operation on the VM.
+func SetLastPowerOperation(vm *v1alpha1.VirtualMachine, status PowerOperationStatus) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if vm.Annotations == nil {
+		vm.Annotations = map[string]string{}
+	}
+	vm.Annotations[LastPowerOperationAnnotationKey] = string(data)
+}
+
+// IsRestartPending returns true if the restart-requested annotation has a value that was not
+// acted on yet.
+func IsRestartPending(vm *v1alpha1.VirtualMachine) bool {
+	value, ok := vm.Annotations[RestartRequestedAnnotationKey]
+	return ok && value != GetLastPowerOperation(vm).RestartRequested
+}
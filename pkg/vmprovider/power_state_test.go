@@ -0,0 +1,112 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	"github.com/vmware-tanzu/vm-operator/test/testutil"
+)
+
+// loadVirtualMachineCRD returns the VirtualMachine CRD of config/crd, with the suspended power
+// state patch applied as kustomize does if patched is true.
+func loadVirtualMachineCRD(patched bool) *apiextensionsv1.CustomResourceDefinition {
+	crdDir := filepath.Join(testutil.GetRootDirOrDie(), "config", "crd")
+
+	data, err := ioutil.ReadFile(filepath.Join(crdDir, "bases", "vmoperator.vmware.com_virtualmachines.yaml"))
+	Expect(err).ToNot(HaveOccurred())
+	data, err = yaml.YAMLToJSON(data)
+	Expect(err).ToNot(HaveOccurred())
+
+	if patched {
+		patchData, err := ioutil.ReadFile(filepath.Join(crdDir, "patches", "virtualmachine_powerstate_suspended.yaml"))
+		Expect(err).ToNot(HaveOccurred())
+		patchData, err = yaml.YAMLToJSON(patchData)
+		Expect(err).ToNot(HaveOccurred())
+		patch, err := jsonpatch.DecodePatch(patchData)
+		Expect(err).ToNot(HaveOccurred())
+		data, err = patch.Apply(data)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	Expect(json.Unmarshal(data, crd)).To(Succeed())
+	return crd
+}
+
+// roundTrip validates the VM against the schema of the CRD, and returns the VM decoded back from
+// its validated JSON.
+func roundTrip(crd *apiextensionsv1.CustomResourceDefinition, vm *v1alpha1.VirtualMachine) (*v1alpha1.VirtualMachine, error) {
+	schema := &apiextensions.CustomResourceValidation{}
+	Expect(apiextensionsv1.Convert_v1_CustomResourceValidation_To_apiextensions_CustomResourceValidation(
+		crd.Spec.Versions[0].Schema, schema, nil)).To(Succeed())
+	validator, _, err := validation.NewSchemaValidator(schema)
+	Expect(err).ToNot(HaveOccurred())
+
+	data, err := json.Marshal(vm)
+	Expect(err).ToNot(HaveOccurred())
+	obj := map[string]interface{}{}
+	Expect(json.Unmarshal(data, &obj)).To(Succeed())
+
+	if errs := validation.ValidateCustomResource(nil, obj, validator); len(errs) > 0 {
+		return nil, errs.ToAggregate()
+	}
+
+	out := &v1alpha1.VirtualMachine{}
+	Expect(json.Unmarshal(data, out)).To(Succeed())
+	return out, nil
+}
+
+var _ = Describe("VirtualMachine CRD power states", func() {
+	var vm *v1alpha1.VirtualMachine
+
+	BeforeEach(func() {
+		vm = &v1alpha1.VirtualMachine{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       "VirtualMachine",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-vm",
+				Namespace: "dummy-ns",
+			},
+			Spec: v1alpha1.VirtualMachineSpec{
+				ImageName:  "dummy-image",
+				ClassName:  "dummy-class",
+				PowerState: vmprovider.VirtualMachineSuspended,
+			},
+			Status: v1alpha1.VirtualMachineStatus{
+				PowerState: vmprovider.VirtualMachineSuspended,
+			},
+		}
+	})
+
+	It("round-trips the suspended power state of the spec and status", func() {
+		out, err := roundTrip(loadVirtualMachineCRD(true), vm)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.Spec.PowerState).To(Equal(vmprovider.VirtualMachineSuspended))
+		Expect(out.Status.PowerState).To(Equal(vmprovider.VirtualMachineSuspended))
+	})
+
+	It("rejects the suspended power state without the patch", func() {
+		_, err := roundTrip(loadVirtualMachineCRD(false), vm)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("status.powerState"))
+	})
+})
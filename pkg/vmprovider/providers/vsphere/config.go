@@ -5,6 +5,7 @@ package vsphere
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -38,6 +39,24 @@ type VSphereVmProviderConfig struct {
 	CtrlVmVmAntiAffinityTag     string
 	WorkerVmVmAntiAffinityTag   string
 	TagCategoryName             string
+
+	// Zones are the availability zones of the namespace, by name.
+	Zones map[string]ZoneConfig
+
+	// ImportResourcePools are the managed object IDs of the resource pools that VMs can be imported
+	// from into the namespace.
+	ImportResourcePools []string
+}
+
+// ZoneConfig is the placement of the VMs of an availability zone.
+type ZoneConfig struct {
+	// Cluster is the managed object ID of the cluster of the zone. It defaults to the owner of
+	// ResourcePool.
+	Cluster string `json:"cluster,omitempty"`
+	// ResourcePool is the managed object ID of the resource pool of the zone.
+	ResourcePool string `json:"resourcePool"`
+	// Folder is the managed object ID of the VM folder of the zone.
+	Folder string `json:"folder"`
 }
 
 const (
@@ -67,6 +86,15 @@ const (
 	NamespaceRPAnnotationKey     = "vmware-system-resource-pool"
 	NamespaceFolderAnnotationKey = "vmware-system-vm-folder"
 
+	// NamespaceZonesAnnotationKey is the namespace annotation with the JSON map of the availability
+	// zones of the namespace, from the zone name to its ZoneConfig.
+	NamespaceZonesAnnotationKey = "vmoperator.vmware.com/zones"
+
+	// NamespaceImportResourcePoolsAnnotationKey is the namespace annotation with the comma separated
+	// managed object IDs of the resource pools that VMs can be imported from into the namespace. A
+	// VM outside of the resource pool of the namespace can only be imported from one of them.
+	NamespaceImportResourcePoolsAnnotationKey = "vmoperator.vmware.com/import-resource-pools"
+
 	NetworkConfigMapName = "vmoperator-network-config"
 	// Keys in the NetworkConfigMapName
 	NameserversKey = "nameservers"
@@ -176,6 +204,27 @@ func UpdateProviderConfigFromNamespace(client ctrlruntime.Client, namespace stri
 			"resourcePool", resourcePool, "vmFolder", vmFolder)
 	}
 
+	if zones := ns.ObjectMeta.Annotations[NamespaceZonesAnnotationKey]; zones != "" {
+		zoneConfigs := map[string]ZoneConfig{}
+		if err := json.Unmarshal([]byte(zones), &zoneConfigs); err != nil {
+			return errors.Wrapf(err, "invalid %s annotation on namespace %s", NamespaceZonesAnnotationKey, namespace)
+		}
+		for name, zone := range zoneConfigs {
+			if name == "" || zone.ResourcePool == "" || zone.Folder == "" {
+				return errors.Errorf("zone %q of namespace %s must have a name, a resource pool and a folder", name, namespace)
+			}
+		}
+		providerConfig.Zones = zoneConfigs
+	}
+
+	if importResourcePools := ns.ObjectMeta.Annotations[NamespaceImportResourcePoolsAnnotationKey]; importResourcePools != "" {
+		for _, resourcePool := range strings.Split(importResourcePools, ",") {
+			if resourcePool = strings.TrimSpace(resourcePool); resourcePool != "" {
+				providerConfig.ImportResourcePools = append(providerConfig.ImportResourcePools, resourcePool)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -101,6 +101,52 @@ var _ = Describe("UpdateVMFolderAndResourcePool", func() {
 			Expect(providerConfig).To(Equal(providerConfigIn))
 		})
 	})
+
+	Context("namespace has zones", func() {
+		It("provider config is updated with the zones", func() {
+			annotations := map[string]string{
+				NamespaceZonesAnnotationKey: `{"zone-a":{"resourcePool":"rp-a","folder":"folder-a"},"zone-b":{"cluster":"cluster-b","resourcePool":"rp-b","folder":"folder-b"}}`,
+			}
+			ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "namespace", Annotations: annotations}}
+			client := clientfake.NewFakeClient(ns)
+
+			providerConfig := &VSphereVmProviderConfig{}
+			Expect(UpdateProviderConfigFromNamespace(client, ns.Name, providerConfig)).To(Succeed())
+			Expect(providerConfig.Zones).To(Equal(map[string]ZoneConfig{
+				"zone-a": {ResourcePool: "rp-a", Folder: "folder-a"},
+				"zone-b": {Cluster: "cluster-b", ResourcePool: "rp-b", Folder: "folder-b"},
+			}))
+		})
+
+		DescribeTable("returns an error when the zones are invalid",
+			func(zones string) {
+				annotations := map[string]string{NamespaceZonesAnnotationKey: zones}
+				ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "namespace", Annotations: annotations}}
+				client := clientfake.NewFakeClient(ns)
+
+				providerConfig := &VSphereVmProviderConfig{}
+				Expect(UpdateProviderConfigFromNamespace(client, ns.Name, providerConfig)).ToNot(Succeed())
+				Expect(providerConfig.Zones).To(BeNil())
+			},
+			Entry("not JSON", "zone-a"),
+			Entry("no resource pool", `{"zone-a":{"folder":"folder-a"}}`),
+			Entry("no folder", `{"zone-a":{"resourcePool":"rp-a"}}`),
+		)
+	})
+
+	Context("namespace has import resource pools", func() {
+		It("provider config is updated with the import resource pools", func() {
+			annotations := map[string]string{
+				NamespaceImportResourcePoolsAnnotationKey: "resgroup-1, resgroup-2,",
+			}
+			ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "namespace", Annotations: annotations}}
+			client := clientfake.NewFakeClient(ns)
+
+			providerConfig := &VSphereVmProviderConfig{}
+			Expect(UpdateProviderConfigFromNamespace(client, ns.Name, providerConfig)).To(Succeed())
+			Expect(providerConfig.ImportResourcePools).To(Equal([]string{"resgroup-1", "resgroup-2"}))
+		})
+	})
 })
 
 var _ = Describe("GetProviderConfigFromConfigMap", func() {
@@ -14,6 +14,8 @@ const (
 
 	// Annotation placed on the VM
 	VCVMAnnotation = "Virtual Machine managed by the vSphere Virtual Machine service"
+	// Annotation placed on a VM retained when its VirtualMachine is deleted
+	VCVMRetainedAnnotation = "Virtual Machine retained from the vSphere Virtual Machine service"
 
 	// TODO: VMSVC-386: Rename and move to vmoperator-api
 	// Annotation key to skip validation checks of GuestOS Type
@@ -39,6 +41,14 @@ const (
 	// ExtraConfig key to mark vm for DRS to power off the vm as part of its maintenance cycle
 	MMPowerOffVMExtraConfigKey = "maintenance.vm.evacuation.poweroff"
 
+	// ExtraConfig key with the UID of the VirtualMachine that adopted an imported VM. Unlike the
+	// guestinfo keys, it cannot be set from the guest.
+	ImportedVMUIDExtraConfigKey = "vmservice.import.virtualmachine.uid"
+
+	// ExtraConfig key with the JSON encoded map of the names of the vSphere volumes without a device
+	// key to the controller key and unit number of the disks created for them.
+	EphemeralDisksExtraConfigKey = "vmservice.ephemeral-disks"
+
 	// VirtualMachineImage annotation to cache the last fetched version.
 	VMImageCLVersionAnnotation = pkg.VmOperatorKey + "/content-library-version"
 
@@ -6,9 +6,11 @@ package vsphere
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
 	vimTypes "github.com/vmware/govmomi/vim25/types"
 )
 
@@ -47,43 +49,102 @@ func CheckPlacementRelocateSpec(spec *vimTypes.VirtualMachineRelocateSpec) bool
 }
 
 func ParsePlaceVmResponse(res *vimTypes.PlacementResult) *vimTypes.VirtualMachineRelocateSpec {
-	for _, r := range res.Recommendations {
+	_, rSpec := parsePlaceVmRecommendation(res)
+	return rSpec
+}
+
+// parsePlaceVmRecommendation returns the first valid recommendation of the PlaceVm response, and
+// the RelocateSpec of its placement action.
+func parsePlaceVmRecommendation(res *vimTypes.PlacementResult) (*vimTypes.ClusterRecommendation, *vimTypes.VirtualMachineRelocateSpec) {
+	for i, r := range res.Recommendations {
 		if r.Reason == string(vimTypes.RecommendationReasonCodeXvmotionPlacement) {
 			for _, a := range r.Action {
 				if pa, ok := a.(*vimTypes.PlacementAction); ok {
 					if CheckPlacementRelocateSpec(pa.RelocateSpec) {
-						return pa.RelocateSpec
+						return &res.Recommendations[i], pa.RelocateSpec
 					}
 				}
 			}
 		}
 	}
-	return nil
+	return nil, nil
+}
+
+// placementRecommendation is the placement of a VM recommended by DRS.
+type placementRecommendation struct {
+	RelocateSpec *vimTypes.VirtualMachineRelocateSpec
+	// Reason is the reason of the recommendation.
+	Reason string
+}
+
+// insufficientResourcesError is returned when DRS does not recommend any placement for a VM.
+type insufficientResourcesError struct {
+	faults []string
+}
+
+func (e *insufficientResourcesError) Error() string {
+	if len(e.faults) == 0 {
+		return "no valid placement action"
+	}
+	return fmt.Sprintf("no valid placement action: %s", strings.Join(e.faults, "; "))
+}
+
+// drsFaults returns the messages of the faults that prevented DRS from placing the VM.
+func drsFaults(res *vimTypes.PlacementResult) []string {
+	if res.DrsFault == nil {
+		return nil
+	}
+
+	var faults []string
+	for _, faultsByVM := range res.DrsFault.FaultsByVm {
+		for _, fault := range faultsByVM.GetClusterDrsFaultsFaultsByVm().Fault {
+			if fault.LocalizedMessage != "" {
+				faults = append(faults, fault.LocalizedMessage)
+			}
+		}
+	}
+	if len(faults) == 0 && res.DrsFault.Reason != "" {
+		faults = append(faults, res.DrsFault.Reason)
+	}
+	return faults
 }
 
 func placeVM(
 	ctx context.Context,
 	cluster *object.ClusterComputeResource,
-	placementSpec vimTypes.PlacementSpec) (*vimTypes.VirtualMachineRelocateSpec, error) {
+	placementSpec vimTypes.PlacementSpec) (*placementRecommendation, error) {
 
 	res, err := cluster.PlaceVm(ctx, placementSpec)
 	if err != nil {
+		if soap.IsSoapFault(err) {
+			switch soap.ToSoapFault(err).VimFault().(type) {
+			case vimTypes.InsufficientResourcesFault, vimTypes.InsufficientCpuResourcesFault,
+				vimTypes.InsufficientMemoryResourcesFault, vimTypes.InsufficientHostCapacityFault:
+				return nil, &insufficientResourcesError{faults: []string{err.Error()}}
+			}
+		}
 		return nil, err
 	}
 
-	rSpec := ParsePlaceVmResponse(res)
+	r, rSpec := parsePlaceVmRecommendation(res)
 	if rSpec == nil {
-		return nil, fmt.Errorf("no valid placement action")
+		return nil, &insufficientResourcesError{faults: drsFaults(res)}
 	}
 
-	return rSpec, nil
+	reason := r.ReasonText
+	if reason == "" {
+		reason = r.Reason
+	}
+
+	return &placementRecommendation{RelocateSpec: rSpec, Reason: reason}, nil
 }
 
 func cloneVMRelocateSpec(
 	ctx context.Context,
 	cluster *object.ClusterComputeResource,
 	vmRef vimTypes.ManagedObjectReference,
-	cloneSpec *vimTypes.VirtualMachineCloneSpec) (*vimTypes.VirtualMachineRelocateSpec, error) {
+	cloneSpec *vimTypes.VirtualMachineCloneSpec,
+	datastores []vimTypes.ManagedObjectReference) (*placementRecommendation, error) {
 
 	placementSpec := vimTypes.PlacementSpec{
 		PlacementType: string(vimTypes.PlacementSpecPlacementTypeClone),
@@ -91,6 +152,24 @@ func cloneVMRelocateSpec(
 		RelocateSpec:  &cloneSpec.Location,
 		CloneName:     cloneSpec.Config.Name,
 		Vm:            &vmRef,
+		Datastores:    datastores,
+	}
+
+	return placeVM(ctx, cluster, placementSpec)
+}
+
+func createVMRelocateSpec(
+	ctx context.Context,
+	cluster *object.ClusterComputeResource,
+	configSpec *vimTypes.VirtualMachineConfigSpec,
+	relocateSpec *vimTypes.VirtualMachineRelocateSpec,
+	datastores []vimTypes.ManagedObjectReference) (*placementRecommendation, error) {
+
+	placementSpec := vimTypes.PlacementSpec{
+		PlacementType: string(vimTypes.PlacementSpecPlacementTypeCreate),
+		ConfigSpec:    configSpec,
+		RelocateSpec:  relocateSpec,
+		Datastores:    datastores,
 	}
 
 	return placeVM(ctx, cluster, placementSpec)
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2018-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package resources
@@ -7,9 +7,11 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/guest"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/task"
 	"github.com/vmware/govmomi/vim25/mo"
@@ -27,6 +29,16 @@ type VirtualMachine struct {
 
 var log = logf.Log.WithName("vmresource")
 
+// ErrGuestToolsNotRunning is returned by guest operations when VMware Tools is not running in the guest.
+var ErrGuestToolsNotRunning = errors.New("VMware Tools is not running")
+
+// GuestProgramPollInterval is how often a program started in the guest is checked for completion.
+var GuestProgramPollInterval = time.Second
+
+// guestProgramTerminateTimeout is how long to wait for a program that did not exit in time to be
+// terminated in the guest.
+const guestProgramTerminateTimeout = 10 * time.Second
+
 // NewVMForCreate returns a VirtualMachine that Create() can be called on
 // to create the VM and set the VirtualMachine object reference.
 func NewVMForCreate(name string) *VirtualMachine {
@@ -228,6 +240,82 @@ func (vm *VirtualMachine) SetPowerState(ctx context.Context, desiredPowerState v
 	return nil
 }
 
+// ShutdownGuest shuts down the guest through VMware Tools. It does not wait for the VM to be
+// powered off.
+func (vm *VirtualMachine) ShutdownGuest(ctx context.Context) error {
+	vm.logger.V(5).Info("ShutdownGuest")
+
+	if err := vm.checkGuestToolsRunning(ctx); err != nil {
+		return err
+	}
+
+	return vm.vcVirtualMachine.ShutdownGuest(ctx)
+}
+
+// WaitForPowerState waits until the VM is in the power state, or the context is done.
+func (vm *VirtualMachine) WaitForPowerState(ctx context.Context, powerState types.VirtualMachinePowerState) error {
+	vm.logger.V(5).Info("WaitForPowerState", "powerState", powerState)
+	return vm.vcVirtualMachine.WaitForPowerState(ctx, powerState)
+}
+
+// RebootGuest reboots the guest through VMware Tools.
+func (vm *VirtualMachine) RebootGuest(ctx context.Context) error {
+	vm.logger.V(5).Info("RebootGuest")
+
+	if err := vm.checkGuestToolsRunning(ctx); err != nil {
+		return err
+	}
+
+	return vm.vcVirtualMachine.RebootGuest(ctx)
+}
+
+// Reset hard resets the VM.
+func (vm *VirtualMachine) Reset(ctx context.Context) error {
+	vm.logger.V(5).Info("Reset")
+
+	resetTask, err := vm.vcVirtualMachine.Reset(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = resetTask.WaitForResult(ctx, nil)
+	return err
+}
+
+// Relocate relocates the VM according to the relocate spec.
+func (vm *VirtualMachine) Relocate(ctx context.Context, relocateSpec types.VirtualMachineRelocateSpec) error {
+	vm.logger.V(5).Info("Relocate", "relocateSpec", relocateSpec)
+
+	relocateTask, err := vm.vcVirtualMachine.Relocate(ctx, relocateSpec, types.VirtualMachineMovePriorityDefaultPriority)
+	if err != nil {
+		return err
+	}
+
+	_, err = relocateTask.WaitForResult(ctx, nil)
+	return err
+}
+
+// StartRelocate starts the relocation of the VM according to the relocate spec, and returns the
+// relocation task without waiting for it.
+func (vm *VirtualMachine) StartRelocate(ctx context.Context, relocateSpec types.VirtualMachineRelocateSpec) (*object.Task, error) {
+	vm.logger.V(5).Info("StartRelocate", "relocateSpec", relocateSpec)
+
+	return vm.vcVirtualMachine.Relocate(ctx, relocateSpec, types.VirtualMachineMovePriorityDefaultPriority)
+}
+
+// Suspend suspends the VM.
+func (vm *VirtualMachine) Suspend(ctx context.Context) error {
+	vm.logger.V(5).Info("Suspend")
+
+	suspendTask, err := vm.vcVirtualMachine.Suspend(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = suspendTask.WaitForResult(ctx, nil)
+	return err
+}
+
 // GetVirtualDevices returns the VMs VirtualDeviceList
 func (vm *VirtualMachine) GetVirtualDevices(ctx context.Context) (object.VirtualDeviceList, error) {
 	vm.logger.V(5).Info("GetVirtualDevices")
@@ -288,3 +376,137 @@ func (vm *VirtualMachine) Customize(ctx context.Context, spec types.Customizatio
 
 	return nil
 }
+
+// RunGuestProgram starts the program in the guest and waits for it to exit, or for the context to be done
+// in which case the program is terminated. It returns the exit code of the program. Each argument is
+// quoted, with the rules of the guest family, so that the guest passes it to the program as is.
+func (vm *VirtualMachine) RunGuestProgram(
+	ctx context.Context,
+	auth types.BaseGuestAuthentication,
+	programPath string,
+	args ...string) (int32, error) {
+
+	vm.logger.V(5).Info("RunGuestProgram", "programPath", programPath)
+
+	guestInfo, err := vm.runningGuestInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	opsMgr := guest.NewOperationsManager(vm.vcVirtualMachine.Client(), vm.vcVirtualMachine.Reference())
+	procMgr, err := opsMgr.ProcessManager(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := procMgr.StartProgram(ctx, auth, &types.GuestProgramSpec{
+		ProgramPath: programPath,
+		Arguments:   guestProgramArguments(guestInfo.GuestFamily, args),
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to start %s in the guest", programPath)
+	}
+
+	for {
+		procs, err := procMgr.ListProcesses(ctx, auth, []int64{pid})
+		if err != nil {
+			return 0, err
+		}
+		if len(procs) == 1 && procs[0].EndTime != nil {
+			return procs[0].ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			vm.terminateGuestProgram(procMgr, auth, programPath, pid)
+			return 0, ctx.Err()
+		case <-time.After(GuestProgramPollInterval):
+		}
+	}
+}
+
+// terminateGuestProgram terminates a program that is still running in the guest so that it does
+// not outlive the caller that gave up waiting for it.
+func (vm *VirtualMachine) terminateGuestProgram(
+	procMgr *guest.ProcessManager,
+	auth types.BaseGuestAuthentication,
+	programPath string,
+	pid int64) {
+
+	// The context of the caller is already done.
+	ctx, cancel := context.WithTimeout(context.Background(), guestProgramTerminateTimeout)
+	defer cancel()
+
+	if err := procMgr.TerminateProcess(ctx, auth, pid); err != nil {
+		vm.logger.Error(err, "Failed to terminate program in the guest", "programPath", programPath, "pid", pid)
+	}
+}
+
+// guestProgramArguments returns the command line of the arguments of a guest program. A Windows
+// guest splits the command line with the rules of the C runtime, so an argument with whitespace or
+// double quotes is double quoted, with its own double quotes and the backslashes before them
+// escaped. Other guests split the command line with the rules of a POSIX shell, so an argument with
+// characters other than the ones below is single quoted, with its own single quotes escaped.
+func guestProgramArguments(guestFamily string, args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if guestFamily == string(types.VirtualMachineGuestOsFamilyWindowsGuest) {
+			quoted[i] = windowsGuestProgramArgument(arg)
+			continue
+		}
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@%+") == "" {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// windowsGuestProgramArgument returns the argument quoted for the command line of a program of a
+// Windows guest. Backslashes are only special before a double quote, so they are doubled before an
+// escaped double quote and before the closing double quote.
+func windowsGuestProgramArgument(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\v\"") {
+		return arg
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteByte('"')
+	backslashes := 0
+	for _, r := range arg {
+		switch r {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			sb.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			sb.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		sb.WriteRune(r)
+		backslashes = 0
+	}
+	sb.WriteString(strings.Repeat(`\`, 2*backslashes))
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// checkGuestToolsRunning returns ErrGuestToolsNotRunning if VMware Tools is not running in the guest.
+func (vm *VirtualMachine) checkGuestToolsRunning(ctx context.Context) error {
+	_, err := vm.runningGuestInfo(ctx)
+	return err
+}
+
+// runningGuestInfo returns the tools running status and the family of the guest, or
+// ErrGuestToolsNotRunning if VMware Tools is not running in the guest.
+func (vm *VirtualMachine) runningGuestInfo(ctx context.Context) (*types.GuestInfo, error) {
+	moVM, err := vm.GetProperties(ctx, []string{"guest.toolsRunningStatus", "guest.guestFamily"})
+	if err != nil {
+		return nil, err
+	}
+	if moVM.Guest == nil || moVM.Guest.ToolsRunningStatus != string(types.VirtualMachineToolsRunningStatusGuestToolsRunning) {
+		return nil, ErrGuestToolsNotRunning
+	}
+	return moVM.Guest, nil
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 
@@ -26,6 +27,7 @@ import (
 
 	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
 )
 
@@ -57,6 +59,18 @@ type Session struct {
 
 	mutex              sync.Mutex
 	cpuMinMHzInCluster uint64 // CPU Min Frequency across all Hosts in the cluster
+
+	// zones are the availability zones of the namespace, by name.
+	zones map[string]*zone
+	// zonePlacements are the zones that the VMs were spread to, by VM name. It is protected by mutex.
+	zonePlacements map[string]string
+
+	// importResourcePools are the managed object IDs of the resource pools that VMs can be imported
+	// from into the namespace.
+	importResourcePools []string
+
+	// clusterRulesMutex serializes the updates of the DRS rules and cluster groups of the VM groups.
+	clusterRulesMutex sync.Mutex
 }
 
 func NewSessionAndConfigure(ctx context.Context, client *Client, config *VSphereVmProviderConfig,
@@ -74,6 +88,7 @@ func NewSessionAndConfigure(ctx context.Context, client *Client, config *VSphere
 		scheme:                scheme,
 		storageClassRequired:  config.StorageClassRequired,
 		useInventoryForImages: config.UseInventoryAsContentSource,
+		importResourcePools:   config.ImportResourcePools,
 	}
 
 	if err := s.initSession(ctx, config); err != nil {
@@ -136,6 +151,10 @@ func (s *Session) initSession(ctx context.Context, config *VSphereVmProviderConf
 		}
 	}
 
+	if err := s.initZones(ctx, config.Zones); err != nil {
+		return err
+	}
+
 	// Network setting is optional. This is only supported for test env, if that.
 	if config.Network != "" {
 		s.network, err = s.Finder.Network(ctx, config.Network)
@@ -274,14 +293,24 @@ func (s *Session) findChildEntity(ctx context.Context, parent object.Reference,
 // ChildResourcePool returns a child resource pool by a given name under the session's parent
 // resource pool, returns error if no child resource pool exists with a given name.
 func (s *Session) ChildResourcePool(ctx context.Context, resourcePoolName string) (*object.ResourcePool, error) {
-	resourcePool, err := s.findChildEntity(ctx, s.resourcePool, resourcePoolName)
-	if err != nil {
-		return nil, err
-	}
+	return s.childResourcePool(ctx, s.resourcePool, resourcePoolName)
+}
 
-	rp, ok := resourcePool.(*object.ResourcePool)
-	if !ok {
-		return nil, fmt.Errorf("ResourcePool %q is not expected ResourcePool type but a %T", resourcePoolName, resourcePool)
+// childResourcePool returns the resource pool with the given name under the parent resource pool.
+// The name can be the path of nested resource pools, such as "tenant/web".
+func (s *Session) childResourcePool(ctx context.Context, parent *object.ResourcePool, resourcePoolName string) (*object.ResourcePool, error) {
+	rp := parent
+	for _, name := range vmprovider.GetResourcePoolPath(resourcePoolName) {
+		resourcePool, err := s.findChildEntity(ctx, rp, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var ok bool
+		rp, ok = resourcePool.(*object.ResourcePool)
+		if !ok {
+			return nil, fmt.Errorf("ResourcePool %q is not expected ResourcePool type but a %T", name, resourcePool)
+		}
 	}
 	return rp, nil
 }
@@ -289,7 +318,11 @@ func (s *Session) ChildResourcePool(ctx context.Context, resourcePoolName string
 // ChildFolder returns a child resource pool by a given name under the session's parent
 // resource pool, returns error if no child resource pool exists with a given name.
 func (s *Session) ChildFolder(ctx context.Context, folderName string) (*object.Folder, error) {
-	folder, err := s.findChildEntity(ctx, s.folder, folderName)
+	return s.childFolder(ctx, s.folder, folderName)
+}
+
+func (s *Session) childFolder(ctx context.Context, parent *object.Folder, folderName string) (*object.Folder, error) {
+	folder, err := s.findChildEntity(ctx, parent, folderName)
 	if err != nil {
 		return nil, err
 	}
@@ -301,59 +334,178 @@ func (s *Session) ChildFolder(ctx context.Context, folderName string) (*object.F
 	return f, nil
 }
 
-// DoesResourcePoolExist checks if a ResourcePool with the given name exists.
+// DoesResourcePoolExist checks if a ResourcePool with the given name exists under the session's
+// ResourcePool and the ResourcePool of each zone.
 func (s *Session) DoesResourcePoolExist(ctx context.Context, resourcePoolName string) (bool, error) {
 	log.V(4).Info("Checking if ResourcePool exists", "resourcePoolName", resourcePoolName)
-	_, err := s.ChildResourcePool(ctx, resourcePoolName)
-	if err != nil {
-		switch err.(type) {
-		case *find.NotFoundError:
-			return false, nil
-		default:
-			return false, err
+	for _, parent := range s.parentResourcePools() {
+		_, err := s.childResourcePool(ctx, parent, resourcePoolName)
+		if err != nil {
+			switch err.(type) {
+			case *find.NotFoundError:
+				return false, nil
+			default:
+				return false, err
+			}
 		}
 	}
 
 	return true, nil
 }
 
-// CreateResourcePool creates a ResourcePool under the parent ResourcePool (session.resourcePool).
+// CreateResourcePool creates a ResourcePool under the parent ResourcePool (session.resourcePool), and
+// under the ResourcePool of each zone. The ResourcePools that already exist are left as is. When
+// the name is the path of nested ResourcePools, the missing parents are created too.
 func (s *Session) CreateResourcePool(ctx context.Context, rpSpec *v1alpha1.ResourcePoolSpec) (string, error) {
+	resourcePoolID, _, err := s.createResourcePool(ctx, rpSpec)
+	return resourcePoolID, err
+}
+
+// createResourcePool is CreateResourcePool that also returns the paths of the parent ResourcePools
+// it created, by MoID of the ResourcePool they were created under. They are returned on error too.
+func (s *Session) createResourcePool(ctx context.Context, rpSpec *v1alpha1.ResourcePoolSpec) (string, map[string][]string, error) {
 	log.Info("Creating ResourcePool with session", "name", rpSpec.Name)
 
 	// CreateResourcePool is invoked during a ResourcePolicy reconciliation to create a ResourcePool for a set of
 	// VirtualMachines. The new RP is created under the RP corresponding to the session.
 	// For a Supervisor Cluster deployment, the session's RP is the supervisor cluster namespace's RP.
 	// For IAAS deployments, the session's RP correspond to RP in provider ConfigMap.
-	resourcePool, err := s.resourcePool.Create(ctx, rpSpec.Name, types.DefaultResourceConfigSpec())
-	if err != nil {
-		return "", err
-	}
+	var resourcePoolID string
+	createdParents := map[string][]string{}
+	for _, parent := range s.parentResourcePools() {
+		path := vmprovider.GetResourcePoolPath(rpSpec.Name)
+		resourcePool := parent
+		for i, name := range path {
+			child, err := s.childResourcePool(ctx, resourcePool, name)
+			if err != nil {
+				if _, ok := err.(*find.NotFoundError); !ok {
+					return "", createdParents, err
+				}
+
+				child, err = resourcePool.Create(ctx, name, types.DefaultResourceConfigSpec())
+				if err != nil {
+					return "", createdParents, err
+				}
+
+				log.Info("Created ResourcePool", "name", child.Name(), "path", child.InventoryPath)
+				if i < len(path)-1 {
+					parentID := parent.Reference().Value
+					createdParents[parentID] = append(createdParents[parentID],
+						strings.Join(path[:i+1], vmprovider.ResourcePoolPathSeparator))
+				}
+			}
+			resourcePool = child
+		}
 
-	log.Info("Created ResourcePool", "name", resourcePool.Name(), "path", resourcePool.InventoryPath)
+		if resourcePoolID == "" {
+			resourcePoolID = resourcePool.Reference().Value
+		}
+	}
 
-	return resourcePool.Reference().Value, nil
+	return resourcePoolID, createdParents, nil
 }
 
-// UpdateResourcePool updates a ResourcePool with the given spec.
-func (s *Session) UpdateResourcePool(ctx context.Context, rpSpec *v1alpha1.ResourcePoolSpec) error {
-	// Nothing to do if no reservation and limits set.
-	hasReservations := !rpSpec.Reservations.Cpu.IsZero() || !rpSpec.Reservations.Memory.IsZero()
-	hasLimits := !rpSpec.Limits.Cpu.IsZero() || !rpSpec.Limits.Memory.IsZero()
-	if !hasReservations || !hasLimits {
-		return nil
-	}
+// UpdateResourcePool updates the reservations, limits and shares of the ResourcePool under the
+// session's ResourcePool and the ResourcePool of each zone. The reservations, limits and shares
+// that are not specified are left as is, unless they were specified when the applied allocation
+// was last applied, in which case they are reset.
+func (s *Session) UpdateResourcePool(
+	ctx context.Context,
+	rpSpec *v1alpha1.ResourcePoolSpec,
+	applied vmprovider.ResourcePoolAllocation,
+	cpuShares, memoryShares vmprovider.Shares) error {
+
+	configSpec := s.resourcePoolConfigSpec(rpSpec, applied, cpuShares, memoryShares)
+
+	for _, parent := range s.parentResourcePools() {
+		resourcePool, err := s.childResourcePool(ctx, parent, rpSpec.Name)
+		if err != nil {
+			return err
+		}
+
+		var o mo.ResourcePool
+		if err := resourcePool.Properties(ctx, resourcePool.Reference(), []string{"config"}, &o); err != nil {
+			return err
+		}
+
+		if isResourceAllocationUpToDate(o.Config.CpuAllocation, configSpec.CpuAllocation) &&
+			isResourceAllocationUpToDate(o.Config.MemoryAllocation, configSpec.MemoryAllocation) {
+			continue
+		}
 
-	log.V(4).Info("Updating the ResourcePool", "name", rpSpec.Name)
-	// TODO https://jira.eng.vmware.com/browse/GCM-1607
+		log.Info("Updating the ResourcePool", "name", rpSpec.Name, "path", resourcePool.InventoryPath)
+		if err := resourcePool.UpdateConfig(ctx, "", &configSpec); err != nil {
+			log.Error(err, "Error in updating ResourcePool", "name", rpSpec.Name)
+			return err
+		}
+	}
 
 	return nil
 }
 
+// DeleteResourcePool deletes the ResourcePool under the session's ResourcePool and the ResourcePool
+// of each zone.
 func (s *Session) DeleteResourcePool(ctx context.Context, resourcePoolName string) error {
+	return s.deleteResourcePool(ctx, resourcePoolName, nil)
+}
+
+// deleteResourcePool is DeleteResourcePool that also deletes the parent ResourcePools created for
+// it, by MoID of the ResourcePool they were created under, that are empty. A parent that has other
+// ResourcePools or VMs is left as is.
+func (s *Session) deleteResourcePool(ctx context.Context, resourcePoolName string, createdParents map[string][]string) error {
 	log.Info("Deleting the ResourcePool", "name", resourcePoolName)
 
-	resourcePool, err := s.ChildResourcePool(ctx, resourcePoolName)
+	for _, parent := range s.parentResourcePools() {
+		if err := s.deleteChildResourcePool(ctx, parent, resourcePoolName); err != nil {
+			return err
+		}
+
+		// Delete the innermost parents first.
+		paths := append([]string(nil), createdParents[parent.Reference().Value]...)
+		sort.Slice(paths, func(i, j int) bool {
+			return len(vmprovider.GetResourcePoolPath(paths[i])) > len(vmprovider.GetResourcePoolPath(paths[j]))
+		})
+		for _, path := range paths {
+			if !strings.HasPrefix(resourcePoolName, path+vmprovider.ResourcePoolPathSeparator) {
+				// Only the parents of the ResourcePool can be deleted with it.
+				continue
+			}
+			if err := s.deleteEmptyChildResourcePool(ctx, parent, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteEmptyChildResourcePool deletes the ResourcePool under the parent ResourcePool if it has no
+// ResourcePools nor VMs.
+func (s *Session) deleteEmptyChildResourcePool(ctx context.Context, parent *object.ResourcePool, resourcePoolName string) error {
+	resourcePool, err := s.childResourcePool(ctx, parent, resourcePoolName)
+	if err != nil {
+		switch err.(type) {
+		case *find.NotFoundError, *find.DefaultNotFoundError:
+			return nil
+		default:
+			return err
+		}
+	}
+
+	var o mo.ResourcePool
+	if err := resourcePool.Properties(ctx, resourcePool.Reference(), []string{"resourcePool", "vm"}, &o); err != nil {
+		return err
+	}
+	if len(o.ResourcePool) != 0 || len(o.Vm) != 0 {
+		log.Info("Keeping the parent ResourcePool that is not empty", "name", resourcePoolName)
+		return nil
+	}
+
+	return s.deleteChildResourcePool(ctx, parent, resourcePoolName)
+}
+
+func (s *Session) deleteChildResourcePool(ctx context.Context, parent *object.ResourcePool, resourcePoolName string) error {
+	resourcePool, err := s.childResourcePool(ctx, parent, resourcePoolName)
 	if err != nil {
 		switch err.(type) {
 		case *find.NotFoundError, *find.DefaultNotFoundError:
@@ -382,22 +534,26 @@ func (s *Session) DeleteResourcePool(ctx context.Context, resourcePoolName strin
 	return nil
 }
 
-// DoesFolderExist checks if a Folder with the given name exists.
+// DoesFolderExist checks if a Folder with the given name exists under the session's Folder and the
+// Folder of each zone.
 func (s *Session) DoesFolderExist(ctx context.Context, folderName string) (bool, error) {
-	_, err := s.ChildFolder(ctx, folderName)
-	if err != nil {
-		switch err.(type) {
-		case *find.NotFoundError:
-			return false, nil
-		default:
-			return false, err
+	for _, parent := range s.parentFolders() {
+		_, err := s.childFolder(ctx, parent, folderName)
+		if err != nil {
+			switch err.(type) {
+			case *find.NotFoundError:
+				return false, nil
+			default:
+				return false, err
+			}
 		}
 	}
 
 	return true, nil
 }
 
-// CreateFolder creates a folder under the parent Folder (session.folder).
+// CreateFolder creates a folder under the parent Folder (session.folder), and under the Folder of
+// each zone. The Folders that already exist are left as is.
 func (s *Session) CreateFolder(ctx context.Context, folderSpec *v1alpha1.FolderSpec) (string, error) {
 	log.Info("Creating a new Folder", "name", folderSpec.Name)
 
@@ -405,21 +561,47 @@ func (s *Session) CreateFolder(ctx context.Context, folderSpec *v1alpha1.FolderS
 	// The new Folder is created under the Folder corresponding to the session.
 	// For a Supervisor Cluster deployment, the session's Folder is the supervisor cluster namespace's Folder.
 	// For IAAS deployments, the session's Folder corresponds to Folder in provider ConfigMap.
-	folder, err := s.folder.CreateFolder(ctx, folderSpec.Name)
-	if err != nil {
-		return "", err
-	}
+	var folderID string
+	for _, parent := range s.parentFolders() {
+		folder, err := s.childFolder(ctx, parent, folderSpec.Name)
+		if err != nil {
+			if _, ok := err.(*find.NotFoundError); !ok {
+				return "", err
+			}
+
+			folder, err = parent.CreateFolder(ctx, folderSpec.Name)
+			if err != nil {
+				return "", err
+			}
 
-	log.Info("Created Folder", "name", folder.Name(), "path", folder.InventoryPath)
+			log.Info("Created Folder", "name", folder.Name(), "path", folder.InventoryPath)
+		}
 
-	return folder.Reference().Value, nil
+		if folderID == "" {
+			folderID = folder.Reference().Value
+		}
+	}
+
+	return folderID, nil
 }
 
-// DeleteFolder deletes the folder under the parent Folder (session.folder).
+// DeleteFolder deletes the folder under the parent Folder (session.folder) and the Folder of each zone.
 func (s *Session) DeleteFolder(ctx context.Context, folderName string) error {
 	log.Info("Deleting the Folder", "name", folderName)
 
-	folder, err := s.ChildFolder(ctx, folderName)
+	for _, parent := range s.parentFolders() {
+		if err := s.deleteChildFolder(ctx, parent, folderName); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Successfully deleted folder", "name", folderName)
+
+	return nil
+}
+
+func (s *Session) deleteChildFolder(ctx context.Context, parent *object.Folder, folderName string) error {
+	folder, err := s.childFolder(ctx, parent, folderName)
 	if err != nil {
 		switch err.(type) {
 		case *find.NotFoundError, *find.DefaultNotFoundError:
@@ -444,22 +626,20 @@ func (s *Session) DeleteFolder(ctx context.Context, folderName string) error {
 		return err
 	}
 
-	log.Info("Successfully deleted folder", "name", folderName)
-
 	return nil
 }
 
-// getResourcePoolAndFolder gets the ResourcePool and Folder from the Resource Policy. If no policy
-// is specified, the session's ResourcePool and Folder is returned instead.
-func (s *Session) getResourcePoolAndFolder(vmCtx VMContext,
+// getResourcePoolAndFolder gets the ResourcePool and Folder of the zone from the Resource Policy. If
+// no policy is specified, the zone's ResourcePool and Folder is returned instead.
+func (s *Session) getResourcePoolAndFolder(vmCtx VMContext, z *zone,
 	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) (*object.ResourcePool, *object.Folder, error) {
 
 	if resourcePolicy == nil {
-		return s.resourcePool, s.folder, nil
+		return z.resourcePool, z.folder, nil
 	}
 
 	resourcePoolName := resourcePolicy.Spec.ResourcePool.Name
-	resourcePool, err := s.ChildResourcePool(vmCtx, resourcePoolName)
+	resourcePool, err := s.childResourcePool(vmCtx, z.resourcePool, resourcePoolName)
 	if err != nil {
 		vmCtx.Logger.Error(err, "Unable to find ResourcePool", "name", resourcePoolName)
 		return nil, nil, err
@@ -469,7 +649,7 @@ func (s *Session) getResourcePoolAndFolder(vmCtx VMContext,
 		"name", resourcePoolName, "moRef", resourcePool.Reference().Value)
 
 	folderName := resourcePolicy.Spec.Folder.Name
-	folder, err := s.ChildFolder(vmCtx, folderName)
+	folder, err := s.childFolder(vmCtx, z.folder, folderName)
 	if err != nil {
 		vmCtx.Logger.Error(err, "Unable to find Folder", "name", folderName)
 		return nil, nil, err
@@ -499,6 +679,11 @@ func (s *Session) GetVirtualMachine(vmCtx VMContext) (*res.VirtualMachine, error
 			"moID", uniqueID, "error", err)
 	}
 
+	z, err := s.getVMZone(vmCtx)
+	if err != nil {
+		return nil, err
+	}
+
 	var folder *object.Folder
 
 	if policyName := vmCtx.VM.Spec.ResourcePolicyName; policyName != "" {
@@ -511,17 +696,16 @@ func (s *Session) GetVirtualMachine(vmCtx VMContext) (*res.VirtualMachine, error
 			return nil, err
 		}
 
-		var err error
-		folder, err = s.ChildFolder(vmCtx, rp.Spec.Folder.Name)
+		folder, err = s.childFolder(vmCtx, z.folder, rp.Spec.Folder.Name)
 		if err != nil {
 			vmCtx.Logger.Error(err, "Failed to find child Folder", "name", rp.Spec.Folder.Name, "rpName", rpKey)
 			return nil, err
 		}
 	} else {
-		// Developer enablement path: use the default folder for the session.
+		// Developer enablement path: use the default folder for the session, or the folder of the zone.
 		// TODO: AKP: If any of the parent objects have been renamed, the cached inventory
 		// path will be stale: https://jira.eng.vmware.com/browse/GCM-3124.
-		folder = s.folder
+		folder = z.folder
 	}
 
 	path := folder.InventoryPath + "/" + vmCtx.VM.Name
@@ -0,0 +1,188 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+var sharesLevels = map[vmprovider.SharesLevel]vimTypes.SharesLevel{
+	vmprovider.SharesLevelLow:    vimTypes.SharesLevelLow,
+	vmprovider.SharesLevelNormal: vimTypes.SharesLevelNormal,
+	vmprovider.SharesLevelHigh:   vimTypes.SharesLevelHigh,
+	vmprovider.SharesLevelCustom: vimTypes.SharesLevelCustom,
+}
+
+// resourcePoolConfigSpec returns the ResourceConfigSpec of the child resource pool of a resource
+// policy. It only has the reservations, limits and shares that the policy specifies, so that the
+// others are left as is, except for the reservations and limits of the applied allocation that the
+// policy no longer specifies, which are reset to no reservation and no limit. The CPU reservation
+// and limit are converted to MHz with the minimum CPU frequency of the cluster, like the ones of the
+// VMs, and are left as is while it is unknown.
+func (s *Session) resourcePoolConfigSpec(
+	rpSpec *v1alpha1.ResourcePoolSpec,
+	applied vmprovider.ResourcePoolAllocation,
+	cpuShares, memoryShares vmprovider.Shares) vimTypes.ResourceConfigSpec {
+
+	spec := vimTypes.ResourceConfigSpec{
+		CpuAllocation:    newResourceAllocationInfo(cpuShares),
+		MemoryAllocation: newResourceAllocationInfo(memoryShares),
+	}
+
+	if minFreq := s.GetCpuMinMHzInCluster(); minFreq != 0 {
+		toMhz := func(q resource.Quantity) int64 { return CpuQuantityToMhz(q, minFreq) }
+		spec.CpuAllocation.Reservation = resourceAllocationValue(rpSpec.Reservations.Cpu, toMhz)
+		spec.CpuAllocation.Limit = resourceAllocationValue(rpSpec.Limits.Cpu, toMhz)
+	} else if !rpSpec.Reservations.Cpu.IsZero() || !rpSpec.Limits.Cpu.IsZero() {
+		log.Info("Skipping the CPU reservation and limit of the ResourcePool since the CPU frequency of the cluster is unknown",
+			"name", rpSpec.Name)
+	}
+
+	spec.MemoryAllocation.Reservation = resourceAllocationValue(rpSpec.Reservations.Memory, memoryQuantityToMb)
+	spec.MemoryAllocation.Limit = resourceAllocationValue(rpSpec.Limits.Memory, memoryQuantityToMb)
+
+	resetRemovedResourceAllocation(&spec.CpuAllocation, rpSpec.Reservations.Cpu, rpSpec.Limits.Cpu,
+		applied.Reservations.Cpu, applied.Limits.Cpu)
+	resetRemovedResourceAllocation(&spec.MemoryAllocation, rpSpec.Reservations.Memory, rpSpec.Limits.Memory,
+		applied.Reservations.Memory, applied.Limits.Memory)
+
+	return spec
+}
+
+// resetRemovedResourceAllocation resets the reservation to 0 and the limit to unlimited when they
+// were applied but are no longer specified.
+func resetRemovedResourceAllocation(
+	allocation *vimTypes.ResourceAllocationInfo,
+	reservation, limit, appliedReservation, appliedLimit resource.Quantity) {
+
+	if reservation.IsZero() && !appliedReservation.IsZero() {
+		allocation.Reservation = new(int64)
+	}
+	if limit.IsZero() && !appliedLimit.IsZero() {
+		unlimited := int64(-1)
+		allocation.Limit = &unlimited
+	}
+}
+
+// resourceAllocationValue returns the converted quantity, or nil if the quantity is not specified.
+func resourceAllocationValue(q resource.Quantity, convert func(resource.Quantity) int64) *int64 {
+	if q.IsZero() {
+		return nil
+	}
+	value := convert(q)
+	return &value
+}
+
+func newResourceAllocationInfo(shares vmprovider.Shares) vimTypes.ResourceAllocationInfo {
+	if shares.Level == "" {
+		return vimTypes.ResourceAllocationInfo{}
+	}
+	return vimTypes.ResourceAllocationInfo{
+		Shares: &vimTypes.SharesInfo{
+			Level:  sharesLevels[shares.Level],
+			Shares: shares.Shares,
+		},
+	}
+}
+
+// isResourceAllocationUpToDate returns true if the allocation has the reservation, limit and shares
+// that the desired allocation has. The number of shares only matters for the custom level, since
+// vSphere computes it for the other levels.
+func isResourceAllocationUpToDate(allocation, desired vimTypes.ResourceAllocationInfo) bool {
+	if desired.Reservation != nil && (allocation.Reservation == nil || *allocation.Reservation != *desired.Reservation) {
+		return false
+	}
+	if desired.Limit != nil && (allocation.Limit == nil || *allocation.Limit != *desired.Limit) {
+		return false
+	}
+	if desired.Shares == nil {
+		return true
+	}
+	if allocation.Shares == nil || allocation.Shares.Level != desired.Shares.Level {
+		return false
+	}
+	return desired.Shares.Level != vimTypes.SharesLevelCustom || allocation.Shares.Shares == desired.Shares.Shares
+}
+
+// GetResourcePoolStatus returns the effective allocation and the utilization of the child resource
+// pool of a resource policy under the session's resource pool and the resource pool of each zone.
+func (s *Session) GetResourcePoolStatus(ctx context.Context, resourcePoolName string) ([]vmprovider.ResourcePoolStatus, error) {
+	var status []vmprovider.ResourcePoolStatus
+
+	seen := map[string]struct{}{}
+	for _, z := range s.sortedZones() {
+		if z.resourcePool == nil {
+			continue
+		}
+		if _, ok := seen[z.resourcePool.Reference().Value]; ok {
+			continue
+		}
+		seen[z.resourcePool.Reference().Value] = struct{}{}
+
+		resourcePool, err := s.childResourcePool(ctx, z.resourcePool, resourcePoolName)
+		if err != nil {
+			return nil, err
+		}
+
+		var o mo.ResourcePool
+		err = resourcePool.Properties(ctx, resourcePool.Reference(), []string{"config", "runtime", "summary"}, &o)
+		if err != nil {
+			return nil, err
+		}
+
+		rpStatus := vmprovider.ResourcePoolStatus{
+			Zone:          z.name,
+			CPU:           newResourcePoolAllocationStatus(o.Config.CpuAllocation, o.Runtime.Cpu),
+			Memory:        newResourcePoolAllocationStatus(o.Config.MemoryAllocation, o.Runtime.Memory),
+			OverallStatus: string(o.Runtime.OverallStatus),
+		}
+
+		// The runtime memory usage is in bytes, unlike the memory allocation.
+		rpStatus.Memory.ReservationUsed /= 1024 * 1024
+
+		if o.Summary != nil {
+			if quickStats := o.Summary.GetResourcePoolSummary().QuickStats; quickStats != nil {
+				rpStatus.CPU.Usage = quickStats.OverallCpuUsage
+				rpStatus.Memory.Usage = quickStats.HostMemoryUsage
+			}
+		}
+
+		status = append(status, rpStatus)
+	}
+
+	return status, nil
+}
+
+func newResourcePoolAllocationStatus(
+	allocation vimTypes.ResourceAllocationInfo,
+	usage vimTypes.ResourcePoolResourceUsage) vmprovider.ResourcePoolAllocationStatus {
+
+	status := vmprovider.ResourcePoolAllocationStatus{
+		Limit:           -1,
+		ReservationUsed: usage.ReservationUsed,
+	}
+	if allocation.Reservation != nil {
+		status.Reservation = *allocation.Reservation
+	}
+	if allocation.Limit != nil {
+		status.Limit = *allocation.Limit
+	}
+	if allocation.Shares != nil {
+		for level, vimLevel := range sharesLevels {
+			if vimLevel == allocation.Shares.Level {
+				status.SharesLevel = string(level)
+			}
+		}
+		status.Shares = allocation.Shares.Shares
+	}
+	return status
+}
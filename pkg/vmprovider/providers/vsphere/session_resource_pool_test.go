@@ -0,0 +1,190 @@
+// +build !integration
+
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+var _ = Describe("Resource pools", func() {
+	// run runs f with a session in the cluster of a vcsim VPX model.
+	run := func(f func(ctx context.Context, session *Session)) {
+		res := simulator.VPX().Run(func(ctx context.Context, c *vim25.Client) error {
+			finder := find.NewFinder(c)
+			dc, err := finder.DefaultDatacenter(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			finder.SetDatacenter(dc)
+
+			cluster, err := finder.DefaultClusterComputeResource(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			resourcePool, err := cluster.ResourcePool(ctx)
+			Expect(err).ToNot(HaveOccurred())
+
+			session := &Session{
+				Client:             &Client{vimClient: c},
+				Finder:             finder,
+				cluster:            cluster,
+				resourcePool:       resourcePool,
+				cpuMinMHzInCluster: 2000,
+			}
+
+			f(ctx, session)
+			return nil
+		})
+		Expect(res).To(Succeed())
+	}
+
+	getConfig := func(ctx context.Context, session *Session, name string) vimTypes.ResourceConfigSpec {
+		resourcePool, err := session.ChildResourcePool(ctx, name)
+		Expect(err).ToNot(HaveOccurred())
+		var o mo.ResourcePool
+		Expect(resourcePool.Properties(ctx, resourcePool.Reference(), []string{"config"}, &o)).To(Succeed())
+		return o.Config
+	}
+
+	It("updates the reservations, limits and shares of a nested resource pool", func() {
+		rpSpec := &vmopv1alpha1.ResourcePoolSpec{
+			Name: "tenant/web",
+			Reservations: vmopv1alpha1.VirtualMachineResourceSpec{
+				Cpu:    resource.MustParse("1"),
+				Memory: resource.MustParse("1Gi"),
+			},
+			Limits: vmopv1alpha1.VirtualMachineResourceSpec{
+				Memory: resource.MustParse("2Gi"),
+			},
+		}
+
+		run(func(ctx context.Context, session *Session) {
+			_, err := session.CreateResourcePool(ctx, rpSpec)
+			Expect(err).ToNot(HaveOccurred())
+			exists, err := session.DoesResourcePoolExist(ctx, "tenant")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exists).To(BeTrue())
+
+			cpuShares := vmprovider.Shares{Level: vmprovider.SharesLevelCustom, Shares: 8000}
+			memoryShares := vmprovider.Shares{Level: vmprovider.SharesLevelHigh}
+			Expect(session.UpdateResourcePool(ctx, rpSpec, vmprovider.ResourcePoolAllocation{}, cpuShares, memoryShares)).To(Succeed())
+
+			config := getConfig(ctx, session, rpSpec.Name)
+			Expect(*config.CpuAllocation.Reservation).To(Equal(int64(2000)))
+			Expect(*config.CpuAllocation.Limit).To(Equal(int64(-1)))
+			Expect(config.CpuAllocation.Shares.Level).To(Equal(vimTypes.SharesLevelCustom))
+			Expect(config.CpuAllocation.Shares.Shares).To(Equal(int32(8000)))
+			Expect(*config.MemoryAllocation.Reservation).To(Equal(int64(1024)))
+			Expect(*config.MemoryAllocation.Limit).To(Equal(int64(2048)))
+			Expect(config.MemoryAllocation.Shares.Level).To(Equal(vimTypes.SharesLevelHigh))
+
+			status, err := session.GetResourcePoolStatus(ctx, rpSpec.Name)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(status).To(HaveLen(1))
+			Expect(status[0].CPU.Reservation).To(Equal(int64(2000)))
+			Expect(status[0].CPU.SharesLevel).To(Equal(string(vmprovider.SharesLevelCustom)))
+			Expect(status[0].Memory.Limit).To(Equal(int64(2048)))
+			Expect(status[0].Memory.SharesLevel).To(Equal(string(vmprovider.SharesLevelHigh)))
+
+			By("leaving the reservations that are not specified as is", func() {
+				rpSpec.Reservations = vmopv1alpha1.VirtualMachineResourceSpec{}
+				Expect(session.UpdateResourcePool(ctx, rpSpec, vmprovider.ResourcePoolAllocation{}, vmprovider.Shares{}, vmprovider.Shares{})).To(Succeed())
+
+				config := getConfig(ctx, session, rpSpec.Name)
+				Expect(*config.CpuAllocation.Reservation).To(Equal(int64(2000)))
+				Expect(config.CpuAllocation.Shares.Level).To(Equal(vimTypes.SharesLevelCustom))
+				Expect(*config.MemoryAllocation.Reservation).To(Equal(int64(1024)))
+				Expect(*config.MemoryAllocation.Limit).To(Equal(int64(2048)))
+				Expect(config.MemoryAllocation.Shares.Level).To(Equal(vimTypes.SharesLevelHigh))
+			})
+
+			By("resetting the applied reservations and limits that are no longer specified", func() {
+				applied := vmprovider.ResourcePoolAllocation{
+					Reservations: vmopv1alpha1.VirtualMachineResourceSpec{
+						Cpu:    resource.MustParse("1"),
+						Memory: resource.MustParse("1Gi"),
+					},
+					Limits: vmopv1alpha1.VirtualMachineResourceSpec{
+						Memory: resource.MustParse("2Gi"),
+					},
+				}
+				rpSpec.Limits = vmopv1alpha1.VirtualMachineResourceSpec{}
+				Expect(session.UpdateResourcePool(ctx, rpSpec, applied, vmprovider.Shares{}, vmprovider.Shares{})).To(Succeed())
+
+				config := getConfig(ctx, session, rpSpec.Name)
+				Expect(*config.CpuAllocation.Reservation).To(BeZero())
+				Expect(*config.CpuAllocation.Limit).To(Equal(int64(-1)))
+				Expect(*config.MemoryAllocation.Reservation).To(BeZero())
+				Expect(*config.MemoryAllocation.Limit).To(Equal(int64(-1)))
+			})
+		})
+	})
+
+	It("leaves the CPU reservation and limit as is while the CPU frequency is unknown", func() {
+		rpSpec := &vmopv1alpha1.ResourcePoolSpec{
+			Name: "web",
+			Reservations: vmopv1alpha1.VirtualMachineResourceSpec{
+				Cpu:    resource.MustParse("1"),
+				Memory: resource.MustParse("1Gi"),
+			},
+		}
+
+		run(func(ctx context.Context, session *Session) {
+			session.SetCpuMinMHzInCluster(0)
+			_, err := session.CreateResourcePool(ctx, rpSpec)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.UpdateResourcePool(ctx, rpSpec, vmprovider.ResourcePoolAllocation{}, vmprovider.Shares{}, vmprovider.Shares{})).To(Succeed())
+
+			config := getConfig(ctx, session, rpSpec.Name)
+			Expect(*config.CpuAllocation.Reservation).To(BeZero())
+			Expect(*config.MemoryAllocation.Reservation).To(Equal(int64(1024)))
+		})
+	})
+
+	It("deletes the empty parent resource pools created for a nested resource pool", func() {
+		run(func(ctx context.Context, session *Session) {
+			_, createdParents, err := session.createResourcePool(ctx, &vmopv1alpha1.ResourcePoolSpec{Name: "tenant/team/web"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(createdParents).To(Equal(map[string][]string{
+				session.resourcePool.Reference().Value: {"tenant", "tenant/team"},
+			}))
+
+			// The parent created for another resource pool is not reported again.
+			_, otherCreatedParents, err := session.createResourcePool(ctx, &vmopv1alpha1.ResourcePoolSpec{Name: "tenant/db"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(otherCreatedParents).To(BeEmpty())
+
+			exists := func(name string) bool {
+				exists, err := session.DoesResourcePoolExist(ctx, name)
+				Expect(err).ToNot(HaveOccurred())
+				return exists
+			}
+
+			By("keeping the parent that has another resource pool", func() {
+				Expect(session.deleteResourcePool(ctx, "tenant/team/web", createdParents)).To(Succeed())
+				Expect(exists("tenant/team/web")).To(BeFalse())
+				Expect(exists("tenant/team")).To(BeFalse())
+				Expect(exists("tenant")).To(BeTrue())
+			})
+
+			By("deleting the parent once it is empty", func() {
+				Expect(session.DeleteResourcePool(ctx, "tenant/db")).To(Succeed())
+				Expect(session.deleteResourcePool(ctx, "tenant/team/web", createdParents)).To(Succeed())
+				Expect(exists("tenant")).To(BeFalse())
+			})
+		})
+	})
+})
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2018-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package vsphere
@@ -6,27 +6,76 @@ package vsphere
 import (
 	"context"
 	"math"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
 	vimTypes "github.com/vmware/govmomi/vim25/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	ctrlruntime "sigs.k8s.io/controller-runtime/pkg/client"
 
 	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg"
+	"github.com/vmware-tanzu/vm-operator/pkg/lib"
+	"github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
 )
 
 type VMContext struct {
 	context.Context
 	Logger logr.Logger
 	VM     *vmopv1alpha1.VirtualMachine
+	// Recorder records the events of the operation on the VM. It may be nil.
+	Recorder record.Recorder
+}
+
+const (
+	// guestShutdownReason, guestShutdownFailedReason and guestShutdownTimeoutReason are the reasons of
+	// the events of the TrySoft power-off mode.
+	guestShutdownReason        = "GuestShutdown"
+	guestShutdownFailedReason  = "GuestShutdownFailed"
+	guestShutdownTimeoutReason = "GuestShutdownTimeout"
+
+	// restartReason and restartFailedReason are the reasons of the events of a requested restart.
+	restartReason       = "Restart"
+	restartFailedReason = "RestartFailed"
+
+	// placedReason is the reason of the event with the zone of a VM and the placement recommended
+	// by DRS.
+	placedReason = "Placed"
+
+	// migratingReason and migratedReason are the reasons of the events of the migration of a VM.
+	migratingReason = "Migrating"
+	migratedReason  = "Migrated"
+)
+
+func (vmCtx VMContext) eventf(reason, message string, args ...interface{}) {
+	if vmCtx.Recorder != nil {
+		vmCtx.Recorder.Eventf(vmCtx.VM, reason, message, args...)
+	}
+}
+
+func (vmCtx VMContext) warnf(reason, message string, args ...interface{}) {
+	if vmCtx.Recorder != nil {
+		vmCtx.Recorder.Warnf(vmCtx.VM, reason, message, args...)
+	}
 }
 
 type VMCloneContext struct {
 	VMContext
+	Cluster             *object.ClusterComputeResource
 	ResourcePool        *object.ResourcePool
 	Folder              *object.Folder
 	StorageProvisioning string
+
+	// Datastores are the datastores that DRS may place the VM on.
+	Datastores []vimTypes.ManagedObjectReference
 }
 
 func memoryQuantityToMb(q resource.Quantity) int64 {
@@ -83,9 +132,21 @@ func (s *Session) DeleteVirtualMachine(vmCtx VMContext) error {
 	}
 
 	if moVM.Summary.Runtime.PowerState != vimTypes.VirtualMachinePowerStatePoweredOff {
-		if err := resVM.SetPowerState(vmCtx, vmopv1alpha1.VirtualMachinePoweredOff); err != nil {
+		poweredOff, err := s.powerOffVirtualMachine(vmCtx, resVM, s.getVirtualMachineClass(vmCtx))
+		if err != nil {
 			return err
 		}
+		if !poweredOff {
+			// The guest is shutting down: the VM is deleted once it is powered off, on a later
+			// reconcile, while the power-off deadline annotation keeps the finalizer in place.
+			return nil
+		}
+	}
+	vmprovider.ClearPowerOffDeadline(vmCtx.VM)
+
+	// Leave the VM groups before the VM is deleted so their DRS rules do not keep a single VM.
+	if err := s.updateVMGroupMembership(vmCtx, resVM, s.getVirtualMachineSetResourcePolicy(vmCtx), true); err != nil {
+		return err
 	}
 
 	if err := resVM.Delete(vmCtx); err != nil {
@@ -95,6 +156,233 @@ func (s *Session) DeleteVirtualMachine(vmCtx VMContext) error {
 	return nil
 }
 
+// RetainVirtualMachine removes the VM from its cluster module and VM groups, detaches its tag, and
+// replaces its annotation and managed by info so that the VM is left in vCenter without the markers
+// of VM Operator ownership.
+func (s *Session) RetainVirtualMachine(vmCtx VMContext) error {
+	resVM, err := s.GetVirtualMachine(vmCtx)
+	if err != nil {
+		return transformVmError(vmCtx.VM.NamespacedName(), err)
+	}
+
+	resourcePolicy := s.getVirtualMachineSetResourcePolicy(vmCtx)
+	if err := s.detachTagsAndModules(vmCtx, resVM, resourcePolicy); err != nil {
+		return err
+	}
+	if err := s.updateVMGroupMembership(vmCtx, resVM, resourcePolicy, true); err != nil {
+		return err
+	}
+
+	moVM, err := resVM.GetProperties(vmCtx, []string{"config.annotation", "config.managedBy", "config.extraConfig"})
+	if err != nil {
+		return err
+	}
+
+	configSpec := &vimTypes.VirtualMachineConfigSpec{}
+	if moVM.Config != nil && moVM.Config.Annotation == VCVMAnnotation {
+		// An empty annotation is omitted from the ConfigSpec so it cannot be cleared.
+		configSpec.Annotation = VCVMRetainedAnnotation
+	}
+	if moVM.Config != nil && moVM.Config.ManagedBy != nil {
+		// An empty ManagedByInfo unsets the managed by info.
+		configSpec.ManagedBy = &vimTypes.ManagedByInfo{}
+	}
+	if moVM.Config != nil {
+		for _, opt := range moVM.Config.ExtraConfig {
+			if optValue := opt.GetOptionValue(); optValue != nil && optValue.Key == ImportedVMUIDExtraConfigKey {
+				// An empty value removes the key.
+				configSpec.ExtraConfig = []vimTypes.BaseOptionValue{
+					&vimTypes.OptionValue{Key: ImportedVMUIDExtraConfigKey, Value: ExtraConfigUnset},
+				}
+			}
+		}
+	}
+
+	if configSpec.Annotation == "" && configSpec.ManagedBy == nil && len(configSpec.ExtraConfig) == 0 {
+		return nil
+	}
+	return resVM.Reconfigure(vmCtx, configSpec)
+}
+
+// detachTagsAndModules undoes attachTagsAndModules. The VM is only removed from its cluster module
+// if the ResourcePolicy still exists.
+func (s *Session) detachTagsAndModules(
+	vmCtx VMContext,
+	resVM *res.VirtualMachine,
+	resourcePolicy *vmopv1alpha1.VirtualMachineSetResourcePolicy) error {
+
+	clusterModuleName := vmCtx.VM.Annotations[pkg.ClusterModuleNameKey]
+	providerTagsName := vmCtx.VM.Annotations[pkg.ProviderTagsAnnotationKey]
+
+	if clusterModuleName == "" || providerTagsName == "" {
+		return nil
+	}
+
+	vmRef := resVM.MoRef()
+
+	if resourcePolicy != nil {
+		for _, clusterModule := range resourcePolicy.Status.ClusterModules {
+			if clusterModule.GroupName != clusterModuleName {
+				continue
+			}
+
+			isMember, err := s.IsVmMemberOfClusterModule(vmCtx, clusterModule.ModuleUuid, vmRef)
+			if err != nil {
+				return err
+			}
+			if isMember {
+				if err := s.RemoveVmFromClusterModule(vmCtx, clusterModule.ModuleUuid, vmRef); err != nil {
+					return err
+				}
+			}
+			break
+		}
+	}
+
+	tagName := s.tagInfo[providerTagsName]
+	tagCategoryName := s.tagInfo[ProviderTagCategoryNameKey]
+	return s.DetachTagFromVm(vmCtx, tagName, tagCategoryName, vmRef)
+}
+
+// detachPreviousResourcePolicy removes the VM from the cluster modules and VM groups of the
+// ResourcePolicy it is attached to, and detaches its tag, when spec.resourcePolicyName changed. The
+// modules and groups of a ResourcePolicy that no longer exists were deleted with it. The tag is
+// attached again by attachTagsAndModules if the new ResourcePolicy has the cluster module of the VM.
+func (s *Session) detachPreviousResourcePolicy(vmCtx VMContext, resVM *res.VirtualMachine) error {
+	name, ok := vmCtx.VM.Annotations[vmprovider.AttachedResourcePolicyAnnotationKey]
+	if !ok || name == vmCtx.VM.Spec.ResourcePolicyName {
+		return nil
+	}
+
+	var resourcePolicy *vmopv1alpha1.VirtualMachineSetResourcePolicy
+	if s.k8sClient != nil {
+		resourcePolicy = &vmopv1alpha1.VirtualMachineSetResourcePolicy{}
+		key := ctrlruntime.ObjectKey{Namespace: vmCtx.VM.Namespace, Name: name}
+		if err := s.k8sClient.Get(vmCtx, key, resourcePolicy); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			resourcePolicy = nil
+		}
+	}
+
+	vmRef := resVM.MoRef()
+
+	if resourcePolicy != nil {
+		for _, clusterModule := range resourcePolicy.Status.ClusterModules {
+			err := s.updateClusterModuleMembership(vmCtx, clusterModule.ModuleUuid, vmRef, false)
+			if err != nil && !lib.IsNotFoundError(err) {
+				return err
+			}
+		}
+
+		if err := s.updateVMGroupMembership(vmCtx, resVM, resourcePolicy, true); err != nil {
+			return err
+		}
+	}
+
+	if providerTagsName := vmCtx.VM.Annotations[pkg.ProviderTagsAnnotationKey]; providerTagsName != "" {
+		tagName := s.tagInfo[providerTagsName]
+		tagCategoryName := s.tagInfo[ProviderTagCategoryNameKey]
+		if err := s.DetachTagFromVm(vmCtx, tagName, tagCategoryName, vmRef); err != nil {
+			return err
+		}
+	}
+
+	vmCtx.Logger.Info("Detached VM from its previous ResourcePolicy", "resourcePolicy", name)
+	delete(vmCtx.VM.Annotations, vmprovider.AttachedResourcePolicyAnnotationKey)
+	return nil
+}
+
+// setAttachedResourcePolicy records the ResourcePolicy of the VM once the VM is attached to it.
+func setAttachedResourcePolicy(vm *vmopv1alpha1.VirtualMachine) {
+	if vm.Spec.ResourcePolicyName == "" {
+		delete(vm.Annotations, vmprovider.AttachedResourcePolicyAnnotationKey)
+		return
+	}
+
+	if vm.Annotations == nil {
+		vm.Annotations = map[string]string{}
+	}
+	vm.Annotations[vmprovider.AttachedResourcePolicyAnnotationKey] = vm.Spec.ResourcePolicyName
+}
+
+// getVirtualMachineSetResourcePolicy returns the ResourcePolicy of the VM, or nil if the VM does not
+// have one or it cannot be retrieved.
+func (s *Session) getVirtualMachineSetResourcePolicy(vmCtx VMContext) *vmopv1alpha1.VirtualMachineSetResourcePolicy {
+	if s.k8sClient == nil || vmCtx.VM.Spec.ResourcePolicyName == "" {
+		return nil
+	}
+
+	resourcePolicy := &vmopv1alpha1.VirtualMachineSetResourcePolicy{}
+	key := ctrlruntime.ObjectKey{Namespace: vmCtx.VM.Namespace, Name: vmCtx.VM.Spec.ResourcePolicyName}
+	if err := s.k8sClient.Get(vmCtx, key, resourcePolicy); err != nil {
+		vmCtx.Logger.V(4).Info("Failed to get VirtualMachineSetResourcePolicy", "name", vmCtx.VM.Spec.ResourcePolicyName, "error", err)
+		return nil
+	}
+	return resourcePolicy
+}
+
+// getVirtualMachineClass returns the class of the VM, or nil if it cannot be retrieved.
+func (s *Session) getVirtualMachineClass(vmCtx VMContext) *vmopv1alpha1.VirtualMachineClass {
+	if s.k8sClient == nil {
+		return nil
+	}
+
+	vmClass := &vmopv1alpha1.VirtualMachineClass{}
+	if err := s.k8sClient.Get(vmCtx, ctrlruntime.ObjectKey{Name: vmCtx.VM.Spec.ClassName}, vmClass); err != nil {
+		vmCtx.Logger.V(4).Info("Failed to get VirtualMachineClass", "name", vmCtx.VM.Spec.ClassName, "error", err)
+		return nil
+	}
+	return vmClass
+}
+
+// powerOffVirtualMachine powers off the VM according to its power-off mode, and returns true once
+// the VM is powered off. With the TrySoft mode, the guest is shut down first and the power-off
+// deadline is recorded on the VM: this returns false until the deadline, so that the caller
+// requeues rather than waiting for the guest, and the VM is hard powered off on the first call
+// after the deadline, or right away if the guest cannot be shut down.
+func (s *Session) powerOffVirtualMachine(vmCtx VMContext, resVM *res.VirtualMachine, vmClass *vmopv1alpha1.VirtualMachineClass) (bool, error) {
+	mode, err := vmprovider.GetPowerOffMode(vmCtx.VM, vmClass)
+	if err != nil {
+		vmCtx.Logger.Error(err, "Ignoring invalid power-off mode")
+		mode = vmprovider.PowerOffModeHard
+	}
+
+	if deadline, ok := vmprovider.GetPowerOffDeadline(vmCtx.VM); ok {
+		if time.Now().Before(deadline) {
+			vmCtx.Logger.V(4).Info("Waiting for the guest to shut down", "deadline", deadline)
+			return false, nil
+		}
+
+		vmCtx.Logger.Info("The VM did not power off after shutting down the guest, powering off the VM")
+		vmCtx.warnf(guestShutdownTimeoutReason, "The VM did not power off by %s after shutting down the guest, powering off the VM",
+			deadline.Format(time.RFC3339))
+	} else if mode == vmprovider.PowerOffModeTrySoft {
+		timeout, err := vmprovider.GetPowerOffTimeout(vmCtx.VM, vmClass)
+		if err != nil {
+			vmCtx.Logger.Error(err, "Ignoring invalid power-off timeout")
+			timeout = vmprovider.DefaultPowerOffTimeout
+		}
+
+		if err := resVM.ShutdownGuest(vmCtx); err != nil {
+			vmCtx.Logger.Info("Failed to shut down the guest, powering off the VM", "error", err.Error())
+			vmCtx.warnf(guestShutdownFailedReason, "Failed to shut down the guest, powering off the VM: %v", err)
+		} else {
+			vmCtx.Logger.Info("Shutting down the guest", "timeout", timeout)
+			vmCtx.eventf(guestShutdownReason, "Shutting down the guest, waiting up to %s for the VM to power off", timeout)
+			vmprovider.SetPowerOffDeadline(vmCtx.VM, time.Now().Add(timeout))
+			return false, nil
+		}
+	}
+
+	if err := resVM.SetPowerState(vmCtx, vmopv1alpha1.VirtualMachinePoweredOff); err != nil {
+		return false, err
+	}
+	vmprovider.ClearPowerOffDeadline(vmCtx.VM)
+	return true, nil
+}
+
 func (s *Session) GetVirtualMachineGuestHeartbeat(vmCtx VMContext) (vmopv1alpha1.GuestHeartbeatStatus, error) {
 	resVM, err := s.GetVirtualMachine(vmCtx)
 	if err != nil {
@@ -109,20 +397,154 @@ func (s *Session) GetVirtualMachineGuestHeartbeat(vmCtx VMContext) (vmopv1alpha1
 	return vmopv1alpha1.GuestHeartbeatStatus(moVM.GuestHeartbeatStatus), nil
 }
 
+// GetVirtualMachineGuestHeartbeats returns the guest heartbeat status of the VMs keyed by their
+// namespaced name. The VMs with a MoID are fetched in a single property collector call, and the
+// others are looked up one by one. Since the property collector call fails as a whole if any of
+// the VMs no longer exists, all the VMs are looked up one by one when it fails.
+func (s *Session) GetVirtualMachineGuestHeartbeats(ctx context.Context, vms []*vmopv1alpha1.VirtualMachine) map[string]vmopv1alpha1.GuestHeartbeatStatus {
+	heartbeats := make(map[string]vmopv1alpha1.GuestHeartbeatStatus, len(vms))
+
+	var refs []vimTypes.ManagedObjectReference
+	var remaining []*vmopv1alpha1.VirtualMachine
+	byMoID := map[string]*vmopv1alpha1.VirtualMachine{}
+	for _, vm := range vms {
+		if vm.Status.UniqueID == "" {
+			remaining = append(remaining, vm)
+			continue
+		}
+		refs = append(refs, vimTypes.ManagedObjectReference{Type: "VirtualMachine", Value: vm.Status.UniqueID})
+		byMoID[vm.Status.UniqueID] = vm
+	}
+
+	if len(refs) > 0 {
+		var moVMs []mo.VirtualMachine
+		pc := property.DefaultCollector(s.Client.VimClient())
+		if err := pc.Retrieve(ctx, refs, []string{"guestHeartbeatStatus"}, &moVMs); err != nil {
+			log.V(4).Info("Failed to retrieve the guest heartbeat of the VMs, falling back to one by one",
+				"count", len(refs), "error", err)
+			remaining = vms
+		} else {
+			for _, moVM := range moVMs {
+				if vm, ok := byMoID[moVM.Self.Value]; ok {
+					heartbeats[vm.NamespacedName()] = vmopv1alpha1.GuestHeartbeatStatus(moVM.GuestHeartbeatStatus)
+				}
+			}
+		}
+	}
+
+	for _, vm := range remaining {
+		vmCtx := VMContext{
+			Context: ctx,
+			Logger:  log.WithValues("vmName", vm.NamespacedName()),
+			VM:      vm,
+		}
+		heartbeat, err := s.GetVirtualMachineGuestHeartbeat(vmCtx)
+		if err != nil {
+			vmCtx.Logger.V(4).Info("Failed to get the guest heartbeat of the VM", "error", err)
+			continue
+		}
+		heartbeats[vm.NamespacedName()] = heartbeat
+	}
+
+	return heartbeats
+}
+
+func (s *Session) RunVirtualMachineGuestProgram(vmCtx VMContext, program vmprovider.GuestProgram) (int32, error) {
+	if len(program.Command) == 0 {
+		return 0, errors.Errorf("no command to run in VM %s", vmCtx.VM.NamespacedName())
+	}
+
+	resVM, err := s.GetVirtualMachine(vmCtx)
+	if err != nil {
+		return 0, transformVmError(vmCtx.VM.NamespacedName(), err)
+	}
+
+	auth := &vimTypes.NamePasswordAuthentication{
+		Username: program.Username,
+		Password: program.Password,
+	}
+	return resVM.RunGuestProgram(vmCtx, auth, program.Command[0], program.Command[1:]...)
+}
+
+func (s *Session) RestartVirtualMachine(vmCtx VMContext, restartType vmprovider.RestartType) error {
+	resVM, err := s.GetVirtualMachine(vmCtx)
+	if err != nil {
+		return transformVmError(vmCtx.VM.NamespacedName(), err)
+	}
+
+	return restartVirtualMachine(vmCtx, resVM, restartType)
+}
+
+func (s *Session) GetVirtualMachineVolumeDevices(vmCtx VMContext) (map[string]vmprovider.VolumeDevice, error) {
+	resVM, err := s.GetVirtualMachine(vmCtx)
+	if err != nil {
+		return nil, transformVmError(vmCtx.VM.NamespacedName(), err)
+	}
+
+	devices, err := resVM.GetVirtualDevices(vmCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return getVolumeDevices(vmCtx.VM, devices), nil
+}
+
+func restartVirtualMachine(vmCtx VMContext, resVM *res.VirtualMachine, restartType vmprovider.RestartType) error {
+	switch restartType {
+	case vmprovider.RestartTypeGuestReboot:
+		return resVM.RebootGuest(vmCtx)
+	case vmprovider.RestartTypeReset:
+		return resVM.Reset(vmCtx)
+	case vmprovider.RestartTypePowerCycle:
+		if err := resVM.SetPowerState(vmCtx, vmopv1alpha1.VirtualMachinePoweredOff); err != nil {
+			return err
+		}
+		return resVM.SetPowerState(vmCtx, vmopv1alpha1.VirtualMachinePoweredOn)
+	default:
+		return errors.Errorf("invalid restart type %s", restartType)
+	}
+}
+
+// updateVirtualDiskDeviceChanges returns the device changes that grow the disks of the vSphere
+// volumes to their capacity, and the boot disk to the boot disk capacity if it is not nil. The
+// capacity of the vSphere volume of the boot disk, if any, overrides the boot disk capacity. The
+// ephemeral disks are the disks created for the vSphere volumes without a device key.
 func updateVirtualDiskDeviceChanges(
 	vmCtx VMContext,
-	virtualDisks object.VirtualDeviceList) ([]vimTypes.BaseVirtualDeviceConfigSpec, error) {
+	virtualDisks object.VirtualDeviceList,
+	ephemeralDisks map[string]*vimTypes.VirtualDisk,
+	bootDiskCapacity *resource.Quantity) ([]vimTypes.BaseVirtualDeviceConfigSpec, error) {
 
-	// XXX (dramdass): Right now, we only resize disks that exist in the VM template. The disks
-	// are keyed by deviceKey and the desired new size must be larger than the original size.
-	// The number of disks is expected to be O(1) so we the nested loop is ok here.
 	var deviceChanges []vimTypes.BaseVirtualDeviceConfigSpec
+
+	if bootDisk := getBootDisk(virtualDisks); bootDiskCapacity != nil && bootDisk != nil {
+		hasVolume := false
+		for _, volume := range vmCtx.VM.Spec.Volumes {
+			if deviceKey, ok := getVsphereVolumeDeviceKey(volume, ephemeralDisks); ok && deviceKey == bootDisk.Key {
+				hasVolume = true
+				break
+			}
+		}
+
+		if !hasVolume && bootDisk.CapacityInBytes < bootDiskCapacity.Value() {
+			bootDisk.CapacityInBytes = bootDiskCapacity.Value()
+			deviceChanges = append(deviceChanges, &vimTypes.VirtualDeviceConfigSpec{
+				Operation: vimTypes.VirtualDeviceConfigSpecOperationEdit,
+				Device:    bootDisk,
+			})
+		}
+	}
+
+	// XXX (dramdass): Right now, we only resize disks that exist in the VM template or that were
+	// created for the vSphere volumes. The disks are keyed by deviceKey and the desired new size
+	// must be larger than the original size. The number of disks is expected to be O(1) so we the
+	// nested loop is ok here.
 	for _, volume := range vmCtx.VM.Spec.Volumes {
-		if volume.VsphereVolume == nil || volume.VsphereVolume.DeviceKey == nil {
+		deviceKey, ok := getVsphereVolumeDeviceKey(volume, ephemeralDisks)
+		if !ok {
 			continue
 		}
 
-		deviceKey := int32(*volume.VsphereVolume.DeviceKey)
 		found := false
 
 		for _, vmDevice := range virtualDisks {
@@ -133,8 +555,9 @@ func updateVirtualDiskDeviceChanges(
 
 			newCapacityInBytes := volume.VsphereVolume.Capacity.StorageEphemeral().Value()
 			if newCapacityInBytes < vmDisk.CapacityInBytes {
-				// TODO VMSVC-261: Could be nice if the validating webhook would check this, but we
-				// have a long ways before the provider can be used from there, if even a good idea.
+				// The validating webhook rejects shrinking a vSphere volume, but the capacity of
+				// the disk may be larger than the one of the volume spec, e.g. when it was grown in
+				// vSphere.
 				err := errors.Errorf("cannot shrink disk with device key %d from %d bytes to %d bytes",
 					deviceKey, vmDisk.CapacityInBytes, newCapacityInBytes)
 				return nil, err
@@ -24,7 +24,12 @@ import (
 	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
 )
 
-func (s *Session) deployOvf(vmCtx VMCloneContext, itemID string, storageProfileID string) (*res.VirtualMachine, error) {
+func (s *Session) deployOvf(
+	vmCtx VMCloneContext,
+	itemID string,
+	storageProfileID string,
+	placement *placementRecommendation) (*res.VirtualMachine, error) {
+
 	deploymentSpec := vcenter.DeploymentSpec{
 		Name:                vmCtx.VM.Name,
 		StorageProvisioning: vmCtx.StorageProvisioning,
@@ -46,6 +51,12 @@ func (s *Session) deployOvf(vmCtx VMCloneContext, itemID string, storageProfileI
 		},
 	}
 
+	// Deploy the VM where DRS recommended. The datastore is compatible with the storage profile.
+	if placement != nil {
+		deploy.Target.HostID = placement.RelocateSpec.Host.Value
+		deploy.DeploymentSpec.DefaultDatastoreID = placement.RelocateSpec.Datastore.Value
+	}
+
 	vmCtx.Logger.Info("Deploying Library Item", "itemID", itemID, "deploy", deploy)
 	deployedVM, err := vcenter.NewManager(s.Client.RestClient()).DeployLibraryItem(vmCtx, itemID, deploy)
 	if err != nil {
@@ -153,15 +164,21 @@ func deployVMFromCLPreCheck(
 func (s *Session) deployVMFromCL(vmCtx VMCloneContext, vmConfigArgs vmprovider.VmConfigArgs, item *library.Item) (*res.VirtualMachine, error) {
 	vmCtx.Logger.Info("Performing preChecks before deploying library item", "itemName", item.Name, "itemType", item.Type)
 
-	if err := deployVMFromCLPreCheck(vmCtx, vmConfigArgs, s.cluster, s.Client.vimClient); err != nil {
+	if err := deployVMFromCLPreCheck(vmCtx, vmConfigArgs, vmCtx.Cluster, s.Client.vimClient); err != nil {
 		return nil, errors.Wrapf(err, "deploy VM preCheck failed for image %q", vmCtx.VM.Spec.ImageName)
 	}
 
+	placement, err := s.recommendCreatePlacement(vmCtx, vmConfigArgs)
+	if err != nil {
+		return nil, errors.Wrapf(markPlacementFailed(vmCtx.VMContext, err), "failed to place VM for image %q", vmCtx.VM.Spec.ImageName)
+	}
+	markPlaced(vmCtx.VMContext, placement)
+
 	vmCtx.Logger.Info("Deploying Content Library item", "itemName", item.Name,
 		"itemType", item.Type, "imageName", vmCtx.VM.Spec.ImageName,
 		"resourcePolicyName", vmCtx.VM.Spec.ResourcePolicyName, "storageProfileID", vmConfigArgs.StorageProfileID)
 
-	deployedVm, err := s.deployOvf(vmCtx, item.ID, vmConfigArgs.StorageProfileID)
+	deployedVm, err := s.deployOvf(vmCtx, item.ID, vmConfigArgs.StorageProfileID, placement)
 	if err != nil {
 		return nil, errors.Wrapf(err, "deploy from content library failed for image %q", vmCtx.VM.Spec.ImageName)
 	}
@@ -236,7 +253,12 @@ func (s *Session) CloneVirtualMachine(
 		}
 	}
 
-	resourcePool, folder, err := s.getResourcePoolAndFolder(vmCtx, vmConfigArgs.ResourcePolicy)
+	z, err := s.placeVM(vmCtx, vmConfigArgs.ResourcePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	resourcePool, folder, err := s.getResourcePoolAndFolder(vmCtx, z, vmConfigArgs.ResourcePolicy)
 	if err != nil {
 		return nil, err
 	}
@@ -248,11 +270,17 @@ func (s *Session) CloneVirtualMachine(
 
 	vmCloneCtx := VMCloneContext{
 		VMContext:           vmCtx,
+		Cluster:             z.cluster,
 		ResourcePool:        resourcePool,
 		Folder:              folder,
 		StorageProvisioning: storageProvisioning,
 	}
 
+	vmCloneCtx.Datastores, err = s.getCandidateDatastores(vmCloneCtx, vmConfigArgs.StorageProfileID)
+	if err != nil {
+		return nil, markPlacementFailed(vmCtx, err)
+	}
+
 	// The ContentLibraryUUID can be empty when we want to clone from inventory VMs. This is
 	// not a supported workflow but we have tests that use this.
 	if vmConfigArgs.ContentLibraryUUID != "" {
@@ -412,7 +440,12 @@ func (s *Session) createCloneSpec(
 	virtualDisks := virtualDevices.SelectByType((*vimTypes.VirtualDisk)(nil))
 	virtualNICs := virtualDevices.SelectByType((*vimTypes.VirtualEthernetCard)(nil))
 
-	diskDeviceChanges, err := updateVirtualDiskDeviceChanges(vmCtx.VMContext, virtualDisks)
+	bootDiskCapacity, err := vmprovider.GetBootDiskCapacity(vmCtx.VM, &vmConfigArgs.VmClass)
+	if err != nil {
+		return nil, err
+	}
+
+	diskDeviceChanges, err := updateVirtualDiskDeviceChanges(vmCtx.VMContext, virtualDisks, nil, bootDiskCapacity)
 	if err != nil {
 		return nil, err
 	}
@@ -442,12 +475,13 @@ func (s *Session) createCloneSpec(
 	cloneSpec.Location.Pool = vimTypes.NewReference(vmCtx.ResourcePool.Reference())
 	cloneSpec.Location.Folder = vimTypes.NewReference(vmCtx.Folder.Reference())
 
-	relocateSpec, err := cloneVMRelocateSpec(vmCtx, s.cluster, sourceVM.MoRef(), cloneSpec)
+	placement, err := cloneVMRelocateSpec(vmCtx, vmCtx.Cluster, sourceVM.MoRef(), cloneSpec, vmCtx.Datastores)
 	if err != nil {
-		return nil, err
+		return nil, markPlacementFailed(vmCtx.VMContext, err)
 	}
-	cloneSpec.Location.Host = relocateSpec.Host
-	cloneSpec.Location.Datastore = relocateSpec.Datastore
+	markPlaced(vmCtx.VMContext, placement)
+	cloneSpec.Location.Host = placement.RelocateSpec.Host
+	cloneSpec.Location.Datastore = placement.RelocateSpec.Datastore
 
 	diskLocators, err := cloneVMDiskLocators(vmCtx, virtualDisks, cloneSpec.Location.Datastore, cloneSpec.Location.Profile)
 	if err != nil {
@@ -0,0 +1,309 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+// getBootDisk returns the boot disk of the VM: its first disk that is not a first class disk, or
+// nil if it has none.
+func getBootDisk(devices object.VirtualDeviceList) *vimTypes.VirtualDisk {
+	for _, device := range devices.SelectByType((*vimTypes.VirtualDisk)(nil)) {
+		if disk := device.(*vimTypes.VirtualDisk); disk.VDiskId == nil {
+			return disk
+		}
+	}
+	return nil
+}
+
+// ephemeralDisk is the location of the disk created for a vSphere volume without a device key. The
+// controller and unit number are chosen when the disk is created, unlike its device key which vSphere
+// assigns, so the disks are recorded in the same reconfigure that creates them.
+type ephemeralDisk struct {
+	ControllerKey int32 `json:"controllerKey"`
+	UnitNumber    int32 `json:"unitNumber"`
+}
+
+// getEphemeralDisks returns the disks of the VM created for its vSphere volumes without a device
+// key, by volume name, as recorded in the EphemeralDisksExtraConfigKey of the VM. The disks that
+// were removed from the VM are omitted, as are the first class disks and the disks without a flat
+// VMDK backing attached at a recorded location since, like the disks of the PersistentVolumeClaim
+// volumes, they were not created for a vSphere volume.
+func getEphemeralDisks(config *vimTypes.VirtualMachineConfigInfo) map[string]*vimTypes.VirtualDisk {
+	disks := map[string]*vimTypes.VirtualDisk{}
+	if config == nil {
+		return disks
+	}
+
+	var locations map[string]ephemeralDisk
+	for _, opt := range config.ExtraConfig {
+		if optValue := opt.GetOptionValue(); optValue != nil && optValue.Key == EphemeralDisksExtraConfigKey {
+			if value, ok := optValue.Value.(string); ok {
+				_ = json.Unmarshal([]byte(value), &locations)
+			}
+		}
+	}
+
+	devices := object.VirtualDeviceList(config.Hardware.Device)
+	for name, location := range locations {
+		for _, device := range devices.SelectByType((*vimTypes.VirtualDisk)(nil)) {
+			disk := device.(*vimTypes.VirtualDisk)
+			if disk.ControllerKey != location.ControllerKey || disk.UnitNumber == nil || *disk.UnitNumber != location.UnitNumber {
+				continue
+			}
+			if _, ok := disk.Backing.(*vimTypes.VirtualDiskFlatVer2BackingInfo); ok && disk.VDiskId == nil {
+				disks[name] = disk
+			}
+			break
+		}
+	}
+	return disks
+}
+
+// getVsphereVolumeDeviceKey returns the device key of the disk of the vSphere volume: the device
+// key of its spec, or else the device key of the disk created for it. It returns false if the disk
+// of the volume has not been created yet.
+func getVsphereVolumeDeviceKey(volume v1alpha1.VirtualMachineVolume, ephemeralDisks map[string]*vimTypes.VirtualDisk) (int32, bool) {
+	if volume.VsphereVolume == nil {
+		return 0, false
+	}
+	if volume.VsphereVolume.DeviceKey != nil {
+		return int32(*volume.VsphereVolume.DeviceKey), true
+	}
+	if disk, ok := ephemeralDisks[volume.Name]; ok {
+		return disk.Key, true
+	}
+	return 0, false
+}
+
+// ephemeralDiskConfigSpec adds to the config spec the device changes that create the disks of the
+// vSphere volumes without a device key, with the storage profile and provisioning of the VM, and
+// that delete the disks of the vSphere volumes removed from the VM. The disks are recorded in the
+// EphemeralDisksExtraConfigKey of the VM by the same reconfigure.
+func (s *Session) ephemeralDiskConfigSpec(
+	vmCtx VMContext,
+	config *vimTypes.VirtualMachineConfigInfo,
+	storageProfileID string,
+	configSpec *vimTypes.VirtualMachineConfigSpec) error {
+
+	existingDisks := getEphemeralDisks(config)
+
+	locations := make(map[string]ephemeralDisk, len(existingDisks))
+	var volumes []v1alpha1.VirtualMachineVolume
+	for _, volume := range vmCtx.VM.Spec.Volumes {
+		if volume.VsphereVolume == nil || volume.VsphereVolume.DeviceKey != nil {
+			continue
+		}
+		if disk, ok := existingDisks[volume.Name]; ok {
+			locations[volume.Name] = ephemeralDisk{ControllerKey: disk.ControllerKey, UnitNumber: *disk.UnitNumber}
+			delete(existingDisks, volume.Name)
+			continue
+		}
+		volumes = append(volumes, volume)
+	}
+
+	// The disks left are the ones of the volumes removed from the VM. The disk of a volume in the
+	// status of the VM is not an ephemeral disk, so it is only removed from the record.
+	volumeDisks := getVolumeDisks(vmCtx.VM)
+	var deviceChanges []vimTypes.BaseVirtualDeviceConfigSpec
+	forgotten := false
+	for name, disk := range existingDisks {
+		if backing := disk.Backing.(*vimTypes.VirtualDiskFlatVer2BackingInfo); volumeDisks[normalizeDiskUUID(backing.Uuid)] {
+			vmCtx.Logger.Info("Not deleting the disk of a removed vSphere volume that is the disk of a volume",
+				"volume", name, "deviceKey", disk.Key, "fileName", backing.FileName)
+			forgotten = true
+			continue
+		}
+		vmCtx.Logger.Info("Deleting the disk of a removed vSphere volume", "volume", name, "deviceKey", disk.Key)
+		deviceChanges = append(deviceChanges, &vimTypes.VirtualDeviceConfigSpec{
+			Operation:     vimTypes.VirtualDeviceConfigSpecOperationRemove,
+			FileOperation: vimTypes.VirtualDeviceConfigSpecFileOperationDestroy,
+			Device:        disk,
+		})
+	}
+
+	if len(volumes) > 0 {
+		storageProvisioning, err := s.getStorageProvisioning(vmCtx, storageProfileID)
+		if err != nil {
+			return err
+		}
+
+		createChanges, disks, err := ephemeralDiskDeviceChanges(volumes, object.VirtualDeviceList(config.Hardware.Device),
+			storageProfileID, storageProvisioning)
+		if err != nil {
+			return err
+		}
+		deviceChanges = append(deviceChanges, createChanges...)
+		for name, disk := range disks {
+			locations[name] = ephemeralDisk{ControllerKey: disk.ControllerKey, UnitNumber: *disk.UnitNumber}
+		}
+	}
+
+	if len(deviceChanges) == 0 && !forgotten {
+		return nil
+	}
+
+	value := ExtraConfigUnset
+	if len(locations) > 0 {
+		data, err := json.Marshal(locations)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	}
+	configSpec.DeviceChange = append(configSpec.DeviceChange, deviceChanges...)
+	configSpec.ExtraConfig = append(configSpec.ExtraConfig, &vimTypes.OptionValue{Key: EphemeralDisksExtraConfigKey, Value: value})
+
+	return nil
+}
+
+// ephemeralDiskDeviceChanges returns the device changes that create the disks of the vSphere
+// volumes, with the storage profile and provisioning of the VM, and the disks by volume name. Each
+// disk is attached to the first SCSI controller of the VM with a free unit number.
+func ephemeralDiskDeviceChanges(
+	volumes []v1alpha1.VirtualMachineVolume,
+	devices object.VirtualDeviceList,
+	storageProfileID string,
+	storageProvisioning string) ([]vimTypes.BaseVirtualDeviceConfigSpec, map[string]*vimTypes.VirtualDisk, error) {
+
+	var profile []vimTypes.BaseVirtualMachineProfileSpec
+	if storageProfileID != "" {
+		profile = []vimTypes.BaseVirtualMachineProfileSpec{
+			&vimTypes.VirtualMachineDefinedProfileSpec{ProfileId: storageProfileID},
+		}
+	}
+
+	deviceChanges := make([]vimTypes.BaseVirtualDeviceConfigSpec, 0, len(volumes))
+	disks := make(map[string]*vimTypes.VirtualDisk, len(volumes))
+	for _, volume := range volumes {
+		controller, disk := createDiskOnFreeSCSIUnit(devices)
+		if disk == nil {
+			return nil, nil, errors.Errorf("cannot attach the disk of volume %s: no SCSI controller with a free unit number",
+				volume.Name)
+		}
+		disk.Key = devices.NewKey()
+		disk.CapacityInBytes = volume.VsphereVolume.Capacity.StorageEphemeral().Value()
+
+		backing := disk.Backing.(*vimTypes.VirtualDiskFlatVer2BackingInfo)
+		backing.Datastore = nil
+		switch storageProvisioning {
+		case string(vimTypes.OvfCreateImportSpecParamsDiskProvisioningTypeThick):
+			backing.ThinProvisioned = vimTypes.NewBool(false)
+		case string(vimTypes.OvfCreateImportSpecParamsDiskProvisioningTypeEagerZeroedThick):
+			backing.ThinProvisioned = vimTypes.NewBool(false)
+			backing.EagerlyScrub = vimTypes.NewBool(true)
+		}
+
+		// Account for the disk so that the next disks get another unit number, or another controller
+		// once this one is full.
+		controller.Device = append(controller.Device, disk.Key)
+		devices = append(devices, disk)
+
+		deviceChanges = append(deviceChanges, &vimTypes.VirtualDeviceConfigSpec{
+			Operation:     vimTypes.VirtualDeviceConfigSpecOperationAdd,
+			FileOperation: vimTypes.VirtualDeviceConfigSpecFileOperationCreate,
+			Device:        disk,
+			Profile:       profile,
+		})
+		disks[volume.Name] = disk
+	}
+
+	return deviceChanges, disks, nil
+}
+
+// createDiskOnFreeSCSIUnit returns a new disk on the first SCSI controller of the devices with a
+// free unit number, and the controller, or nil if all the SCSI controllers are full.
+func createDiskOnFreeSCSIUnit(devices object.VirtualDeviceList) (*vimTypes.VirtualController, *vimTypes.VirtualDisk) {
+	for _, device := range devices {
+		if _, ok := device.(vimTypes.BaseVirtualSCSIController); !ok {
+			continue
+		}
+
+		controller := device.(vimTypes.BaseVirtualController)
+		disk := devices.CreateDisk(controller, vimTypes.ManagedObjectReference{}, "")
+		if *disk.UnitNumber >= 0 && *disk.UnitNumber < 16 {
+			return controller.GetVirtualController(), disk
+		}
+	}
+	return nil, nil
+}
+
+// normalizeDiskUUID returns the disk UUID in the lower case format without separators of the disk
+// UUID of the volume status.
+func normalizeDiskUUID(uuid string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(uuid))
+}
+
+// getVolumeDisks returns the normalized disk UUIDs of the volumes in the status of the VM.
+func getVolumeDisks(vm *v1alpha1.VirtualMachine) map[string]bool {
+	disks := make(map[string]bool, len(vm.Status.Volumes))
+	for _, volume := range vm.Status.Volumes {
+		if volume.DiskUuid != "" {
+			disks[normalizeDiskUUID(volume.DiskUuid)] = true
+		}
+	}
+	return disks
+}
+
+// getVolumeDevices returns the controller and unit number of the disks of the attached
+// PersistentVolumeClaim volumes of the VM, by volume name. The disks are found by the disk UUID of
+// the volume status.
+func getVolumeDevices(vm *v1alpha1.VirtualMachine, devices object.VirtualDeviceList) map[string]vmprovider.VolumeDevice {
+	disks := make(map[string]*vimTypes.VirtualDisk)
+	for _, device := range devices.SelectByType((*vimTypes.VirtualDisk)(nil)) {
+		disk := device.(*vimTypes.VirtualDisk)
+		if backing, ok := disk.Backing.(*vimTypes.VirtualDiskFlatVer2BackingInfo); ok && backing.Uuid != "" {
+			disks[normalizeDiskUUID(backing.Uuid)] = disk
+		}
+	}
+
+	volumeDevices := make(map[string]vmprovider.VolumeDevice)
+	for _, volume := range vm.Status.Volumes {
+		if !volume.Attached || volume.DiskUuid == "" {
+			continue
+		}
+		disk, ok := disks[normalizeDiskUUID(volume.DiskUuid)]
+		if !ok || disk.UnitNumber == nil {
+			continue
+		}
+		controller, ok := devices.FindByKey(disk.ControllerKey).(vimTypes.BaseVirtualController)
+		if !ok {
+			continue
+		}
+
+		volumeDevices[volume.Name] = vmprovider.VolumeDevice{
+			ControllerType:      controllerType(controller),
+			ControllerBusNumber: controller.GetVirtualController().BusNumber,
+			UnitNumber:          *disk.UnitNumber,
+		}
+	}
+
+	return volumeDevices
+}
+
+// controllerType returns the type of the disk controller, such as SCSI.
+func controllerType(controller vimTypes.BaseVirtualController) string {
+	switch controller.(type) {
+	case vimTypes.BaseVirtualSCSIController:
+		return "SCSI"
+	case vimTypes.BaseVirtualSATAController:
+		return "SATA"
+	case *vimTypes.VirtualNVMEController:
+		return "NVME"
+	case *vimTypes.VirtualIDEController:
+		return "IDE"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,328 @@
+//go:build !integration
+// +build !integration
+
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
+)
+
+var _ = Describe("Disks", func() {
+	var vm *vmopv1alpha1.VirtualMachine
+
+	vsphereVolume := func(name, capacity string, deviceKey *int) vmopv1alpha1.VirtualMachineVolume {
+		return vmopv1alpha1.VirtualMachineVolume{
+			Name: name,
+			VsphereVolume: &vmopv1alpha1.VsphereVolumeSource{
+				Capacity:  corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse(capacity)},
+				DeviceKey: deviceKey,
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		vm = &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-vm",
+				Namespace: "dummy-ns",
+			},
+		}
+	})
+
+	Context("updateVirtualDiskDeviceChanges", func() {
+		var disks object.VirtualDeviceList
+
+		BeforeEach(func() {
+			disks = object.VirtualDeviceList{
+				&vimTypes.VirtualDisk{VirtualDevice: vimTypes.VirtualDevice{Key: 2000}, CapacityInBytes: 10 * 1024 * 1024 * 1024},
+				&vimTypes.VirtualDisk{VirtualDevice: vimTypes.VirtualDevice{Key: 2001}, CapacityInBytes: 1024 * 1024 * 1024},
+			}
+		})
+
+		It("grows the boot disk to the boot disk capacity", func() {
+			capacity := resource.MustParse("40Gi")
+			deviceChanges, err := updateVirtualDiskDeviceChanges(VMContext{VM: vm}, disks, nil, &capacity)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deviceChanges).To(HaveLen(1))
+			disk := deviceChanges[0].GetVirtualDeviceConfigSpec().Device.(*vimTypes.VirtualDisk)
+			Expect(disk.Key).To(Equal(int32(2000)))
+			Expect(disk.CapacityInBytes).To(Equal(capacity.Value()))
+		})
+
+		It("does not shrink the boot disk", func() {
+			capacity := resource.MustParse("5Gi")
+			deviceChanges, err := updateVirtualDiskDeviceChanges(VMContext{VM: vm}, disks, nil, &capacity)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deviceChanges).To(BeEmpty())
+		})
+
+		It("uses the capacity of the vSphere volume of the boot disk", func() {
+			deviceKey := 2000
+			vm.Spec.Volumes = []vmopv1alpha1.VirtualMachineVolume{vsphereVolume("boot", "20Gi", &deviceKey)}
+
+			capacity := resource.MustParse("40Gi")
+			deviceChanges, err := updateVirtualDiskDeviceChanges(VMContext{VM: vm}, disks, nil, &capacity)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deviceChanges).To(HaveLen(1))
+			disk := deviceChanges[0].GetVirtualDeviceConfigSpec().Device.(*vimTypes.VirtualDisk)
+			Expect(disk.CapacityInBytes).To(Equal(int64(20 * 1024 * 1024 * 1024)))
+		})
+
+		It("grows the disk created for an ephemeral vSphere volume", func() {
+			vm.Spec.Volumes = []vmopv1alpha1.VirtualMachineVolume{vsphereVolume("data", "2Gi", nil)}
+			ephemeralDisks := map[string]*vimTypes.VirtualDisk{"data": disks[1].(*vimTypes.VirtualDisk)}
+
+			deviceChanges, err := updateVirtualDiskDeviceChanges(VMContext{VM: vm}, disks, ephemeralDisks, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deviceChanges).To(HaveLen(1))
+			disk := deviceChanges[0].GetVirtualDeviceConfigSpec().Device.(*vimTypes.VirtualDisk)
+			Expect(disk.Key).To(Equal(int32(2001)))
+		})
+	})
+
+	It("returns the controller and unit number of the disks of the attached volumes", func() {
+		unitNumber := int32(3)
+		devices := object.VirtualDeviceList{
+			&vimTypes.ParaVirtualSCSIController{VirtualSCSIController: vimTypes.VirtualSCSIController{
+				VirtualController: vimTypes.VirtualController{VirtualDevice: vimTypes.VirtualDevice{Key: 1001}, BusNumber: 1},
+			}},
+			&vimTypes.VirtualDisk{
+				VirtualDevice: vimTypes.VirtualDevice{
+					Key:           2003,
+					ControllerKey: 1001,
+					UnitNumber:    &unitNumber,
+					Backing: &vimTypes.VirtualDiskFlatVer2BackingInfo{
+						Uuid: "6000C298-595b-f457-5739-e9105b2c0c2d",
+					},
+				},
+			},
+		}
+		vm.Status.Volumes = []vmopv1alpha1.VirtualMachineVolumeStatus{
+			{Name: "data", Attached: true, DiskUuid: "6000c298595bf4575739e9105b2c0c2d"},
+			{Name: "logs", Attached: false},
+		}
+
+		Expect(getVolumeDevices(vm, devices)).To(Equal(map[string]vmprovider.VolumeDevice{
+			"data": {ControllerType: "SCSI", ControllerBusNumber: 1, UnitNumber: 3},
+		}))
+
+		vm.Status.Volumes = nil
+		Expect(getVolumeDevices(vm, devices)).To(BeEmpty())
+	})
+
+	It("creates the disks of the ephemeral vSphere volumes with the storage profile", func() {
+		vm.Spec.Volumes = []vmopv1alpha1.VirtualMachineVolume{
+			vsphereVolume("data", "2Gi", nil),
+			vsphereVolume("logs", "1Gi", nil),
+		}
+		devices := object.VirtualDeviceList{
+			&vimTypes.ParaVirtualSCSIController{VirtualSCSIController: vimTypes.VirtualSCSIController{
+				VirtualController: vimTypes.VirtualController{VirtualDevice: vimTypes.VirtualDevice{Key: 1000}},
+				ScsiCtlrUnitNumber: 7,
+			}},
+		}
+
+		deviceChanges, disks, err := ephemeralDiskDeviceChanges(vm.Spec.Volumes, devices, "profile-id",
+			string(vimTypes.OvfCreateImportSpecParamsDiskProvisioningTypeThick))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deviceChanges).To(HaveLen(2))
+		Expect(*disks["data"].UnitNumber).ToNot(Equal(*disks["logs"].UnitNumber))
+		Expect(deviceChanges[0].GetVirtualDeviceConfigSpec().Profile).To(HaveLen(1))
+		backing := disks["data"].Backing.(*vimTypes.VirtualDiskFlatVer2BackingInfo)
+		Expect(*backing.ThinProvisioned).To(BeFalse())
+	})
+
+	It("attaches the disks of the ephemeral vSphere volumes to another SCSI controller once one is full", func() {
+		vm.Spec.Volumes = []vmopv1alpha1.VirtualMachineVolume{vsphereVolume("data", "2Gi", nil)}
+		devices := object.VirtualDeviceList{
+			&vimTypes.ParaVirtualSCSIController{VirtualSCSIController: vimTypes.VirtualSCSIController{
+				VirtualController: vimTypes.VirtualController{VirtualDevice: vimTypes.VirtualDevice{Key: 1000}},
+				ScsiCtlrUnitNumber: 7,
+			}},
+			&vimTypes.ParaVirtualSCSIController{VirtualSCSIController: vimTypes.VirtualSCSIController{
+				VirtualController: vimTypes.VirtualController{VirtualDevice: vimTypes.VirtualDevice{Key: 1001}, BusNumber: 1},
+				ScsiCtlrUnitNumber: 7,
+			}},
+		}
+		for unitNumber := int32(0); unitNumber < 16; unitNumber++ {
+			if unitNumber == 7 {
+				continue
+			}
+			devices = append(devices, &vimTypes.VirtualDisk{VirtualDevice: vimTypes.VirtualDevice{
+				Key:           2000 + unitNumber,
+				ControllerKey: 1000,
+				UnitNumber:    vimTypes.NewInt32(unitNumber),
+			}})
+		}
+
+		_, disks, err := ephemeralDiskDeviceChanges(vm.Spec.Volumes, devices, "", "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(disks["data"].ControllerKey).To(Equal(int32(1001)))
+		Expect(*disks["data"].UnitNumber).To(Equal(int32(0)))
+	})
+
+	It("creates and deletes the disks of the ephemeral vSphere volumes", func() {
+		vm.Spec.Volumes = []vmopv1alpha1.VirtualMachineVolume{
+			vsphereVolume("data", "2Gi", nil),
+			vsphereVolume("logs", "1Gi", nil),
+		}
+
+		res := simulator.VPX().Run(func(ctx context.Context, c *vim25.Client) error {
+			vmObj, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+			Expect(err).ToNot(HaveOccurred())
+			resVM, err := res.NewVMFromObject(vmObj)
+			Expect(err).ToNot(HaveOccurred())
+			vmCtx := VMContext{
+				Context: ctx,
+				Logger:  ctrl.Log.WithName("test"),
+				VM:      vm,
+			}
+			session := &Session{}
+
+			getConfig := func() *vimTypes.VirtualMachineConfigInfo {
+				var moVM mo.VirtualMachine
+				Expect(vmObj.Properties(ctx, vmObj.Reference(), []string{"config"}, &moVM)).To(Succeed())
+				return moVM.Config
+			}
+			reconfigure := func() {
+				configSpec := &vimTypes.VirtualMachineConfigSpec{}
+				Expect(session.ephemeralDiskConfigSpec(vmCtx, getConfig(), "", configSpec)).To(Succeed())
+				if len(configSpec.DeviceChange) > 0 {
+					Expect(resVM.Reconfigure(ctx, configSpec)).To(Succeed())
+				}
+			}
+
+			config := getConfig()
+			numDisks := len(object.VirtualDeviceList(config.Hardware.Device).SelectByType((*vimTypes.VirtualDisk)(nil)))
+			Expect(getEphemeralDisks(config)).To(BeEmpty())
+
+			By("creating the disks of the volumes", func() {
+				reconfigure()
+				config = getConfig()
+				Expect(object.VirtualDeviceList(config.Hardware.Device).SelectByType((*vimTypes.VirtualDisk)(nil))).To(HaveLen(numDisks + 2))
+
+				ephemeralDisks := getEphemeralDisks(config)
+				Expect(ephemeralDisks).To(HaveLen(2))
+				deviceKey, ok := getVsphereVolumeDeviceKey(vm.Spec.Volumes[0], ephemeralDisks)
+				Expect(ok).To(BeTrue())
+				disk, ok := object.VirtualDeviceList(config.Hardware.Device).FindByKey(deviceKey).(*vimTypes.VirtualDisk)
+				Expect(ok).To(BeTrue())
+				Expect(disk.CapacityInBytes).To(Equal(int64(2 * 1024 * 1024 * 1024)))
+			})
+
+			By("not creating the disks again", func() {
+				configSpec := &vimTypes.VirtualMachineConfigSpec{}
+				Expect(session.ephemeralDiskConfigSpec(vmCtx, getConfig(), "", configSpec)).To(Succeed())
+				Expect(configSpec.DeviceChange).To(BeEmpty())
+			})
+
+			By("deleting the disk of a removed volume", func() {
+				vm.Spec.Volumes = vm.Spec.Volumes[:1]
+				reconfigure()
+				config = getConfig()
+				Expect(object.VirtualDeviceList(config.Hardware.Device).SelectByType((*vimTypes.VirtualDisk)(nil))).To(HaveLen(numDisks + 1))
+				Expect(getEphemeralDisks(config)).To(HaveKey("data"))
+				Expect(getEphemeralDisks(config)).ToNot(HaveKey("logs"))
+			})
+			return nil
+		})
+		Expect(res).To(Succeed())
+	})
+
+	It("does not delete the disks at the location of an ephemeral disk that were not created for a vSphere volume", func() {
+		config := &vimTypes.VirtualMachineConfigInfo{
+			ExtraConfig: []vimTypes.BaseOptionValue{&vimTypes.OptionValue{
+				Key:   EphemeralDisksExtraConfigKey,
+				Value: `{"fcd": {"controllerKey": 1000, "unitNumber": 1}, "pvc": {"controllerKey": 1000, "unitNumber": 2}}`,
+			}},
+			Hardware: vimTypes.VirtualHardware{Device: []vimTypes.BaseVirtualDevice{
+				&vimTypes.VirtualDisk{
+					VirtualDevice: vimTypes.VirtualDevice{
+						Key:           2001,
+						ControllerKey: 1000,
+						UnitNumber:    vimTypes.NewInt32(1),
+						Backing:       &vimTypes.VirtualDiskFlatVer2BackingInfo{Uuid: "6000C291-0000-0000-0000-000000000001"},
+					},
+					VDiskId: &vimTypes.ID{Id: "fcd-id"},
+				},
+				&vimTypes.VirtualDisk{
+					VirtualDevice: vimTypes.VirtualDevice{
+						Key:           2002,
+						ControllerKey: 1000,
+						UnitNumber:    vimTypes.NewInt32(2),
+						Backing:       &vimTypes.VirtualDiskFlatVer2BackingInfo{Uuid: "6000C291-0000-0000-0000-000000000002"},
+					},
+				},
+			}},
+		}
+
+		ephemeralDisks := getEphemeralDisks(config)
+		Expect(ephemeralDisks).ToNot(HaveKey("fcd"))
+		Expect(ephemeralDisks).To(HaveKey("pvc"))
+
+		vm.Status.Volumes = []vmopv1alpha1.VirtualMachineVolumeStatus{
+			{Name: "pvc", Attached: true, DiskUuid: "6000c291000000000000000000000002"},
+		}
+		vmCtx := VMContext{Context: context.Background(), Logger: ctrl.Log.WithName("test"), VM: vm}
+		configSpec := &vimTypes.VirtualMachineConfigSpec{}
+		Expect((&Session{}).ephemeralDiskConfigSpec(vmCtx, config, "", configSpec)).To(Succeed())
+		Expect(configSpec.DeviceChange).To(BeEmpty())
+		Expect(configSpec.ExtraConfig).To(ConsistOf(&vimTypes.OptionValue{Key: EphemeralDisksExtraConfigKey, Value: ExtraConfigUnset}))
+	})
+
+	It("hot-extends the disk of a grown vSphere volume of a powered on VM", func() {
+		res := simulator.VPX().Run(func(ctx context.Context, c *vim25.Client) error {
+			vmObj, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+			Expect(err).ToNot(HaveOccurred())
+			resVM, err := res.NewVMFromObject(vmObj)
+			Expect(err).ToNot(HaveOccurred())
+			vmCtx := VMContext{
+				Context: ctx,
+				Logger:  ctrl.Log.WithName("test"),
+				VM:      vm,
+			}
+
+			devices, err := resVM.GetVirtualDevices(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			disk := getBootDisk(devices)
+			Expect(disk).ToNot(BeNil())
+			deviceKey := int(disk.Key)
+			capacity := resource.NewQuantity(disk.CapacityInBytes+1024*1024*1024, resource.BinarySI)
+			vm.Spec.Volumes = []vmopv1alpha1.VirtualMachineVolume{vsphereVolume("boot", capacity.String(), &deviceKey)}
+
+			var moVM mo.VirtualMachine
+			Expect(vmObj.Properties(ctx, vmObj.Reference(), []string{"config"}, &moVM)).To(Succeed())
+			Expect((&Session{}).poweredOnVMReconfigure(vmCtx, resVM, moVM.Config, "")).To(Succeed())
+
+			devices, err = resVM.GetVirtualDevices(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			disk, ok := devices.FindByKey(int32(deviceKey)).(*vimTypes.VirtualDisk)
+			Expect(ok).To(BeTrue())
+			Expect(disk.CapacityInBytes).To(Equal(capacity.Value()))
+			return nil
+		})
+		Expect(res).To(Succeed())
+	})
+})
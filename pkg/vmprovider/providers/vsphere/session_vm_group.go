@@ -0,0 +1,552 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	k8serrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrlruntime "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/lib"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
+)
+
+// vmGroupNamePrefix returns the prefix of the names of the DRS rules and cluster groups of the VM
+// groups of the resource policy. The namespace and name of the resource policy cannot contain a
+// slash, so the prefix is unique in the cluster.
+func vmGroupNamePrefix(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) string {
+	return fmt.Sprintf("%s/%s/", resourcePolicy.Namespace, resourcePolicy.Name)
+}
+
+// vmGroupRuleName returns the name of the DRS rule of a VM group.
+func vmGroupRuleName(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy, groupName string) string {
+	return vmGroupNamePrefix(resourcePolicy) + groupName
+}
+
+// setVMGroupNames sets the names of the DRS rule and cluster groups of a VM group in its status.
+// The names are derived from the resource policy and the name of the group rather than read from
+// the status annotation, so that VM Operator only changes the DRS rules and cluster groups it owns.
+func setVMGroupNames(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy, groupStatus *vmprovider.VMGroupStatus) {
+	groupStatus.RuleName, groupStatus.VMGroupName, groupStatus.HostGroupName = "", "", ""
+
+	switch groupStatus.Backing {
+	case vmprovider.VMGroupBackingDRSRule:
+		groupStatus.RuleName = vmGroupRuleName(resourcePolicy, groupStatus.Name)
+	case vmprovider.VMGroupBackingDRSHostRule:
+		groupStatus.RuleName = vmGroupRuleName(resourcePolicy, groupStatus.Name)
+		groupStatus.VMGroupName = groupStatus.RuleName + "/vms"
+		groupStatus.HostGroupName = groupStatus.RuleName + "/hosts"
+	}
+}
+
+// checkVMGroupName returns an error if the DRS rule or cluster group with the name is not one of
+// the VM groups of the resource policy.
+func checkVMGroupName(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy, name string) error {
+	if !strings.HasPrefix(name, vmGroupNamePrefix(resourcePolicy)) {
+		return fmt.Errorf("%s is not a DRS rule or cluster group of the resource policy %s/%s",
+			name, resourcePolicy.Namespace, resourcePolicy.Name)
+	}
+	return nil
+}
+
+// reconcileVMGroups creates the cluster modules and DRS VM-Host rules of the VM groups of the
+// resource policy, updates the existing DRS VM-VM rules of the groups, and deletes the cluster
+// modules and DRS rules of the groups that were removed from the resource policy. The DRS VM-VM
+// rules are created when the VMs join the groups.
+func (s *Session) reconcileVMGroups(
+	ctx context.Context,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) error {
+
+	groups, err := vmprovider.GetVMGroups(resourcePolicy)
+	if err != nil {
+		return err
+	}
+
+	oldStatus := vmprovider.GetVMGroupsStatus(resourcePolicy)
+	if len(groups) == 0 && len(oldStatus) == 0 {
+		return nil
+	}
+	if s.cluster == nil {
+		return errors.New("VM groups require the session to have a cluster")
+	}
+
+	declared := make(map[string]vmprovider.VMGroupSpec, len(groups))
+	for _, group := range groups {
+		declared[group.Name] = group
+	}
+
+	var (
+		status []vmprovider.VMGroupStatus
+		errs   []error
+	)
+
+	current := make(map[string]vmprovider.VMGroupStatus, len(oldStatus))
+	for _, groupStatus := range oldStatus {
+		setVMGroupNames(resourcePolicy, &groupStatus)
+		if group, ok := declared[groupStatus.Name]; ok && group.Backing == groupStatus.Backing {
+			current[groupStatus.Name] = groupStatus
+			continue
+		}
+
+		if err := s.deleteVMGroup(ctx, resourcePolicy, groupStatus); err != nil {
+			errs = append(errs, err)
+			status = append(status, groupStatus)
+		}
+	}
+
+	for _, group := range groups {
+		groupStatus, ok := current[group.Name]
+		if !ok {
+			groupStatus = vmprovider.VMGroupStatus{Name: group.Name, Backing: group.Backing}
+			setVMGroupNames(resourcePolicy, &groupStatus)
+		}
+
+		switch group.Backing {
+		case vmprovider.VMGroupBackingClusterModule:
+			exists, err := s.DoesClusterModuleExist(ctx, groupStatus.ModuleUuid)
+			if err == nil && !exists {
+				groupStatus.ModuleUuid, err = s.CreateClusterModule(ctx)
+			}
+			if err != nil {
+				errs = append(errs, err)
+				if groupStatus.ModuleUuid == "" {
+					continue
+				}
+			}
+		case vmprovider.VMGroupBackingDRSRule:
+			if err := s.updateVMGroupRuleSettings(ctx, group, groupStatus.RuleName); err != nil {
+				errs = append(errs, err)
+			}
+		case vmprovider.VMGroupBackingDRSHostRule:
+			if err := s.reconcileVMHostGroup(ctx, group, &groupStatus); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		status = append(status, groupStatus)
+	}
+
+	vmprovider.SetVMGroupsStatus(resourcePolicy, status)
+	return k8serrors.NewAggregate(errs)
+}
+
+// deleteVMGroups deletes the cluster modules and DRS rules of all the VM groups of the resource
+// policy.
+func (s *Session) deleteVMGroups(
+	ctx context.Context,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) error {
+
+	var (
+		status []vmprovider.VMGroupStatus
+		errs   []error
+	)
+
+	for _, groupStatus := range vmprovider.GetVMGroupsStatus(resourcePolicy) {
+		setVMGroupNames(resourcePolicy, &groupStatus)
+		if err := s.deleteVMGroup(ctx, resourcePolicy, groupStatus); err != nil {
+			errs = append(errs, err)
+			status = append(status, groupStatus)
+		}
+	}
+
+	vmprovider.SetVMGroupsStatus(resourcePolicy, status)
+	return k8serrors.NewAggregate(errs)
+}
+
+// deleteVMGroup deletes the cluster module or the DRS rule of a VM group. It refuses to delete a
+// DRS rule or cluster group that does not belong to the resource policy.
+func (s *Session) deleteVMGroup(
+	ctx context.Context,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy,
+	groupStatus vmprovider.VMGroupStatus) error {
+
+	switch groupStatus.Backing {
+	case vmprovider.VMGroupBackingClusterModule:
+		if groupStatus.ModuleUuid == "" {
+			return nil
+		}
+		// If the clusterModule has already been deleted, we can ignore the error and proceed.
+		if err := s.DeleteClusterModule(ctx, groupStatus.ModuleUuid); err != nil && !lib.IsNotFoundError(err) {
+			return err
+		}
+	case vmprovider.VMGroupBackingDRSRule:
+		if err := checkVMGroupName(resourcePolicy, groupStatus.RuleName); err != nil {
+			return err
+		}
+
+		s.clusterRulesMutex.Lock()
+		defer s.clusterRulesMutex.Unlock()
+
+		rule, err := s.getClusterRule(ctx, groupStatus.RuleName)
+		if err != nil || rule == nil {
+			return err
+		}
+		return s.reconfigureClusterRules(ctx, removeClusterRuleSpec(rule))
+	case vmprovider.VMGroupBackingDRSHostRule:
+		return s.deleteVMHostRule(ctx, resourcePolicy, groupStatus)
+	}
+
+	return nil
+}
+
+// updateVMGroupMembership adds the VM to the cluster modules, DRS rules and cluster VM groups of the
+// VM groups of its resource policy that it is a member of, and removes it from the other ones. The
+// VM leaves all the groups when leave is true. The VM groups are in the session's cluster, so a VM
+// in the cluster of another zone does not join them.
+func (s *Session) updateVMGroupMembership(
+	vmCtx VMContext,
+	resVM *res.VirtualMachine,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy,
+	leave bool) error {
+
+	if resourcePolicy == nil {
+		return nil
+	}
+
+	groupsStatus := vmprovider.GetVMGroupsStatus(resourcePolicy)
+	if len(groupsStatus) == 0 || s.cluster == nil {
+		return nil
+	}
+
+	groups, err := vmprovider.GetVMGroups(resourcePolicy)
+	if err != nil {
+		return err
+	}
+	declared := make(map[string]vmprovider.VMGroupSpec, len(groups))
+	for _, group := range groups {
+		declared[group.Name] = group
+	}
+
+	inCluster := s.isInSessionCluster(vmprovider.GetZone(vmCtx.VM))
+	vmRef := resVM.MoRef()
+
+	var errs []error
+	for _, groupStatus := range groupsStatus {
+		setVMGroupNames(resourcePolicy, &groupStatus)
+		group, ok := declared[groupStatus.Name]
+		join := ok && !leave && inCluster && vmprovider.IsVMGroupMember(vmCtx.VM, groupStatus.Name)
+
+		switch groupStatus.Backing {
+		case vmprovider.VMGroupBackingClusterModule:
+			if err := s.updateClusterModuleMembership(vmCtx, groupStatus.ModuleUuid, vmRef, join); err != nil {
+				errs = append(errs, err)
+			}
+		case vmprovider.VMGroupBackingDRSRule:
+			// The DRS rule of a group that was removed from the resource policy is deleted with the group.
+			if !ok {
+				continue
+			}
+			members, err := s.vmGroupRuleMembers(vmCtx, vmRef, resourcePolicy, group.Name, join)
+			if err == nil {
+				err = s.updateVMGroupRule(vmCtx, group, groupStatus.RuleName, members)
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case vmprovider.VMGroupBackingDRSHostRule:
+			if groupStatus.VMGroupName == "" {
+				continue
+			}
+			if err := s.updateClusterVMGroupMembership(vmCtx, groupStatus.VMGroupName, vmRef, join); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return k8serrors.NewAggregate(errs)
+}
+
+// updateClusterModuleMembership adds the VM to the cluster module when join is true, or removes
+// it otherwise.
+func (s *Session) updateClusterModuleMembership(
+	ctx context.Context,
+	moduleUuid string,
+	vmRef mo.Reference,
+	join bool) error {
+
+	isMember, err := s.IsVmMemberOfClusterModule(ctx, moduleUuid, vmRef)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case join && !isMember:
+		return s.AddVmToClusterModule(ctx, moduleUuid, vmRef)
+	case !join && isMember:
+		return s.RemoveVmFromClusterModule(ctx, moduleUuid, vmRef)
+	}
+	return nil
+}
+
+// isInSessionCluster returns true if the VMs of the zone are in the session's cluster. The VMs
+// without a zone are.
+func (s *Session) isInSessionCluster(zoneName string) bool {
+	if zoneName == "" {
+		return true
+	}
+	z, ok := s.zones[zoneName]
+	if !ok {
+		return false
+	}
+	return z.cluster == nil || s.cluster == nil || z.cluster.Reference() == s.cluster.Reference()
+}
+
+// vmGroupRuleMembers returns the VMs of the DRS rule of a VM group, sorted by MoID: the VMs of the
+// resource policy in the session's cluster that are members of the group and not being deleted.
+// The VM of vmCtx is a member only if join is true.
+func (s *Session) vmGroupRuleMembers(
+	vmCtx VMContext,
+	vmRef mo.Reference,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy,
+	groupName string,
+	join bool) ([]vimTypes.ManagedObjectReference, error) {
+
+	var members []vimTypes.ManagedObjectReference
+	if join {
+		members = append(members, vmRef.Reference())
+	}
+	if s.k8sClient == nil {
+		return members, nil
+	}
+
+	vmList := &v1alpha1.VirtualMachineList{}
+	if err := s.k8sClient.List(vmCtx, vmList, ctrlruntime.InNamespace(vmCtx.VM.Namespace)); err != nil {
+		return nil, err
+	}
+
+	for i := range vmList.Items {
+		vm := &vmList.Items[i]
+		if vm.Name == vmCtx.VM.Name || vm.Spec.ResourcePolicyName != resourcePolicy.Name ||
+			vm.Status.UniqueID == "" || !vm.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if !vmprovider.IsVMGroupMember(vm, groupName) || !s.isInSessionCluster(vmprovider.GetZone(vm)) {
+			continue
+		}
+		members = append(members, vimTypes.ManagedObjectReference{Type: "VirtualMachine", Value: vm.Status.UniqueID})
+	}
+
+	sortReferences(members)
+	return members, nil
+}
+
+// updateVMGroupRule creates, updates or removes the DRS rule of a VM group so that it has the given
+// VMs. A DRS VM-VM rule needs at least two VMs, so the rule is removed when there are fewer.
+func (s *Session) updateVMGroupRule(
+	ctx context.Context,
+	group vmprovider.VMGroupSpec,
+	ruleName string,
+	vms []vimTypes.ManagedObjectReference) error {
+
+	s.clusterRulesMutex.Lock()
+	defer s.clusterRulesMutex.Unlock()
+
+	rule, err := s.getClusterRule(ctx, ruleName)
+	if err != nil {
+		return err
+	}
+
+	if len(vms) < 2 {
+		if rule == nil {
+			return nil
+		}
+		log.Info("Removing DRS rule of VM group", "rule", ruleName)
+		return s.reconfigureClusterRules(ctx, removeClusterRuleSpec(rule))
+	}
+
+	info := newVMGroupRuleInfo(group, ruleName, vms)
+	if rule == nil {
+		log.Info("Creating DRS rule of VM group", "rule", ruleName, "vms", vms)
+		return s.reconfigureClusterRules(ctx, vimTypes.ClusterRuleSpec{
+			ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{Operation: vimTypes.ArrayUpdateOperationAdd},
+			Info:            info,
+		})
+	}
+
+	if isVMGroupRuleUpToDate(rule, group, vms) {
+		return nil
+	}
+
+	log.Info("Updating DRS rule of VM group", "rule", ruleName, "vms", vms)
+	return s.replaceClusterRule(ctx, rule, info)
+}
+
+// updateVMGroupRuleSettings updates the policy and mandatory setting of the existing DRS rule of
+// a VM group, keeping its VMs.
+func (s *Session) updateVMGroupRuleSettings(
+	ctx context.Context,
+	group vmprovider.VMGroupSpec,
+	ruleName string) error {
+
+	s.clusterRulesMutex.Lock()
+	defer s.clusterRulesMutex.Unlock()
+
+	rule, err := s.getClusterRule(ctx, ruleName)
+	if err != nil || rule == nil {
+		return err
+	}
+
+	vms := clusterRuleVMs(rule)
+	if isVMGroupRuleUpToDate(rule, group, vms) {
+		return nil
+	}
+
+	log.Info("Updating DRS rule of VM group", "rule", ruleName, "policy", group.Policy, "mandatory", group.Mandatory)
+	return s.replaceClusterRule(ctx, rule, newVMGroupRuleInfo(group, ruleName, vms))
+}
+
+// replaceClusterRule replaces an existing DRS rule. The rule is edited in place unless its type
+// changes, which requires removing and adding it.
+func (s *Session) replaceClusterRule(
+	ctx context.Context,
+	rule vimTypes.BaseClusterRuleInfo,
+	info vimTypes.BaseClusterRuleInfo) error {
+
+	if fmt.Sprintf("%T", rule) != fmt.Sprintf("%T", info) {
+		return s.reconfigureClusterRules(ctx,
+			removeClusterRuleSpec(rule),
+			vimTypes.ClusterRuleSpec{
+				ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{Operation: vimTypes.ArrayUpdateOperationAdd},
+				Info:            info,
+			})
+	}
+
+	info.GetClusterRuleInfo().Key = rule.GetClusterRuleInfo().Key
+	return s.reconfigureClusterRules(ctx, vimTypes.ClusterRuleSpec{
+		ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{Operation: vimTypes.ArrayUpdateOperationEdit},
+		Info:            info,
+	})
+}
+
+// getClusterRule returns the DRS rule of the session's cluster with the given name, or nil if
+// there is none.
+func (s *Session) getClusterRule(ctx context.Context, name string) (vimTypes.BaseClusterRuleInfo, error) {
+	config, err := s.cluster.Configuration(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return findClusterRule(config, name), nil
+}
+
+// findClusterRule returns the DRS rule with the given name, or nil if there is none.
+func findClusterRule(config *vimTypes.ClusterConfigInfoEx, name string) vimTypes.BaseClusterRuleInfo {
+	for _, rule := range config.Rule {
+		if rule.GetClusterRuleInfo().Name == name {
+			return rule
+		}
+	}
+	return nil
+}
+
+// reconfigureClusterRules applies the DRS rule changes to the session's cluster.
+func (s *Session) reconfigureClusterRules(ctx context.Context, specs ...vimTypes.ClusterRuleSpec) error {
+	return s.reconfigureCluster(ctx, &vimTypes.ClusterConfigSpecEx{RulesSpec: specs})
+}
+
+// reconfigureCluster applies the DRS rule and cluster group changes of the spec to the session's
+// cluster.
+func (s *Session) reconfigureCluster(ctx context.Context, spec *vimTypes.ClusterConfigSpecEx) error {
+	task, err := s.cluster.Reconfigure(ctx, spec, true)
+	if err != nil {
+		return err
+	}
+
+	if taskResult, err := task.WaitForResult(ctx, nil); err != nil {
+		msg := ""
+		if taskResult != nil && taskResult.Error != nil {
+			msg = taskResult.Error.LocalizedMessage
+		}
+		log.Error(err, "Error in reconfiguring cluster", "clusterMoID", s.cluster.Reference().Value, "msg", msg)
+		return err
+	}
+
+	return nil
+}
+
+func removeClusterRuleSpec(rule vimTypes.BaseClusterRuleInfo) vimTypes.ClusterRuleSpec {
+	return vimTypes.ClusterRuleSpec{
+		ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{
+			Operation: vimTypes.ArrayUpdateOperationRemove,
+			RemoveKey: rule.GetClusterRuleInfo().Key,
+		},
+	}
+}
+
+func newVMGroupRuleInfo(
+	group vmprovider.VMGroupSpec,
+	ruleName string,
+	vms []vimTypes.ManagedObjectReference) vimTypes.BaseClusterRuleInfo {
+
+	enabled, mandatory := true, group.Mandatory
+	info := vimTypes.ClusterRuleInfo{
+		Name:      ruleName,
+		Enabled:   &enabled,
+		Mandatory: &mandatory,
+	}
+
+	if group.Policy == vmprovider.VMGroupPolicyAffinity {
+		return &vimTypes.ClusterAffinityRuleSpec{ClusterRuleInfo: info, Vm: vms}
+	}
+	return &vimTypes.ClusterAntiAffinityRuleSpec{ClusterRuleInfo: info, Vm: vms}
+}
+
+// clusterRuleVMs returns the VMs of a VM-VM DRS rule, sorted by MoID.
+func clusterRuleVMs(rule vimTypes.BaseClusterRuleInfo) []vimTypes.ManagedObjectReference {
+	var vms []vimTypes.ManagedObjectReference
+	switch r := rule.(type) {
+	case *vimTypes.ClusterAffinityRuleSpec:
+		vms = append(vms, r.Vm...)
+	case *vimTypes.ClusterAntiAffinityRuleSpec:
+		vms = append(vms, r.Vm...)
+	}
+
+	sortReferences(vms)
+	return vms
+}
+
+// isVMGroupRuleUpToDate returns true if the DRS rule has the policy, mandatory setting and VMs of
+// the VM group.
+func isVMGroupRuleUpToDate(
+	rule vimTypes.BaseClusterRuleInfo,
+	group vmprovider.VMGroupSpec,
+	vms []vimTypes.ManagedObjectReference) bool {
+
+	switch rule.(type) {
+	case *vimTypes.ClusterAffinityRuleSpec:
+		if group.Policy != vmprovider.VMGroupPolicyAffinity {
+			return false
+		}
+	case *vimTypes.ClusterAntiAffinityRuleSpec:
+		if group.Policy != vmprovider.VMGroupPolicyAntiAffinity {
+			return false
+		}
+	default:
+		return false
+	}
+
+	info := rule.GetClusterRuleInfo()
+	if info.Mandatory == nil || *info.Mandatory != group.Mandatory {
+		return false
+	}
+
+	current := clusterRuleVMs(rule)
+	if len(current) != len(vms) {
+		return false
+	}
+	for i := range vms {
+		if current[i].Value != vms[i].Value {
+			return false
+		}
+	}
+	return true
+}
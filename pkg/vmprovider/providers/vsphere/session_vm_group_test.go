@@ -0,0 +1,293 @@
+// +build !integration
+
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
+)
+
+var _ = Describe("VM groups", func() {
+	const (
+		namespace  = "dummy-ns"
+		policyName = "dummy-policy"
+		ruleName   = namespace + "/" + policyName + "/web"
+	)
+
+	var (
+		resourcePolicy *vmopv1alpha1.VirtualMachineSetResourcePolicy
+	)
+
+	newVM := func(name, moID, groups string) *vmopv1alpha1.VirtualMachine {
+		return &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: map[string]string{vmprovider.VMGroupMembershipAnnotationKey: groups},
+			},
+			Spec: vmopv1alpha1.VirtualMachineSpec{
+				ResourcePolicyName: policyName,
+			},
+			Status: vmopv1alpha1.VirtualMachineStatus{
+				UniqueID: moID,
+			},
+		}
+	}
+
+	// run runs f with a session in the cluster of a vcsim VPX model, the MoIDs of two of its VMs and
+	// a function that returns the DRS rule of the web group.
+	run := func(f func(ctx context.Context, session *Session, vmRefs []vimTypes.ManagedObjectReference, getRule func() vimTypes.BaseClusterRuleInfo)) {
+		res := simulator.VPX().Run(func(ctx context.Context, c *vim25.Client) error {
+			finder := find.NewFinder(c)
+			dc, err := finder.DefaultDatacenter(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			finder.SetDatacenter(dc)
+
+			cluster, err := finder.DefaultClusterComputeResource(ctx)
+			Expect(err).ToNot(HaveOccurred())
+
+			vms, err := finder.VirtualMachineList(ctx, "DC0_C0_RP0_VM*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(vms)).To(BeNumerically(">=", 2))
+
+			scheme := runtime.NewScheme()
+			Expect(vmopv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+			session := &Session{
+				k8sClient: clientfake.NewFakeClientWithScheme(scheme,
+					newVM("vm-0", vms[0].Reference().Value, "web"),
+					newVM("vm-1", vms[1].Reference().Value, "web")),
+				cluster: cluster,
+			}
+
+			getRule := func() vimTypes.BaseClusterRuleInfo {
+				rule, err := session.getClusterRule(ctx, ruleName)
+				Expect(err).ToNot(HaveOccurred())
+				return rule
+			}
+
+			f(ctx, session, []vimTypes.ManagedObjectReference{vms[0].Reference(), vms[1].Reference()}, getRule)
+			return nil
+		})
+		Expect(res).To(Succeed())
+	}
+
+	vmContext := func(ctx context.Context, vm *vmopv1alpha1.VirtualMachine) VMContext {
+		return VMContext{
+			Context: ctx,
+			Logger:  ctrl.Log.WithName("test"),
+			VM:      vm,
+		}
+	}
+
+	BeforeEach(func() {
+		resourcePolicy = &vmopv1alpha1.VirtualMachineSetResourcePolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      policyName,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					vmprovider.VMGroupsAnnotationKey: `[{"name": "web", "policy": "Affinity"}]`,
+				},
+			},
+		}
+	})
+
+	It("maintains the DRS rule of the members of a group", func() {
+		run(func(ctx context.Context, session *Session, vmRefs []vimTypes.ManagedObjectReference, getRule func() vimTypes.BaseClusterRuleInfo) {
+			Expect(session.reconcileVMGroups(ctx, resourcePolicy)).To(Succeed())
+			Expect(vmprovider.GetVMGroupsStatus(resourcePolicy)).To(Equal([]vmprovider.VMGroupStatus{
+				{Name: "web", Backing: vmprovider.VMGroupBackingDRSRule, RuleName: ruleName},
+			}))
+			Expect(getRule()).To(BeNil())
+
+			resVM, err := res.NewVMFromObject(object.NewVirtualMachine(session.cluster.Client(), vmRefs[0]))
+			Expect(err).ToNot(HaveOccurred())
+			vm := newVM("vm-0", vmRefs[0].Value, "web")
+
+			By("creating the rule when the group has two VMs", func() {
+				Expect(session.updateVMGroupMembership(vmContext(ctx, vm), resVM, resourcePolicy, false)).To(Succeed())
+				rule, ok := getRule().(*vimTypes.ClusterAffinityRuleSpec)
+				Expect(ok).To(BeTrue())
+				Expect(rule.Vm).To(ConsistOf(vmRefs[0], vmRefs[1]))
+				Expect(*rule.Mandatory).To(BeFalse())
+			})
+
+			By("removing the rule when a VM leaves the group", func() {
+				vm.Annotations[vmprovider.VMGroupMembershipAnnotationKey] = ""
+				Expect(session.updateVMGroupMembership(vmContext(ctx, vm), resVM, resourcePolicy, false)).To(Succeed())
+				Expect(getRule()).To(BeNil())
+			})
+
+			By("recreating the rule when the VM joins the group again", func() {
+				vm.Annotations[vmprovider.VMGroupMembershipAnnotationKey] = "web"
+				Expect(session.updateVMGroupMembership(vmContext(ctx, vm), resVM, resourcePolicy, false)).To(Succeed())
+				Expect(getRule()).ToNot(BeNil())
+			})
+
+			By("updating the rule when the group changes", func() {
+				resourcePolicy.Annotations[vmprovider.VMGroupsAnnotationKey] = `[{"name": "web", "policy": "AntiAffinity", "backing": "DRSRule", "mandatory": true}]`
+				Expect(session.reconcileVMGroups(ctx, resourcePolicy)).To(Succeed())
+				rule, ok := getRule().(*vimTypes.ClusterAntiAffinityRuleSpec)
+				Expect(ok).To(BeTrue())
+				Expect(rule.Vm).To(ConsistOf(vmRefs[0], vmRefs[1]))
+				Expect(*rule.Mandatory).To(BeTrue())
+			})
+
+			By("removing the rule when the VM is deleted", func() {
+				Expect(session.updateVMGroupMembership(vmContext(ctx, vm), resVM, resourcePolicy, true)).To(Succeed())
+				Expect(getRule()).To(BeNil())
+			})
+		})
+	})
+
+	It("removes the VM from the DRS rule of its previous resource policy", func() {
+		run(func(ctx context.Context, session *Session, vmRefs []vimTypes.ManagedObjectReference, getRule func() vimTypes.BaseClusterRuleInfo) {
+			Expect(session.reconcileVMGroups(ctx, resourcePolicy)).To(Succeed())
+			Expect(session.k8sClient.Create(ctx, resourcePolicy)).To(Succeed())
+
+			resVM, err := res.NewVMFromObject(object.NewVirtualMachine(session.cluster.Client(), vmRefs[0]))
+			Expect(err).ToNot(HaveOccurred())
+			vm := newVM("vm-0", vmRefs[0].Value, "web")
+			Expect(session.updateVMGroupMembership(vmContext(ctx, vm), resVM, resourcePolicy, false)).To(Succeed())
+			setAttachedResourcePolicy(vm)
+			Expect(vm.Annotations).To(HaveKeyWithValue(vmprovider.AttachedResourcePolicyAnnotationKey, policyName))
+			Expect(getRule()).ToNot(BeNil())
+
+			By("keeping the VM in the rule while its resource policy is the same", func() {
+				Expect(session.detachPreviousResourcePolicy(vmContext(ctx, vm), resVM)).To(Succeed())
+				Expect(getRule()).ToNot(BeNil())
+			})
+
+			By("removing the VM from the rule when its resource policy changes", func() {
+				vm.Spec.ResourcePolicyName = "other-policy"
+				Expect(session.detachPreviousResourcePolicy(vmContext(ctx, vm), resVM)).To(Succeed())
+				Expect(getRule()).To(BeNil())
+				Expect(vm.Annotations).ToNot(HaveKey(vmprovider.AttachedResourcePolicyAnnotationKey))
+			})
+		})
+	})
+
+	It("deletes the DRS rule of a group removed from the resource policy", func() {
+		run(func(ctx context.Context, session *Session, vmRefs []vimTypes.ManagedObjectReference, getRule func() vimTypes.BaseClusterRuleInfo) {
+			Expect(session.reconcileVMGroups(ctx, resourcePolicy)).To(Succeed())
+
+			resVM, err := res.NewVMFromObject(object.NewVirtualMachine(session.cluster.Client(), vmRefs[0]))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(session.updateVMGroupMembership(vmContext(ctx, newVM("vm-0", vmRefs[0].Value, "web")), resVM, resourcePolicy, false)).To(Succeed())
+			Expect(getRule()).ToNot(BeNil())
+
+			delete(resourcePolicy.Annotations, vmprovider.VMGroupsAnnotationKey)
+			Expect(session.reconcileVMGroups(ctx, resourcePolicy)).To(Succeed())
+			Expect(getRule()).To(BeNil())
+			Expect(resourcePolicy.Annotations).ToNot(HaveKey(vmprovider.VMGroupsStatusAnnotationKey))
+		})
+	})
+
+	It("does not delete the DRS rules of another resource policy", func() {
+		run(func(ctx context.Context, session *Session, vmRefs []vimTypes.ManagedObjectReference, _ func() vimTypes.BaseClusterRuleInfo) {
+			const otherRuleName = namespace + "/other-policy/web"
+			Expect(session.updateVMGroupRule(ctx, vmprovider.VMGroupSpec{Name: "web", Policy: vmprovider.VMGroupPolicyAffinity}, otherRuleName, vmRefs)).To(Succeed())
+
+			vmprovider.SetVMGroupsStatus(resourcePolicy, []vmprovider.VMGroupStatus{
+				{Name: "web", Backing: vmprovider.VMGroupBackingDRSRule, RuleName: otherRuleName},
+				{Name: "licensed", Backing: vmprovider.VMGroupBackingDRSHostRule, RuleName: otherRuleName, VMGroupName: otherRuleName},
+			})
+			delete(resourcePolicy.Annotations, vmprovider.VMGroupsAnnotationKey)
+			Expect(session.reconcileVMGroups(ctx, resourcePolicy)).To(Succeed())
+
+			rule, err := session.getClusterRule(ctx, otherRuleName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rule).ToNot(BeNil())
+		})
+	})
+
+	It("refuses to delete a DRS rule or cluster group without the prefix of the resource policy", func() {
+		Expect(checkVMGroupName(resourcePolicy, ruleName)).To(Succeed())
+		Expect(checkVMGroupName(resourcePolicy, ruleName+"/vms")).To(Succeed())
+		Expect(checkVMGroupName(resourcePolicy, namespace+"/other-policy/web")).ToNot(Succeed())
+		Expect(checkVMGroupName(resourcePolicy, "")).ToNot(Succeed())
+	})
+
+	It("maintains the DRS VM-Host rule of a group", func() {
+		resourcePolicy.Annotations[vmprovider.VMGroupsAnnotationKey] = `[{"name": "licensed", "policy": "HostAffinity", "hostTag": "licensed", "mandatory": true}]`
+		groups, err := vmprovider.GetVMGroups(resourcePolicy)
+		Expect(err).ToNot(HaveOccurred())
+		group := groups[0]
+
+		run(func(ctx context.Context, session *Session, vmRefs []vimTypes.ManagedObjectReference, _ func() vimTypes.BaseClusterRuleInfo) {
+			hosts, err := session.cluster.Hosts(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			hostRefs := []vimTypes.ManagedObjectReference{hosts[0].Reference()}
+
+			groupStatus := vmprovider.VMGroupStatus{Name: group.Name, Backing: group.Backing}
+			setVMGroupNames(resourcePolicy, &groupStatus)
+			Expect(session.updateVMHostRule(ctx, group, &groupStatus, hostRefs)).To(Succeed())
+			Expect(groupStatus.Hosts).To(Equal([]string{hostRefs[0].Value}))
+			vmprovider.SetVMGroupsStatus(resourcePolicy, []vmprovider.VMGroupStatus{groupStatus})
+
+			config, err := session.cluster.Configuration(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			rule, ok := findClusterRule(config, groupStatus.RuleName).(*vimTypes.ClusterVmHostRuleInfo)
+			Expect(ok).To(BeTrue())
+			Expect(rule.VmGroupName).To(Equal(groupStatus.VMGroupName))
+			Expect(rule.AffineHostGroupName).To(Equal(groupStatus.HostGroupName))
+			Expect(*rule.Mandatory).To(BeTrue())
+			hostGroup, ok := findClusterGroup(config, groupStatus.HostGroupName).(*vimTypes.ClusterHostGroup)
+			Expect(ok).To(BeTrue())
+			Expect(hostGroup.Host).To(Equal(hostRefs))
+
+			getVMGroup := func() *vimTypes.ClusterVmGroup {
+				config, err := session.cluster.Configuration(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				vmGroup, _ := findClusterGroup(config, groupStatus.VMGroupName).(*vimTypes.ClusterVmGroup)
+				return vmGroup
+			}
+			Expect(getVMGroup()).ToNot(BeNil())
+			Expect(getVMGroup().Vm).To(BeEmpty())
+
+			resVM, err := res.NewVMFromObject(object.NewVirtualMachine(session.cluster.Client(), vmRefs[0]))
+			Expect(err).ToNot(HaveOccurred())
+			vm := newVM("vm-0", vmRefs[0].Value, "licensed")
+
+			Expect(session.updateVMGroupMembership(vmContext(ctx, vm), resVM, resourcePolicy, false)).To(Succeed())
+			Expect(getVMGroup().Vm).To(Equal([]vimTypes.ManagedObjectReference{vmRefs[0]}))
+
+			Expect(session.updateVMGroupMembership(vmContext(ctx, vm), resVM, resourcePolicy, true)).To(Succeed())
+			Expect(getVMGroup().Vm).To(BeEmpty())
+
+			Expect(session.deleteVMGroups(ctx, resourcePolicy)).To(Succeed())
+			config, err = session.cluster.Configuration(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Rule).To(BeEmpty())
+			Expect(config.Group).To(BeEmpty())
+		})
+	})
+
+	It("does not add a VM in the cluster of another zone", func() {
+		session := &Session{zones: map[string]*zone{"zone-a": {cluster: object.NewClusterComputeResource(nil, vimTypes.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c2"})}}}
+		session.cluster = object.NewClusterComputeResource(nil, vimTypes.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c1"})
+		Expect(session.isInSessionCluster("")).To(BeTrue())
+		Expect(session.isInSessionCluster("zone-a")).To(BeFalse())
+		Expect(session.isInSessionCluster("zone-b")).To(BeFalse())
+	})
+})
@@ -0,0 +1,328 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/vmware/govmomi/vapi/tags"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+// reconcileVMHostGroup creates or updates the cluster host group with the cluster hosts that have
+// the host tag, the cluster VM group, and the DRS VM-Host rule of a VM group.
+func (s *Session) reconcileVMHostGroup(
+	ctx context.Context,
+	group vmprovider.VMGroupSpec,
+	groupStatus *vmprovider.VMGroupStatus) error {
+
+	hosts, err := s.getTaggedClusterHosts(ctx, group.HostTag, group.HostTagCategory)
+	if err != nil {
+		return err
+	}
+	return s.updateVMHostRule(ctx, group, groupStatus, hosts)
+}
+
+// getTaggedClusterHosts returns the hosts of the session's cluster that have the tag, sorted by
+// MoID. The category is only needed when the tag name is not unique.
+func (s *Session) getTaggedClusterHosts(
+	ctx context.Context,
+	tagName, categoryName string) ([]vimTypes.ManagedObjectReference, error) {
+
+	manager := tags.NewManager(s.Client.RestClient())
+
+	var (
+		tag *tags.Tag
+		err error
+	)
+	if categoryName != "" {
+		tag, err = manager.GetTagForCategory(ctx, tagName, categoryName)
+	} else {
+		tag, err = manager.GetTag(ctx, tagName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attached, err := manager.ListAttachedObjects(ctx, tag.ID)
+	if err != nil {
+		return nil, err
+	}
+	tagged := make(map[string]struct{}, len(attached))
+	for _, ref := range attached {
+		if ref.Reference().Type == "HostSystem" {
+			tagged[ref.Reference().Value] = struct{}{}
+		}
+	}
+
+	clusterHosts, err := s.cluster.Hosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []vimTypes.ManagedObjectReference
+	for _, host := range clusterHosts {
+		if _, ok := tagged[host.Reference().Value]; ok {
+			hosts = append(hosts, host.Reference())
+		}
+	}
+
+	sortReferences(hosts)
+	return hosts, nil
+}
+
+// updateVMHostRule creates or updates the cluster host group with the hosts, the cluster VM group,
+// and the DRS VM-Host rule of a VM group, and records the hosts and the compliance of the rule in
+// the status of the group. The VMs are added to the cluster VM group when they join the group.
+func (s *Session) updateVMHostRule(
+	ctx context.Context,
+	group vmprovider.VMGroupSpec,
+	groupStatus *vmprovider.VMGroupStatus,
+	hosts []vimTypes.ManagedObjectReference) error {
+
+	s.clusterRulesMutex.Lock()
+	defer s.clusterRulesMutex.Unlock()
+
+	config, err := s.cluster.Configuration(ctx)
+	if err != nil {
+		return err
+	}
+
+	spec := &vimTypes.ClusterConfigSpecEx{}
+
+	hostGroup := &vimTypes.ClusterHostGroup{
+		ClusterGroupInfo: vimTypes.ClusterGroupInfo{Name: groupStatus.HostGroupName},
+		Host:             hosts,
+	}
+	switch existing, _ := findClusterGroup(config, groupStatus.HostGroupName).(*vimTypes.ClusterHostGroup); {
+	case existing == nil:
+		spec.GroupSpec = append(spec.GroupSpec, addClusterGroupSpec(hostGroup))
+	case !equalReferences(existing.Host, hosts):
+		spec.GroupSpec = append(spec.GroupSpec, vimTypes.ClusterGroupSpec{
+			ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{Operation: vimTypes.ArrayUpdateOperationEdit},
+			Info:            hostGroup,
+		})
+	}
+
+	if findClusterGroup(config, groupStatus.VMGroupName) == nil {
+		spec.GroupSpec = append(spec.GroupSpec, addClusterGroupSpec(&vimTypes.ClusterVmGroup{
+			ClusterGroupInfo: vimTypes.ClusterGroupInfo{Name: groupStatus.VMGroupName},
+		}))
+	}
+
+	info := newVMHostRuleInfo(group, groupStatus)
+	rule := findClusterRule(config, groupStatus.RuleName)
+	switch {
+	case rule == nil:
+		spec.RulesSpec = append(spec.RulesSpec, vimTypes.ClusterRuleSpec{
+			ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{Operation: vimTypes.ArrayUpdateOperationAdd},
+			Info:            info,
+		})
+	case !isVMHostRuleUpToDate(rule, info):
+		info.Key = rule.GetClusterRuleInfo().Key
+		spec.RulesSpec = append(spec.RulesSpec, vimTypes.ClusterRuleSpec{
+			ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{Operation: vimTypes.ArrayUpdateOperationEdit},
+			Info:            info,
+		})
+	}
+
+	groupStatus.Hosts = nil
+	for _, host := range hosts {
+		groupStatus.Hosts = append(groupStatus.Hosts, host.Value)
+	}
+	groupStatus.InCompliance = nil
+	if rule != nil {
+		groupStatus.InCompliance = rule.GetClusterRuleInfo().InCompliance
+	}
+
+	if len(spec.GroupSpec) == 0 && len(spec.RulesSpec) == 0 {
+		return nil
+	}
+
+	log.Info("Updating DRS VM-Host rule of VM group", "rule", groupStatus.RuleName, "hosts", hosts)
+	return s.reconfigureCluster(ctx, spec)
+}
+
+// deleteVMHostRule deletes the DRS VM-Host rule, the cluster VM group and the cluster host group
+// of a VM group. It refuses to delete them if they do not belong to the resource policy.
+func (s *Session) deleteVMHostRule(
+	ctx context.Context,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy,
+	groupStatus vmprovider.VMGroupStatus) error {
+
+	for _, name := range []string{groupStatus.RuleName, groupStatus.VMGroupName, groupStatus.HostGroupName} {
+		if err := checkVMGroupName(resourcePolicy, name); err != nil {
+			return err
+		}
+	}
+
+	s.clusterRulesMutex.Lock()
+	defer s.clusterRulesMutex.Unlock()
+
+	config, err := s.cluster.Configuration(ctx)
+	if err != nil {
+		return err
+	}
+
+	spec := &vimTypes.ClusterConfigSpecEx{}
+	if rule := findClusterRule(config, groupStatus.RuleName); rule != nil {
+		spec.RulesSpec = append(spec.RulesSpec, removeClusterRuleSpec(rule))
+	}
+	for _, name := range []string{groupStatus.VMGroupName, groupStatus.HostGroupName} {
+		if findClusterGroup(config, name) != nil {
+			spec.GroupSpec = append(spec.GroupSpec, vimTypes.ClusterGroupSpec{
+				ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{
+					Operation: vimTypes.ArrayUpdateOperationRemove,
+					RemoveKey: name,
+				},
+			})
+		}
+	}
+
+	if len(spec.GroupSpec) == 0 && len(spec.RulesSpec) == 0 {
+		return nil
+	}
+
+	log.Info("Deleting DRS VM-Host rule of VM group", "rule", groupStatus.RuleName)
+	return s.reconfigureCluster(ctx, spec)
+}
+
+// updateClusterVMGroupMembership adds the VM to the cluster VM group when join is true, or removes
+// it otherwise.
+func (s *Session) updateClusterVMGroupMembership(
+	ctx context.Context,
+	vmGroupName string,
+	vmRef mo.Reference,
+	join bool) error {
+
+	s.clusterRulesMutex.Lock()
+	defer s.clusterRulesMutex.Unlock()
+
+	config, err := s.cluster.Configuration(ctx)
+	if err != nil {
+		return err
+	}
+
+	vmGroup, _ := findClusterGroup(config, vmGroupName).(*vimTypes.ClusterVmGroup)
+	if vmGroup == nil {
+		if join {
+			return fmt.Errorf("cluster VM group %s does not exist", vmGroupName)
+		}
+		return nil
+	}
+
+	var (
+		vms      []vimTypes.ManagedObjectReference
+		isMember bool
+	)
+	for _, vm := range vmGroup.Vm {
+		if vm.Value == vmRef.Reference().Value {
+			isMember = true
+			continue
+		}
+		vms = append(vms, vm)
+	}
+	if join == isMember {
+		return nil
+	}
+	if join {
+		vms = append(vms, vmRef.Reference())
+	}
+
+	log.Info("Updating cluster VM group", "vmGroup", vmGroupName, "vmId", vmRef, "join", join)
+	return s.reconfigureCluster(ctx, &vimTypes.ClusterConfigSpecEx{
+		GroupSpec: []vimTypes.ClusterGroupSpec{
+			{
+				ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{Operation: vimTypes.ArrayUpdateOperationEdit},
+				Info: &vimTypes.ClusterVmGroup{
+					ClusterGroupInfo: vimTypes.ClusterGroupInfo{Name: vmGroupName},
+					Vm:               vms,
+				},
+			},
+		},
+	})
+}
+
+func newVMHostRuleInfo(
+	group vmprovider.VMGroupSpec,
+	groupStatus *vmprovider.VMGroupStatus) *vimTypes.ClusterVmHostRuleInfo {
+
+	enabled, mandatory := true, group.Mandatory
+	info := &vimTypes.ClusterVmHostRuleInfo{
+		ClusterRuleInfo: vimTypes.ClusterRuleInfo{
+			Name:      groupStatus.RuleName,
+			Enabled:   &enabled,
+			Mandatory: &mandatory,
+		},
+		VmGroupName: groupStatus.VMGroupName,
+	}
+
+	if group.Policy == vmprovider.VMGroupPolicyHostAffinity {
+		info.AffineHostGroupName = groupStatus.HostGroupName
+	} else {
+		info.AntiAffineHostGroupName = groupStatus.HostGroupName
+	}
+	return info
+}
+
+// isVMHostRuleUpToDate returns true if the DRS rule is the VM-Host rule described by info.
+func isVMHostRuleUpToDate(rule vimTypes.BaseClusterRuleInfo, info *vimTypes.ClusterVmHostRuleInfo) bool {
+	r, ok := rule.(*vimTypes.ClusterVmHostRuleInfo)
+	if !ok {
+		return false
+	}
+	return r.Mandatory != nil && *r.Mandatory == *info.Mandatory &&
+		r.VmGroupName == info.VmGroupName &&
+		r.AffineHostGroupName == info.AffineHostGroupName &&
+		r.AntiAffineHostGroupName == info.AntiAffineHostGroupName
+}
+
+func addClusterGroupSpec(info vimTypes.BaseClusterGroupInfo) vimTypes.ClusterGroupSpec {
+	return vimTypes.ClusterGroupSpec{
+		ArrayUpdateSpec: vimTypes.ArrayUpdateSpec{Operation: vimTypes.ArrayUpdateOperationAdd},
+		Info:            info,
+	}
+}
+
+// findClusterGroup returns the cluster group with the given name, or nil if there is none.
+func findClusterGroup(config *vimTypes.ClusterConfigInfoEx, name string) vimTypes.BaseClusterGroupInfo {
+	for _, group := range config.Group {
+		if group.GetClusterGroupInfo().Name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+func sortReferences(refs []vimTypes.ManagedObjectReference) {
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Value < refs[j].Value
+	})
+}
+
+// equalReferences returns true if the references have the same values, in any order.
+func equalReferences(a, b []vimTypes.ManagedObjectReference) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	values := make(map[string]int, len(a))
+	for _, ref := range a {
+		values[ref.Value]++
+	}
+	for _, ref := range b {
+		if values[ref.Value] == 0 {
+			return false
+		}
+		values[ref.Value]--
+	}
+	return true
+}
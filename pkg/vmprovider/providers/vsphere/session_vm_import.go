@@ -0,0 +1,327 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
+)
+
+// ImportVirtualMachine adopts the existing VM of the import source of the VirtualMachine. The VM must
+// be in the resource pool and folder of the VirtualMachine, or is moved into them if the import
+// source allows it and the VM is in an import resource pool of the namespace. The spec of the VirtualMachine is first back-filled from the live config of the
+// VM so that the following update does not change the VM, and nil is returned: the VM is only marked
+// as managed and returned by the following call, once the back-filled spec has been persisted. A VM
+// already marked as managed is only adopted again by the VirtualMachine that adopted it, so that
+// the import can be retried when the status of the VirtualMachine cannot be updated.
+func (s *Session) ImportVirtualMachine(vmCtx VMContext, vmConfigArgs vmprovider.VmConfigArgs) (*res.VirtualMachine, error) {
+	source, err := vmprovider.GetImportSource(vmCtx.VM)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, errors.New("the VirtualMachine does not import a VM")
+	}
+
+	resVM, err := s.lookupVMForImport(vmCtx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	moVM, err := resVM.GetProperties(vmCtx, []string{"config", "runtime", "resourcePool", "parent"})
+	if err != nil {
+		return nil, err
+	}
+
+	// See govmomi VirtualMachine::Device() explanation for this check.
+	if moVM.Config == nil {
+		return nil, fmt.Errorf("VM config is not available, connectionState=%s", moVM.Runtime.ConnectionState)
+	}
+	adopted := moVM.Config.Annotation == VCVMAnnotation
+	if adopted && !isImportedBy(moVM.Config, vmCtx.VM) {
+		return nil, fmt.Errorf("VM %s is already managed by the vSphere Virtual Machine service", resVM.ReferenceValue())
+	}
+
+	z, err := s.placeVM(vmCtx, vmConfigArgs.ResourcePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	resourcePool, folder, err := s.getResourcePoolAndFolder(vmCtx, z, vmConfigArgs.ResourcePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.placeVMForImport(vmCtx, resVM, moVM, resourcePool, folder, source.Relocate); err != nil {
+		return nil, err
+	}
+	markPlaced(vmCtx, nil)
+
+	if vmprovider.GetImportedMoID(vmCtx.VM) != resVM.ReferenceValue() {
+		backfillImportedVMSpec(vmCtx.VM, moVM, s.getPortgroupNames(vmCtx, moVM.Config))
+		vmprovider.SetImportedMoID(vmCtx.VM, resVM.ReferenceValue())
+		vmCtx.Logger.Info("Back-filled the spec from the imported VM, adopting it once persisted", "moID", resVM.ReferenceValue())
+		return nil, nil
+	}
+
+	if !adopted {
+		// Mark the VM as managed by VM Operator like a VM it created, and by this VirtualMachine.
+		configSpec := &vimTypes.VirtualMachineConfigSpec{
+			Annotation: VCVMAnnotation,
+			ExtraConfig: []vimTypes.BaseOptionValue{
+				&vimTypes.OptionValue{Key: ImportedVMUIDExtraConfigKey, Value: string(vmCtx.VM.UID)},
+			},
+		}
+		if moVM.Config.ManagedBy == nil {
+			configSpec.ManagedBy = &vimTypes.ManagedByInfo{
+				ExtensionKey: "com.vmware.vcenter.wcp",
+				Type:         "VirtualMachine",
+			}
+		}
+		if err := resVM.Reconfigure(vmCtx, configSpec); err != nil {
+			return nil, err
+		}
+	}
+
+	markImportHardware(vmCtx, moVM, &vmConfigArgs.VmClass)
+
+	return resVM, nil
+}
+
+// isImportedBy returns true if the VM was adopted by the VirtualMachine.
+func isImportedBy(config *vimTypes.VirtualMachineConfigInfo, vm *v1alpha1.VirtualMachine) bool {
+	for _, opt := range config.ExtraConfig {
+		if optValue := opt.GetOptionValue(); optValue != nil && optValue.Key == ImportedVMUIDExtraConfigKey {
+			return vm.UID != "" && optValue.Value == string(vm.UID)
+		}
+	}
+	return false
+}
+
+// markImportHardware reports whether the hardware of the imported VM matches its class. The class
+// hardware is only applied when the VM is powered on by VM Operator, so a mismatch is not changed
+// by the import.
+func markImportHardware(vmCtx VMContext, moVM *mo.VirtualMachine, vmClass *v1alpha1.VirtualMachineClass) {
+	classSpec := vmClass.Spec
+	if moVM.Config.Hardware.NumCPU == int32(classSpec.Hardware.Cpus) &&
+		int64(moVM.Config.Hardware.MemoryMB) == memoryQuantityToMb(classSpec.Hardware.Memory) {
+		conditions.MarkTrue(vmCtx.VM, vmprovider.VirtualMachineImportReadyCondition)
+		return
+	}
+
+	conditions.MarkFalse(vmCtx.VM, vmprovider.VirtualMachineImportReadyCondition, vmprovider.ImportHardwareMismatchReason,
+		v1alpha1.ConditionSeverityWarning,
+		"The VM has %d CPUs and %d MB of memory, but VirtualMachineClass %s has %d CPUs and %d MB of memory",
+		moVM.Config.Hardware.NumCPU, moVM.Config.Hardware.MemoryMB, vmClass.Name,
+		classSpec.Hardware.Cpus, memoryQuantityToMb(classSpec.Hardware.Memory))
+	vmCtx.warnf(vmprovider.ImportHardwareMismatchReason, "%s", conditions.GetMessage(vmCtx.VM, vmprovider.VirtualMachineImportReadyCondition))
+}
+
+// lookupVMForImport returns the VM of the import source.
+func (s *Session) lookupVMForImport(vmCtx VMContext, source *vmprovider.ImportSource) (*res.VirtualMachine, error) {
+	if source.MoID != "" {
+		return s.lookupVMByMoID(vmCtx, source.MoID)
+	}
+
+	si := object.NewSearchIndex(s.Client.VimClient())
+	ref, err := si.FindByUuid(vmCtx, s.datacenter, source.BiosUUID, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		// SearchIndex returns nil when the VM is not found
+		return nil, &find.NotFoundError{}
+	}
+
+	return s.lookupVMByMoID(vmCtx, ref.Reference().Value)
+}
+
+// placeVMForImport checks that the VM is in the resource pool and folder, and moves it into them when
+// relocate is true. A VM outside of the resource pool is only moved from one of the import resource
+// pools of the namespace, so that a VirtualMachine cannot adopt any VM of the vCenter.
+func (s *Session) placeVMForImport(
+	vmCtx VMContext,
+	resVM *res.VirtualMachine,
+	moVM *mo.VirtualMachine,
+	resourcePool *object.ResourcePool,
+	folder *object.Folder,
+	relocate bool) error {
+
+	inResourcePool := moVM.ResourcePool != nil && moVM.ResourcePool.Value == resourcePool.Reference().Value
+	inFolder := moVM.Parent != nil && moVM.Parent.Value == folder.Reference().Value
+	if inResourcePool && inFolder {
+		return nil
+	}
+
+	if !relocate {
+		return fmt.Errorf("VM %s is not in ResourcePool %s and Folder %s, and relocation was not requested",
+			resVM.ReferenceValue(), resourcePool.Reference().Value, folder.Reference().Value)
+	}
+
+	if !inResourcePool {
+		if moVM.ResourcePool == nil || !s.isImportResourcePool(moVM.ResourcePool.Value) {
+			return fmt.Errorf("VM %s is not in ResourcePool %s or in a ResourcePool that VMs can be imported from",
+				resVM.ReferenceValue(), resourcePool.Reference().Value)
+		}
+
+		vmCtx.Logger.Info("Relocating imported VM", "resourcePool", resourcePool.Reference().Value)
+		poolRef := resourcePool.Reference()
+		if err := resVM.Relocate(vmCtx, vimTypes.VirtualMachineRelocateSpec{Pool: &poolRef}); err != nil {
+			return err
+		}
+	}
+
+	if !inFolder {
+		vmCtx.Logger.Info("Moving imported VM", "folder", folder.Reference().Value)
+		moveTask, err := folder.MoveInto(vmCtx, []vimTypes.ManagedObjectReference{resVM.MoRef()})
+		if err != nil {
+			return err
+		}
+		if _, err := moveTask.WaitForResult(vmCtx, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isImportResourcePool returns true if VMs can be imported from the resource pool into the namespace.
+func (s *Session) isImportResourcePool(moID string) bool {
+	for _, importResourcePool := range s.importResourcePools {
+		if importResourcePool == moID {
+			return true
+		}
+	}
+	return false
+}
+
+// getPortgroupNames returns the names of the distributed port groups of the network interfaces of
+// the VM keyed by port group key. Port groups whose name cannot be found are not in the map.
+func (s *Session) getPortgroupNames(vmCtx VMContext, config *vimTypes.VirtualMachineConfigInfo) map[string]string {
+	names := map[string]string{}
+
+	ethCards := object.VirtualDeviceList(config.Hardware.Device).SelectByType((*vimTypes.VirtualEthernetCard)(nil))
+	for _, dev := range ethCards {
+		backing, ok := dev.GetVirtualDevice().Backing.(*vimTypes.VirtualEthernetCardDistributedVirtualPortBackingInfo)
+		if !ok {
+			continue
+		}
+
+		key := backing.Port.PortgroupKey
+		ref, err := s.Finder.ObjectReference(vmCtx, vimTypes.ManagedObjectReference{Type: "DistributedVirtualPortgroup", Value: key})
+		if err != nil {
+			vmCtx.Logger.V(4).Info("Failed to find port group", "key", key, "error", err)
+			continue
+		}
+		if pg, ok := ref.(*object.DistributedVirtualPortgroup); ok {
+			names[key] = pg.Name()
+		}
+	}
+
+	return names
+}
+
+// backfillImportedVMSpec sets the spec fields of the VirtualMachine that are reconciled by the
+// provider from the live config of the imported VM:
+//   - PowerState, so the VM is not powered on or off
+//   - AdvancedOptions.ChangeBlockTracking, so a powered on VM is not reconfigured
+//   - NetworkInterfaces, if none are specified and every interface is on a distinct distributed
+//     port group of portgroupNames
+//   - Volumes of the virtual disks, if no vSphere volumes are specified
+func backfillImportedVMSpec(vm *v1alpha1.VirtualMachine, moVM *mo.VirtualMachine, portgroupNames map[string]string) {
+	vm.Spec.PowerState = v1alpha1.VirtualMachinePowerState(moVM.Runtime.PowerState)
+
+	if moVM.Config.ChangeTrackingEnabled != nil {
+		if vm.Spec.AdvancedOptions == nil {
+			vm.Spec.AdvancedOptions = &v1alpha1.VirtualMachineAdvancedOptions{}
+		}
+		changeTrackingEnabled := *moVM.Config.ChangeTrackingEnabled
+		vm.Spec.AdvancedOptions.ChangeBlockTracking = &changeTrackingEnabled
+	}
+
+	devices := object.VirtualDeviceList(moVM.Config.Hardware.Device)
+
+	if len(vm.Spec.NetworkInterfaces) == 0 {
+		vm.Spec.NetworkInterfaces = backfillNetworkInterfaces(devices, portgroupNames)
+	}
+
+	for _, volume := range vm.Spec.Volumes {
+		if volume.VsphereVolume != nil {
+			return
+		}
+	}
+
+	for _, dev := range devices.SelectByType((*vimTypes.VirtualDisk)(nil)) {
+		disk := dev.(*vimTypes.VirtualDisk)
+
+		// The capacity of a vSphere volume must be a multiple of MB.
+		if disk.CapacityInBytes%(1024*1024) != 0 {
+			continue
+		}
+
+		capacity := resource.NewQuantity(disk.CapacityInBytes, resource.BinarySI)
+		deviceKey := int(disk.Key)
+		vm.Spec.Volumes = append(vm.Spec.Volumes, v1alpha1.VirtualMachineVolume{
+			Name: fmt.Sprintf("disk-%d", disk.Key),
+			VsphereVolume: &v1alpha1.VsphereVolumeSource{
+				Capacity:  corev1.ResourceList{corev1.ResourceEphemeralStorage: *capacity},
+				DeviceKey: &deviceKey,
+			},
+		})
+	}
+}
+
+// backfillNetworkInterfaces returns the network interfaces of the ethernet cards, or nil if one of
+// them cannot be represented.
+func backfillNetworkInterfaces(devices object.VirtualDeviceList, portgroupNames map[string]string) []v1alpha1.VirtualMachineNetworkInterface {
+	var networkInterfaces []v1alpha1.VirtualMachineNetworkInterface
+	networkNames := map[string]struct{}{}
+
+	for _, dev := range devices.SelectByType((*vimTypes.VirtualEthernetCard)(nil)) {
+		backing, ok := dev.GetVirtualDevice().Backing.(*vimTypes.VirtualEthernetCardDistributedVirtualPortBackingInfo)
+		if !ok {
+			return nil
+		}
+
+		networkName, ok := portgroupNames[backing.Port.PortgroupKey]
+		if !ok {
+			return nil
+		}
+
+		// Multiple network interfaces cannot be connected to the same network.
+		if _, ok := networkNames[networkName]; ok {
+			return nil
+		}
+		networkNames[networkName] = struct{}{}
+
+		networkInterfaces = append(networkInterfaces, v1alpha1.VirtualMachineNetworkInterface{
+			NetworkType:      VdsNetworkType,
+			NetworkName:      networkName,
+			EthernetCardType: ethernetCardType(dev),
+		})
+	}
+
+	return networkInterfaces
+}
+
+// ethernetCardType returns the EthernetCardType of the ethernet card, like the name govmomi uses to
+// create one: the lower case type name without the Virtual prefix.
+func ethernetCardType(dev vimTypes.BaseVirtualDevice) string {
+	return strings.ToLower(strings.TrimPrefix(reflect.TypeOf(dev).Elem().Name(), "Virtual"))
+}
@@ -0,0 +1,199 @@
+// +build !integration
+
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+var _ = Describe("Import VM", func() {
+
+	Context("backfillImportedVMSpec", func() {
+		var (
+			vm             *vmopv1alpha1.VirtualMachine
+			moVM           *mo.VirtualMachine
+			portgroupNames map[string]string
+		)
+
+		dvpgCard := func(key int32, portgroupKey string) vimTypes.BaseVirtualDevice {
+			return &vimTypes.VirtualVmxnet3{
+				VirtualVmxnet: vimTypes.VirtualVmxnet{
+					VirtualEthernetCard: vimTypes.VirtualEthernetCard{
+						VirtualDevice: vimTypes.VirtualDevice{
+							Key: key,
+							Backing: &vimTypes.VirtualEthernetCardDistributedVirtualPortBackingInfo{
+								Port: vimTypes.DistributedVirtualSwitchPortConnection{PortgroupKey: portgroupKey},
+							},
+						},
+					},
+				},
+			}
+		}
+
+		disk := func(key int32, capacityInBytes int64) vimTypes.BaseVirtualDevice {
+			return &vimTypes.VirtualDisk{
+				VirtualDevice:   vimTypes.VirtualDevice{Key: key},
+				CapacityInBytes: capacityInBytes,
+			}
+		}
+
+		BeforeEach(func() {
+			vm = &vmopv1alpha1.VirtualMachine{}
+			changeTrackingEnabled := true
+			moVM = &mo.VirtualMachine{
+				Config: &vimTypes.VirtualMachineConfigInfo{
+					ChangeTrackingEnabled: &changeTrackingEnabled,
+					Hardware: vimTypes.VirtualHardware{
+						Device: []vimTypes.BaseVirtualDevice{
+							dvpgCard(4000, "dvportgroup-1"),
+							disk(2000, 10*1024*1024*1024),
+						},
+					},
+				},
+				Runtime: vimTypes.VirtualMachineRuntimeInfo{PowerState: vimTypes.VirtualMachinePowerStatePoweredOn},
+			}
+			portgroupNames = map[string]string{"dvportgroup-1": "workload-network"}
+		})
+
+		It("back-fills the spec from the VM", func() {
+			backfillImportedVMSpec(vm, moVM, portgroupNames)
+
+			Expect(vm.Spec.PowerState).To(Equal(vmopv1alpha1.VirtualMachinePoweredOn))
+			Expect(vm.Spec.AdvancedOptions).ToNot(BeNil())
+			Expect(vm.Spec.AdvancedOptions.ChangeBlockTracking).To(Equal(moVM.Config.ChangeTrackingEnabled))
+
+			Expect(vm.Spec.NetworkInterfaces).To(HaveLen(1))
+			Expect(vm.Spec.NetworkInterfaces[0].NetworkType).To(Equal(VdsNetworkType))
+			Expect(vm.Spec.NetworkInterfaces[0].NetworkName).To(Equal("workload-network"))
+			Expect(vm.Spec.NetworkInterfaces[0].EthernetCardType).To(Equal("vmxnet3"))
+
+			Expect(vm.Spec.Volumes).To(HaveLen(1))
+			Expect(vm.Spec.Volumes[0].Name).To(Equal("disk-2000"))
+			Expect(vm.Spec.Volumes[0].VsphereVolume).ToNot(BeNil())
+			Expect(*vm.Spec.Volumes[0].VsphereVolume.DeviceKey).To(Equal(2000))
+			capacity := vm.Spec.Volumes[0].VsphereVolume.Capacity[corev1.ResourceEphemeralStorage]
+			Expect(capacity.Value()).To(Equal(int64(10 * 1024 * 1024 * 1024)))
+		})
+
+		It("does not back-fill network interfaces on unknown port groups", func() {
+			delete(portgroupNames, "dvportgroup-1")
+			backfillImportedVMSpec(vm, moVM, portgroupNames)
+			Expect(vm.Spec.NetworkInterfaces).To(BeEmpty())
+		})
+
+		It("does not back-fill network interfaces on the same port group", func() {
+			moVM.Config.Hardware.Device = append(moVM.Config.Hardware.Device, dvpgCard(4001, "dvportgroup-1"))
+			backfillImportedVMSpec(vm, moVM, portgroupNames)
+			Expect(vm.Spec.NetworkInterfaces).To(BeEmpty())
+		})
+
+		It("skips disks whose capacity is not a multiple of MB", func() {
+			moVM.Config.Hardware.Device = append(moVM.Config.Hardware.Device, disk(2001, 1024*1024+512))
+			backfillImportedVMSpec(vm, moVM, portgroupNames)
+			Expect(vm.Spec.Volumes).To(HaveLen(1))
+		})
+
+		It("keeps the specified network interfaces and vSphere volumes", func() {
+			vm.Spec.NetworkInterfaces = []vmopv1alpha1.VirtualMachineNetworkInterface{{NetworkName: "specified-network"}}
+			vm.Spec.Volumes = []vmopv1alpha1.VirtualMachineVolume{
+				{
+					Name: "specified-disk",
+					VsphereVolume: &vmopv1alpha1.VsphereVolumeSource{
+						Capacity: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+					},
+				},
+			}
+
+			backfillImportedVMSpec(vm, moVM, portgroupNames)
+			Expect(vm.Spec.NetworkInterfaces).To(HaveLen(1))
+			Expect(vm.Spec.NetworkInterfaces[0].NetworkName).To(Equal("specified-network"))
+			Expect(vm.Spec.Volumes).To(HaveLen(1))
+			Expect(vm.Spec.Volumes[0].Name).To(Equal("specified-disk"))
+		})
+	})
+
+	Context("isImportedBy", func() {
+		var (
+			vm     *vmopv1alpha1.VirtualMachine
+			config *vimTypes.VirtualMachineConfigInfo
+		)
+
+		BeforeEach(func() {
+			vm = &vmopv1alpha1.VirtualMachine{}
+			vm.UID = "dummy-uid"
+			config = &vimTypes.VirtualMachineConfigInfo{}
+		})
+
+		It("returns true for the VM adopted by the VirtualMachine", func() {
+			config.ExtraConfig = []vimTypes.BaseOptionValue{
+				&vimTypes.OptionValue{Key: ImportedVMUIDExtraConfigKey, Value: "dummy-uid"},
+			}
+			Expect(isImportedBy(config, vm)).To(BeTrue())
+		})
+
+		It("returns false for the VM adopted by another VirtualMachine", func() {
+			config.ExtraConfig = []vimTypes.BaseOptionValue{
+				&vimTypes.OptionValue{Key: ImportedVMUIDExtraConfigKey, Value: "other-uid"},
+			}
+			Expect(isImportedBy(config, vm)).To(BeFalse())
+		})
+
+		It("returns false for a VM that was not imported", func() {
+			Expect(isImportedBy(config, vm)).To(BeFalse())
+		})
+	})
+
+	Context("markImportHardware", func() {
+		var (
+			vmCtx   VMContext
+			moVM    *mo.VirtualMachine
+			vmClass *vmopv1alpha1.VirtualMachineClass
+		)
+
+		BeforeEach(func() {
+			vmCtx = VMContext{VM: &vmopv1alpha1.VirtualMachine{}}
+			moVM = &mo.VirtualMachine{
+				Config: &vimTypes.VirtualMachineConfigInfo{
+					Hardware: vimTypes.VirtualHardware{NumCPU: 2, MemoryMB: 4096},
+				},
+			}
+			vmClass = &vmopv1alpha1.VirtualMachineClass{
+				Spec: vmopv1alpha1.VirtualMachineClassSpec{
+					Hardware: vmopv1alpha1.VirtualMachineClassHardware{
+						Cpus:   2,
+						Memory: resource.MustParse("4Gi"),
+					},
+				},
+			}
+			vmClass.Name = "dummy-class"
+		})
+
+		It("marks the import ready when the hardware matches the class", func() {
+			markImportHardware(vmCtx, moVM, vmClass)
+			Expect(conditions.IsTrue(vmCtx.VM, vmprovider.VirtualMachineImportReadyCondition)).To(BeTrue())
+		})
+
+		It("reports the hardware mismatch", func() {
+			moVM.Config.Hardware.NumCPU = 4
+			markImportHardware(vmCtx, moVM, vmClass)
+			Expect(conditions.IsFalse(vmCtx.VM, vmprovider.VirtualMachineImportReadyCondition)).To(BeTrue())
+			Expect(conditions.GetReason(vmCtx.VM, vmprovider.VirtualMachineImportReadyCondition)).To(Equal(vmprovider.ImportHardwareMismatchReason))
+			Expect(conditions.GetMessage(vmCtx.VM, vmprovider.VirtualMachineImportReadyCondition)).To(
+				Equal("The VM has 4 CPUs and 4096 MB of memory, but VirtualMachineClass dummy-class has 2 CPUs and 4096 MB of memory"))
+		})
+	})
+})
@@ -0,0 +1,401 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
+)
+
+// migrateVirtualMachine migrates the VM to the resource pool and folder of its resource policy in
+// its zone when the resource policy or the zone of the VM changed. When the VM runs in another
+// cluster than the one of the zone, it is migrated to the host of the cluster recommended by DRS,
+// and to a datastore of the cluster.
+// When the storage class of the VM changed, the VM home and disks are migrated to a datastore
+// compatible with the storage profile, and their profiles are updated.
+//
+// The migration runs in the background: migrateVirtualMachine returns true while the migration task
+// is in progress, and reports its progress in the VirtualMachineMigrationReady condition. moVM must
+// have the config, datastore, resourcePool, parent and runtime properties.
+func (s *Session) migrateVirtualMachine(
+	vmCtx VMContext,
+	resVM *res.VirtualMachine,
+	moVM *mo.VirtualMachine,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy,
+	storageProfileID string) (bool, error) {
+
+	if taskID, ok := vmCtx.VM.Annotations[vmprovider.MigrationTaskAnnotationKey]; ok {
+		inProgress, err := s.checkMigrationTask(vmCtx, taskID)
+		if inProgress || err != nil {
+			return inProgress, err
+		}
+
+		// The placement of the VM changed, so it is refreshed to check whether the VM needs another
+		// migration, for instance if its resource policy changed again during the migration.
+		moVM, err = resVM.GetProperties(vmCtx, []string{"config", "datastore", "resourcePool", "parent", "runtime"})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	z, err := s.getVMZone(vmCtx)
+	if err != nil {
+		return false, markMigrationFailed(vmCtx, err)
+	}
+
+	resourcePool, folder, err := s.getResourcePoolAndFolder(vmCtx, z, resourcePolicy)
+	if err != nil {
+		return false, markMigrationFailed(vmCtx, err)
+	}
+
+	var (
+		relocateSpec vimTypes.VirtualMachineRelocateSpec
+		destination  []string
+	)
+	if resourcePool != nil && folder != nil {
+		if moVM.ResourcePool == nil || moVM.ResourcePool.Value != resourcePool.Reference().Value {
+			relocateSpec.Pool = vimTypes.NewReference(resourcePool.Reference())
+			destination = append(destination, "resource pool "+resourcePool.Reference().Value)
+		}
+		if moVM.Parent == nil || moVM.Parent.Value != folder.Reference().Value {
+			relocateSpec.Folder = vimTypes.NewReference(folder.Reference())
+			destination = append(destination, "folder "+folder.Reference().Value)
+		}
+	}
+
+	storageChanged, err := s.storageRelocateSpec(vmCtx, z, moVM, storageProfileID, &relocateSpec)
+	if err != nil {
+		return false, markMigrationFailed(vmCtx, err)
+	}
+	if storageChanged {
+		destination = append(destination, fmt.Sprintf("datastore %s with storage class %s",
+			relocateSpec.Datastore.Value, vmCtx.VM.Spec.StorageClass))
+	}
+
+	if len(destination) == 0 {
+		return false, nil
+	}
+
+	if relocateSpec.Pool != nil && z.cluster != nil {
+		inCluster, err := s.isVMInCluster(vmCtx, moVM, z.cluster)
+		if err != nil {
+			return false, err
+		}
+
+		if !inCluster {
+			// The datastore of the VM may not be available to the hosts of the other cluster.
+			if relocateSpec.Datastore == nil {
+				datastoreChanged, err := s.clusterDatastoreRelocateSpec(vmCtx, z, moVM, storageProfileID, &relocateSpec)
+				if err != nil {
+					return false, markMigrationFailed(vmCtx, err)
+				}
+				if datastoreChanged {
+					destination = append(destination, "datastore "+relocateSpec.Datastore.Value)
+				}
+			}
+
+			rec, err := placeVM(vmCtx, z.cluster, vimTypes.PlacementSpec{
+				PlacementType: string(vimTypes.PlacementSpecPlacementTypeRelocate),
+				Vm:            vimTypes.NewReference(resVM.MoRef()),
+				RelocateSpec:  &relocateSpec,
+			})
+			if err != nil {
+				return false, markMigrationFailed(vmCtx, err)
+			}
+
+			relocateSpec.Host = rec.RelocateSpec.Host
+			destination = append(destination, "host "+relocateSpec.Host.Value)
+		}
+	}
+
+	message := strings.Join(destination, ", ")
+	if zone := vmprovider.GetZone(vmCtx.VM); zone != "" {
+		message = "zone " + zone + ", " + message
+	}
+
+	vmCtx.Logger.Info("Migrating VM", "relocateSpec", relocateSpec)
+	task, err := resVM.StartRelocate(vmCtx, relocateSpec)
+	if err != nil {
+		return false, markMigrationFailed(vmCtx, err)
+	}
+
+	if vmCtx.VM.Annotations == nil {
+		vmCtx.VM.Annotations = map[string]string{}
+	}
+	vmCtx.VM.Annotations[vmprovider.MigrationTaskAnnotationKey] = task.Reference().Value
+
+	conditions.MarkFalse(vmCtx.VM, vmprovider.VirtualMachineMigrationReadyCondition,
+		vmprovider.MigrationInProgressReason, v1alpha1.ConditionSeverityInfo, "migrating to %s: 0%% complete", message)
+	vmCtx.eventf(migratingReason, "Migrating the VM to %s", message)
+
+	return true, nil
+}
+
+// checkMigrationTask updates the VirtualMachineMigrationReady condition with the state of the
+// migration task, and returns true if it is in progress. The migration task annotation is removed
+// once the task completes.
+func (s *Session) checkMigrationTask(vmCtx VMContext, taskID string) (bool, error) {
+	taskRef := vimTypes.ManagedObjectReference{Type: "Task", Value: taskID}
+
+	var task mo.Task
+	err := property.DefaultCollector(s.Client.VimClient()).RetrieveOne(vmCtx, taskRef, []string{"info"}, &task)
+	if err != nil {
+		if !isManagedObjectNotFound(err) {
+			return false, err
+		}
+
+		// vCenter only keeps the recent tasks, so the outcome of the migration is unknown.
+		vmCtx.Logger.Info("Migration task not found", "task", taskID)
+		delete(vmCtx.VM.Annotations, vmprovider.MigrationTaskAnnotationKey)
+		return false, nil
+	}
+
+	switch task.Info.State {
+	case vimTypes.TaskInfoStateQueued, vimTypes.TaskInfoStateRunning:
+		message := "migrating"
+		if c := conditions.Get(vmCtx.VM, vmprovider.VirtualMachineMigrationReadyCondition); c != nil {
+			// Keep the destination recorded when the migration started.
+			message = strings.SplitN(c.Message, ":", 2)[0]
+		}
+		conditions.MarkFalse(vmCtx.VM, vmprovider.VirtualMachineMigrationReadyCondition,
+			vmprovider.MigrationInProgressReason, v1alpha1.ConditionSeverityInfo,
+			"%s: %d%% complete", message, task.Info.Progress)
+		return true, nil
+
+	case vimTypes.TaskInfoStateError:
+		delete(vmCtx.VM.Annotations, vmprovider.MigrationTaskAnnotationKey)
+
+		msg := "unknown error"
+		if task.Info.Error != nil {
+			msg = task.Info.Error.LocalizedMessage
+		}
+		return false, markMigrationFailed(vmCtx, fmt.Errorf("migration task %s failed: %s", taskID, msg))
+
+	default:
+		delete(vmCtx.VM.Annotations, vmprovider.MigrationTaskAnnotationKey)
+		// The storage class cannot change during the migration, so the VM storage now complies with it.
+		if vmCtx.VM.Spec.StorageClass != "" {
+			vmCtx.VM.Annotations[vmprovider.StorageClassAnnotationKey] = vmCtx.VM.Spec.StorageClass
+		}
+
+		conditions.MarkTrue(vmCtx.VM, vmprovider.VirtualMachineMigrationReadyCondition)
+		vmCtx.eventf(migratedReason, "Migrated the VM")
+		return false, nil
+	}
+}
+
+// storageRelocateSpec adds the datastore and the storage profile of the VM home and disks to the
+// relocate spec when the storage class of the VM changed, and returns true if it did. The datastore
+// is the datastore of the VM if it is compatible with the storage profile, or else the compatible
+// datastore of the cluster with the most free space. The disks of volumes are managed by CSI and
+// keep their datastore and profile.
+func (s *Session) storageRelocateSpec(
+	vmCtx VMContext,
+	z *zone,
+	moVM *mo.VirtualMachine,
+	storageProfileID string,
+	relocateSpec *vimTypes.VirtualMachineRelocateSpec) (bool, error) {
+
+	storageClass := vmCtx.VM.Spec.StorageClass
+	placedStorageClass, ok := vmCtx.VM.Annotations[vmprovider.StorageClassAnnotationKey]
+	if !ok {
+		// The VM storage was placed with the storage class of the VM by the clone or deploy.
+		if storageClass != "" {
+			if vmCtx.VM.Annotations == nil {
+				vmCtx.VM.Annotations = map[string]string{}
+			}
+			vmCtx.VM.Annotations[vmprovider.StorageClassAnnotationKey] = storageClass
+		}
+		return false, nil
+	}
+	if placedStorageClass == storageClass || storageProfileID == "" {
+		return false, nil
+	}
+
+	if moVM.Config == nil {
+		return false, fmt.Errorf("VM config is not available, connectionState=%s", moVM.Runtime.ConnectionState)
+	}
+
+	datastores, err := s.getCandidateDatastores(VMCloneContext{VMContext: vmCtx, Cluster: z.cluster}, storageProfileID)
+	if err != nil {
+		return false, err
+	}
+	if len(datastores) == 0 {
+		return false, fmt.Errorf("no datastore is compatible with storage policy %s", storageProfileID)
+	}
+
+	datastore, err := s.selectDatastore(vmCtx, moVM, datastores)
+	if err != nil {
+		return false, err
+	}
+
+	profile := []vimTypes.BaseVirtualMachineProfileSpec{
+		&vimTypes.VirtualMachineDefinedProfileSpec{ProfileId: storageProfileID},
+	}
+	relocateSpec.Datastore = &datastore
+	relocateSpec.Profile = profile
+
+	devices := object.VirtualDeviceList(moVM.Config.Hardware.Device)
+	for _, device := range devices.SelectByType((*vimTypes.VirtualDisk)(nil)) {
+		disk := device.(*vimTypes.VirtualDisk)
+		if disk.VDiskId != nil {
+			continue
+		}
+		relocateSpec.Disk = append(relocateSpec.Disk, vimTypes.VirtualMachineRelocateSpecDiskLocator{
+			DiskId:    disk.Key,
+			Datastore: datastore,
+			Profile:   profile,
+		})
+	}
+
+	return true, nil
+}
+
+// clusterDatastoreRelocateSpec adds the datastore of the VM home and disks to the relocate spec of
+// a VM migrated to the cluster of the zone, and returns true if it is not a datastore of the VM. The
+// datastore is the datastore of the VM if the cluster has it and it is compatible with the storage
+// profile, or else the compatible datastore of the cluster with the most free space. The disks of
+// volumes are managed by CSI and keep their datastore.
+func (s *Session) clusterDatastoreRelocateSpec(
+	vmCtx VMContext,
+	z *zone,
+	moVM *mo.VirtualMachine,
+	storageProfileID string,
+	relocateSpec *vimTypes.VirtualMachineRelocateSpec) (bool, error) {
+
+	if moVM.Config == nil {
+		return false, fmt.Errorf("VM config is not available, connectionState=%s", moVM.Runtime.ConnectionState)
+	}
+
+	var datastores []vimTypes.ManagedObjectReference
+	if storageProfileID != "" {
+		var err error
+		datastores, err = s.getCandidateDatastores(VMCloneContext{VMContext: vmCtx, Cluster: z.cluster}, storageProfileID)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		var cluster mo.ClusterComputeResource
+		if err := z.cluster.Properties(vmCtx, z.cluster.Reference(), []string{"datastore"}, &cluster); err != nil {
+			return false, err
+		}
+		datastores = cluster.Datastore
+	}
+	if len(datastores) == 0 {
+		return false, fmt.Errorf("no datastore of cluster %s is available to the VM", z.cluster.Reference().Value)
+	}
+
+	datastore, err := s.selectDatastore(vmCtx, moVM, datastores)
+	if err != nil {
+		return false, err
+	}
+	relocateSpec.Datastore = &datastore
+
+	devices := object.VirtualDeviceList(moVM.Config.Hardware.Device)
+	for _, device := range devices.SelectByType((*vimTypes.VirtualDisk)(nil)) {
+		disk := device.(*vimTypes.VirtualDisk)
+		if disk.VDiskId == nil {
+			continue
+		}
+		backing, ok := disk.Backing.(vimTypes.BaseVirtualDeviceFileBackingInfo)
+		if !ok || backing.GetVirtualDeviceFileBackingInfo().Datastore == nil {
+			continue
+		}
+		relocateSpec.Disk = append(relocateSpec.Disk, vimTypes.VirtualMachineRelocateSpecDiskLocator{
+			DiskId:    disk.Key,
+			Datastore: *backing.GetVirtualDeviceFileBackingInfo().Datastore,
+		})
+	}
+
+	for _, vmDS := range moVM.Datastore {
+		if vmDS.Value == datastore.Value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// selectDatastore returns the datastore of the VM if it is one of the datastores, or else the
+// datastore with the most free space.
+func (s *Session) selectDatastore(
+	vmCtx VMContext,
+	moVM *mo.VirtualMachine,
+	datastores []vimTypes.ManagedObjectReference) (vimTypes.ManagedObjectReference, error) {
+
+	for _, ds := range datastores {
+		for _, vmDS := range moVM.Datastore {
+			if ds.Value == vmDS.Value {
+				return ds, nil
+			}
+		}
+	}
+
+	var moDatastores []mo.Datastore
+	pc := property.DefaultCollector(s.Client.VimClient())
+	if err := pc.Retrieve(vmCtx, datastores, []string{"summary.freeSpace"}, &moDatastores); err != nil {
+		return vimTypes.ManagedObjectReference{}, err
+	}
+
+	selected := moDatastores[0]
+	for _, ds := range moDatastores[1:] {
+		if ds.Summary.FreeSpace > selected.Summary.FreeSpace {
+			selected = ds
+		}
+	}
+	return selected.Reference(), nil
+}
+
+// isVMInCluster returns true if the VM runs on a host of the cluster.
+func (s *Session) isVMInCluster(
+	vmCtx VMContext,
+	moVM *mo.VirtualMachine,
+	cluster *object.ClusterComputeResource) (bool, error) {
+
+	if moVM.Runtime.Host == nil {
+		return false, nil
+	}
+
+	var host mo.HostSystem
+	hostObj := object.NewHostSystem(s.Client.VimClient(), *moVM.Runtime.Host)
+	if err := hostObj.Properties(vmCtx, hostObj.Reference(), []string{"parent"}, &host); err != nil {
+		return false, err
+	}
+
+	return host.Parent != nil && host.Parent.Value == cluster.Reference().Value, nil
+}
+
+// markMigrationFailed marks the migration of the VM as failed because of the error, and returns the
+// error.
+func markMigrationFailed(vmCtx VMContext, err error) error {
+	reason := vmprovider.MigrationFailedReason
+	if _, ok := err.(*insufficientResourcesError); ok {
+		reason = vmprovider.InsufficientResourcesReason
+	}
+
+	conditions.MarkFalse(vmCtx.VM, vmprovider.VirtualMachineMigrationReadyCondition,
+		reason, v1alpha1.ConditionSeverityError, "%v", err)
+	vmCtx.warnf(reason, "Failed to migrate the VM: %v", err)
+
+	return err
+}
+
+func isManagedObjectNotFound(err error) bool {
+	if soap.IsSoapFault(err) {
+		_, ok := soap.ToSoapFault(err).VimFault().(vimTypes.ManagedObjectNotFound)
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+// +build !integration
+
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgorecord "k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
+)
+
+var _ = Describe("Migration", func() {
+	var (
+		vm               *vmopv1alpha1.VirtualMachine
+		resourcePolicy   *vmopv1alpha1.VirtualMachineSetResourcePolicy
+		storageProfileID string
+		events           chan string
+	)
+
+	// run runs f with a session in the cluster of a vcsim VPX model, the context of a VM of the
+	// cluster, and a function that migrates the VM to the placement of the resource policy and storage
+	// profile.
+	run := func(f func(ctx context.Context, session *Session, vmCtx VMContext, resVM *res.VirtualMachine, migrate func() (bool, error))) {
+		res := simulator.VPX().Run(func(ctx context.Context, c *vim25.Client) error {
+			finder := find.NewFinder(c)
+			dc, err := finder.DefaultDatacenter(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			finder.SetDatacenter(dc)
+
+			cluster, err := finder.DefaultClusterComputeResource(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			resourcePool, err := cluster.ResourcePool(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			folders, err := dc.Folders(ctx)
+			Expect(err).ToNot(HaveOccurred())
+
+			session := &Session{
+				Client:       &Client{vimClient: c},
+				Finder:       finder,
+				cluster:      cluster,
+				resourcePool: resourcePool,
+				folder:       folders.VmFolder,
+			}
+			_, err = session.CreateResourcePool(ctx, &resourcePolicy.Spec.ResourcePool)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = session.CreateFolder(ctx, &resourcePolicy.Spec.Folder)
+			Expect(err).ToNot(HaveOccurred())
+
+			vmObj, err := finder.VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+			Expect(err).ToNot(HaveOccurred())
+			resVM, err := res.NewVMFromObject(vmObj)
+			Expect(err).ToNot(HaveOccurred())
+
+			fakeRecorder := clientgorecord.NewFakeRecorder(10)
+			events = fakeRecorder.Events
+			vmCtx := VMContext{
+				Context:  ctx,
+				Logger:   ctrl.Log.WithName("test"),
+				VM:       vm,
+				Recorder: record.New(fakeRecorder),
+			}
+
+			migrate := func() (bool, error) {
+				moVM, err := resVM.GetProperties(ctx, []string{"config", "datastore", "resourcePool", "parent", "runtime"})
+				Expect(err).ToNot(HaveOccurred())
+				return session.migrateVirtualMachine(vmCtx, resVM, moVM, resourcePolicy, storageProfileID)
+			}
+
+			f(ctx, session, vmCtx, resVM, migrate)
+			return nil
+		})
+		Expect(res).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		vm = &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-vm",
+				Namespace: "dummy-ns",
+			},
+		}
+		resourcePolicy = &vmopv1alpha1.VirtualMachineSetResourcePolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-policy",
+				Namespace: "dummy-ns",
+			},
+			Spec: vmopv1alpha1.VirtualMachineSetResourcePolicySpec{
+				ResourcePool: vmopv1alpha1.ResourcePoolSpec{Name: "dummy-resource-pool"},
+				Folder:       vmopv1alpha1.FolderSpec{Name: "dummy-folder"},
+			},
+		}
+		storageProfileID = ""
+	})
+
+	It("migrates the VM to the resource pool and folder of its resource policy", func() {
+		run(func(ctx context.Context, session *Session, vmCtx VMContext, resVM *res.VirtualMachine, migrate func() (bool, error)) {
+			migrating, err := migrate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(migrating).To(BeTrue())
+			Expect(vm.Annotations).To(HaveKey(vmprovider.MigrationTaskAnnotationKey))
+			Expect(conditions.GetReason(vm, vmprovider.VirtualMachineMigrationReadyCondition)).To(Equal(vmprovider.MigrationInProgressReason))
+			Expect(events).To(Receive(HavePrefix("Normal " + migratingReason)))
+
+			Eventually(func() bool {
+				migrating, err := migrate()
+				Expect(err).ToNot(HaveOccurred())
+				return migrating
+			}).Should(BeFalse())
+			Expect(vm.Annotations).ToNot(HaveKey(vmprovider.MigrationTaskAnnotationKey))
+			Expect(conditions.IsTrue(vm, vmprovider.VirtualMachineMigrationReadyCondition)).To(BeTrue())
+			Expect(events).To(Receive(HavePrefix("Normal " + migratedReason)))
+
+			resourcePool, folder, err := session.getResourcePoolAndFolder(vmCtx, session.defaultZone(), resourcePolicy)
+			Expect(err).ToNot(HaveOccurred())
+			moVM, err := resVM.GetProperties(ctx, []string{"resourcePool", "parent"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*moVM.ResourcePool).To(Equal(resourcePool.Reference()))
+			Expect(*moVM.Parent).To(Equal(folder.Reference()))
+
+			By("not migrating the VM again", func() {
+				migrating, err := migrate()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(migrating).To(BeFalse())
+				Expect(vm.Annotations).ToNot(HaveKey(vmprovider.MigrationTaskAnnotationKey))
+			})
+		})
+	})
+
+	It("forgets a migration task that no longer exists", func() {
+		run(func(ctx context.Context, session *Session, vmCtx VMContext, _ *res.VirtualMachine, _ func() (bool, error)) {
+			vm.Annotations = map[string]string{vmprovider.MigrationTaskAnnotationKey: "task-404"}
+
+			inProgress, err := session.checkMigrationTask(vmCtx, "task-404")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(inProgress).To(BeFalse())
+			Expect(vm.Annotations).ToNot(HaveKey(vmprovider.MigrationTaskAnnotationKey))
+		})
+	})
+
+	It("does not migrate a VM without a resource policy in the session's placement", func() {
+		run(func(ctx context.Context, session *Session, vmCtx VMContext, resVM *res.VirtualMachine, _ func() (bool, error)) {
+			moVM, err := resVM.GetProperties(ctx, []string{"config", "datastore", "resourcePool", "parent", "runtime"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(*moVM.ResourcePool).To(Equal(session.resourcePool.Reference()))
+
+			migrating, err := session.migrateVirtualMachine(vmCtx, resVM, moVM, nil, "")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(migrating).To(BeFalse())
+			Expect(conditions.Has(vm, vmprovider.VirtualMachineMigrationReadyCondition)).To(BeFalse())
+		})
+	})
+
+	It("keeps the datastore of a VM migrated to another cluster that has it", func() {
+		run(func(ctx context.Context, session *Session, vmCtx VMContext, resVM *res.VirtualMachine, _ func() (bool, error)) {
+			moVM, err := resVM.GetProperties(ctx, []string{"config", "datastore", "resourcePool", "parent", "runtime"})
+			Expect(err).ToNot(HaveOccurred())
+
+			var relocateSpec vimTypes.VirtualMachineRelocateSpec
+			changed, err := session.clusterDatastoreRelocateSpec(vmCtx, session.defaultZone(), moVM, "", &relocateSpec)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeFalse())
+			Expect(relocateSpec.Datastore).ToNot(BeNil())
+			Expect(moVM.Datastore).To(ContainElement(*relocateSpec.Datastore))
+			Expect(relocateSpec.Profile).To(BeEmpty())
+		})
+	})
+
+	Context("when the storage class changes", func() {
+		BeforeEach(func() {
+			vm.Spec.StorageClass = "gold"
+			storageProfileID = "gold-profile-id"
+		})
+
+		It("records the storage class of a VM without one", func() {
+			run(func(ctx context.Context, session *Session, vmCtx VMContext, resVM *res.VirtualMachine, _ func() (bool, error)) {
+				moVM, err := resVM.GetProperties(ctx, []string{"config", "datastore", "resourcePool", "parent", "runtime"})
+				Expect(err).ToNot(HaveOccurred())
+
+				migrating, err := session.migrateVirtualMachine(vmCtx, resVM, moVM, nil, storageProfileID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(migrating).To(BeFalse())
+				Expect(vm.Annotations).To(HaveKeyWithValue(vmprovider.StorageClassAnnotationKey, "gold"))
+			})
+		})
+
+		It("migrates the VM storage to a datastore compatible with the storage profile", func() {
+			vm.Annotations = map[string]string{vmprovider.StorageClassAnnotationKey: "silver"}
+
+			run(func(ctx context.Context, session *Session, vmCtx VMContext, resVM *res.VirtualMachine, _ func() (bool, error)) {
+				moVM, err := resVM.GetProperties(ctx, []string{"config", "datastore", "resourcePool", "parent", "runtime"})
+				Expect(err).ToNot(HaveOccurred())
+
+				var relocateSpec vimTypes.VirtualMachineRelocateSpec
+				changed, err := session.storageRelocateSpec(vmCtx, session.defaultZone(), moVM, storageProfileID, &relocateSpec)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(changed).To(BeTrue())
+				Expect(relocateSpec.Datastore).ToNot(BeNil())
+				Expect(moVM.Datastore).To(ContainElement(*relocateSpec.Datastore))
+				Expect(relocateSpec.Profile).To(HaveLen(1))
+				Expect(relocateSpec.Disk).To(HaveLen(1))
+				Expect(relocateSpec.Disk[0].Profile).To(Equal(relocateSpec.Profile))
+
+				migrating, err := session.migrateVirtualMachine(vmCtx, resVM, moVM, nil, storageProfileID)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(migrating).To(BeTrue())
+				Expect(conditions.GetMessage(vm, vmprovider.VirtualMachineMigrationReadyCondition)).To(ContainSubstring("storage class gold"))
+
+				Eventually(func() bool {
+					migrating, err := session.migrateVirtualMachine(vmCtx, resVM, moVM, nil, storageProfileID)
+					Expect(err).ToNot(HaveOccurred())
+					return migrating
+				}).Should(BeFalse())
+				Expect(conditions.IsTrue(vm, vmprovider.VirtualMachineMigrationReadyCondition)).To(BeTrue())
+				Expect(vm.Annotations).To(HaveKeyWithValue(vmprovider.StorageClassAnnotationKey, "gold"))
+			})
+		})
+	})
+})
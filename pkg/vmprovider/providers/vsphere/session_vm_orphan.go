@@ -0,0 +1,99 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/view"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+// ListManagedVirtualMachines returns the VMs with the VM Operator annotation in the folder of the
+// session and the folders of its zones, including the child folders of resource policies.
+func (s *Session) ListManagedVirtualMachines(ctx context.Context) ([]vmprovider.ManagedVirtualMachine, error) {
+	var vms []vmprovider.ManagedVirtualMachine
+	seen := map[string]struct{}{}
+
+	for _, folder := range s.parentFolders() {
+		folderVMs, err := s.listManagedVirtualMachines(ctx, folder)
+		if err != nil {
+			return nil, err
+		}
+
+		// The folder of a zone may be nested in another folder.
+		for _, vm := range folderVMs {
+			if _, ok := seen[vm.UniqueID]; !ok {
+				seen[vm.UniqueID] = struct{}{}
+				vms = append(vms, vm)
+			}
+		}
+	}
+
+	return vms, nil
+}
+
+func (s *Session) listManagedVirtualMachines(ctx context.Context, folder *object.Folder) ([]vmprovider.ManagedVirtualMachine, error) {
+	m := view.NewManager(s.Client.VimClient())
+	v, err := m.CreateContainerView(ctx, folder.Reference(), []string{"VirtualMachine"}, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = v.Destroy(ctx)
+	}()
+
+	var moVMs []mo.VirtualMachine
+	if err := v.Retrieve(ctx, []string{"VirtualMachine"}, []string{"name", "config.annotation", "config.instanceUuid"}, &moVMs); err != nil {
+		return nil, err
+	}
+
+	var vms []vmprovider.ManagedVirtualMachine
+	for _, moVM := range moVMs {
+		if moVM.Config == nil || moVM.Config.Annotation != VCVMAnnotation {
+			continue
+		}
+		vms = append(vms, vmprovider.ManagedVirtualMachine{
+			Name:         moVM.Name,
+			UniqueID:     moVM.Self.Value,
+			InstanceUUID: moVM.Config.InstanceUuid,
+		})
+	}
+
+	return vms, nil
+}
+
+// DeleteManagedVirtualMachine powers off and deletes a VM returned by ListManagedVirtualMachines.
+// The VM is only deleted if it is still managed by VM Operator and has the same instance UUID.
+func (s *Session) DeleteManagedVirtualMachine(ctx context.Context, vm vmprovider.ManagedVirtualMachine) error {
+	resVM, err := s.lookupVMByMoID(ctx, vm.UniqueID)
+	if err != nil {
+		return err
+	}
+
+	moVM, err := resVM.GetProperties(ctx, []string{"config.annotation", "config.instanceUuid", "summary.runtime"})
+	if err != nil {
+		return err
+	}
+
+	if moVM.Config == nil || moVM.Config.Annotation != VCVMAnnotation || moVM.Config.InstanceUuid != vm.InstanceUUID {
+		return fmt.Errorf("VM %s is no longer the managed VM %s", vm.UniqueID, vm.Name)
+	}
+
+	if moVM.Summary.Runtime.PowerState != vimTypes.VirtualMachinePowerStatePoweredOff {
+		// There is no VirtualMachine with a power-off mode, so the VM is powered off hard.
+		if err := resVM.SetPowerState(ctx, v1alpha1.VirtualMachinePoweredOff); err != nil {
+			return err
+		}
+	}
+
+	return resVM.Delete(ctx)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi/pbm"
+	pbmTypes "github.com/vmware/govmomi/pbm/types"
+	"github.com/vmware/govmomi/vim25/mo"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+// getCandidateDatastores returns the datastores that DRS may place a VM on: the datastores of the
+// cluster that are compatible with the storage profile or, without a storage profile, the session's
+// datastore.
+func (s *Session) getCandidateDatastores(vmCtx VMCloneContext, storageProfileID string) ([]vimTypes.ManagedObjectReference, error) {
+	if storageProfileID == "" {
+		if s.datastore == nil {
+			return nil, nil
+		}
+		return []vimTypes.ManagedObjectReference{s.datastore.Reference()}, nil
+	}
+
+	if vmCtx.Cluster == nil {
+		return nil, nil
+	}
+
+	var cluster mo.ClusterComputeResource
+	if err := vmCtx.Cluster.Properties(vmCtx, vmCtx.Cluster.Reference(), []string{"datastore"}, &cluster); err != nil {
+		return nil, err
+	}
+
+	hubs := make([]pbmTypes.PbmPlacementHub, 0, len(cluster.Datastore))
+	for _, ds := range cluster.Datastore {
+		hubs = append(hubs, pbmTypes.PbmPlacementHub{HubType: ds.Type, HubId: ds.Value})
+	}
+
+	c, err := pbm.NewClient(vmCtx, s.Client.VimClient())
+	if err != nil {
+		return nil, err
+	}
+
+	requirements := []pbmTypes.BasePbmPlacementRequirement{
+		&pbmTypes.PbmPlacementCapabilityProfileRequirement{
+			ProfileId: pbmTypes.PbmProfileId{UniqueId: storageProfileID},
+		},
+	}
+	result, err := c.CheckRequirements(vmCtx, hubs, nil, requirements)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only keep the datastores of the cluster, in case the hubs that are not searched are returned.
+	clusterDatastores := make(map[string]struct{}, len(cluster.Datastore))
+	for _, ds := range cluster.Datastore {
+		clusterDatastores[ds.Value] = struct{}{}
+	}
+
+	var datastores []vimTypes.ManagedObjectReference
+	for _, hub := range result.CompatibleDatastores() {
+		if _, ok := clusterDatastores[hub.HubId]; ok {
+			datastores = append(datastores, vimTypes.ManagedObjectReference{Type: hub.HubType, Value: hub.HubId})
+		}
+	}
+
+	if len(datastores) == 0 {
+		return nil, &insufficientResourcesError{
+			faults: []string{fmt.Sprintf("no datastore of cluster %s is compatible with storage policy %s",
+				vmCtx.Cluster.Reference().Value, storageProfileID)},
+		}
+	}
+
+	return datastores, nil
+}
+
+// recommendCreatePlacement returns the host and datastore recommended by DRS for a VM deployed
+// from an OVF.
+func (s *Session) recommendCreatePlacement(
+	vmCtx VMCloneContext,
+	vmConfigArgs vmprovider.VmConfigArgs) (*placementRecommendation, error) {
+
+	configSpec := s.createConfigSpec(vmCtx.VM.Name, &vmConfigArgs.VmClass.Spec)
+	if vmConfigArgs.StorageProfileID != "" {
+		configSpec.VmProfile = []vimTypes.BaseVirtualMachineProfileSpec{
+			&vimTypes.VirtualMachineDefinedProfileSpec{ProfileId: vmConfigArgs.StorageProfileID},
+		}
+	}
+
+	relocateSpec := &vimTypes.VirtualMachineRelocateSpec{
+		Pool:   vimTypes.NewReference(vmCtx.ResourcePool.Reference()),
+		Folder: vimTypes.NewReference(vmCtx.Folder.Reference()),
+	}
+
+	return createVMRelocateSpec(vmCtx, vmCtx.Cluster, configSpec, relocateSpec, vmCtx.Datastores)
+}
+
+// markPlaced marks the VM as placed in its zone, if any, and on the host and datastore recommended
+// by DRS, if any, and reports the placement as an event.
+func markPlaced(vmCtx VMContext, rec *placementRecommendation) {
+	var placement []string
+	if zone := vmprovider.GetZone(vmCtx.VM); zone != "" {
+		placement = append(placement, "zone "+zone)
+	}
+	if rec != nil {
+		placement = append(placement,
+			"host "+rec.RelocateSpec.Host.Value,
+			"datastore "+rec.RelocateSpec.Datastore.Value)
+	}
+
+	if len(placement) == 0 {
+		return
+	}
+
+	message := strings.Join(placement, ", ")
+	if rec != nil && rec.Reason != "" {
+		message += fmt.Sprintf(" (%s)", rec.Reason)
+	}
+
+	conditions.Set(vmCtx.VM, &v1alpha1.Condition{
+		Type:    vmprovider.VirtualMachinePlacementReadyCondition,
+		Status:  corev1.ConditionTrue,
+		Message: message,
+	})
+
+	if rec != nil {
+		vmCtx.eventf(placedReason, "DRS placed the VM in %s", message)
+	} else {
+		vmCtx.eventf(placedReason, "Placed the VM in %s", message)
+	}
+}
+
+// markPlacementFailed marks the VM as not placed because of the error, and returns the error.
+func markPlacementFailed(vmCtx VMContext, err error) error {
+	reason := vmprovider.PlacementFailedReason
+	if _, ok := err.(*insufficientResourcesError); ok {
+		reason = vmprovider.InsufficientResourcesReason
+	}
+
+	conditions.MarkFalse(vmCtx.VM, vmprovider.VirtualMachinePlacementReadyCondition,
+		reason, v1alpha1.ConditionSeverityError, "%v", err)
+	vmCtx.warnf(reason, "Failed to place the VM: %v", err)
+
+	return err
+}
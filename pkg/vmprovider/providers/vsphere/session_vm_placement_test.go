@@ -0,0 +1,144 @@
+// +build !integration
+
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware/govmomi/object"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	clientgorecord "k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/record"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+var _ = Describe("Placement", func() {
+
+	var (
+		vm     *vmopv1alpha1.VirtualMachine
+		vmCtx  VMContext
+		events chan string
+	)
+
+	BeforeEach(func() {
+		vm = &vmopv1alpha1.VirtualMachine{}
+		fakeRecorder := clientgorecord.NewFakeRecorder(10)
+		events = fakeRecorder.Events
+		vmCtx = VMContext{
+			Context:  context.Background(),
+			Logger:   ctrl.Log.WithName("test"),
+			VM:       vm,
+			Recorder: record.New(fakeRecorder),
+		}
+	})
+
+	Context("markPlaced", func() {
+		rec := &placementRecommendation{
+			RelocateSpec: &vimTypes.VirtualMachineRelocateSpec{
+				Host:      &vimTypes.ManagedObjectReference{Type: "HostSystem", Value: "host-1"},
+				Datastore: &vimTypes.ManagedObjectReference{Type: "Datastore", Value: "datastore-1"},
+			},
+			Reason: "xvmotionPlacement",
+		}
+
+		It("reports the recommendation of DRS", func() {
+			markPlaced(vmCtx, rec)
+			Expect(conditions.IsTrue(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(BeTrue())
+			Expect(conditions.GetMessage(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(
+				Equal("host host-1, datastore datastore-1 (xvmotionPlacement)"))
+			Expect(events).To(Receive(HavePrefix("Normal " + placedReason)))
+		})
+
+		It("reports the zone of the VM", func() {
+			vm.Labels = map[string]string{vmprovider.ZoneLabelKey: "zone-a"}
+
+			markPlaced(vmCtx, rec)
+			Expect(conditions.GetMessage(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(
+				Equal("zone zone-a, host host-1, datastore datastore-1 (xvmotionPlacement)"))
+
+			markPlaced(vmCtx, nil)
+			Expect(conditions.GetMessage(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(Equal("zone zone-a"))
+			Expect(events).To(Receive(Equal("Normal " + placedReason + " DRS placed the VM in zone zone-a, host host-1, datastore datastore-1 (xvmotionPlacement)")))
+			Expect(events).To(Receive(Equal("Normal " + placedReason + " Placed the VM in zone zone-a")))
+		})
+
+		It("does not report anything without a zone or a recommendation", func() {
+			markPlaced(vmCtx, nil)
+			Expect(conditions.Has(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(BeFalse())
+			Expect(events).ToNot(Receive())
+		})
+	})
+
+	Context("markClusterModuleNotInZone", func() {
+		It("reports that the anti-affinity of the VM is not enforced once", func() {
+			z := &zone{
+				name:    "zone-b",
+				cluster: object.NewClusterComputeResource(nil, vimTypes.ManagedObjectReference{Type: "ClusterComputeResource", Value: "domain-c2"}),
+			}
+
+			markClusterModuleNotInZone(vmCtx, "web", z)
+			Expect(conditions.IsFalse(vm, vmprovider.VirtualMachineClusterModuleReadyCondition)).To(BeTrue())
+			Expect(conditions.GetReason(vm, vmprovider.VirtualMachineClusterModuleReadyCondition)).To(Equal(vmprovider.ClusterModuleNotInZoneReason))
+			Expect(conditions.GetMessage(vm, vmprovider.VirtualMachineClusterModuleReadyCondition)).To(
+				Equal("the VM is in cluster domain-c2 of zone zone-b, but ClusterModule web is in another cluster: its anti-affinity is not enforced"))
+			Expect(events).To(Receive(HavePrefix("Warning " + vmprovider.ClusterModuleNotInZoneReason)))
+
+			markClusterModuleNotInZone(vmCtx, "web", z)
+			Expect(events).ToNot(Receive())
+		})
+	})
+
+	Context("markPlacementFailed", func() {
+		It("reports insufficient resources", func() {
+			err := &insufficientResourcesError{faults: []string{"not enough memory"}}
+			Expect(markPlacementFailed(vmCtx, err)).To(Equal(err))
+			Expect(conditions.IsFalse(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(BeTrue())
+			Expect(conditions.GetReason(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(Equal(vmprovider.InsufficientResourcesReason))
+			Expect(conditions.GetMessage(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(
+				Equal("no valid placement action: not enough memory"))
+			Expect(events).To(Receive(HavePrefix("Warning " + vmprovider.InsufficientResourcesReason)))
+		})
+
+		It("reports other placement failures", func() {
+			Expect(markPlacementFailed(vmCtx, errors.New("boom"))).To(HaveOccurred())
+			Expect(conditions.GetReason(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(Equal(vmprovider.PlacementFailedReason))
+		})
+	})
+
+	Context("drsFaults", func() {
+		It("returns the faults of the VM", func() {
+			res := &vimTypes.PlacementResult{
+				DrsFault: &vimTypes.ClusterDrsFaults{
+					Reason: "placement",
+					FaultsByVm: []vimTypes.BaseClusterDrsFaultsFaultsByVm{
+						&vimTypes.ClusterDrsFaultsFaultsByVm{
+							Fault: []vimTypes.LocalizedMethodFault{
+								{LocalizedMessage: "not enough CPU"},
+								{LocalizedMessage: "not enough memory"},
+							},
+						},
+					},
+				},
+			}
+			Expect(drsFaults(res)).To(Equal([]string{"not enough CPU", "not enough memory"}))
+		})
+
+		It("returns the reason when the faults have no message", func() {
+			res := &vimTypes.PlacementResult{DrsFault: &vimTypes.ClusterDrsFaults{Reason: "placement"}}
+			Expect(drsFaults(res)).To(Equal([]string{"placement"}))
+			Expect(drsFaults(&vimTypes.PlacementResult{})).To(BeEmpty())
+		})
+	})
+})
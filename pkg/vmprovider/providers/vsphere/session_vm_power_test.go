@@ -0,0 +1,113 @@
+//go:build !integration
+// +build !integration
+
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	vimTypes "github.com/vmware/govmomi/vim25/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
+)
+
+var _ = Describe("powerOffVirtualMachine", func() {
+	var vm *vmopv1alpha1.VirtualMachine
+
+	BeforeEach(func() {
+		vm = &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-vm",
+				Namespace: "dummy-ns",
+			},
+		}
+	})
+
+	// powerOff powers off a powered on vcsim VM with VMware Tools running, and returns whether
+	// powerOffVirtualMachine reported it as powered off, and the power state of the VM.
+	powerOff := func() (bool, vimTypes.VirtualMachinePowerState) {
+		var (
+			poweredOff bool
+			powerState vimTypes.VirtualMachinePowerState
+		)
+
+		res := simulator.VPX().Run(func(ctx context.Context, c *vim25.Client) error {
+			vmObj, err := find.NewFinder(c).VirtualMachine(ctx, "DC0_C0_RP0_VM0")
+			Expect(err).ToNot(HaveOccurred())
+			svm := simulator.Map.Get(vmObj.Reference()).(*simulator.VirtualMachine)
+			svm.Guest.ToolsRunningStatus = string(vimTypes.VirtualMachineToolsRunningStatusGuestToolsRunning)
+
+			resVM, err := res.NewVMFromObject(vmObj)
+			Expect(err).ToNot(HaveOccurred())
+			vmCtx := VMContext{
+				Context: ctx,
+				Logger:  ctrl.Log.WithName("test"),
+				VM:      vm,
+			}
+
+			poweredOff, err = (&Session{}).powerOffVirtualMachine(vmCtx, resVM, nil)
+			Expect(err).ToNot(HaveOccurred())
+			if poweredOff {
+				powerState = svm.Runtime.PowerState
+			}
+			return nil
+		})
+		Expect(res).To(Succeed())
+
+		return poweredOff, powerState
+	}
+
+	It("hard powers off the VM", func() {
+		poweredOff, powerState := powerOff()
+		Expect(poweredOff).To(BeTrue())
+		Expect(powerState).To(Equal(vimTypes.VirtualMachinePowerStatePoweredOff))
+		Expect(vmprovider.IsPowerOffInProgress(vm)).To(BeFalse())
+	})
+
+	Context("with the TrySoft power-off mode", func() {
+		BeforeEach(func() {
+			vm.Annotations = map[string]string{
+				vmprovider.PowerOffModeAnnotationKey:    string(vmprovider.PowerOffModeTrySoft),
+				vmprovider.PowerOffTimeoutAnnotationKey: "5m",
+			}
+		})
+
+		It("shuts down the guest and records the power-off deadline without waiting", func() {
+			poweredOff, _ := powerOff()
+			Expect(poweredOff).To(BeFalse())
+			deadline, ok := vmprovider.GetPowerOffDeadline(vm)
+			Expect(ok).To(BeTrue())
+			Expect(deadline).To(BeTemporally("~", time.Now().Add(5*time.Minute), time.Minute))
+		})
+
+		It("waits for the guest until the power-off deadline", func() {
+			vmprovider.SetPowerOffDeadline(vm, time.Now().Add(time.Minute))
+			poweredOff, _ := powerOff()
+			Expect(poweredOff).To(BeFalse())
+			Expect(vmprovider.IsPowerOffInProgress(vm)).To(BeTrue())
+		})
+
+		It("hard powers off the VM once the power-off deadline has passed", func() {
+			vmprovider.SetPowerOffDeadline(vm, time.Now().Add(-time.Minute))
+			poweredOff, powerState := powerOff()
+			Expect(poweredOff).To(BeTrue())
+			Expect(powerState).To(Equal(vimTypes.VirtualMachinePowerStatePoweredOff))
+			Expect(vmprovider.IsPowerOffInProgress(vm)).To(BeFalse())
+		})
+	})
+})
@@ -1,20 +1,69 @@
 // +build !integration
 
-// Copyright (c) 2019 VMware, Inc. All Rights Reserved.
+// Copyright (c) 2019-2021 VMware, Inc. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package vsphere_test
 
 import (
+	"context"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
+	"github.com/vmware/govmomi/vim25/methods"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
 	vimTypes "github.com/vmware/govmomi/vim25/types"
 
 	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
 )
 
+// guestProcessManager simulates a program that exits with exitCode, or that
+// keeps running until it is terminated. vcsim does not implement the
+// GuestProcessManager methods.
+type guestProcessManager struct {
+	mo.GuestProcessManager
+	exitCode   int32
+	running    bool
+	spec       vimTypes.GuestProgramSpec
+	terminated []int64
+}
+
+func (m *guestProcessManager) StartProgramInGuest(req *vimTypes.StartProgramInGuest) soap.HasFault {
+	m.spec = *req.Spec.GetGuestProgramSpec()
+	return &methods.StartProgramInGuestBody{
+		Res: &vimTypes.StartProgramInGuestResponse{Returnval: 42},
+	}
+}
+
+func (m *guestProcessManager) ListProcessesInGuest(req *vimTypes.ListProcessesInGuest) soap.HasFault {
+	info := vimTypes.GuestProcessInfo{Pid: 42, ExitCode: m.exitCode}
+	if !m.running {
+		endTime := time.Now()
+		info.EndTime = &endTime
+	}
+	return &methods.ListProcessesInGuestBody{
+		Res: &vimTypes.ListProcessesInGuestResponse{
+			Returnval: []vimTypes.GuestProcessInfo{info},
+		},
+	}
+}
+
+func (m *guestProcessManager) TerminateProcessInGuest(req *vimTypes.TerminateProcessInGuest) soap.HasFault {
+	m.terminated = append(m.terminated, req.Pid)
+	m.running = false
+	return &methods.TerminateProcessInGuestBody{
+		Res: &vimTypes.TerminateProcessInGuestResponse{},
+	}
+}
+
 var _ = Describe("Session VM", func() {
 
 	Context("GetMergedvAppConfigSpec", func() {
@@ -79,4 +128,122 @@ var _ = Describe("Session VM", func() {
 			),
 		)
 	})
+
+	Context("RunGuestProgram", func() {
+		auth := &vimTypes.NamePasswordAuthentication{Username: "user", Password: "pass"}
+
+		var (
+			args    []string
+			running bool
+		)
+
+		BeforeEach(func() {
+			args = []string{"is-active", "nginx"}
+			running = false
+		})
+
+		runGuestProgram := func(toolsRunningStatus vimTypes.VirtualMachineToolsRunningStatus, exitCode int32) (int32, *guestProcessManager, error) {
+			var (
+				code int32
+				pm   *guestProcessManager
+				err  error
+			)
+
+			simulator.Test(func(ctx context.Context, c *vim25.Client) {
+				gom := simulator.Map.Get(*c.ServiceContent.GuestOperationsManager).(*simulator.GuestOperationsManager)
+				pm = &guestProcessManager{exitCode: exitCode, running: running}
+				pm.Self = *gom.ProcessManager
+				simulator.Map.Put(pm)
+
+				svm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+				svm.Guest.ToolsRunningStatus = string(toolsRunningStatus)
+
+				resVM, vmErr := res.NewVMFromObject(object.NewVirtualMachine(c, svm.Reference()))
+				Expect(vmErr).ToNot(HaveOccurred())
+
+				if running {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, 100*time.Millisecond)
+					defer cancel()
+				}
+				code, err = resVM.RunGuestProgram(ctx, auth, "/usr/bin/systemctl", args...)
+			})
+
+			return code, pm, err
+		}
+
+		It("returns the exit code of a successful program", func() {
+			exitCode, pm, err := runGuestProgram(vimTypes.VirtualMachineToolsRunningStatusGuestToolsRunning, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exitCode).To(BeZero())
+			Expect(pm.spec.ProgramPath).To(Equal("/usr/bin/systemctl"))
+			Expect(pm.spec.Arguments).To(Equal("is-active nginx"))
+		})
+
+		It("quotes the arguments of the program", func() {
+			args = []string{"-c", "echo 'it works'", ""}
+			_, pm, err := runGuestProgram(vimTypes.VirtualMachineToolsRunningStatusGuestToolsRunning, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pm.spec.Arguments).To(Equal(`-c 'echo '\''it works'\''' ''`))
+		})
+
+		It("terminates a program that does not exit in time", func() {
+			running = true
+			_, pm, err := runGuestProgram(vimTypes.VirtualMachineToolsRunningStatusGuestToolsRunning, 0)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(pm.terminated).To(ConsistOf(int64(42)))
+		})
+
+		It("returns a non-zero exit code", func() {
+			exitCode, _, err := runGuestProgram(vimTypes.VirtualMachineToolsRunningStatusGuestToolsRunning, 3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(exitCode).To(Equal(int32(3)))
+		})
+
+		It("returns an error when VMware Tools is not running", func() {
+			_, pm, err := runGuestProgram(vimTypes.VirtualMachineToolsRunningStatusGuestToolsNotRunning, 0)
+			Expect(err).To(MatchError(res.ErrGuestToolsNotRunning))
+			Expect(pm.spec.ProgramPath).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("ShutdownGuest", func() {
+
+	shutdownGuest := func(toolsRunningStatus vimTypes.VirtualMachineToolsRunningStatus) (vimTypes.VirtualMachinePowerState, error) {
+		var (
+			powerState vimTypes.VirtualMachinePowerState
+			err        error
+		)
+
+		simulator.Test(func(ctx context.Context, c *vim25.Client) {
+			svm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+			svm.Guest.ToolsRunningStatus = string(toolsRunningStatus)
+
+			resVM, vmErr := res.NewVMFromObject(object.NewVirtualMachine(c, svm.Reference()))
+			Expect(vmErr).ToNot(HaveOccurred())
+
+			if err = resVM.ShutdownGuest(ctx); err == nil {
+				waitCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				defer cancel()
+				Expect(resVM.WaitForPowerState(waitCtx, vimTypes.VirtualMachinePowerStatePoweredOff)).To(Succeed())
+			}
+
+			powerState = svm.Runtime.PowerState
+		})
+
+		return powerState, err
+	}
+
+	It("shuts down the guest", func() {
+		powerState, err := shutdownGuest(vimTypes.VirtualMachineToolsRunningStatusGuestToolsRunning)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(powerState).To(Equal(vimTypes.VirtualMachinePowerStatePoweredOff))
+	})
+
+	It("returns an error when VMware Tools is not running", func() {
+		powerState, err := shutdownGuest(vimTypes.VirtualMachineToolsRunningStatusGuestToolsNotRunning)
+		Expect(err).To(MatchError(res.ErrGuestToolsNotRunning))
+		Expect(powerState).To(Equal(vimTypes.VirtualMachinePowerStatePoweredOn))
+	})
 })
@@ -15,6 +15,7 @@ import (
 	"github.com/vmware/govmomi/task"
 	vimTypes "github.com/vmware/govmomi/vim25/types"
 	apiEquality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8serrors "k8s.io/apimachinery/pkg/util/errors"
 
 	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
@@ -550,7 +551,12 @@ func (s *Session) prePowerOnVMConfigSpec(
 	currentDisks := virtualDevices.SelectByType((*vimTypes.VirtualDisk)(nil))
 	currentEthCards := virtualDevices.SelectByType((*vimTypes.VirtualEthernetCard)(nil))
 
-	diskDeviceChanges, err := updateVirtualDiskDeviceChanges(vmCtx, currentDisks)
+	bootDiskCapacity, err := vmprovider.GetBootDiskCapacity(vmCtx.VM, &updateArgs.VmClass)
+	if err != nil {
+		return nil, err
+	}
+
+	diskDeviceChanges, err := updateVirtualDiskDeviceChanges(vmCtx, currentDisks, getEphemeralDisks(config), bootDiskCapacity)
 	if err != nil {
 		return nil, err
 	}
@@ -588,6 +594,12 @@ func (s *Session) prePowerOnVMReconfigure(
 		return err
 	}
 
+	// The disks of the vSphere volumes without a device key are created with the VM storage policy,
+	// and the disks of the removed ones are deleted.
+	if err := s.ephemeralDiskConfigSpec(vmCtx, config, updateArgs.StorageProfileID, configSpec); err != nil {
+		return err
+	}
+
 	defaultConfigSpec := &vimTypes.VirtualMachineConfigSpec{}
 	if !apiEquality.Semantic.DeepEqual(configSpec, defaultConfigSpec) {
 		vmCtx.Logger.Info("Pre PowerOn Reconfigure", "configSpec", configSpec)
@@ -780,11 +792,27 @@ func (s *Session) prepareVMForPowerOn(
 func (s *Session) poweredOnVMReconfigure(
 	vmCtx VMContext,
 	resVM *res.VirtualMachine,
-	config *vimTypes.VirtualMachineConfigInfo) error {
+	config *vimTypes.VirtualMachineConfigInfo,
+	storageProfileID string) error {
 
 	configSpec := &vimTypes.VirtualMachineConfigSpec{}
 	updateConfigSpecChangeBlockTracking(config, configSpec, vmCtx.VM.Spec)
 
+	// The disks of the vSphere volumes whose capacity was increased are hot-extended. The boot disk
+	// capacity only applies when the VM is deployed.
+	currentDisks := object.VirtualDeviceList(config.Hardware.Device).SelectByType((*vimTypes.VirtualDisk)(nil))
+	diskDeviceChanges, err := updateVirtualDiskDeviceChanges(vmCtx, currentDisks, getEphemeralDisks(config), nil)
+	if err != nil {
+		return err
+	}
+	configSpec.DeviceChange = append(configSpec.DeviceChange, diskDeviceChanges...)
+
+	// The disks of the added and removed vSphere volumes without a device key are hot-added and
+	// hot-removed.
+	if err := s.ephemeralDiskConfigSpec(vmCtx, config, storageProfileID, configSpec); err != nil {
+		return err
+	}
+
 	defaultConfigSpec := &vimTypes.VirtualMachineConfigSpec{}
 	if !apiEquality.Semantic.DeepEqual(configSpec, defaultConfigSpec) {
 		vmCtx.Logger.Info("PoweredOn Reconfigure", "configSpec", configSpec)
@@ -834,14 +862,26 @@ func (s *Session) attachTagsAndModules(
 
 	vmRef := resVM.MoRef()
 
-	isMember, err := s.IsVmMemberOfClusterModule(vmCtx, moduleUuid, vmRef)
+	// The ClusterModules are created in the session's cluster, so a VM in the cluster of another
+	// zone cannot be added to them.
+	z, err := s.getVMZone(vmCtx)
 	if err != nil {
 		return err
 	}
-	if !isMember {
-		if err := s.AddVmToClusterModule(vmCtx, moduleUuid, vmRef); err != nil {
+
+	if z.cluster != nil && s.cluster != nil && z.cluster.Reference() != s.cluster.Reference() {
+		markClusterModuleNotInZone(vmCtx, clusterModuleName, z)
+	} else {
+		isMember, err := s.IsVmMemberOfClusterModule(vmCtx, moduleUuid, vmRef)
+		if err != nil {
 			return err
 		}
+		if !isMember {
+			if err := s.AddVmToClusterModule(vmCtx, moduleUuid, vmRef); err != nil {
+				return err
+			}
+		}
+		conditions.MarkTrue(vmCtx.VM, vmprovider.VirtualMachineClusterModuleReadyCondition)
 	}
 
 	// Lookup the real tag name from config and attach to the VM.
@@ -854,6 +894,23 @@ func (s *Session) attachTagsAndModules(
 	return nil
 }
 
+// markClusterModuleNotInZone reports that the VM is not added to the cluster module of its resource
+// policy because it is placed in the cluster of another zone. It is only logged and reported as an
+// event the first time.
+func markClusterModuleNotInZone(vmCtx VMContext, clusterModuleName string, z *zone) {
+	if conditions.GetReason(vmCtx.VM, vmprovider.VirtualMachineClusterModuleReadyCondition) == vmprovider.ClusterModuleNotInZoneReason {
+		return
+	}
+
+	vmCtx.Logger.Info("Skipping ClusterModule of VM in the cluster of another zone",
+		"clusterModule", clusterModuleName, "zone", z.name, "cluster", z.cluster.Reference().Value)
+	conditions.MarkFalse(vmCtx.VM, vmprovider.VirtualMachineClusterModuleReadyCondition,
+		vmprovider.ClusterModuleNotInZoneReason, v1alpha1.ConditionSeverityWarning,
+		"the VM is in cluster %s of zone %s, but ClusterModule %s is in another cluster: its anti-affinity is not enforced",
+		z.cluster.Reference().Value, z.name, clusterModuleName)
+	vmCtx.warnf(vmprovider.ClusterModuleNotInZoneReason, "%s", conditions.GetMessage(vmCtx.VM, vmprovider.VirtualMachineClusterModuleReadyCondition))
+}
+
 func ipCIDRNotation(ipAddress string, prefix int32) string {
 	return ipAddress + "/" + strconv.Itoa(int(prefix))
 }
@@ -877,7 +934,7 @@ func (s *Session) updateVMStatus(
 
 	// TODO: We could be smarter about not re-fetching the config: if we didn't do a
 	// reconfigure or power change, the prior config is still entirely valid.
-	moVM, err := resVM.GetProperties(vmCtx, []string{"config.changeTrackingEnabled", "guest", "summary"})
+	moVM, err := resVM.GetProperties(vmCtx, []string{"config.changeTrackingEnabled", "config.hardware.device", "guest", "summary"})
 	if err != nil {
 		// Leave the current Status unchanged.
 		return err
@@ -930,6 +987,52 @@ func (s *Session) updateVMStatus(
 	return k8serrors.NewAggregate(errs)
 }
 
+// recordPowerOperation records the status of a power operation on the VM.
+func recordPowerOperation(vmCtx VMContext, operation vmprovider.PowerOperation, err error) {
+	status := vmprovider.GetLastPowerOperation(vmCtx.VM)
+	status.Operation = operation
+	status.Time = metav1.Now()
+	status.Error = ""
+	if err != nil {
+		status.Error = err.Error()
+	}
+	vmprovider.SetLastPowerOperation(vmCtx.VM, status)
+}
+
+// restartVirtualMachineIfRequested restarts the VM once for each new value of the restart-requested
+// annotation. The request is marked as handled before the restart so that a failed restart is not
+// retried. When restart is false the request is only marked as handled.
+func restartVirtualMachineIfRequested(vmCtx VMContext, resVM *res.VirtualMachine, restart bool) error {
+	if !vmprovider.IsRestartPending(vmCtx.VM) {
+		return nil
+	}
+
+	status := vmprovider.GetLastPowerOperation(vmCtx.VM)
+	status.RestartRequested = vmCtx.VM.Annotations[vmprovider.RestartRequestedAnnotationKey]
+	vmprovider.SetLastPowerOperation(vmCtx.VM, status)
+
+	if !restart {
+		vmCtx.Logger.Info("Ignoring restart request because the VM was not powered on")
+		return nil
+	}
+
+	restartType, err := vmprovider.GetRestartType(vmCtx.VM)
+	if err != nil {
+		vmCtx.Logger.Error(err, "Ignoring invalid restart request")
+		return nil
+	}
+
+	vmCtx.Logger.Info("Restarting VM", "restartType", restartType)
+	vmCtx.eventf(restartReason, "Restarting the VM with %s", restartType)
+
+	err = restartVirtualMachine(vmCtx, resVM, restartType)
+	recordPowerOperation(vmCtx, vmprovider.PowerOperation(restartType), err)
+	if err != nil {
+		vmCtx.warnf(restartFailedReason, "Failed to restart the VM with %s: %v", restartType, err)
+	}
+	return err
+}
+
 func (s *Session) UpdateVirtualMachine(
 	vmCtx VMContext,
 	vmConfigArgs vmprovider.VmConfigArgs) error {
@@ -939,20 +1042,51 @@ func (s *Session) UpdateVirtualMachine(
 		return err
 	}
 
-	moVM, err := resVM.GetProperties(vmCtx, []string{"config", "runtime"})
+	moVM, err := resVM.GetProperties(vmCtx, []string{"config", "datastore", "runtime", "resourcePool", "parent"})
 	if err != nil {
 		return err
 	}
 
 	isOff := moVM.Runtime.PowerState == vimTypes.VirtualMachinePowerStatePoweredOff
+	isSuspended := moVM.Runtime.PowerState == vimTypes.VirtualMachinePowerStateSuspended
 
 	// Update VMStatus with BiosUUID to unblock volume controller
 	vmCtx.VM.Status.BiosUUID = moVM.Config.Uuid
 
+	// The VM leaves the cluster modules and VM groups of its previous resource policy before it is
+	// migrated out of its resource pool.
+	if err := s.detachPreviousResourcePolicy(vmCtx, resVM); err != nil {
+		return err
+	}
+
+	migrating, err := s.migrateVirtualMachine(vmCtx, resVM, moVM, vmConfigArgs.ResourcePolicy, vmConfigArgs.StorageProfileID)
+	if err != nil {
+		return err
+	}
+	if migrating {
+		// The VM cannot be reconfigured nor change power state until the migration completes.
+		return s.updateVMStatus(vmCtx, resVM)
+	}
+
+	// The VM joins its groups before it is powered on, so that DRS places it on the hosts of their
+	// DRS VM-Host rules right away.
+	if err := s.updateVMGroupMembership(vmCtx, resVM, vmConfigArgs.ResourcePolicy, false); err != nil {
+		return err
+	}
+	setAttachedResourcePolicy(vmCtx.VM)
+
+	if isOff || vmCtx.VM.Spec.PowerState != v1alpha1.VirtualMachinePoweredOff {
+		// The guest shut down, or the VM no longer has to be powered off.
+		vmprovider.ClearPowerOffDeadline(vmCtx.VM)
+	}
+
 	switch vmCtx.VM.Spec.PowerState {
 	case v1alpha1.VirtualMachinePoweredOff:
 		if !isOff {
-			err := resVM.SetPowerState(vmCtx, v1alpha1.VirtualMachinePoweredOff)
+			poweredOff, err := s.powerOffVirtualMachine(vmCtx, resVM, &vmConfigArgs.VmClass)
+			if poweredOff || err != nil {
+				recordPowerOperation(vmCtx, vmprovider.PowerOperationPowerOff, err)
+			}
 			if err != nil {
 				return err
 			}
@@ -977,15 +1111,39 @@ func (s *Session) UpdateVirtualMachine(
 			}
 
 			err = resVM.SetPowerState(vmCtx, v1alpha1.VirtualMachinePoweredOn)
+			recordPowerOperation(vmCtx, vmprovider.PowerOperationPowerOn, err)
+			if err != nil {
+				return err
+			}
+		} else if isSuspended {
+			// A suspended VM cannot be reconfigured so it is resumed as is.
+			err := resVM.SetPowerState(vmCtx, v1alpha1.VirtualMachinePoweredOn)
+			recordPowerOperation(vmCtx, vmprovider.PowerOperationPowerOn, err)
 			if err != nil {
 				return err
 			}
 		} else {
-			err := s.poweredOnVMReconfigure(vmCtx, resVM, config)
+			err := s.poweredOnVMReconfigure(vmCtx, resVM, config, vmConfigArgs.StorageProfileID)
 			if err != nil {
 				return err
 			}
 		}
+
+	case vmprovider.VirtualMachineSuspended:
+		// Only a powered on VM can be suspended.
+		if moVM.Runtime.PowerState == vimTypes.VirtualMachinePowerStatePoweredOn {
+			err := resVM.Suspend(vmCtx)
+			recordPowerOperation(vmCtx, vmprovider.PowerOperationSuspend, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// A restart is only useful when the VM was already powered on and stays powered on.
+	wasPoweredOn := moVM.Runtime.PowerState == vimTypes.VirtualMachinePowerStatePoweredOn
+	if err := restartVirtualMachineIfRequested(vmCtx, resVM, wasPoweredOn && vmCtx.VM.Spec.PowerState == v1alpha1.VirtualMachinePoweredOn); err != nil {
+		return err
 	}
 
 	if err := s.updateVMStatus(vmCtx, resVM); err != nil {
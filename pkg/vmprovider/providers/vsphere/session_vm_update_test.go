@@ -13,6 +13,8 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25"
 	vimTypes "github.com/vmware/govmomi/vim25/types"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,6 +25,7 @@ import (
 	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
 	"github.com/vmware-tanzu/vm-operator/pkg/lib"
 	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+	res "github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere/resources"
 )
 
 var _ = Describe("Update ConfigSpec", func() {
@@ -1037,3 +1040,99 @@ var _ = Describe("Network Interfaces VM Status", func() {
 		})
 	})
 })
+
+var _ = Describe("Power operations", func() {
+
+	var vmCtx VMContext
+
+	BeforeEach(func() {
+		vm := &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "dummy-vm",
+				Namespace: "dummy-ns",
+			},
+		}
+		vmCtx = VMContext{
+			Context: context.Background(),
+			Logger:  log.WithValues("vmName", vm.NamespacedName()),
+			VM:      vm,
+		}
+	})
+
+	Context("restartVirtualMachineIfRequested", func() {
+		const requested = "2021-06-01T10:00:00Z"
+
+		restart := func(restart bool) []vimTypes.VirtualMachinePowerState {
+			var powerStates []vimTypes.VirtualMachinePowerState
+
+			simulator.Test(func(ctx context.Context, c *vim25.Client) {
+				svm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+				resVM, err := res.NewVMFromObject(object.NewVirtualMachine(c, svm.Reference()))
+				Expect(err).ToNot(HaveOccurred())
+
+				vmCtx.Context = ctx
+				for i := 0; i < 2; i++ {
+					Expect(restartVirtualMachineIfRequested(vmCtx, resVM, restart)).To(Succeed())
+					powerStates = append(powerStates, svm.Runtime.PowerState)
+				}
+			})
+
+			return powerStates
+		}
+
+		BeforeEach(func() {
+			vmCtx.VM.Annotations = map[string]string{
+				vmprovider.RestartRequestedAnnotationKey: requested,
+				vmprovider.RestartTypeAnnotationKey:      string(vmprovider.RestartTypePowerCycle),
+			}
+		})
+
+		It("restarts the VM once", func() {
+			powerStates := restart(true)
+			Expect(powerStates).To(ConsistOf(vimTypes.VirtualMachinePowerStatePoweredOn, vimTypes.VirtualMachinePowerStatePoweredOn))
+
+			status := vmprovider.GetLastPowerOperation(vmCtx.VM)
+			Expect(status.Operation).To(Equal(vmprovider.PowerOperationPowerCycle))
+			Expect(status.Error).To(BeEmpty())
+			Expect(status.RestartRequested).To(Equal(requested))
+			Expect(vmprovider.IsRestartPending(vmCtx.VM)).To(BeFalse())
+		})
+
+		It("only marks the request as handled when the VM must not be restarted", func() {
+			restart(false)
+
+			status := vmprovider.GetLastPowerOperation(vmCtx.VM)
+			Expect(status.Operation).To(BeEmpty())
+			Expect(status.RestartRequested).To(Equal(requested))
+		})
+
+		It("restarts the VM again for a new request", func() {
+			restart(true)
+			firstTime := vmprovider.GetLastPowerOperation(vmCtx.VM).Time
+
+			vmCtx.VM.Annotations[vmprovider.RestartRequestedAnnotationKey] = "2021-06-01T11:00:00Z"
+			Expect(vmprovider.IsRestartPending(vmCtx.VM)).To(BeTrue())
+			restart(true)
+
+			status := vmprovider.GetLastPowerOperation(vmCtx.VM)
+			Expect(status.RestartRequested).To(Equal("2021-06-01T11:00:00Z"))
+			Expect(status.Time.Before(&firstTime)).To(BeFalse())
+		})
+	})
+
+	Context("Suspend", func() {
+		It("suspends the VM", func() {
+			simulator.Test(func(ctx context.Context, c *vim25.Client) {
+				svm := simulator.Map.Any("VirtualMachine").(*simulator.VirtualMachine)
+				resVM, err := res.NewVMFromObject(object.NewVirtualMachine(c, svm.Reference()))
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(resVM.Suspend(ctx)).To(Succeed())
+				Expect(svm.Runtime.PowerState).To(Equal(vimTypes.VirtualMachinePowerStateSuspended))
+
+				recordPowerOperation(vmCtx, vmprovider.PowerOperationSuspend, nil)
+				Expect(vmprovider.GetLastPowerOperation(vmCtx.VM).Operation).To(Equal(vmprovider.PowerOperationSuspend))
+			})
+		})
+	})
+})
@@ -0,0 +1,231 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/object"
+	ctrlruntime "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+// zone is where the VMs of an availability zone are placed. The VMs without a zone are placed in
+// the cluster, resource pool and folder of the session.
+type zone struct {
+	name         string
+	cluster      *object.ClusterComputeResource
+	resourcePool *object.ResourcePool
+	folder       *object.Folder
+}
+
+func (s *Session) initZones(ctx context.Context, zoneConfigs map[string]ZoneConfig) error {
+	s.zones = make(map[string]*zone, len(zoneConfigs))
+	s.zonePlacements = map[string]string{}
+
+	for name, zoneConfig := range zoneConfigs {
+		z := &zone{name: name}
+
+		var err error
+		z.resourcePool, err = s.GetResourcePoolByMoID(ctx, zoneConfig.ResourcePool)
+		if err != nil {
+			return errors.Wrapf(err, "failed to init Resource Pool %q of zone %q", zoneConfig.ResourcePool, name)
+		}
+
+		if zoneConfig.Cluster != "" {
+			z.cluster, err = s.GetClusterByMoID(ctx, zoneConfig.Cluster)
+		} else {
+			z.cluster, err = GetResourcePoolOwner(ctx, z.resourcePool)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to init Cluster of zone %q", name)
+		}
+
+		z.folder, err = s.GetFolderByMoID(ctx, zoneConfig.Folder)
+		if err != nil {
+			return errors.Wrapf(err, "failed to init folder %q of zone %q", zoneConfig.Folder, name)
+		}
+
+		s.zones[name] = z
+	}
+
+	return nil
+}
+
+// defaultZone returns the placement of the VMs without a zone.
+func (s *Session) defaultZone() *zone {
+	return &zone{
+		cluster:      s.cluster,
+		resourcePool: s.resourcePool,
+		folder:       s.folder,
+	}
+}
+
+// sortedZones returns the default placement followed by the zones sorted by name.
+func (s *Session) sortedZones() []*zone {
+	names := make([]string, 0, len(s.zones))
+	for name := range s.zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	zones := []*zone{s.defaultZone()}
+	for _, name := range names {
+		zones = append(zones, s.zones[name])
+	}
+	return zones
+}
+
+// parentResourcePools returns the distinct resource pools of the default placement and the zones,
+// which are the parents of the child resource pools of the resource policies.
+func (s *Session) parentResourcePools() []*object.ResourcePool {
+	var resourcePools []*object.ResourcePool
+	seen := map[string]struct{}{}
+	for _, z := range s.sortedZones() {
+		if z.resourcePool == nil {
+			continue
+		}
+		if _, ok := seen[z.resourcePool.Reference().Value]; !ok {
+			seen[z.resourcePool.Reference().Value] = struct{}{}
+			resourcePools = append(resourcePools, z.resourcePool)
+		}
+	}
+	return resourcePools
+}
+
+// parentFolders returns the distinct folders of the default placement and the zones, which are the
+// parents of the child folders of the resource policies.
+func (s *Session) parentFolders() []*object.Folder {
+	var folders []*object.Folder
+	seen := map[string]struct{}{}
+	for _, z := range s.sortedZones() {
+		if z.folder == nil {
+			continue
+		}
+		if _, ok := seen[z.folder.Reference().Value]; !ok {
+			seen[z.folder.Reference().Value] = struct{}{}
+			folders = append(folders, z.folder)
+		}
+	}
+	return folders
+}
+
+// getVMZone returns the placement of an existing VM from its zone label.
+func (s *Session) getVMZone(vmCtx VMContext) (*zone, error) {
+	name := vmprovider.GetZone(vmCtx.VM)
+	if name == "" {
+		return s.defaultZone(), nil
+	}
+
+	z, ok := s.zones[name]
+	if !ok {
+		return nil, fmt.Errorf("zone %q does not exist in namespace %s", name, vmCtx.VM.Namespace)
+	}
+	return z, nil
+}
+
+// placeVM returns the placement of a VM being created. The VM is placed in the zone of its label if
+// it has one. Otherwise, if the namespace has zones and the VM has a resource policy, the VM is
+// placed in the zone with the fewest VMs of the resource policy, and the label is set to that zone.
+func (s *Session) placeVM(
+	vmCtx VMContext,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) (*zone, error) {
+
+	name := vmprovider.GetZone(vmCtx.VM)
+	if name == "" {
+		if len(s.zones) == 0 || resourcePolicy == nil {
+			return s.defaultZone(), nil
+		}
+
+		var err error
+		name, err = s.spreadVM(vmCtx, resourcePolicy)
+		if err != nil {
+			return nil, err
+		}
+
+		vmCtx.Logger.Info("Spreading VM to zone", "zone", name, "resourcePolicy", resourcePolicy.Name)
+		if vmCtx.VM.Labels == nil {
+			vmCtx.VM.Labels = map[string]string{}
+		}
+		vmCtx.VM.Labels[vmprovider.ZoneLabelKey] = name
+	}
+
+	z, ok := s.zones[name]
+	if !ok {
+		conditions.MarkFalse(vmCtx.VM, vmprovider.VirtualMachinePlacementReadyCondition,
+			vmprovider.ZoneNotFoundReason, v1alpha1.ConditionSeverityError,
+			"zone %s does not exist in namespace %s", name, vmCtx.VM.Namespace)
+		return nil, fmt.Errorf("zone %q does not exist in namespace %s", name, vmCtx.VM.Namespace)
+	}
+
+	return z, nil
+}
+
+// spreadVM returns the zone with the fewest VMs of the resource policy, the first zone by name on a
+// tie. The VMs that this session placed are counted even if their label is not updated yet, so
+// that the VMs of a resource policy created together are spread too.
+func (s *Session) spreadVM(
+	vmCtx VMContext,
+	resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) (string, error) {
+
+	vmList := &v1alpha1.VirtualMachineList{}
+	if err := s.k8sClient.List(vmCtx, vmList, ctrlruntime.InNamespace(vmCtx.VM.Namespace)); err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counts := make(map[string]int, len(s.zones))
+	for name := range s.zones {
+		counts[name] = 0
+	}
+
+	exists := make(map[string]struct{}, len(vmList.Items))
+	for i := range vmList.Items {
+		vm := &vmList.Items[i]
+		exists[vm.Name] = struct{}{}
+		if vm.Name == vmCtx.VM.Name || vm.Spec.ResourcePolicyName != resourcePolicy.Name {
+			continue
+		}
+
+		name := vmprovider.GetZone(vm)
+		if name == "" {
+			name = s.zonePlacements[vm.Name]
+		}
+		if _, ok := counts[name]; ok {
+			counts[name]++
+		}
+	}
+
+	// Forget the VMs that were deleted.
+	for name := range s.zonePlacements {
+		if _, ok := exists[name]; !ok {
+			delete(s.zonePlacements, name)
+		}
+	}
+
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	chosen := names[0]
+	for _, name := range names[1:] {
+		if counts[name] < counts[chosen] {
+			chosen = name
+		}
+	}
+
+	s.zonePlacements[vmCtx.VM.Name] = chosen
+	return chosen, nil
+}
@@ -0,0 +1,158 @@
+// +build !integration
+
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vsphere
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	vmopv1alpha1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+
+	"github.com/vmware-tanzu/vm-operator/pkg/conditions"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
+)
+
+var _ = Describe("Zones", func() {
+	const (
+		namespace  = "dummy-ns"
+		policyName = "dummy-policy"
+	)
+
+	var (
+		initObjects    []runtime.Object
+		session        *Session
+		vm             *vmopv1alpha1.VirtualMachine
+		resourcePolicy *vmopv1alpha1.VirtualMachineSetResourcePolicy
+	)
+
+	newVM := func(name, zone string) *vmopv1alpha1.VirtualMachine {
+		vm := &vmopv1alpha1.VirtualMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: vmopv1alpha1.VirtualMachineSpec{
+				ResourcePolicyName: policyName,
+			},
+		}
+		if zone != "" {
+			vm.Labels = map[string]string{vmprovider.ZoneLabelKey: zone}
+		}
+		return vm
+	}
+
+	placeVM := func(vm *vmopv1alpha1.VirtualMachine) (*zone, error) {
+		vmCtx := VMContext{
+			Context: context.Background(),
+			Logger:  ctrl.Log.WithName("test"),
+			VM:      vm,
+		}
+		return session.placeVM(vmCtx, resourcePolicy)
+	}
+
+	BeforeEach(func() {
+		initObjects = nil
+		vm = newVM("dummy-vm", "")
+		resourcePolicy = &vmopv1alpha1.VirtualMachineSetResourcePolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      policyName,
+				Namespace: namespace,
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(vmopv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+		session = &Session{
+			k8sClient: clientfake.NewFakeClientWithScheme(scheme, initObjects...),
+			zones: map[string]*zone{
+				"zone-a": {name: "zone-a"},
+				"zone-b": {name: "zone-b"},
+				"zone-c": {name: "zone-c"},
+			},
+			zonePlacements: map[string]string{},
+		}
+	})
+
+	Context("placeVM", func() {
+		It("places the VM in the requested zone", func() {
+			vm.Labels = map[string]string{vmprovider.ZoneLabelKey: "zone-b"}
+
+			z, err := placeVM(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(z.name).To(Equal("zone-b"))
+		})
+
+		It("returns an error if the requested zone does not exist", func() {
+			vm.Labels = map[string]string{vmprovider.ZoneLabelKey: "zone-z"}
+
+			_, err := placeVM(vm)
+			Expect(err).To(HaveOccurred())
+			Expect(conditions.IsFalse(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(BeTrue())
+			Expect(conditions.GetReason(vm, vmprovider.VirtualMachinePlacementReadyCondition)).To(Equal(vmprovider.ZoneNotFoundReason))
+		})
+
+		It("uses the default placement for a VM without a resource policy", func() {
+			resourcePolicy = nil
+
+			z, err := placeVM(vm)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(z.name).To(BeEmpty())
+			Expect(vm.Labels).ToNot(HaveKey(vmprovider.ZoneLabelKey))
+		})
+
+		When("the resource policy has VMs in the zones", func() {
+			BeforeEach(func() {
+				otherVM := func(name string) *vmopv1alpha1.VirtualMachine {
+					vm := newVM(name, "zone-c")
+					vm.Spec.ResourcePolicyName = "other-policy"
+					return vm
+				}
+				initObjects = append(initObjects,
+					newVM("vm-1", "zone-a"),
+					newVM("vm-2", "zone-b"),
+					newVM("vm-3", "zone-a"),
+					otherVM("other-vm-1"),
+					otherVM("other-vm-2"),
+				)
+			})
+
+			It("spreads the VM to the zone with the fewest VMs of the resource policy", func() {
+				z, err := placeVM(vm)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(z.name).To(Equal("zone-c"))
+				Expect(vmprovider.GetZone(vm)).To(Equal("zone-c"))
+			})
+		})
+
+		When("VMs of the resource policy are placed before their label is updated", func() {
+			BeforeEach(func() {
+				initObjects = append(initObjects, newVM("vm-1", ""), newVM("vm-2", ""), newVM("vm-3", ""))
+			})
+
+			It("spreads the VMs across the zones", func() {
+				for _, name := range []string{"vm-1", "vm-2", "vm-3"} {
+					_, err := placeVM(newVM(name, ""))
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(session.zonePlacements).To(Equal(map[string]string{
+					"vm-1": "zone-a",
+					"vm-2": "zone-b",
+					"vm-3": "zone-c",
+				}))
+			})
+		})
+	})
+})
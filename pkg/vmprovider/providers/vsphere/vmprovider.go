@@ -16,6 +16,7 @@ import (
 	"github.com/vmware/govmomi/vapi/library"
 	vimtypes "github.com/vmware/govmomi/vim25/types"
 
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -164,12 +165,46 @@ func (vs *vSphereVmProvider) CreateVirtualMachine(ctx context.Context, vm *v1alp
 	return nil
 }
 
+func (vs *vSphereVmProvider) ImportVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error {
+	vmCtx := VMContext{
+		Context:  context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "import")),
+		Logger:   log.WithValues("vmName", vm.NamespacedName()),
+		VM:       vm,
+		Recorder: vs.eventRecorder,
+	}
+
+	vmCtx.Logger.Info("Importing VirtualMachine")
+
+	ses, err := vs.sessions.GetSession(vmCtx, vm.Namespace)
+	if err != nil {
+		return err
+	}
+
+	resVM, err := ses.ImportVirtualMachine(vmCtx, vmConfigArgs)
+	if err != nil {
+		vmCtx.Logger.Error(err, "Import VirtualMachine failed")
+		return err
+	}
+	if resVM == nil {
+		// The VM is adopted once the back-filled spec of the VirtualMachine has been persisted.
+		return nil
+	}
+
+	// Like CreateVirtualMachine, the controller will immediately call UpdateVirtualMachine() which
+	// will set the rest of the Status.
+	vm.Status.Phase = v1alpha1.Created
+	vm.Status.UniqueID = resVM.MoRef().Value
+
+	return nil
+}
+
 // UpdateVirtualMachine updates the VM status, power state, phase etc
 func (vs *vSphereVmProvider) UpdateVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, vmConfigArgs vmprovider.VmConfigArgs) error {
 	vmCtx := VMContext{
-		Context: context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "update")),
-		Logger:  log.WithValues("vmName", vm.NamespacedName()),
-		VM:      vm,
+		Context:  context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "update")),
+		Logger:   log.WithValues("vmName", vm.NamespacedName()),
+		VM:       vm,
+		Recorder: vs.eventRecorder,
 	}
 
 	vmCtx.Logger.V(4).Info("Updating VirtualMachine")
@@ -189,9 +224,10 @@ func (vs *vSphereVmProvider) UpdateVirtualMachine(ctx context.Context, vm *v1alp
 
 func (vs *vSphereVmProvider) DeleteVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine) error {
 	vmCtx := VMContext{
-		Context: context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "delete")),
-		Logger:  log.WithValues("vmName", vm.NamespacedName()),
-		VM:      vm,
+		Context:  context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "delete")),
+		Logger:   log.WithValues("vmName", vm.NamespacedName()),
+		VM:       vm,
+		Recorder: vs.eventRecorder,
 	}
 
 	vmCtx.Logger.Info("Deleting VirtualMachine")
@@ -210,6 +246,30 @@ func (vs *vSphereVmProvider) DeleteVirtualMachine(ctx context.Context, vm *v1alp
 	return nil
 }
 
+func (vs *vSphereVmProvider) RetainVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine) error {
+	vmCtx := VMContext{
+		Context:  context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "retain")),
+		Logger:   log.WithValues("vmName", vm.NamespacedName()),
+		VM:       vm,
+		Recorder: vs.eventRecorder,
+	}
+
+	vmCtx.Logger.Info("Retaining VirtualMachine")
+
+	ses, err := vs.sessions.GetSession(ctx, vmCtx.VM.Namespace)
+	if err != nil {
+		return err
+	}
+
+	err = ses.RetainVirtualMachine(vmCtx)
+	if err != nil {
+		vmCtx.Logger.Error(err, "Failed to retain VM")
+		return err
+	}
+
+	return nil
+}
+
 func (vs *vSphereVmProvider) GetVirtualMachineGuestHeartbeat(ctx context.Context, vm *v1alpha1.VirtualMachine) (v1alpha1.GuestHeartbeatStatus, error) {
 	vmCtx := VMContext{
 		Context: context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "heartbeat")),
@@ -230,6 +290,112 @@ func (vs *vSphereVmProvider) GetVirtualMachineGuestHeartbeat(ctx context.Context
 	return status, nil
 }
 
+func (vs *vSphereVmProvider) GetVirtualMachineGuestHeartbeats(ctx context.Context, vms []*v1alpha1.VirtualMachine) (map[string]v1alpha1.GuestHeartbeatStatus, error) {
+	// Sessions are per namespace, so fetch the heartbeats of the VMs of each namespace together.
+	vmsByNamespace := map[string][]*v1alpha1.VirtualMachine{}
+	for _, vm := range vms {
+		vmsByNamespace[vm.Namespace] = append(vmsByNamespace[vm.Namespace], vm)
+	}
+
+	heartbeats := make(map[string]v1alpha1.GuestHeartbeatStatus, len(vms))
+	for namespace, nsVMs := range vmsByNamespace {
+		ses, err := vs.sessions.GetSession(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		opCtx := context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, nsVMs[0], "heartbeats"))
+		for name, heartbeat := range ses.GetVirtualMachineGuestHeartbeats(opCtx, nsVMs) {
+			heartbeats[name] = heartbeat
+		}
+	}
+
+	return heartbeats, nil
+}
+
+func (vs *vSphereVmProvider) RunVirtualMachineGuestProgram(ctx context.Context, vm *v1alpha1.VirtualMachine, program vmprovider.GuestProgram) (int32, error) {
+	vmCtx := VMContext{
+		Context: context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "guestProgram")),
+		Logger:  log.WithValues("vmName", vm.NamespacedName()),
+		VM:      vm,
+	}
+
+	ses, err := vs.sessions.GetSession(ctx, vmCtx.VM.Namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	return ses.RunVirtualMachineGuestProgram(vmCtx, program)
+}
+
+func (vs *vSphereVmProvider) RestartVirtualMachine(ctx context.Context, vm *v1alpha1.VirtualMachine, restartType vmprovider.RestartType) error {
+	vmCtx := VMContext{
+		Context: context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "restart")),
+		Logger:  log.WithValues("vmName", vm.NamespacedName()),
+		VM:      vm,
+	}
+
+	ses, err := vs.sessions.GetSession(ctx, vmCtx.VM.Namespace)
+	if err != nil {
+		return err
+	}
+
+	return ses.RestartVirtualMachine(vmCtx, restartType)
+}
+
+func (vs *vSphereVmProvider) GetVirtualMachineVolumeDevices(ctx context.Context, vm *v1alpha1.VirtualMachine) (map[string]vmprovider.VolumeDevice, error) {
+	vmCtx := VMContext{
+		Context: context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, vm, "volumeDevices")),
+		Logger:  log.WithValues("vmName", vm.NamespacedName()),
+		VM:      vm,
+	}
+
+	ses, err := vs.sessions.GetSession(ctx, vmCtx.VM.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return ses.GetVirtualMachineVolumeDevices(vmCtx)
+}
+
+func (vs *vSphereVmProvider) ListManagedVirtualMachines(ctx context.Context, namespace string) ([]vmprovider.ManagedVirtualMachine, error) {
+	// Without the namespace annotations, the session of the namespace uses the folder of the provider
+	// config that is not specific to the namespace.
+	ns := &corev1.Namespace{}
+	if err := vs.sessions.k8sClient.Get(ctx, ctrlruntime.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, err
+	}
+	if ns.Annotations[NamespaceRPAnnotationKey] == "" || ns.Annotations[NamespaceFolderAnnotationKey] == "" {
+		return nil, nil
+	}
+
+	ses, err := vs.sessions.GetSession(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return ses.ListManagedVirtualMachines(ctx)
+}
+
+func (vs *vSphereVmProvider) DeleteManagedVirtualMachine(ctx context.Context, namespace string, vm vmprovider.ManagedVirtualMachine) error {
+	opVM := &v1alpha1.VirtualMachine{ObjectMeta: metav1.ObjectMeta{Name: vm.Name, Namespace: namespace}}
+	ctx = context.WithValue(ctx, vimtypes.ID{}, vs.getOpId(ctx, opVM, "gc"))
+
+	log.Info("Deleting orphaned VM", "namespace", namespace, "name", vm.Name, "uniqueID", vm.UniqueID)
+
+	ses, err := vs.sessions.GetSession(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	if err := ses.DeleteManagedVirtualMachine(ctx, vm); err != nil {
+		log.Error(err, "Failed to delete orphaned VM", "namespace", namespace, "name", vm.Name, "uniqueID", vm.UniqueID)
+		return err
+	}
+
+	return nil
+}
+
 func (vs *vSphereVmProvider) ComputeClusterCpuMinFrequency(ctx context.Context) error {
 
 	if err := vs.sessions.ComputeClusterCpuMinFrequency(ctx); err != nil {
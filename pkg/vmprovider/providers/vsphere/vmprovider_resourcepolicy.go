@@ -9,6 +9,7 @@ import (
 	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
 	"github.com/vmware-tanzu/vm-operator/pkg/lib"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 )
 
 // DoesVirtualMachineSetResourcePolicyExist checks if the entities of a VirtualMachineSetResourcePolicy exist on vSphere
@@ -49,15 +50,34 @@ func (vs *vSphereVmProvider) CreateOrUpdateVirtualMachineSetResourcePolicy(ctx c
 	}
 
 	if !rpExists {
-		if _, err = ses.CreateResourcePool(ctx, &resourcePolicy.Spec.ResourcePool); err != nil {
-			return err
-		}
-	} else {
-		if err = ses.UpdateResourcePool(ctx, &resourcePolicy.Spec.ResourcePool); err != nil {
+		_, createdParents, err := ses.createResourcePool(ctx, &resourcePolicy.Spec.ResourcePool)
+		addResourcePoolCreatedParents(resourcePolicy, createdParents)
+		if err != nil {
 			return err
 		}
 	}
 
+	cpuShares, memoryShares, err := vmprovider.GetResourcePoolShares(resourcePolicy)
+	if err != nil {
+		return err
+	}
+
+	rpSpec := &resourcePolicy.Spec.ResourcePool
+	applied := vmprovider.GetResourcePoolAppliedAllocation(resourcePolicy)
+	if err = ses.UpdateResourcePool(ctx, rpSpec, applied, cpuShares, memoryShares); err != nil {
+		return err
+	}
+	vmprovider.SetResourcePoolAppliedAllocation(resourcePolicy, vmprovider.ResourcePoolAllocation{
+		Reservations: rpSpec.Reservations,
+		Limits:       rpSpec.Limits,
+	})
+
+	rpStatus, err := ses.GetResourcePoolStatus(ctx, resourcePolicy.Spec.ResourcePool.Name)
+	if err != nil {
+		return err
+	}
+	vmprovider.SetResourcePoolStatus(resourcePolicy, rpStatus)
+
 	folderExists, err := ses.DoesFolderExist(ctx, resourcePolicy.Spec.Folder.Name)
 	if err != nil {
 		return err
@@ -80,6 +100,10 @@ func (vs *vSphereVmProvider) CreateOrUpdateVirtualMachineSetResourcePolicy(ctx c
 		}
 	}
 
+	if err = ses.reconcileVMGroups(ctx, resourcePolicy); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -90,9 +114,11 @@ func (vs *vSphereVmProvider) DeleteVirtualMachineSetResourcePolicy(ctx context.C
 		return err
 	}
 
-	if err = ses.DeleteResourcePool(ctx, resourcePolicy.Spec.ResourcePool.Name); err != nil {
+	createdParents := vmprovider.GetResourcePoolCreatedParents(resourcePolicy)
+	if err = ses.deleteResourcePool(ctx, resourcePolicy.Spec.ResourcePool.Name, createdParents); err != nil {
 		return err
 	}
+	vmprovider.SetResourcePoolCreatedParents(resourcePolicy, nil)
 
 	if err = ses.DeleteFolder(ctx, resourcePolicy.Spec.Folder.Name); err != nil {
 		return err
@@ -102,9 +128,27 @@ func (vs *vSphereVmProvider) DeleteVirtualMachineSetResourcePolicy(ctx context.C
 		return err
 	}
 
+	if err = ses.deleteVMGroups(ctx, resourcePolicy); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// addResourcePoolCreatedParents records the parent resource pools created for the resource pool of
+// the resource policy with the ones created before.
+func addResourcePoolCreatedParents(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy, createdParents map[string][]string) {
+	if len(createdParents) == 0 {
+		return
+	}
+
+	parents := vmprovider.GetResourcePoolCreatedParents(resourcePolicy)
+	for parentID, paths := range createdParents {
+		parents[parentID] = append(parents[parentID], paths...)
+	}
+	vmprovider.SetResourcePoolCreatedParents(resourcePolicy, parents)
+}
+
 // A helper function to check whether a given clusterModule has been created, and exists in VC.
 func isClusterModulePresent(ctx context.Context, session *Session, moduleSpec v1alpha1.ClusterModuleSpec, moduleStatuses []v1alpha1.ClusterModuleStatus) (bool, error) {
 	for _, module := range moduleStatuses {
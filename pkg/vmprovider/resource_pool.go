@@ -0,0 +1,247 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// ResourcePoolCPUSharesAnnotationKey is the VirtualMachineSetResourcePolicy annotation with the
+	// CPU shares of the resource pool: Low, Normal, High or a custom number of shares. The shares
+	// are left as is when it is absent, which is Normal for a new resource pool.
+	ResourcePoolCPUSharesAnnotationKey = "vmoperator.vmware.com/resource-pool-cpu-shares"
+
+	// ResourcePoolMemorySharesAnnotationKey is the VirtualMachineSetResourcePolicy annotation with
+	// the memory shares of the resource pool: Low, Normal, High or a custom number of shares. The
+	// shares are left as is when it is absent, which is Normal for a new resource pool.
+	ResourcePoolMemorySharesAnnotationKey = "vmoperator.vmware.com/resource-pool-memory-shares"
+
+	// ResourcePoolStatusAnnotationKey is the VirtualMachineSetResourcePolicy annotation with the
+	// JSON encoded list of ResourcePoolStatus of the resource pools of the resource policy. It is
+	// set by VM Operator.
+	ResourcePoolStatusAnnotationKey = "vmoperator.vmware.com/resource-pool-status"
+
+	// ResourcePoolCreatedParentsAnnotationKey is the VirtualMachineSetResourcePolicy annotation with
+	// the JSON encoded paths of the parent resource pools that VM Operator created for the nested
+	// resource pool of the resource policy, by MoID of the resource pool they were created under.
+	// They are deleted with the resource pool of the resource policy if they are empty. It is set by
+	// VM Operator, and the webhook denies the changes made by other users.
+	ResourcePoolCreatedParentsAnnotationKey = "vmoperator.vmware.com/resource-pool-created-parents"
+
+	// ResourcePoolAppliedAllocationAnnotationKey is the VirtualMachineSetResourcePolicy annotation
+	// with the JSON encoded ResourcePoolAllocation of the reservations and limits of the spec that
+	// were last applied to the resource pool. A reservation or limit that is removed from the spec is
+	// reset to no reservation or no limit, while the ones that were never specified are left as is.
+	// It is set by VM Operator, and the webhook denies the changes made by other users.
+	ResourcePoolAppliedAllocationAnnotationKey = "vmoperator.vmware.com/resource-pool-applied-allocation"
+
+	// ResourcePoolPathSeparator separates the names of the nested resource pools in the name of
+	// the resource pool of a resource policy, such as "tenant/web". The parent resource pools that
+	// do not exist are created with the default allocation.
+	ResourcePoolPathSeparator = "/"
+)
+
+// SharesLevel is the relative priority of a resource pool over its siblings.
+type SharesLevel string
+
+const (
+	// SharesLevelLow is half the shares of the Normal level.
+	SharesLevelLow SharesLevel = "Low"
+	// SharesLevelNormal is the default level.
+	SharesLevelNormal SharesLevel = "Normal"
+	// SharesLevelHigh is twice the shares of the Normal level.
+	SharesLevelHigh SharesLevel = "High"
+	// SharesLevelCustom is an explicit number of shares.
+	SharesLevelCustom SharesLevel = "Custom"
+)
+
+// Shares are the CPU or memory shares of a resource pool.
+type Shares struct {
+	Level SharesLevel
+	// Shares is the number of shares of the Custom level.
+	Shares int32
+}
+
+// ResourcePoolAllocation is the reservations and limits of the spec of a resource pool of a
+// resource policy.
+type ResourcePoolAllocation struct {
+	Reservations v1alpha1.VirtualMachineResourceSpec `json:"reservations,omitempty"`
+	Limits       v1alpha1.VirtualMachineResourceSpec `json:"limits,omitempty"`
+}
+
+// ResourcePoolStatus is the observed allocation and utilization of a resource pool of a resource
+// policy.
+type ResourcePoolStatus struct {
+	// Zone is the availability zone of the resource pool, or empty for the resource pool of the VMs
+	// without a zone.
+	Zone string `json:"zone,omitempty"`
+
+	// CPU is the CPU allocation and utilization, in MHz.
+	CPU ResourcePoolAllocationStatus `json:"cpu"`
+
+	// Memory is the memory allocation and utilization, in MB.
+	Memory ResourcePoolAllocationStatus `json:"memory"`
+
+	// OverallStatus is the overall health of the resource pool reported by vSphere: green, yellow,
+	// red or gray.
+	OverallStatus string `json:"overallStatus,omitempty"`
+}
+
+// ResourcePoolAllocationStatus is the CPU or memory allocation and utilization of a resource pool.
+type ResourcePoolAllocationStatus struct {
+	// Reservation is the amount of the resource guaranteed to the resource pool.
+	Reservation int64 `json:"reservation"`
+
+	// Limit is the maximum amount of the resource the resource pool can use, or -1 if unlimited.
+	Limit int64 `json:"limit"`
+
+	// SharesLevel and Shares are the effective shares of the resource pool.
+	SharesLevel string `json:"sharesLevel,omitempty"`
+	Shares      int32  `json:"shares"`
+
+	// ReservationUsed is the amount of the reservation used by the VMs and child resource pools.
+	ReservationUsed int64 `json:"reservationUsed"`
+
+	// Usage is the amount of the resource used by the running VMs of the resource pool.
+	Usage int64 `json:"usage"`
+}
+
+// GetResourcePoolPath returns the names of the nested resource pools of the resource pool name,
+// from the outermost to the resource pool itself.
+func GetResourcePoolPath(name string) []string {
+	return strings.Split(name, ResourcePoolPathSeparator)
+}
+
+// ValidateResourcePoolName returns an error if the name of a resource pool of a resource policy has
+// an empty nested resource pool name.
+func ValidateResourcePoolName(name string) error {
+	for _, n := range GetResourcePoolPath(name) {
+		if strings.TrimSpace(n) == "" {
+			return fmt.Errorf("resource pool name %q must not have an empty nested resource pool name", name)
+		}
+	}
+	return nil
+}
+
+// GetResourcePoolShares returns the CPU and memory shares of the resource pool of the resource
+// policy, or an error if they are not valid. The shares have an empty level when the annotation is
+// absent, and are then left as is.
+func GetResourcePoolShares(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) (cpu, memory Shares, err error) {
+	if cpu, err = parseShares(resourcePolicy.Annotations, ResourcePoolCPUSharesAnnotationKey); err != nil {
+		return
+	}
+	memory, err = parseShares(resourcePolicy.Annotations, ResourcePoolMemorySharesAnnotationKey)
+	return
+}
+
+func parseShares(annotations map[string]string, key string) (Shares, error) {
+	value, ok := annotations[key]
+	if !ok {
+		return Shares{}, nil
+	}
+
+	switch level := SharesLevel(value); level {
+	case SharesLevelLow, SharesLevelNormal, SharesLevelHigh:
+		return Shares{Level: level}, nil
+	}
+
+	shares, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || shares <= 0 {
+		return Shares{}, fmt.Errorf("invalid %s annotation %q: must be %s, %s, %s or a positive number of shares",
+			key, value, SharesLevelLow, SharesLevelNormal, SharesLevelHigh)
+	}
+	return Shares{Level: SharesLevelCustom, Shares: int32(shares)}, nil
+}
+
+// GetResourcePoolStatus returns the status of the resource pools of the resource policy. It is
+// empty if the annotation is absent or cannot be decoded.
+func GetResourcePoolStatus(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) []ResourcePoolStatus {
+	var status []ResourcePoolStatus
+	if value, ok := resourcePolicy.Annotations[ResourcePoolStatusAnnotationKey]; ok {
+		_ = json.Unmarshal([]byte(value), &status)
+	}
+	return status
+}
+
+// SetResourcePoolStatus records the status of the resource pools of the resource policy.
+func SetResourcePoolStatus(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy, status []ResourcePoolStatus) {
+	if len(status) == 0 {
+		delete(resourcePolicy.Annotations, ResourcePoolStatusAnnotationKey)
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if resourcePolicy.Annotations == nil {
+		resourcePolicy.Annotations = map[string]string{}
+	}
+	resourcePolicy.Annotations[ResourcePoolStatusAnnotationKey] = string(data)
+}
+
+// GetResourcePoolCreatedParents returns the paths of the parent resource pools that VM Operator
+// created for the resource pool of the resource policy, by MoID of the resource pool they were
+// created under. It is empty if the annotation is absent or cannot be decoded.
+func GetResourcePoolCreatedParents(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) map[string][]string {
+	parents := map[string][]string{}
+	if value, ok := resourcePolicy.Annotations[ResourcePoolCreatedParentsAnnotationKey]; ok {
+		_ = json.Unmarshal([]byte(value), &parents)
+	}
+	return parents
+}
+
+// SetResourcePoolCreatedParents records the paths of the parent resource pools that VM Operator
+// created for the resource pool of the resource policy.
+func SetResourcePoolCreatedParents(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy, parents map[string][]string) {
+	if len(parents) == 0 {
+		delete(resourcePolicy.Annotations, ResourcePoolCreatedParentsAnnotationKey)
+		return
+	}
+
+	data, err := json.Marshal(parents)
+	if err != nil {
+		return
+	}
+	if resourcePolicy.Annotations == nil {
+		resourcePolicy.Annotations = map[string]string{}
+	}
+	resourcePolicy.Annotations[ResourcePoolCreatedParentsAnnotationKey] = string(data)
+}
+
+// GetResourcePoolAppliedAllocation returns the reservations and limits of the spec that were last
+// applied to the resource pool of the resource policy. It is empty if the annotation is absent or
+// cannot be decoded.
+func GetResourcePoolAppliedAllocation(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) ResourcePoolAllocation {
+	var allocation ResourcePoolAllocation
+	if value, ok := resourcePolicy.Annotations[ResourcePoolAppliedAllocationAnnotationKey]; ok {
+		_ = json.Unmarshal([]byte(value), &allocation)
+	}
+	return allocation
+}
+
+// SetResourcePoolAppliedAllocation records the reservations and limits of the spec that were
+// applied to the resource pool of the resource policy.
+func SetResourcePoolAppliedAllocation(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy, allocation ResourcePoolAllocation) {
+	if allocation.Reservations.Cpu.IsZero() && allocation.Reservations.Memory.IsZero() &&
+		allocation.Limits.Cpu.IsZero() && allocation.Limits.Memory.IsZero() {
+		delete(resourcePolicy.Annotations, ResourcePoolAppliedAllocationAnnotationKey)
+		return
+	}
+
+	data, err := json.Marshal(allocation)
+	if err != nil {
+		return
+	}
+	if resourcePolicy.Annotations == nil {
+		resourcePolicy.Annotations = map[string]string{}
+	}
+	resourcePolicy.Annotations[ResourcePoolAppliedAllocationAnnotationKey] = string(data)
+}
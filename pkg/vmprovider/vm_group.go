@@ -0,0 +1,254 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// VMGroupsAnnotationKey is the VirtualMachineSetResourcePolicy annotation with the JSON encoded
+	// list of VMGroupSpec of the resource policy.
+	VMGroupsAnnotationKey = "vmoperator.vmware.com/vm-groups"
+
+	// VMGroupsStatusAnnotationKey is the VirtualMachineSetResourcePolicy annotation with the JSON
+	// encoded list of VMGroupStatus of the groups that exist in vSphere. It is set by VM Operator, and
+	// the webhook denies the changes made by other users.
+	VMGroupsStatusAnnotationKey = "vmoperator.vmware.com/vm-groups-status"
+
+	// VMGroupMembershipAnnotationKey is the VirtualMachine annotation with the comma separated names
+	// of the groups of its resource policy that the VM is a member of.
+	VMGroupMembershipAnnotationKey = "vmoperator.vmware.com/vm-group-membership"
+
+	// VMHostGroupsRefreshPeriod is how often the hosts and the compliance of the VM groups backed by
+	// a DRS VM-Host rule are refreshed, since the host tags are not watched.
+	VMHostGroupsRefreshPeriod = time.Minute
+)
+
+// VMGroupPolicy is how the VMs of a group are placed relative to each other or to the hosts of
+// the cluster.
+type VMGroupPolicy string
+
+const (
+	// VMGroupPolicyAffinity keeps the VMs of the group on the same host.
+	VMGroupPolicyAffinity VMGroupPolicy = "Affinity"
+	// VMGroupPolicyAntiAffinity keeps the VMs of the group on different hosts.
+	VMGroupPolicyAntiAffinity VMGroupPolicy = "AntiAffinity"
+	// VMGroupPolicyHostAffinity runs the VMs of the group on the hosts with the host tag.
+	VMGroupPolicyHostAffinity VMGroupPolicy = "HostAffinity"
+	// VMGroupPolicyHostAntiAffinity runs the VMs of the group on the hosts without the host tag.
+	VMGroupPolicyHostAntiAffinity VMGroupPolicy = "HostAntiAffinity"
+)
+
+// VMGroupBacking is the vSphere object that enforces the policy of a group.
+type VMGroupBacking string
+
+const (
+	// VMGroupBackingClusterModule backs the group with a cluster module. Cluster modules only support
+	// anti-affinity.
+	VMGroupBackingClusterModule VMGroupBacking = "ClusterModule"
+	// VMGroupBackingDRSRule backs the group with a DRS VM-VM rule. The rule only exists while the
+	// group has at least two VMs.
+	VMGroupBackingDRSRule VMGroupBacking = "DRSRule"
+	// VMGroupBackingDRSHostRule backs the group with a DRS VM-Host rule between a cluster VM group
+	// and a cluster host group. It is the only backing of the host policies.
+	VMGroupBackingDRSHostRule VMGroupBacking = "DRSHostRule"
+)
+
+// VMGroupSpec is a named group of VMs of a resource policy.
+type VMGroupSpec struct {
+	// Name is the name of the group, unique in the resource policy.
+	Name string `json:"name"`
+
+	// Policy is the placement policy of the VMs of the group.
+	Policy VMGroupPolicy `json:"policy"`
+
+	// Backing is the vSphere object that enforces the policy. Defaults to ClusterModule for
+	// AntiAffinity, DRSRule for Affinity and DRSHostRule for HostAffinity and HostAntiAffinity.
+	Backing VMGroupBacking `json:"backing,omitempty"`
+
+	// Mandatory makes the DRS rule of the group mandatory: the VMs must, rather than should, run on
+	// the hosts of a host policy. It is not valid with the ClusterModule backing.
+	Mandatory bool `json:"mandatory,omitempty"`
+
+	// HostTag is the name of the vSphere tag of the hosts of a host policy.
+	HostTag string `json:"hostTag,omitempty"`
+
+	// HostTagCategory is the category of HostTag. It is only needed when the tag name is not unique.
+	HostTagCategory string `json:"hostTagCategory,omitempty"`
+}
+
+// VMGroupStatus is a group of a resource policy that exists in vSphere.
+type VMGroupStatus struct {
+	// Name is the name of the group.
+	Name string `json:"name"`
+
+	// Backing is the vSphere object that enforces the policy of the group.
+	Backing VMGroupBacking `json:"backing"`
+
+	// ModuleUuid is the UUID of the cluster module of the group.
+	ModuleUuid string `json:"moduleUuid,omitempty"`
+
+	// RuleName is the name of the DRS rule of the group.
+	RuleName string `json:"ruleName,omitempty"`
+
+	// VMGroupName and HostGroupName are the names of the cluster VM group and cluster host group of
+	// the DRS VM-Host rule of the group.
+	VMGroupName   string `json:"vmGroupName,omitempty"`
+	HostGroupName string `json:"hostGroupName,omitempty"`
+
+	// Hosts are the MoIDs of the hosts of the cluster host group. They are refreshed every
+	// VMHostGroupsRefreshPeriod.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// InCompliance is whether the VMs of the group comply with its DRS VM-Host rule, as last
+	// reported by DRS. It is refreshed every VMHostGroupsRefreshPeriod.
+	InCompliance *bool `json:"inCompliance,omitempty"`
+}
+
+// GetVMGroups returns the VM groups of the resource policy with their defaults, or an error if they
+// are not valid.
+func GetVMGroups(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) ([]VMGroupSpec, error) {
+	data, ok := resourcePolicy.Annotations[VMGroupsAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var groups []VMGroupSpec
+	if err := json.Unmarshal([]byte(data), &groups); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", VMGroupsAnnotationKey, err)
+	}
+
+	names := make(map[string]struct{}, len(groups))
+	for i := range groups {
+		group := &groups[i]
+
+		if group.Name == "" {
+			return nil, fmt.Errorf("group %d must have a name", i)
+		}
+		if strings.Contains(group.Name, ",") {
+			return nil, fmt.Errorf("group name %q must not contain a comma", group.Name)
+		}
+		if _, ok := names[group.Name]; ok {
+			return nil, fmt.Errorf("group name %q is not unique", group.Name)
+		}
+		names[group.Name] = struct{}{}
+
+		switch group.Policy {
+		case VMGroupPolicyAntiAffinity:
+			if group.Backing == "" {
+				group.Backing = VMGroupBackingClusterModule
+			}
+		case VMGroupPolicyAffinity:
+			if group.Backing == "" {
+				group.Backing = VMGroupBackingDRSRule
+			}
+		case VMGroupPolicyHostAffinity, VMGroupPolicyHostAntiAffinity:
+			if group.Backing == "" {
+				group.Backing = VMGroupBackingDRSHostRule
+			}
+			if group.HostTag == "" {
+				return nil, fmt.Errorf("group %q with policy %s must have a host tag", group.Name, group.Policy)
+			}
+		default:
+			return nil, fmt.Errorf("group %q has invalid policy %q: must be %s, %s, %s or %s",
+				group.Name, group.Policy, VMGroupPolicyAffinity, VMGroupPolicyAntiAffinity,
+				VMGroupPolicyHostAffinity, VMGroupPolicyHostAntiAffinity)
+		}
+
+		if group.HostTag != "" && group.Backing != VMGroupBackingDRSHostRule {
+			return nil, fmt.Errorf("group %q with backing %s cannot have a host tag", group.Name, group.Backing)
+		}
+
+		switch group.Backing {
+		case VMGroupBackingClusterModule:
+			if group.Policy != VMGroupPolicyAntiAffinity {
+				return nil, fmt.Errorf("group %q with backing %s must have policy %s",
+					group.Name, VMGroupBackingClusterModule, VMGroupPolicyAntiAffinity)
+			}
+			if group.Mandatory {
+				return nil, fmt.Errorf("group %q with backing %s cannot be mandatory", group.Name, VMGroupBackingClusterModule)
+			}
+		case VMGroupBackingDRSRule:
+			if group.Policy != VMGroupPolicyAffinity && group.Policy != VMGroupPolicyAntiAffinity {
+				return nil, fmt.Errorf("group %q with backing %s must have policy %s or %s",
+					group.Name, VMGroupBackingDRSRule, VMGroupPolicyAffinity, VMGroupPolicyAntiAffinity)
+			}
+		case VMGroupBackingDRSHostRule:
+			if group.Policy != VMGroupPolicyHostAffinity && group.Policy != VMGroupPolicyHostAntiAffinity {
+				return nil, fmt.Errorf("group %q with backing %s must have policy %s or %s",
+					group.Name, VMGroupBackingDRSHostRule, VMGroupPolicyHostAffinity, VMGroupPolicyHostAntiAffinity)
+			}
+		default:
+			return nil, fmt.Errorf("group %q has invalid backing %q: must be %s, %s or %s",
+				group.Name, group.Backing, VMGroupBackingClusterModule, VMGroupBackingDRSRule, VMGroupBackingDRSHostRule)
+		}
+	}
+
+	return groups, nil
+}
+
+// HasVMHostGroups returns true if the resource policy has a VM group backed by a DRS VM-Host rule.
+func HasVMHostGroups(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) bool {
+	groups, _ := GetVMGroups(resourcePolicy)
+	for _, group := range groups {
+		if group.Backing == VMGroupBackingDRSHostRule {
+			return true
+		}
+	}
+	return false
+}
+
+// GetVMGroupsStatus returns the status of the VM groups of the resource policy. It is empty if the
+// annotation is absent or cannot be decoded.
+func GetVMGroupsStatus(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy) []VMGroupStatus {
+	var status []VMGroupStatus
+	if value, ok := resourcePolicy.Annotations[VMGroupsStatusAnnotationKey]; ok {
+		_ = json.Unmarshal([]byte(value), &status)
+	}
+	return status
+}
+
+// SetVMGroupsStatus records the status of the VM groups of the resource policy.
+func SetVMGroupsStatus(resourcePolicy *v1alpha1.VirtualMachineSetResourcePolicy, status []VMGroupStatus) {
+	if len(status) == 0 {
+		delete(resourcePolicy.Annotations, VMGroupsStatusAnnotationKey)
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if resourcePolicy.Annotations == nil {
+		resourcePolicy.Annotations = map[string]string{}
+	}
+	resourcePolicy.Annotations[VMGroupsStatusAnnotationKey] = string(data)
+}
+
+// GetVMGroupMembership returns the names of the VM groups the VM is a member of.
+func GetVMGroupMembership(vm *v1alpha1.VirtualMachine) []string {
+	var names []string
+	for _, name := range strings.Split(vm.Annotations[VMGroupMembershipAnnotationKey], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IsVMGroupMember returns true if the VM is a member of the named VM group.
+func IsVMGroupMember(vm *v1alpha1.VirtualMachine, groupName string) bool {
+	for _, name := range GetVMGroupMembership(vm) {
+		if name == groupName {
+			return true
+		}
+	}
+	return false
+}
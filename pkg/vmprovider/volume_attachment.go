@@ -0,0 +1,91 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// OrderedVolumeAttachmentAnnotationKey is the VirtualMachine annotation that, when "true",
+	// attaches its PersistentVolumeClaim volumes one at a time in the order of its spec: a volume
+	// is only attached once the previous ones are, so that they get device numbers in that order.
+	// The status of the volumes is also kept in the order of the spec.
+	OrderedVolumeAttachmentAnnotationKey = "vmoperator.vmware.com/ordered-volume-attachment"
+
+	// VolumeDevicesAnnotationKey is the VirtualMachine annotation with the JSON encoded map of the
+	// names of its attached PersistentVolumeClaim volumes to the controller and unit number of
+	// their disks. It is set by VM Operator when the attached volumes change.
+	VolumeDevicesAnnotationKey = "vmoperator.vmware.com/volume-devices"
+
+	// VirtualMachineOrderedVolumeAttachmentReadyCondition reports whether the PersistentVolumeClaim
+	// volumes of a VM with ordered volume attachment are all attached. It is only set on these VMs.
+	VirtualMachineOrderedVolumeAttachmentReadyCondition v1alpha1.ConditionType = "VirtualMachineOrderedVolumeAttachmentReady"
+
+	// VolumeAttachmentPendingReason (Severity=Info) documents that a volume is being attached, and
+	// that the next volumes are attached once it is. The message names the volume.
+	VolumeAttachmentPendingReason = "VolumeAttachmentPending"
+
+	// VolumeAttachmentBlockedReason (Severity=Warning) documents that the attachment of a volume
+	// failed, so the next volumes are not attached until it succeeds. The message names the volume
+	// and has the error of its attachment.
+	VolumeAttachmentBlockedReason = "VolumeAttachmentBlocked"
+)
+
+// VolumeDevice is the location of the disk of a volume in the virtual hardware of the VM.
+type VolumeDevice struct {
+	// ControllerType is the type of the controller of the disk, such as SCSI.
+	ControllerType string `json:"controllerType"`
+	// ControllerBusNumber is the bus number of the controller of the disk.
+	ControllerBusNumber int32 `json:"controllerBusNumber"`
+	// UnitNumber is the unit number of the disk on its controller.
+	UnitNumber int32 `json:"unitNumber"`
+}
+
+// IsOrderedVolumeAttachment returns true if the volumes of the VM are attached in the order of its
+// spec, or an error if the annotation is not a boolean.
+func IsOrderedVolumeAttachment(vm *v1alpha1.VirtualMachine) (bool, error) {
+	value, ok := vm.Annotations[OrderedVolumeAttachmentAnnotationKey]
+	if !ok {
+		return false, nil
+	}
+
+	ordered, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid ordered volume attachment %q: must be true or false", value)
+	}
+	return ordered, nil
+}
+
+// GetVolumeDevices returns the controller and unit number of the disks of the attached volumes of
+// the VM, by volume name. It is empty if the annotation is absent or cannot be decoded.
+func GetVolumeDevices(vm *v1alpha1.VirtualMachine) map[string]VolumeDevice {
+	devices := map[string]VolumeDevice{}
+	if value, ok := vm.Annotations[VolumeDevicesAnnotationKey]; ok {
+		_ = json.Unmarshal([]byte(value), &devices)
+	}
+	return devices
+}
+
+// SetVolumeDevices records the controller and unit number of the disks of the attached volumes of
+// the VM.
+func SetVolumeDevices(vm *v1alpha1.VirtualMachine, devices map[string]VolumeDevice) {
+	if len(devices) == 0 {
+		delete(vm.Annotations, VolumeDevicesAnnotationKey)
+		return
+	}
+
+	data, err := json.Marshal(devices)
+	if err != nil {
+		return
+	}
+	if vm.Annotations == nil {
+		vm.Annotations = map[string]string{}
+	}
+	vm.Annotations[VolumeDevicesAnnotationKey] = string(data)
+}
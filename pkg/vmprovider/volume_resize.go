@@ -0,0 +1,119 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package vmprovider
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
+)
+
+const (
+	// VolumeResizeStatusAnnotationKey is the VirtualMachine annotation with the JSON encoded list of
+	// the resizes in progress of its PersistentVolumeClaim volumes. It is set by VM Operator. The
+	// resizes are reported in this annotation, not in status.volumes, because the v1alpha1
+	// VirtualMachineVolumeStatus has no field for them: status.volumes only has the attachment of
+	// the volumes, and the annotation is removed once no volume is being resized.
+	VolumeResizeStatusAnnotationKey = "vmoperator.vmware.com/volume-resize-status"
+)
+
+// VolumeResizeState is the state of the resize of a PersistentVolumeClaim volume.
+type VolumeResizeState string
+
+const (
+	// VolumeResizePending is the state of a volume whose requested capacity is greater than its
+	// capacity, before the CSI resizer starts to expand it.
+	VolumeResizePending VolumeResizeState = "Pending"
+
+	// VolumeResizeInProgress is the state of a volume being expanded by the CSI resizer.
+	VolumeResizeInProgress VolumeResizeState = "Resizing"
+
+	// VolumeResizeFileSystemPending is the state of a volume whose disk has been expanded, but not
+	// its file system yet.
+	VolumeResizeFileSystemPending VolumeResizeState = "FileSystemResizePending"
+)
+
+// VolumeResizeStatus is the status of the resize of a PersistentVolumeClaim volume.
+type VolumeResizeStatus struct {
+	// Name is the name of the volume, as in the spec of the VM.
+	Name string `json:"name"`
+	// Capacity is the current capacity of the volume.
+	Capacity resource.Quantity `json:"capacity"`
+	// RequestedCapacity is the capacity the volume is being resized to.
+	RequestedCapacity resource.Quantity `json:"requestedCapacity"`
+	// State is the state of the resize.
+	State VolumeResizeState `json:"state"`
+	// Message is the message of the PersistentVolumeClaim condition of the resize, if any.
+	Message string `json:"message,omitempty"`
+}
+
+// GetPersistentVolumeClaimResizeStatus returns the resize status of the volume backed by the
+// PersistentVolumeClaim, or nil if the claim is not being resized.
+func GetPersistentVolumeClaimResizeStatus(volumeName string, pvc *corev1.PersistentVolumeClaim) *VolumeResizeStatus {
+	capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]
+	if !ok {
+		// The claim is not bound yet.
+		return nil
+	}
+
+	status := &VolumeResizeStatus{
+		Name:              volumeName,
+		Capacity:          capacity,
+		RequestedCapacity: pvc.Spec.Resources.Requests[corev1.ResourceStorage],
+	}
+
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case corev1.PersistentVolumeClaimResizing:
+			status.State = VolumeResizeInProgress
+		case corev1.PersistentVolumeClaimFileSystemResizePending:
+			status.State = VolumeResizeFileSystemPending
+		default:
+			continue
+		}
+		status.Message = condition.Message
+		return status
+	}
+
+	if status.RequestedCapacity.Cmp(capacity) > 0 {
+		status.State = VolumeResizePending
+		return status
+	}
+
+	return nil
+}
+
+// GetVolumeResizeStatus returns the resizes in progress of the PersistentVolumeClaim volumes of the
+// VM. It is empty if the annotation is absent or cannot be decoded.
+func GetVolumeResizeStatus(vm *v1alpha1.VirtualMachine) []VolumeResizeStatus {
+	var status []VolumeResizeStatus
+	if value, ok := vm.Annotations[VolumeResizeStatusAnnotationKey]; ok {
+		_ = json.Unmarshal([]byte(value), &status)
+	}
+	return status
+}
+
+// SetVolumeResizeStatus records the resizes in progress of the PersistentVolumeClaim volumes of the
+// VM.
+func SetVolumeResizeStatus(vm *v1alpha1.VirtualMachine, status []VolumeResizeStatus) {
+	if len(status) == 0 {
+		delete(vm.Annotations, VolumeResizeStatusAnnotationKey)
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if vm.Annotations == nil {
+		vm.Annotations = map[string]string{}
+	}
+	vm.Annotations[VolumeResizeStatusAnnotationKey] = string(data)
+}
@@ -0,0 +1,10 @@
+// Copyright (c) 2021 VMware, Inc. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+const (
+	// AnnotationInvalidFmt is the validation error of an annotation whose value cannot be parsed,
+	// formatted with the annotation key and the parse error.
+	AnnotationInvalidFmt = "annotation %s is invalid: %s"
+)
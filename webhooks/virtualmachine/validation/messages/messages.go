@@ -4,13 +4,26 @@
 package messages
 
 const (
-	UpdatingImmutableFieldsNotAllowed      = "updates to immutable fields are not allowed: %s"
-	UpdatingFieldsNotAllowedInPowerState   = "updates to fields %s are not allowed in the '%s' power state"
-	ImageNotSpecified                      = "spec.imageName must be specified"
-	ClassNotSpecified                      = "spec.className must be specified"
-	MetadataTransportConfigMapNotSpecified = "spec.vmMetadata.configMapName must be specified"
-	ReadinessProbeNoActions                = "spec.readinessProbe must specify an action"
-	ReadinessProbeOnlyOneAction            = "spec.readinessProbe only one action can be specified"
+	UpdatingImmutableFieldsNotAllowed         = "updates to immutable fields are not allowed: %s"
+	UpdatingFieldsNotAllowedInPowerState      = "updates to fields %s are not allowed in the '%s' power state"
+	ImageNotSpecified                         = "spec.imageName must be specified"
+	ClassNotSpecified                         = "spec.className must be specified"
+	MetadataTransportConfigMapNotSpecified    = "spec.vmMetadata.configMapName must be specified"
+	ReadinessProbeNoActions                   = "spec.readinessProbe must specify an action"
+	ReadinessProbeOnlyOneAction               = "spec.readinessProbe only one action can be specified"
+	ReadinessProbeAnnotationNoProbeFmt        = "annotation %s requires spec.readinessProbe"
+	PowerStateNotSupportedFmt                 = "spec.powerState %s is not supported"
+	PowerStateTransitionNotAllowedFmt         = "spec.powerState cannot be changed from '%s' to '%s'"
+	RestartNotAllowedInPowerStateFmt          = "a restart cannot be requested in the '%s' power state"
+	DeletionProtectedFmt                      = "deletion is not allowed while annotation %s is true"
+	ImportAnnotationInvalidFmt                = "import annotations are invalid: %s"
+	ImportSourceUpdateNotAllowed              = "the VM to import cannot be changed after it has been imported"
+	PrivilegedAnnotationNotAllowedFmt         = "annotation %s can only be set by VM Operator"
+	UpdatingVMOperatorAnnotationNotAllowedFmt = "annotation %s is set by VM Operator and cannot be changed"
+	ZoneRemovalNotAllowedFmt                  = "label %s cannot be removed after the VM has been placed"
+	MigrationInProgressFmt                    = "%s cannot be changed while the VM is migrating"
+	StorageClassAddOrRemoveNotAllowed         = "spec.storageClass cannot be added or removed"
+	VMGroupMembershipNoResourcePolicyFmt      = "annotation %s requires spec.resourcePolicyName"
 
 	NetworkNameNotSpecifiedFmt               = "spec.networkInterfaces[%d].networkName must be specified"
 	NetworkTypeNotSupportedFmt               = "spec.networkInterfaces[%d].networkType is not supported. supported network types: %s and %s"
@@ -27,6 +40,8 @@ const (
 	MultipleVolumeSpecifiedFmt                       = "only one of spec.volumes[%d].persistentVolumeClaim/spec.volumes[%d].vsphereVolume must be specified"
 	VolumeNotSpecifiedFmt                            = "one of spec.volumes[%d].persistentVolumeClaim/spec.volumes[%d].vsphereVolume must be specified"
 	VsphereVolumeSizeNotMBMultipleFmt                = "spec.volumes[%d].vsphereVolume.capacity.ephemeral-storage must be a multiple of MB"
+	VsphereVolumeSizeDecreaseNotAllowedFmt           = "spec.volumes[%d].vsphereVolume.capacity.ephemeral-storage cannot be decreased"
+	VsphereVolumeSizeNotSpecifiedFmt                 = "spec.volumes[%d].vsphereVolume.capacity.ephemeral-storage must be specified without a deviceKey"
 	EagerZeroedAndThinProvisionedNotSupported        = "Volume provisioning cannot have EagerZeroed and ThinProvisioning set. Eager zeroing requires thick provisioning"
 
 	VirtualMachineImageNotSupported = "VirtualMachineImage is not compatible with v1alpha1 or is not a TKG Image"
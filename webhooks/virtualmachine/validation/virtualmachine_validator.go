@@ -4,6 +4,7 @@
 package validation
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -29,6 +30,8 @@ import (
 	netopv1alpha1 "github.com/vmware-tanzu/vm-operator/external/net-operator/api/v1alpha1"
 	"github.com/vmware-tanzu/vm-operator/pkg/builder"
 	"github.com/vmware-tanzu/vm-operator/pkg/context"
+	prober "github.com/vmware-tanzu/vm-operator/pkg/prober/probe"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere"
 	"github.com/vmware-tanzu/vm-operator/webhooks/common"
 	"github.com/vmware-tanzu/vm-operator/webhooks/virtualmachine/validation/messages"
@@ -39,7 +42,7 @@ const (
 	storageResourceQuotaStrPattern = ".storageclass.storage.k8s.io/"
 )
 
-// +kubebuilder:webhook:verbs=create;update,path=/default-validate-vmoperator-vmware-com-v1alpha1-virtualmachine,mutating=false,failurePolicy=fail,groups=vmoperator.vmware.com,resources=virtualmachines,versions=v1alpha1,name=default.validating.virtualmachine.vmoperator.vmware.com,sideEffects=None,admissionReviewVersions=v1beta1,webhookVersions=v1beta1
+// +kubebuilder:webhook:verbs=create;update;delete,path=/default-validate-vmoperator-vmware-com-v1alpha1-virtualmachine,mutating=false,failurePolicy=fail,groups=vmoperator.vmware.com,resources=virtualmachines,versions=v1alpha1,name=default.validating.virtualmachine.vmoperator.vmware.com,sideEffects=None,admissionReviewVersions=v1beta1,webhookVersions=v1beta1
 // +kubebuilder:rbac:groups=vmoperator.vmware.com,resources=virtualmachines,verbs=get;list
 // +kubebuilder:rbac:groups=vmoperator.vmware.com,resources=virtualmachines/status,verbs=get
 
@@ -87,13 +90,34 @@ func (v validator) ValidateCreate(ctx *context.WebhookRequestContext) admission.
 	validationErrs = append(validationErrs, v.validateNetwork(ctx, vm)...)
 	validationErrs = append(validationErrs, v.validateVolumes(ctx, vm)...)
 	validationErrs = append(validationErrs, v.validateVmVolumeProvisioningOptions(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateBootDisk(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateVolumeAttachment(ctx, vm)...)
 	validationErrs = append(validationErrs, v.validateReadinessProbe(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateLivenessProbe(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validatePowerOff(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validatePowerState(ctx, vm, nil)...)
+	validationErrs = append(validationErrs, v.validateDeletion(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateImport(ctx, vm, nil)...)
+	validationErrs = append(validationErrs, v.validateVMOperatorAnnotations(ctx, vm, nil)...)
+	validationErrs = append(validationErrs, v.validateVMGroupMembership(ctx, vm)...)
 
 	return common.BuildValidationResponse(ctx, validationErrs, nil)
 }
 
-func (v validator) ValidateDelete(*context.WebhookRequestContext) admission.Response {
-	return admission.Allowed("")
+// ValidateDelete denies the deletion of a VM with deletion protection.
+func (v validator) ValidateDelete(ctx *context.WebhookRequestContext) admission.Response {
+	var validationErrs []string
+
+	vm, err := v.vmFromUnstructured(ctx.Obj)
+	if err != nil {
+		return webhook.Errored(http.StatusBadRequest, err)
+	}
+
+	if protected, _ := vmprovider.IsDeletionProtected(vm); protected {
+		validationErrs = append(validationErrs, fmt.Sprintf(messages.DeletionProtectedFmt, vmprovider.DeletionProtectionAnnotationKey))
+	}
+
+	return common.BuildValidationResponse(ctx, validationErrs, nil)
 }
 
 // ValidateUpdate validates if the given VirtualMachineSpec update is valid.
@@ -101,7 +125,6 @@ func (v validator) ValidateDelete(*context.WebhookRequestContext) admission.Resp
 //   - ImageName
 //   - ClassName
 //   - StorageClass
-//   - ResourcePolicyName
 
 // Following fields can only be updated when the VM is powered off.
 //   - Ports
@@ -111,6 +134,10 @@ func (v validator) ValidateDelete(*context.WebhookRequestContext) admission.Resp
 //   - AdvancedOptions
 //     - DefaultVolumeProvisioningOptions
 
+// Following fields cannot be updated while the VM is migrating.
+//   - ResourcePolicyName
+//   - The zone label
+
 // All other updates are allowed.
 func (v validator) ValidateUpdate(ctx *context.WebhookRequestContext) admission.Response {
 	var validationErrs []string
@@ -135,7 +162,8 @@ func (v validator) ValidateUpdate(ctx *context.WebhookRequestContext) admission.
 	// If a VM is requesting a power off, we can Reconfigure the VM _after_ we power it off - all changes are allowed.
 	// If a VM is requesting a power on, we can Reconfigure the VM _before_ we power it on - all changes are allowed.
 	// So, we only run these validations when the VM is powered on, and is not requesting a power state change.
-	if currentPowerState == desiredPowerState && currentPowerState == vmopv1.VirtualMachinePoweredOn {
+	// The spec of an imported VM is back-filled from the VM before it is adopted, so those changes are allowed too.
+	if currentPowerState == desiredPowerState && currentPowerState == vmopv1.VirtualMachinePoweredOn && !vmprovider.IsImportPending(oldVM) {
 		invalidFields := v.validateUpdatesWhenPoweredOn(ctx, vm, oldVM)
 		if len(invalidFields) > 0 {
 			validationErrs = append(validationErrs, fmt.Sprintf(messages.UpdatingFieldsNotAllowedInPowerState, invalidFields, vm.Spec.PowerState))
@@ -147,8 +175,20 @@ func (v validator) ValidateUpdate(ctx *context.WebhookRequestContext) admission.
 	validationErrs = append(validationErrs, v.validateMetadata(ctx, vm)...)
 	validationErrs = append(validationErrs, v.validateNetwork(ctx, vm)...)
 	validationErrs = append(validationErrs, v.validateVolumes(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateVsphereVolumesUpdate(ctx, vm, oldVM)...)
 	validationErrs = append(validationErrs, v.validateVmVolumeProvisioningOptions(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateBootDisk(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateVolumeAttachment(ctx, vm)...)
 	validationErrs = append(validationErrs, v.validateReadinessProbe(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateLivenessProbe(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validatePowerOff(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validatePowerState(ctx, vm, oldVM)...)
+	validationErrs = append(validationErrs, v.validateDeletion(ctx, vm)...)
+	validationErrs = append(validationErrs, v.validateImport(ctx, vm, oldVM)...)
+	validationErrs = append(validationErrs, v.validateVMOperatorAnnotations(ctx, vm, oldVM)...)
+	validationErrs = append(validationErrs, v.validateZone(ctx, vm, oldVM)...)
+	validationErrs = append(validationErrs, v.validateStorageClassUpdate(ctx, vm, oldVM)...)
+	validationErrs = append(validationErrs, v.validateVMGroupMembership(ctx, vm)...)
 
 	return common.BuildValidationResponse(ctx, validationErrs, nil)
 }
@@ -347,6 +387,11 @@ func (v validator) validateVsphereVolume(vsphereVolume *vmopv1.VsphereVolumeSour
 		validationErrs = append(validationErrs, fmt.Sprintf(messages.VsphereVolumeSizeNotMBMultipleFmt, idx))
 	}
 
+	// The disk of a volume without a device key is created with the VM.
+	if vsphereVolume.DeviceKey == nil && vsphereVolume.Capacity.StorageEphemeral().Value() <= 0 {
+		validationErrs = append(validationErrs, fmt.Sprintf(messages.VsphereVolumeSizeNotSpecifiedFmt, idx))
+	}
+
 	return validationErrs
 }
 
@@ -361,23 +406,369 @@ func (v validator) validateVmVolumeProvisioningOptions(ctx *context.WebhookReque
 	return validationErrs
 }
 
+func (v validator) validateBootDisk(ctx *context.WebhookRequestContext, vm *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	if _, err := vmprovider.GetBootDiskCapacity(vm, nil); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.BootDiskCapacityAnnotationKey, err))
+	}
+
+	return validationErrs
+}
+
+func (v validator) validateVolumeAttachment(ctx *context.WebhookRequestContext, vm *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	if _, err := vmprovider.IsOrderedVolumeAttachment(vm); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.OrderedVolumeAttachmentAnnotationKey, err))
+	}
+
+	return validationErrs
+}
+
 func (v validator) validateReadinessProbe(ctx *context.WebhookRequestContext, vm *vmopv1.VirtualMachine) []string {
 	probe := vm.Spec.ReadinessProbe
+	_, hasHTTPGet := vm.Annotations[prober.HTTPGetActionAnnotationKey]
+	_, hasExec := vm.Annotations[prober.ExecActionAnnotationKey]
+	_, hasThresholds := vm.Annotations[prober.ThresholdsAnnotationKey]
 	if probe == nil {
-		return nil
+		var validationErrs []string
+		if hasHTTPGet {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.ReadinessProbeAnnotationNoProbeFmt, prober.HTTPGetActionAnnotationKey))
+		}
+		if hasExec {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.ReadinessProbeAnnotationNoProbeFmt, prober.ExecActionAnnotationKey))
+		}
+		if hasThresholds {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.ReadinessProbeAnnotationNoProbeFmt, prober.ThresholdsAnnotationKey))
+		}
+		return validationErrs
 	}
 
 	var validationErrs []string
+	if hasThresholds {
+		validationErrs = append(validationErrs, validateThresholds(vm)...)
+	}
 
-	if probe.TCPSocket == nil && probe.GuestHeartbeat == nil {
+	actions := 0
+	if probe.TCPSocket != nil {
+		actions++
+	}
+	if probe.GuestHeartbeat != nil {
+		actions++
+	}
+	if hasHTTPGet {
+		actions++
+		validationErrs = append(validationErrs, validateHTTPGetAction(vm)...)
+	}
+	if hasExec {
+		actions++
+		validationErrs = append(validationErrs, validateExecAction(vm)...)
+	}
+
+	if actions == 0 {
 		validationErrs = append(validationErrs, messages.ReadinessProbeNoActions)
-	} else if probe.TCPSocket != nil && probe.GuestHeartbeat != nil {
+	} else if actions > 1 {
 		validationErrs = append(validationErrs, messages.ReadinessProbeOnlyOneAction)
 	}
 
 	return validationErrs
 }
 
+func (v validator) validateLivenessProbe(ctx *context.WebhookRequestContext, vm *vmopv1.VirtualMachine) []string {
+	invalid := func(reason string) []string {
+		return []string{fmt.Sprintf(common.AnnotationInvalidFmt, prober.LivenessProbeAnnotationKey, reason)}
+	}
+
+	probe, err := prober.GetLivenessProbe(vm)
+	if err != nil {
+		return invalid(err.Error())
+	}
+	if probe == nil {
+		return nil
+	}
+
+	var validationErrs []string
+	if probe.TCPSocket == nil && probe.GuestHeartbeat == nil {
+		validationErrs = append(validationErrs, invalid("tcpSocket or guestHeartbeat must be specified")...)
+	} else if probe.TCPSocket != nil && probe.GuestHeartbeat != nil {
+		validationErrs = append(validationErrs, invalid("only one of tcpSocket or guestHeartbeat can be specified")...)
+	}
+	switch probe.Remediation {
+	case vmprovider.RestartTypeGuestReboot, vmprovider.RestartTypeReset, vmprovider.RestartTypePowerCycle:
+	default:
+		validationErrs = append(validationErrs, invalid(fmt.Sprintf("remediation must be one of %s, %s or %s",
+			vmprovider.RestartTypeGuestReboot, vmprovider.RestartTypeReset, vmprovider.RestartTypePowerCycle))...)
+	}
+
+	return validationErrs
+}
+
+func (v validator) validatePowerOff(ctx *context.WebhookRequestContext, vm *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	if _, err := vmprovider.GetPowerOffMode(vm, nil); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffModeAnnotationKey, err))
+	}
+	if _, err := vmprovider.GetPowerOffTimeout(vm, nil); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffTimeoutAnnotationKey, err))
+	}
+
+	return validationErrs
+}
+
+func (v validator) validateDeletion(ctx *context.WebhookRequestContext, vm *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	if _, err := vmprovider.GetDeletionPolicy(vm); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.DeletionPolicyAnnotationKey, err))
+	}
+	if _, err := vmprovider.IsDeletionProtected(vm); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.DeletionProtectionAnnotationKey, err))
+	}
+
+	return validationErrs
+}
+
+// validateImport validates the import source of the VM. oldVM is nil when the VM is created.
+func (v validator) validateImport(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	source, err := vmprovider.GetImportSource(vm)
+	if err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(messages.ImportAnnotationInvalidFmt, err))
+	}
+
+	// The import source cannot be changed once the VM has been adopted.
+	if oldVM != nil && oldVM.Status.UniqueID != "" {
+		oldSource, _ := vmprovider.GetImportSource(oldVM)
+		if oldSource != nil && (source == nil || source.MoID != oldSource.MoID || source.BiosUUID != oldSource.BiosUUID) {
+			validationErrs = append(validationErrs, messages.ImportSourceUpdateNotAllowed)
+		}
+	}
+
+	return validationErrs
+}
+
+// privilegedAnnotationKeys are the annotations that only VM Operator can set. They give the VM
+// access to objects that the user may not have access to: the import source adopts any VM of the
+// vCenter, and the metadata Secret is read with the permissions of VM Operator.
+var privilegedAnnotationKeys = []string{
+	vmprovider.ImportMoIDAnnotationKey,
+	vmprovider.ImportBiosUUIDAnnotationKey,
+	vmprovider.ImportRelocateAnnotationKey,
+	vmprovider.MetadataSecretAnnotationKey,
+}
+
+// vmOperatorAnnotationKeys are the annotations set by VM Operator. They record the state of the VM
+// that VM Operator acts on, so only VM Operator can change them.
+var vmOperatorAnnotationKeys = []string{
+	vmprovider.ImportedMoIDAnnotationKey,
+	vmprovider.MigrationTaskAnnotationKey,
+	vmprovider.StorageClassAnnotationKey,
+	vmprovider.AttachedResourcePolicyAnnotationKey,
+}
+
+// validateVMOperatorAnnotations denies the changes to the privileged annotations and to the
+// annotations set by VM Operator, unless they are made by VM Operator. oldVM is nil when the VM is
+// created.
+func (v validator) validateVMOperatorAnnotations(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	if ctx.IsPrivilegedAccount {
+		return validationErrs
+	}
+
+	for _, key := range privilegedAnnotationKeys {
+		if annotationChanged(key, vm, oldVM) {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.PrivilegedAnnotationNotAllowedFmt, key))
+		}
+	}
+	for _, key := range vmOperatorAnnotationKeys {
+		if annotationChanged(key, vm, oldVM) {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, key))
+		}
+	}
+
+	return validationErrs
+}
+
+// annotationChanged returns true if the annotation of the VM was added, removed or changed. oldVM
+// is nil when the VM is created.
+func annotationChanged(key string, vm, oldVM *vmopv1.VirtualMachine) bool {
+	value, ok := vm.Annotations[key]
+	oldValue, oldOk := "", false
+	if oldVM != nil {
+		oldValue, oldOk = oldVM.Annotations[key]
+	}
+	return ok != oldOk || value != oldValue
+}
+
+// validateVMGroupMembership validates that a VM that is a member of VM groups has a resource policy,
+// which declares the groups.
+func (v validator) validateVMGroupMembership(ctx *context.WebhookRequestContext, vm *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	if len(vmprovider.GetVMGroupMembership(vm)) > 0 && vm.Spec.ResourcePolicyName == "" {
+		validationErrs = append(validationErrs, fmt.Sprintf(messages.VMGroupMembershipNoResourcePolicyFmt, vmprovider.VMGroupMembershipAnnotationKey))
+	}
+
+	return validationErrs
+}
+
+// validateZone validates the changes of the zone and resource policy of the VM. Once the VM has been
+// placed, changing them migrates the VM, so its zone can be changed but not removed, and neither can
+// be changed while a migration is in progress.
+func (v validator) validateZone(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	if oldVM.Status.UniqueID == "" {
+		return validationErrs
+	}
+
+	zoneChanged := vmprovider.GetZone(vm) != vmprovider.GetZone(oldVM)
+	if zoneChanged && vmprovider.GetZone(vm) == "" {
+		validationErrs = append(validationErrs, fmt.Sprintf(messages.ZoneRemovalNotAllowedFmt, vmprovider.ZoneLabelKey))
+	}
+
+	if vmprovider.IsMigrationInProgress(oldVM) {
+		if zoneChanged {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.MigrationInProgressFmt, "label "+vmprovider.ZoneLabelKey))
+		}
+		if vm.Spec.ResourcePolicyName != oldVM.Spec.ResourcePolicyName {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.MigrationInProgressFmt, "spec.resourcePolicyName"))
+		}
+	}
+
+	return validationErrs
+}
+
+// validateStorageClassUpdate validates a change of the storage class of the VM, which migrates the
+// VM storage to the datastores of the new storage class.
+func (v validator) validateStorageClassUpdate(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
+	if vm.Spec.StorageClass == oldVM.Spec.StorageClass {
+		return nil
+	}
+
+	if vm.Spec.StorageClass == "" || oldVM.Spec.StorageClass == "" {
+		return []string{messages.StorageClassAddOrRemoveNotAllowed}
+	}
+	if vmprovider.IsMigrationInProgress(oldVM) {
+		return []string{fmt.Sprintf(messages.MigrationInProgressFmt, "spec.storageClass")}
+	}
+
+	return v.validateStorageClass(ctx, vm)
+}
+
+// validatePowerState validates the desired power state transition and the restart request of the
+// VM. oldVM is nil when the VM is created.
+func (v validator) validatePowerState(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	switch vm.Spec.PowerState {
+	case vmopv1.VirtualMachinePoweredOn, vmopv1.VirtualMachinePoweredOff:
+	case vmprovider.VirtualMachineSuspended:
+		// Only a powered on VM can be suspended.
+		if oldVM == nil || (!vmprovider.IsImportPending(oldVM) && oldVM.Spec.PowerState != vmopv1.VirtualMachinePoweredOn && oldVM.Spec.PowerState != vmprovider.VirtualMachineSuspended) {
+			currentPowerState := vmopv1.VirtualMachinePowerState("")
+			if oldVM != nil {
+				currentPowerState = oldVM.Spec.PowerState
+			}
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.PowerStateTransitionNotAllowedFmt, currentPowerState, vm.Spec.PowerState))
+		}
+	default:
+		validationErrs = append(validationErrs, fmt.Sprintf(messages.PowerStateNotSupportedFmt, vm.Spec.PowerState))
+	}
+
+	if _, err := vmprovider.GetRestartRequest(vm); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.RestartRequestedAnnotationKey, err))
+	}
+	if _, err := vmprovider.GetRestartType(vm); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.RestartTypeAnnotationKey, err))
+	}
+
+	// A new restart request is only allowed for a VM that is and stays powered on.
+	if oldVM != nil {
+		requested, ok := vm.Annotations[vmprovider.RestartRequestedAnnotationKey]
+		if ok && requested != oldVM.Annotations[vmprovider.RestartRequestedAnnotationKey] &&
+			(oldVM.Spec.PowerState != vmopv1.VirtualMachinePoweredOn || vm.Spec.PowerState != vmopv1.VirtualMachinePoweredOn) {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.RestartNotAllowedInPowerStateFmt, vm.Spec.PowerState))
+		}
+	}
+
+	return validationErrs
+}
+
+func validateHTTPGetAction(vm *vmopv1.VirtualMachine) []string {
+	invalid := func(reason string) []string {
+		return []string{fmt.Sprintf(common.AnnotationInvalidFmt, prober.HTTPGetActionAnnotationKey, reason)}
+	}
+
+	action, err := prober.GetHTTPGetAction(vm)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	var validationErrs []string
+	if action.Port.IntValue() == 0 && action.Port.StrVal == "" {
+		validationErrs = append(validationErrs, invalid("port must be specified")...)
+	}
+	if action.Scheme != "" && action.Scheme != prober.URISchemeHTTP && action.Scheme != prober.URISchemeHTTPS {
+		validationErrs = append(validationErrs, invalid(fmt.Sprintf("scheme must be %s or %s", prober.URISchemeHTTP, prober.URISchemeHTTPS))...)
+	}
+	if action.MinStatusCode < 100 || action.MaxStatusCode > 599 || action.MinStatusCode > action.MaxStatusCode {
+		validationErrs = append(validationErrs, invalid("status code range must be within 100 and 599")...)
+	}
+
+	return validationErrs
+}
+
+func validateThresholds(vm *vmopv1.VirtualMachine) []string {
+	invalid := func(reason string) []string {
+		return []string{fmt.Sprintf(common.AnnotationInvalidFmt, prober.ThresholdsAnnotationKey, reason)}
+	}
+
+	// Unmarshal the annotation directly because GetThresholds replaces invalid values with defaults.
+	thresholds := &prober.Thresholds{}
+	if err := json.Unmarshal([]byte(vm.Annotations[prober.ThresholdsAnnotationKey]), thresholds); err != nil {
+		return invalid(err.Error())
+	}
+
+	var validationErrs []string
+	if thresholds.InitialDelaySeconds < 0 {
+		validationErrs = append(validationErrs, invalid("initialDelaySeconds must not be negative")...)
+	}
+	if thresholds.SuccessThreshold < 0 {
+		validationErrs = append(validationErrs, invalid("successThreshold must not be negative")...)
+	}
+	if thresholds.FailureThreshold < 0 {
+		validationErrs = append(validationErrs, invalid("failureThreshold must not be negative")...)
+	}
+
+	return validationErrs
+}
+
+func validateExecAction(vm *vmopv1.VirtualMachine) []string {
+	invalid := func(reason string) []string {
+		return []string{fmt.Sprintf(common.AnnotationInvalidFmt, prober.ExecActionAnnotationKey, reason)}
+	}
+
+	action, err := prober.GetExecAction(vm)
+	if err != nil {
+		return invalid(err.Error())
+	}
+
+	var validationErrs []string
+	if len(action.Command) == 0 || action.Command[0] == "" {
+		validationErrs = append(validationErrs, invalid("command must be specified")...)
+	}
+	if action.SecretName == "" {
+		validationErrs = append(validationErrs, invalid("secretName must be specified")...)
+	}
+
+	return validationErrs
+}
+
 func (v validator) validateUpdatesWhenPoweredOn(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
 	var fieldNames []string
 
@@ -425,12 +816,13 @@ func (v validator) validateAdvancedOptionsUpdateWhenPoweredOn(ctx *context.Webho
 }
 
 // validateVsphereVolumesUpdateWhenPoweredOn validates that Volume update request is valid when the VM is powered on.
-// We do not support any modifications to vSphere volumes while the VM is powered on.
+// The only modification to vSphere volumes supported while the VM is powered on is increasing their capacity: their
+// disks are hot-extended.
 func (v validator) validateVsphereVolumesUpdateWhenPoweredOn(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
 	volumesKey := "spec.volumes[VsphereVolume]"
 	var fieldNames []string
 
-	// Do not allow modifications to vSphere Volumes while the VM is powered on.
+	// Do not allow other modifications to vSphere Volumes while the VM is powered on.
 	oldvSphereVolumes := make(map[string]vmopv1.VirtualMachineVolume)
 	for _, vol := range oldVM.Spec.Volumes {
 		if vol.VsphereVolume != nil {
@@ -441,6 +833,10 @@ func (v validator) validateVsphereVolumesUpdateWhenPoweredOn(ctx *context.Webhoo
 	newvSphereVolumes := make(map[string]vmopv1.VirtualMachineVolume)
 	for _, vol := range vm.Spec.Volumes {
 		if vol.VsphereVolume != nil {
+			if oldVol, ok := oldvSphereVolumes[vol.Name]; ok && isVsphereVolumeExpansion(oldVol.VsphereVolume, vol.VsphereVolume) {
+				vol = *vol.DeepCopy()
+				vol.VsphereVolume.Capacity = oldVol.VsphereVolume.Capacity
+			}
 			newvSphereVolumes[vol.Name] = vol
 		}
 	}
@@ -452,6 +848,38 @@ func (v validator) validateVsphereVolumesUpdateWhenPoweredOn(ctx *context.Webhoo
 	return fieldNames
 }
 
+// validateVsphereVolumesUpdate validates that the capacity of the vSphere volumes is not decreased, since their disks
+// cannot be shrunk.
+func (v validator) validateVsphereVolumesUpdate(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
+	var validationErrs []string
+
+	oldCapacities := make(map[string]resource.Quantity)
+	for _, vol := range oldVM.Spec.Volumes {
+		if vol.VsphereVolume != nil {
+			oldCapacities[vol.Name] = *vol.VsphereVolume.Capacity.StorageEphemeral()
+		}
+	}
+
+	for i, vol := range vm.Spec.Volumes {
+		if vol.VsphereVolume == nil {
+			continue
+		}
+		if oldCapacity, ok := oldCapacities[vol.Name]; ok && vol.VsphereVolume.Capacity.StorageEphemeral().Cmp(oldCapacity) < 0 {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.VsphereVolumeSizeDecreaseNotAllowedFmt, i))
+		}
+	}
+
+	return validationErrs
+}
+
+// isVsphereVolumeExpansion returns true if the only change to the vSphere volume is an increase of its capacity.
+func isVsphereVolumeExpansion(oldVol, vol *vmopv1.VsphereVolumeSource) bool {
+	if !reflect.DeepEqual(oldVol.DeviceKey, vol.DeviceKey) {
+		return false
+	}
+	return vol.Capacity.StorageEphemeral().Cmp(*oldVol.Capacity.StorageEphemeral()) > 0
+}
+
 func (v validator) validateImmutableFields(ctx *context.WebhookRequestContext, vm, oldVM *vmopv1.VirtualMachine) []string {
 	var validationErrs, fieldNames []string
 
@@ -461,12 +889,6 @@ func (v validator) validateImmutableFields(ctx *context.WebhookRequestContext, v
 	if vm.Spec.ClassName != oldVM.Spec.ClassName {
 		fieldNames = append(fieldNames, "spec.className")
 	}
-	if vm.Spec.StorageClass != oldVM.Spec.StorageClass {
-		fieldNames = append(fieldNames, "spec.storageClass")
-	}
-	if vm.Spec.ResourcePolicyName != oldVM.Spec.ResourcePolicyName {
-		fieldNames = append(fieldNames, "spec.resourcePolicyName")
-	}
 
 	if len(fieldNames) > 0 {
 		validationErrs = append(validationErrs, fmt.Sprintf(messages.UpdatingImmutableFieldsNotAllowed, fieldNames))
@@ -164,13 +164,13 @@ func intgTestsValidateUpdate() {
 			Expect(err.Error()).To(ContainSubstring("updates to immutable fields are not allowed: [spec.imageName]"))
 		})
 	})
-	When("update is performed with changed storageClass name", func() {
+	When("update is performed with an added storageClass name", func() {
 		BeforeEach(func() {
 			ctx.vm.Spec.StorageClass += "-2"
 		})
 		It("should deny the request", func() {
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("updates to immutable fields are not allowed: [spec.storageClass]"))
+			Expect(err.Error()).To(ContainSubstring(messages.StorageClassAddOrRemoveNotAllowed))
 		})
 	})
 
@@ -19,8 +19,11 @@ import (
 
 	vmopv1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
+	prober "github.com/vmware-tanzu/vm-operator/pkg/prober/probe"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider/providers/vsphere"
 	"github.com/vmware-tanzu/vm-operator/test/builder"
+	"github.com/vmware-tanzu/vm-operator/webhooks/common"
 	"github.com/vmware-tanzu/vm-operator/webhooks/virtualmachine/validation/messages"
 )
 
@@ -88,6 +91,9 @@ func unitTestsValidateCreate() {
 		invalidPVCHwVersion        bool
 		invalidMetadataConfigMap   bool
 		invalidVsphereVolumeSource bool
+		ephemeralVolumeCapacity    string
+		bootDiskCapacity           string
+		orderedVolumeAttachment    string
 		invalidVmVolumeProvOpts    bool
 		invalidStorageClass        bool
 		invalidResourceQuota       bool
@@ -95,6 +101,27 @@ func unitTestsValidateCreate() {
 		imageNonCompatible         bool
 		invalidReadinessNoProbe    bool
 		invalidReadinessProbe      bool
+		httpGetReadinessProbe      string
+		httpGetWithoutProbe        bool
+		httpGetAndTCPProbe         bool
+		execReadinessProbe         string
+		livenessProbe              string
+		readinessThresholds        string
+		powerOffMode               string
+		powerOffTimeout            string
+		powerState                 vmopv1.VirtualMachinePowerState
+		restartRequested           string
+		restartType                string
+		deletionPolicy             string
+		deletionProtection         string
+		importMoID                 string
+		importBiosUUID             string
+		importRelocate             string
+		importedMoID               string
+		metadataSecret             string
+		vmGroupMembership          string
+		resourcePolicyName         string
+		privileged                 bool
 	}
 
 	validateCreate := func(args createArgs, expectedAllowed bool, expectedReason string, expectedErr error) {
@@ -163,6 +190,26 @@ func unitTestsValidateCreate() {
 				},
 			}
 		}
+		if args.ephemeralVolumeCapacity != "" {
+			ctx.vm.Spec.Volumes[0].PersistentVolumeClaim = nil
+			ctx.vm.Spec.Volumes[0].VsphereVolume = &vmopv1.VsphereVolumeSource{
+				Capacity: map[corev1.ResourceName]resource.Quantity{
+					"ephemeral-storage": resource.MustParse(args.ephemeralVolumeCapacity),
+				},
+			}
+		}
+		if args.bootDiskCapacity != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.BootDiskCapacityAnnotationKey] = args.bootDiskCapacity
+		}
+		if args.orderedVolumeAttachment != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.OrderedVolumeAttachmentAnnotationKey] = args.orderedVolumeAttachment
+		}
 		if args.invalidVmVolumeProvOpts {
 			setProvOpts := true
 			ctx.vm.Spec.AdvancedOptions = &vmopv1.VirtualMachineAdvancedOptions{
@@ -200,6 +247,106 @@ func unitTestsValidateCreate() {
 				GuestHeartbeat: &vmopv1.GuestHeartbeatAction{},
 			}
 		}
+		if args.httpGetReadinessProbe != "" || args.httpGetWithoutProbe || args.httpGetAndTCPProbe {
+			httpGet := args.httpGetReadinessProbe
+			if httpGet == "" {
+				httpGet = `{"port": 80}`
+			}
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[prober.HTTPGetActionAnnotationKey] = httpGet
+			if !args.httpGetWithoutProbe {
+				ctx.vm.Spec.ReadinessProbe = &vmopv1.Probe{}
+			}
+			if args.httpGetAndTCPProbe {
+				ctx.vm.Spec.ReadinessProbe.TCPSocket = &vmopv1.TCPSocketAction{}
+			}
+		}
+
+		if args.execReadinessProbe != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[prober.ExecActionAnnotationKey] = args.execReadinessProbe
+			ctx.vm.Spec.ReadinessProbe = &vmopv1.Probe{}
+		}
+		if args.livenessProbe != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[prober.LivenessProbeAnnotationKey] = args.livenessProbe
+		}
+		if args.readinessThresholds != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[prober.ThresholdsAnnotationKey] = args.readinessThresholds
+			ctx.vm.Spec.ReadinessProbe = &vmopv1.Probe{TCPSocket: &vmopv1.TCPSocketAction{}}
+		}
+		if args.powerOffMode != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.PowerOffModeAnnotationKey] = args.powerOffMode
+		}
+		if args.powerOffTimeout != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.PowerOffTimeoutAnnotationKey] = args.powerOffTimeout
+		}
+		if args.powerState != "" {
+			ctx.vm.Spec.PowerState = args.powerState
+		}
+		if args.restartRequested != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.RestartRequestedAnnotationKey] = args.restartRequested
+		}
+		if args.restartType != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.RestartTypeAnnotationKey] = args.restartType
+		}
+		if args.deletionPolicy != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.DeletionPolicyAnnotationKey] = args.deletionPolicy
+		}
+		if args.deletionProtection != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.DeletionProtectionAnnotationKey] = args.deletionProtection
+		}
+		for key, value := range map[string]string{
+			vmprovider.ImportMoIDAnnotationKey:     args.importMoID,
+			vmprovider.ImportBiosUUIDAnnotationKey: args.importBiosUUID,
+			vmprovider.ImportRelocateAnnotationKey: args.importRelocate,
+			vmprovider.ImportedMoIDAnnotationKey:   args.importedMoID,
+			vmprovider.MetadataSecretAnnotationKey: args.metadataSecret,
+		} {
+			if value != "" {
+				if ctx.vm.Annotations == nil {
+					ctx.vm.Annotations = map[string]string{}
+				}
+				ctx.vm.Annotations[key] = value
+			}
+		}
+		if args.vmGroupMembership != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.VMGroupMembershipAnnotationKey] = args.vmGroupMembership
+		}
+		if args.resourcePolicyName != "" {
+			ctx.vm.Spec.ResourcePolicyName = args.resourcePolicyName
+		}
+		ctx.IsPrivilegedAccount = args.privileged
 
 		ctx.WebhookRequestContext.Obj, err = builder.ToUnstructured(ctx.vm)
 		Expect(err).ToNot(HaveOccurred())
@@ -227,6 +374,73 @@ func unitTestsValidateCreate() {
 		Entry("should deny invalid image name", createArgs{invalidImageName: true}, false, messages.ImageNotSpecified, nil),
 		Entry("should fail when Readiness probe has multiple actions", createArgs{invalidReadinessProbe: true}, false, fmt.Sprintf(messages.ReadinessProbeOnlyOneAction), nil),
 		Entry("should fail when Readiness probe has no actions", createArgs{invalidReadinessNoProbe: true}, false, fmt.Sprintf(messages.ReadinessProbeNoActions), nil),
+		Entry("should allow Readiness probe with an HTTP GET action", createArgs{httpGetReadinessProbe: `{"port": "http", "scheme": "HTTPS", "path": "/healthz"}`}, true, nil, nil),
+		Entry("should fail when Readiness probe has HTTP GET and TCP actions", createArgs{httpGetAndTCPProbe: true}, false, messages.ReadinessProbeOnlyOneAction, nil),
+		Entry("should fail when HTTP GET action has no Readiness probe", createArgs{httpGetWithoutProbe: true}, false,
+			fmt.Sprintf(messages.ReadinessProbeAnnotationNoProbeFmt, prober.HTTPGetActionAnnotationKey), nil),
+		Entry("should fail when HTTP GET action is not JSON", createArgs{httpGetReadinessProbe: "{"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.HTTPGetActionAnnotationKey, ""), nil),
+		Entry("should fail when HTTP GET action has no port", createArgs{httpGetReadinessProbe: `{"path": "/"}`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.HTTPGetActionAnnotationKey, "port must be specified"), nil),
+		Entry("should fail when HTTP GET action has an invalid scheme", createArgs{httpGetReadinessProbe: `{"port": 80, "scheme": "FTP"}`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.HTTPGetActionAnnotationKey, "scheme must be"), nil),
+		Entry("should fail when HTTP GET action has an invalid status code range", createArgs{httpGetReadinessProbe: `{"port": 80, "minStatusCode": 400, "maxStatusCode": 200}`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.HTTPGetActionAnnotationKey, "status code range"), nil),
+		Entry("should allow Readiness probe with an exec action", createArgs{execReadinessProbe: `{"command": ["/bin/true"], "secretName": "guest-creds"}`}, true, nil, nil),
+		Entry("should fail when exec action has no command", createArgs{execReadinessProbe: `{"secretName": "guest-creds"}`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.ExecActionAnnotationKey, "command must be specified"), nil),
+		Entry("should fail when exec action has no Secret", createArgs{execReadinessProbe: `{"command": ["/bin/true"]}`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.ExecActionAnnotationKey, "secretName must be specified"), nil),
+		Entry("should allow liveness probe", createArgs{livenessProbe: `{"guestHeartbeat": {"thresholdStatus": "green"}, "remediation": "Reset"}`}, true, nil, nil),
+		Entry("should fail when liveness probe is not JSON", createArgs{livenessProbe: "{"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.LivenessProbeAnnotationKey, ""), nil),
+		Entry("should fail when liveness probe has no action", createArgs{livenessProbe: `{"failureThreshold": 3}`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.LivenessProbeAnnotationKey, "tcpSocket or guestHeartbeat must be specified"), nil),
+		Entry("should fail when liveness probe has an invalid remediation", createArgs{livenessProbe: `{"tcpSocket": {"port": 22}, "remediation": "Delete"}`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.LivenessProbeAnnotationKey, "remediation must be one of"), nil),
+		Entry("should allow Readiness probe thresholds", createArgs{readinessThresholds: `{"initialDelaySeconds": 30, "successThreshold": 2, "failureThreshold": 5}`}, true, nil, nil),
+		Entry("should fail when Readiness probe thresholds are not JSON", createArgs{readinessThresholds: "{"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.ThresholdsAnnotationKey, ""), nil),
+		Entry("should fail when Readiness probe thresholds are negative", createArgs{readinessThresholds: `{"failureThreshold": -1}`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, prober.ThresholdsAnnotationKey, "failureThreshold must not be negative"), nil),
+		Entry("should allow TrySoft power-off mode", createArgs{powerOffMode: "TrySoft", powerOffTimeout: "5m"}, true, nil, nil),
+		Entry("should fail when power-off mode is invalid", createArgs{powerOffMode: "Soft"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffModeAnnotationKey, "invalid power-off mode"), nil),
+		Entry("should fail when power-off timeout is invalid", createArgs{powerOffTimeout: "5"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffTimeoutAnnotationKey, "invalid power-off timeout"), nil),
+		Entry("should fail when power-off timeout is too long", createArgs{powerOffTimeout: "2h"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffTimeoutAnnotationKey, `invalid power-off timeout "2h": must not be greater than`), nil),
+		Entry("should deny suspended power state", createArgs{powerState: vmprovider.VirtualMachineSuspended}, false,
+			fmt.Sprintf(messages.PowerStateTransitionNotAllowedFmt, "", vmprovider.VirtualMachineSuspended), nil),
+		Entry("should deny unsupported power state", createArgs{powerState: "standby"}, false,
+			fmt.Sprintf(messages.PowerStateNotSupportedFmt, "standby"), nil),
+		Entry("should allow restart request", createArgs{restartRequested: "2021-06-01T10:00:00Z", restartType: "Reset"}, true, nil, nil),
+		Entry("should fail when restart request is not a time", createArgs{restartRequested: "now"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.RestartRequestedAnnotationKey, "invalid restart time"), nil),
+		Entry("should fail when restart type is invalid", createArgs{restartType: "Shutdown"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.RestartTypeAnnotationKey, "invalid restart type"), nil),
+		Entry("should allow Retain deletion policy and deletion protection", createArgs{deletionPolicy: "Retain", deletionProtection: "true"}, true, nil, nil),
+		Entry("should fail when deletion policy is invalid", createArgs{deletionPolicy: "Orphan"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.DeletionPolicyAnnotationKey, "invalid deletion policy"), nil),
+		Entry("should fail when deletion protection is invalid", createArgs{deletionProtection: "yes"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.DeletionProtectionAnnotationKey, "invalid deletion protection"), nil),
+		Entry("should allow import by MoID by VM Operator", createArgs{importMoID: "vm-42", importRelocate: "true", privileged: true}, true, nil, nil),
+		Entry("should deny import by MoID by a user", createArgs{importMoID: "vm-42"}, false,
+			fmt.Sprintf(messages.PrivilegedAnnotationNotAllowedFmt, vmprovider.ImportMoIDAnnotationKey), nil),
+		Entry("should deny import by BIOS UUID by a user", createArgs{importBiosUUID: "4216b2fa-1f6e-4c3d-a1b2-0123456789ab"}, false,
+			fmt.Sprintf(messages.PrivilegedAnnotationNotAllowedFmt, vmprovider.ImportBiosUUIDAnnotationKey), nil),
+		Entry("should fail when import has both MoID and BIOS UUID", createArgs{importMoID: "vm-42", importBiosUUID: "4216b2fa-1f6e-4c3d-a1b2-0123456789ab", privileged: true}, false,
+			fmt.Sprintf(messages.ImportAnnotationInvalidFmt, "only one of"), nil),
+		Entry("should fail when import relocate is invalid", createArgs{importBiosUUID: "4216b2fa-1f6e-4c3d-a1b2-0123456789ab", importRelocate: "yes", privileged: true}, false,
+			fmt.Sprintf(messages.ImportAnnotationInvalidFmt, "invalid import relocate"), nil),
+		Entry("should allow metadata Secret set by VM Operator", createArgs{metadataSecret: "vm-cloud-init", privileged: true}, true, nil, nil),
+		Entry("should deny metadata Secret set by a user", createArgs{metadataSecret: "vm-cloud-init"}, false,
+			fmt.Sprintf(messages.PrivilegedAnnotationNotAllowedFmt, vmprovider.MetadataSecretAnnotationKey), nil),
+		Entry("should deny imported MoID set by a user", createArgs{importedMoID: "vm-42"}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.ImportedMoIDAnnotationKey), nil),
+		Entry("should allow VM group membership with a resource policy", createArgs{vmGroupMembership: "db,web", resourcePolicyName: "policy"}, true, nil, nil),
+		Entry("should fail when VM group membership has no resource policy", createArgs{vmGroupMembership: "db"}, false,
+			fmt.Sprintf(messages.VMGroupMembershipNoResourcePolicyFmt, vmprovider.VMGroupMembershipAnnotationKey), nil),
 		Entry("should deny invalid network name for VDS network type", createArgs{invalidNetworkName: true}, false, fmt.Sprintf(messages.NetworkNameNotSpecifiedFmt, 0), nil),
 		Entry("should deny invalid network type", createArgs{invalidNetworkType: true}, false, fmt.Sprintf(messages.NetworkTypeNotSupportedFmt, 0, vsphere.NsxtNetworkType, vsphere.VdsNetworkType), nil),
 		Entry("should deny invalid network card type", createArgs{invalidNetworkCardType: true}, false, fmt.Sprintf(messages.NetworkTypeEthCardTypeNotSupportedFmt, 0), nil),
@@ -241,6 +455,14 @@ func unitTestsValidateCreate() {
 		Entry("should deny invalid PVC name", createArgs{invalidPVCReadOnly: true}, false, fmt.Sprintf(messages.PersistentVolumeClaimNameReadOnlyFmt, 0), nil),
 		Entry("should deny invalid PVC hardware verion", createArgs{invalidPVCHwVersion: true}, false, fmt.Sprintf(messages.PersistentVolumeClaimHardwareVersionNotSupported, builder.DummyImageName, 12, 13), nil),
 		Entry("should deny invalid vsphere volume source spec", createArgs{invalidVsphereVolumeSource: true}, false, fmt.Sprintf(messages.VsphereVolumeSizeNotMBMultipleFmt, 0), nil),
+		Entry("should allow ephemeral vsphere volume", createArgs{ephemeralVolumeCapacity: "10Gi"}, true, nil, nil),
+		Entry("should deny ephemeral vsphere volume without capacity", createArgs{ephemeralVolumeCapacity: "0"}, false, fmt.Sprintf(messages.VsphereVolumeSizeNotSpecifiedFmt, 0), nil),
+		Entry("should allow boot disk capacity", createArgs{bootDiskCapacity: "40Gi"}, true, nil, nil),
+		Entry("should deny boot disk capacity that is not a multiple of MB", createArgs{bootDiskCapacity: "1Ki"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.BootDiskCapacityAnnotationKey, `invalid boot disk capacity "1Ki": must be a positive multiple of MB`), nil),
+		Entry("should allow ordered volume attachment", createArgs{orderedVolumeAttachment: "true"}, true, nil, nil),
+		Entry("should deny invalid ordered volume attachment", createArgs{orderedVolumeAttachment: "sometimes"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.OrderedVolumeAttachmentAnnotationKey, `invalid ordered volume attachment "sometimes": must be true or false`), nil),
 		Entry("should deny invalid vm volume provisioning opts", createArgs{invalidVmVolumeProvOpts: true}, false, fmt.Sprintf(messages.EagerZeroedAndThinProvisionedNotSupported), nil),
 		Entry("should deny invalid vmMetadata configmap", createArgs{invalidMetadataConfigMap: true}, false, messages.MetadataTransportConfigMapNotSpecified, nil),
 		Entry("should deny invalid resource quota", createArgs{invalidResourceQuota: true}, false, fmt.Sprintf(messages.NoResourceQuota, ""), nil),
@@ -260,7 +482,30 @@ func unitTestsValidateUpdate() {
 		changeClassName      bool
 		changeImageName      bool
 		changeStorageClass   bool
+		removeStorageClass   bool
+		storageClassQuota    bool
 		changeResourcePolicy bool
+
+		oldPowerState    vmopv1.VirtualMachinePowerState
+		powerState       vmopv1.VirtualMachinePowerState
+		restartRequested string
+
+		importPending      bool
+		imported           bool
+		changeImportMoID   bool
+		changeImportedMoID bool
+		addNetworkAndDisk  bool
+
+		placed     bool
+		migrating  bool
+		changeZone bool
+		removeZone bool
+
+		changeMigrationAnnotation string
+
+		vsphereVolumeCapacity string
+
+		privileged bool
 	}
 
 	validateUpdate := func(args updateArgs, expectedAllowed bool, expectedReason string, expectedErr error) {
@@ -272,14 +517,118 @@ func unitTestsValidateUpdate() {
 		if args.changeImageName {
 			ctx.vm.Spec.ImageName += updateSuffix
 		}
-		if args.changeStorageClass {
-			ctx.vm.Spec.StorageClass += updateSuffix
+		if args.changeStorageClass || args.removeStorageClass {
+			ctx.oldVM.Spec.StorageClass = "old-storage-class"
+			ctx.WebhookRequestContext.OldObj, err = builder.ToUnstructured(ctx.oldVM)
+			Expect(err).ToNot(HaveOccurred())
+			if args.changeStorageClass {
+				ctx.vm.Spec.StorageClass = builder.DummyStorageClassName
+			}
+		}
+		if args.storageClassQuota {
+			rlName := builder.DummyStorageClassName + ".storageclass.storage.k8s.io/persistentvolumeclaims"
+			Expect(ctx.Client.Create(ctx, builder.DummyResourceQuota(ctx.vm.Namespace, rlName))).To(Succeed())
 		}
 
 		if args.changeResourcePolicy {
 			ctx.vm.Spec.ResourcePolicyName = updateSuffix
 		}
 
+		if args.oldPowerState != "" {
+			ctx.oldVM.Spec.PowerState = args.oldPowerState
+			ctx.WebhookRequestContext.OldObj, err = builder.ToUnstructured(ctx.oldVM)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		if args.powerState != "" {
+			ctx.vm.Spec.PowerState = args.powerState
+		}
+		if args.restartRequested != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.RestartRequestedAnnotationKey] = args.restartRequested
+		}
+
+		if args.importPending || args.imported {
+			if ctx.oldVM.Annotations == nil {
+				ctx.oldVM.Annotations = map[string]string{}
+			}
+			ctx.oldVM.Annotations[vmprovider.ImportMoIDAnnotationKey] = "vm-42"
+			if args.imported {
+				ctx.oldVM.Status.UniqueID = "vm-42"
+			}
+			ctx.WebhookRequestContext.OldObj, err = builder.ToUnstructured(ctx.oldVM)
+			Expect(err).ToNot(HaveOccurred())
+
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[vmprovider.ImportMoIDAnnotationKey] = "vm-42"
+			if args.changeImportMoID {
+				ctx.vm.Annotations[vmprovider.ImportMoIDAnnotationKey] = "vm-43"
+			}
+			if args.changeImportedMoID {
+				ctx.vm.Annotations[vmprovider.ImportedMoIDAnnotationKey] = "vm-42"
+			}
+		}
+		if args.addNetworkAndDisk {
+			ctx.vm.Spec.NetworkInterfaces = append(ctx.vm.Spec.NetworkInterfaces, vmopv1.VirtualMachineNetworkInterface{
+				NetworkType: vsphere.VdsNetworkType,
+				NetworkName: "imported-network",
+			})
+			ctx.vm.Spec.Volumes = append(ctx.vm.Spec.Volumes, vmopv1.VirtualMachineVolume{
+				Name: "disk-2000",
+				VsphereVolume: &vmopv1.VsphereVolumeSource{
+					Capacity: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+				},
+			})
+		}
+
+		if args.vsphereVolumeCapacity != "" {
+			deviceKey := 2001
+			vsphereVolume := func(capacity string) vmopv1.VirtualMachineVolume {
+				return vmopv1.VirtualMachineVolume{
+					Name: "data",
+					VsphereVolume: &vmopv1.VsphereVolumeSource{
+						Capacity:  corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse(capacity)},
+						DeviceKey: &deviceKey,
+					},
+				}
+			}
+			ctx.oldVM.Spec.Volumes = append(ctx.oldVM.Spec.Volumes, vsphereVolume("2Gi"))
+			ctx.WebhookRequestContext.OldObj, err = builder.ToUnstructured(ctx.oldVM)
+			Expect(err).ToNot(HaveOccurred())
+			ctx.vm.Spec.Volumes = append(ctx.vm.Spec.Volumes, vsphereVolume(args.vsphereVolumeCapacity))
+		}
+
+		if args.placed {
+			ctx.oldVM.Status.UniqueID = "vm-42"
+			ctx.oldVM.Labels = map[string]string{vmprovider.ZoneLabelKey: "zone-a"}
+			ctx.vm.Labels = map[string]string{vmprovider.ZoneLabelKey: "zone-a"}
+			if args.migrating {
+				ctx.oldVM.Annotations = map[string]string{vmprovider.MigrationTaskAnnotationKey: "task-42"}
+				ctx.vm.Annotations = map[string]string{vmprovider.MigrationTaskAnnotationKey: "task-42"}
+			}
+			ctx.WebhookRequestContext.OldObj, err = builder.ToUnstructured(ctx.oldVM)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		if args.changeZone {
+			if ctx.vm.Labels == nil {
+				ctx.vm.Labels = map[string]string{}
+			}
+			ctx.vm.Labels[vmprovider.ZoneLabelKey] = "zone-b"
+		}
+		if args.removeZone {
+			delete(ctx.vm.Labels, vmprovider.ZoneLabelKey)
+		}
+		if args.changeMigrationAnnotation != "" {
+			if ctx.vm.Annotations == nil {
+				ctx.vm.Annotations = map[string]string{}
+			}
+			ctx.vm.Annotations[args.changeMigrationAnnotation] = updateSuffix
+		}
+		ctx.IsPrivilegedAccount = args.privileged
+
 		ctx.WebhookRequestContext.Obj, err = builder.ToUnstructured(ctx.vm)
 		Expect(err).ToNot(HaveOccurred())
 
@@ -305,8 +654,62 @@ func unitTestsValidateUpdate() {
 		Entry("should allow", updateArgs{}, true, nil, nil),
 		Entry("should deny class name change", updateArgs{changeClassName: true}, false, "updates to immutable fields are not allowed: [spec.className]", nil),
 		Entry("should deny image name change", updateArgs{changeImageName: true}, false, "updates to immutable fields are not allowed: [spec.imageName]", nil),
-		Entry("should deny storageClass change", updateArgs{changeStorageClass: true}, false, "updates to immutable fields are not allowed: [spec.storageClass]", nil),
-		Entry("should deny resourcePolicy change", updateArgs{changeResourcePolicy: true}, false, "updates to immutable fields are not allowed: [spec.resourcePolicyName]", nil),
+		Entry("should allow storageClass change to a storage class of a ResourceQuota", updateArgs{changeStorageClass: true, storageClassQuota: true}, true, nil, nil),
+		Entry("should deny storageClass change to a storage class without ResourceQuota", updateArgs{changeStorageClass: true}, false,
+			fmt.Sprintf(messages.NoResourceQuota, ""), nil),
+		Entry("should deny storageClass removal", updateArgs{removeStorageClass: true}, false, messages.StorageClassAddOrRemoveNotAllowed, nil),
+		Entry("should allow resourcePolicy change", updateArgs{changeResourcePolicy: true}, true, nil, nil),
+
+		// Power State
+		Entry("should allow suspending a powered on VM", updateArgs{powerState: vmprovider.VirtualMachineSuspended}, true, nil, nil),
+		Entry("should allow resuming a suspended VM", updateArgs{oldPowerState: vmprovider.VirtualMachineSuspended, powerState: vmopv1.VirtualMachinePoweredOn}, true, nil, nil),
+		Entry("should allow powering off a suspended VM", updateArgs{oldPowerState: vmprovider.VirtualMachineSuspended, powerState: vmopv1.VirtualMachinePoweredOff}, true, nil, nil),
+		Entry("should deny suspending a powered off VM", updateArgs{oldPowerState: vmopv1.VirtualMachinePoweredOff, powerState: vmprovider.VirtualMachineSuspended}, false,
+			fmt.Sprintf(messages.PowerStateTransitionNotAllowedFmt, vmopv1.VirtualMachinePoweredOff, vmprovider.VirtualMachineSuspended), nil),
+		Entry("should allow restart request of a powered on VM", updateArgs{restartRequested: "2021-06-01T10:00:00Z"}, true, nil, nil),
+		Entry("should deny restart request of a powered off VM", updateArgs{oldPowerState: vmopv1.VirtualMachinePoweredOff, powerState: vmopv1.VirtualMachinePoweredOff, restartRequested: "2021-06-01T10:00:00Z"}, false,
+			fmt.Sprintf(messages.RestartNotAllowedInPowerStateFmt, vmopv1.VirtualMachinePoweredOff), nil),
+		Entry("should deny restart request of a VM being suspended", updateArgs{powerState: vmprovider.VirtualMachineSuspended, restartRequested: "2021-06-01T10:00:00Z"}, false,
+			fmt.Sprintf(messages.RestartNotAllowedInPowerStateFmt, vmprovider.VirtualMachineSuspended), nil),
+
+		// vSphere Volumes
+		Entry("should allow growing a vSphere volume of a powered on VM", updateArgs{vsphereVolumeCapacity: "4Gi"}, true, nil, nil),
+		Entry("should allow growing a vSphere volume of a powered off VM", updateArgs{oldPowerState: vmopv1.VirtualMachinePoweredOff, powerState: vmopv1.VirtualMachinePoweredOff, vsphereVolumeCapacity: "4Gi"}, true, nil, nil),
+		Entry("should deny shrinking a vSphere volume", updateArgs{oldPowerState: vmopv1.VirtualMachinePoweredOff, powerState: vmopv1.VirtualMachinePoweredOff, vsphereVolumeCapacity: "1Gi"}, false,
+			fmt.Sprintf(messages.VsphereVolumeSizeDecreaseNotAllowedFmt, 1), nil),
+
+		// Import
+		Entry("should allow back-filling the spec of a VM being imported", updateArgs{importPending: true, addNetworkAndDisk: true}, true, nil, nil),
+		Entry("should deny adding a network and disk to an imported powered on VM", updateArgs{imported: true, addNetworkAndDisk: true}, false, nil, nil),
+		Entry("should allow changing the import source before the VM is imported by VM Operator", updateArgs{importPending: true, changeImportMoID: true, privileged: true}, true, nil, nil),
+		Entry("should deny changing the import source by a user", updateArgs{importPending: true, changeImportMoID: true}, false,
+			fmt.Sprintf(messages.PrivilegedAnnotationNotAllowedFmt, vmprovider.ImportMoIDAnnotationKey), nil),
+		Entry("should deny changing the import source after the VM is imported", updateArgs{imported: true, changeImportMoID: true, privileged: true}, false, messages.ImportSourceUpdateNotAllowed, nil),
+		Entry("should allow setting the imported MoID by VM Operator", updateArgs{importPending: true, changeImportedMoID: true, privileged: true}, true, nil, nil),
+		Entry("should deny setting the imported MoID by a user", updateArgs{importPending: true, changeImportedMoID: true}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.ImportedMoIDAnnotationKey), nil),
+
+		// Zone
+		Entry("should allow setting the zone before the VM is placed", updateArgs{changeZone: true}, true, nil, nil),
+		Entry("should allow changing the zone after the VM is placed", updateArgs{placed: true, changeZone: true}, true, nil, nil),
+		Entry("should deny removing the zone after the VM is placed", updateArgs{placed: true, removeZone: true}, false,
+			fmt.Sprintf(messages.ZoneRemovalNotAllowedFmt, vmprovider.ZoneLabelKey), nil),
+
+		// Migration
+		Entry("should allow resourcePolicy change of a placed VM", updateArgs{placed: true, changeResourcePolicy: true}, true, nil, nil),
+		Entry("should deny resourcePolicy change while the VM is migrating", updateArgs{placed: true, migrating: true, changeResourcePolicy: true}, false,
+			fmt.Sprintf(messages.MigrationInProgressFmt, "spec.resourcePolicyName"), nil),
+		Entry("should deny storageClass change while the VM is migrating", updateArgs{placed: true, migrating: true, changeStorageClass: true, storageClassQuota: true}, false,
+			fmt.Sprintf(messages.MigrationInProgressFmt, "spec.storageClass"), nil),
+		Entry("should deny changing the zone while the VM is migrating", updateArgs{placed: true, migrating: true, changeZone: true}, false,
+			fmt.Sprintf(messages.MigrationInProgressFmt, "label "+vmprovider.ZoneLabelKey), nil),
+		Entry("should allow changing the migration task by VM Operator", updateArgs{placed: true, changeMigrationAnnotation: vmprovider.MigrationTaskAnnotationKey, privileged: true}, true, nil, nil),
+		Entry("should deny changing the migration task by a user", updateArgs{placed: true, migrating: true, changeMigrationAnnotation: vmprovider.MigrationTaskAnnotationKey}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.MigrationTaskAnnotationKey), nil),
+		Entry("should deny changing the storage class annotation by a user", updateArgs{placed: true, changeMigrationAnnotation: vmprovider.StorageClassAnnotationKey}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.StorageClassAnnotationKey), nil),
+		Entry("should deny changing the attached resource policy by a user", updateArgs{placed: true, changeMigrationAnnotation: vmprovider.AttachedResourcePolicyAnnotationKey}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.AttachedResourcePolicyAnnotationKey), nil),
 	)
 
 	When("the update is performed while object deletion", func() {
@@ -348,5 +751,19 @@ func unitTestsValidateDelete() {
 			Expect(response.Allowed).To(BeTrue())
 			Expect(response.Result).ToNot(BeNil())
 		})
+
+		When("the VM has deletion protection", func() {
+			BeforeEach(func() {
+				var err error
+				ctx.vm.Annotations = map[string]string{vmprovider.DeletionProtectionAnnotationKey: "true"}
+				ctx.WebhookRequestContext.Obj, err = builder.ToUnstructured(ctx.vm)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("should deny the request", func() {
+				Expect(response.Allowed).To(BeFalse())
+				Expect(string(response.Result.Reason)).To(ContainSubstring(fmt.Sprintf(messages.DeletionProtectedFmt, vmprovider.DeletionProtectionAnnotationKey)))
+			})
+		})
 	})
 }
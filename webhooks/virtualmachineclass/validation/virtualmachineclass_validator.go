@@ -4,6 +4,7 @@
 package validation
 
 import (
+	"fmt"
 	"net/http"
 	"reflect"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/vmware-tanzu/vm-operator/pkg/builder"
 	"github.com/vmware-tanzu/vm-operator/pkg/context"
 	"github.com/vmware-tanzu/vm-operator/pkg/lib"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	"github.com/vmware-tanzu/vm-operator/webhooks/common"
 	"github.com/vmware-tanzu/vm-operator/webhooks/virtualmachineclass/validation/messages"
 )
@@ -91,6 +93,8 @@ func (v validator) ValidateUpdate(ctx *context.WebhookRequestContext) admission.
 		return webhook.Errored(http.StatusBadRequest, err)
 	}
 
+	validationErrs = append(validationErrs, v.validateMetadata(ctx, vmClass)...)
+
 	// If the WCP_VMService FSS is enabled, we allow VirtualMachineClasses edits.
 	if !lib.IsVMServiceFSSEnabled() {
 		validationErrs = append(validationErrs, v.validateAllowedChanges(ctx, vmClass, oldVMClass)...)
@@ -101,6 +105,19 @@ func (v validator) ValidateUpdate(ctx *context.WebhookRequestContext) admission.
 
 func (v validator) validateMetadata(ctx *context.WebhookRequestContext, vmClass *vmopv1.VirtualMachineClass) []string {
 	var validationErrs []string
+
+	// The power-off and boot disk annotations of the class are the defaults of its VMs.
+	vm := &vmopv1.VirtualMachine{}
+	if _, err := vmprovider.GetPowerOffMode(vm, vmClass); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffModeAnnotationKey, err))
+	}
+	if _, err := vmprovider.GetPowerOffTimeout(vm, vmClass); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffTimeoutAnnotationKey, err))
+	}
+	if _, err := vmprovider.GetBootDiskCapacity(vm, vmClass); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.BootDiskCapacityAnnotationKey, err))
+	}
+
 	return validationErrs
 }
 
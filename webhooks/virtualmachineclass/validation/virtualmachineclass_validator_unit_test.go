@@ -4,6 +4,8 @@
 package validation_test
 
 import (
+	"fmt"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -15,7 +17,9 @@ import (
 	vmopv1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
 	"github.com/vmware-tanzu/vm-operator/pkg/lib"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	"github.com/vmware-tanzu/vm-operator/test/builder"
+	"github.com/vmware-tanzu/vm-operator/webhooks/common"
 )
 
 func unitTests() {
@@ -61,6 +65,9 @@ func unitTestsValidateCreate() {
 		invalidMemoryRequest bool
 		noCpuLimit           bool
 		noMemoryLimit        bool
+		powerOffMode         string
+		powerOffTimeout      string
+		bootDiskCapacity     string
 	}
 
 	validateCreate := func(args createArgs, expectedAllowed bool, expectedReason string, expectedErr error) {
@@ -80,6 +87,15 @@ func unitTestsValidateCreate() {
 		if args.noMemoryLimit {
 			ctx.vmClass.Spec.Policies.Resources.Limits.Memory = resource.MustParse("0")
 		}
+		if args.powerOffMode != "" || args.powerOffTimeout != "" {
+			ctx.vmClass.Annotations = map[string]string{
+				vmprovider.PowerOffModeAnnotationKey:    args.powerOffMode,
+				vmprovider.PowerOffTimeoutAnnotationKey: args.powerOffTimeout,
+			}
+		}
+		if args.bootDiskCapacity != "" {
+			ctx.vmClass.Annotations = map[string]string{vmprovider.BootDiskCapacityAnnotationKey: args.bootDiskCapacity}
+		}
 
 		ctx.WebhookRequestContext.Obj, err = builder.ToUnstructured(ctx.vmClass)
 		Expect(err).ToNot(HaveOccurred())
@@ -107,6 +123,16 @@ func unitTestsValidateCreate() {
 		Entry("should allow no memory limit", createArgs{noMemoryLimit: true}, true, nil, nil),
 		Entry("should deny invalid cpu request", createArgs{invalidCpuRequest: true}, false, "CPU request must not be larger than the CPU limit", nil),
 		Entry("should deny invalid memory request", createArgs{invalidMemoryRequest: true}, false, "memory request must not be larger than the memory limit", nil),
+		Entry("should allow TrySoft power-off mode", createArgs{powerOffMode: "TrySoft", powerOffTimeout: "90s"}, true, nil, nil),
+		Entry("should deny invalid power-off mode", createArgs{powerOffMode: "Soft", powerOffTimeout: "90s"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffModeAnnotationKey, `invalid power-off mode "Soft": must be Hard or TrySoft`), nil),
+		Entry("should deny invalid power-off timeout", createArgs{powerOffMode: "TrySoft", powerOffTimeout: "-1s"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffTimeoutAnnotationKey, `invalid power-off timeout "-1s": must be positive`), nil),
+		Entry("should deny too long power-off timeout", createArgs{powerOffMode: "TrySoft", powerOffTimeout: "1h"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.PowerOffTimeoutAnnotationKey, `invalid power-off timeout "1h": must not be greater than 30m0s`), nil),
+		Entry("should allow boot disk capacity", createArgs{bootDiskCapacity: "40Gi"}, true, nil, nil),
+		Entry("should deny invalid boot disk capacity", createArgs{bootDiskCapacity: "40 GB"}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.BootDiskCapacityAnnotationKey, `invalid boot disk capacity "40 GB": quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$'`), nil),
 	)
 }
 
@@ -4,7 +4,8 @@
 package messages
 
 const (
-	UpdatingImmutableFieldsNotAllowed = "updates to immutable fields are not allowed"
-	InvalidMemoryRequest              = "memory reservation must not be larger than the memory limit"
-	InvalidCPURequest                 = "CPU reservation must not be larger than the CPU limit"
+	UpdatingImmutableFieldsNotAllowed         = "updates to immutable fields are not allowed"
+	InvalidMemoryRequest                      = "memory reservation must not be larger than the memory limit"
+	InvalidCPURequest                         = "CPU reservation must not be larger than the CPU limit"
+	UpdatingVMOperatorAnnotationNotAllowedFmt = "annotation %s is set by VM Operator and cannot be changed"
 )
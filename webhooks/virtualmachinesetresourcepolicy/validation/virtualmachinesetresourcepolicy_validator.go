@@ -4,6 +4,7 @@
 package validation
 
 import (
+	"fmt"
 	"net/http"
 	"reflect"
 
@@ -22,6 +23,7 @@ import (
 
 	"github.com/vmware-tanzu/vm-operator/pkg/builder"
 	"github.com/vmware-tanzu/vm-operator/pkg/context"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	"github.com/vmware-tanzu/vm-operator/webhooks/common"
 	"github.com/vmware-tanzu/vm-operator/webhooks/virtualmachinesetresourcepolicy/validation/messages"
 )
@@ -69,8 +71,10 @@ func (v validator) ValidateCreate(ctx *context.WebhookRequestContext) admission.
 	}
 
 	validationErrs = append(validationErrs, v.validateMetadata(ctx, vmRP)...)
+	validationErrs = append(validationErrs, v.validateResourcePoolName(ctx, vmRP)...)
 	validationErrs = append(validationErrs, v.validateMemory(ctx, vmRP)...)
 	validationErrs = append(validationErrs, v.validateCPU(ctx, vmRP)...)
+	validationErrs = append(validationErrs, v.validateVMOperatorAnnotations(ctx, vmRP, nil)...)
 
 	return common.BuildValidationResponse(ctx, validationErrs, nil)
 }
@@ -92,12 +96,51 @@ func (v validator) ValidateUpdate(ctx *context.WebhookRequestContext) admission.
 		return webhook.Errored(http.StatusBadRequest, err)
 	}
 
+	validationErrs = append(validationErrs, v.validateMetadata(ctx, vmRP)...)
+	validationErrs = append(validationErrs, v.validateMemory(ctx, vmRP)...)
+	validationErrs = append(validationErrs, v.validateCPU(ctx, vmRP)...)
 	validationErrs = append(validationErrs, v.validateAllowedChanges(ctx, vmRP, oldVMRP)...)
+	validationErrs = append(validationErrs, v.validateVMOperatorAnnotations(ctx, vmRP, oldVMRP)...)
 	return common.BuildValidationResponse(ctx, validationErrs, nil)
 }
 
+// ValidateUpdateOnDeleting only denies the changes to the annotations set by VM Operator, since VM
+// Operator deletes the vSphere objects they name when the resource policy is deleted.
+func (v validator) ValidateUpdateOnDeleting(ctx *context.WebhookRequestContext) admission.Response {
+	vmRP, err := v.vmRPFromUnstructured(ctx.Obj)
+	if err != nil {
+		return webhook.Errored(http.StatusBadRequest, err)
+	}
+
+	oldVMRP, err := v.vmRPFromUnstructured(ctx.OldObj)
+	if err != nil {
+		return webhook.Errored(http.StatusBadRequest, err)
+	}
+
+	return common.BuildValidationResponse(ctx, v.validateVMOperatorAnnotations(ctx, vmRP, oldVMRP), nil)
+}
+
 func (v validator) validateMetadata(ctx *context.WebhookRequestContext, vmRP *vmopv1.VirtualMachineSetResourcePolicy) []string {
 	var validationErrs []string
+
+	if _, err := vmprovider.GetVMGroups(vmRP); err != nil {
+		validationErrs = append(validationErrs, fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.VMGroupsAnnotationKey, err))
+	}
+
+	if _, _, err := vmprovider.GetResourcePoolShares(vmRP); err != nil {
+		validationErrs = append(validationErrs, err.Error())
+	}
+
+	return validationErrs
+}
+
+func (v validator) validateResourcePoolName(ctx *context.WebhookRequestContext, vmRP *vmopv1.VirtualMachineSetResourcePolicy) []string {
+	var validationErrs []string
+
+	if err := vmprovider.ValidateResourcePoolName(vmRP.Spec.ResourcePool.Name); err != nil {
+		validationErrs = append(validationErrs, err.Error())
+	}
+
 	return validationErrs
 }
 
@@ -127,17 +170,53 @@ func (v validator) validateCPU(ctx *context.WebhookRequestContext, vmRP *vmopv1.
 	return validationErrs
 }
 
-// validateAllowedChanges returns true only if immutable fields have not been modified.
+// validateAllowedChanges returns true only if immutable fields have not been modified. The
+// reservations and limits of the resource pool can be changed.
 func (v validator) validateAllowedChanges(ctx *context.WebhookRequestContext, vmRP, oldVMRP *vmopv1.VirtualMachineSetResourcePolicy) []string {
 	var validationErrs []string
 
-	if !apiEquality.Semantic.DeepEqual(vmRP.Spec, oldVMRP.Spec) {
+	spec, oldSpec := vmRP.Spec.DeepCopy(), oldVMRP.Spec.DeepCopy()
+	spec.ResourcePool.Reservations, oldSpec.ResourcePool.Reservations = vmopv1.VirtualMachineResourceSpec{}, vmopv1.VirtualMachineResourceSpec{}
+	spec.ResourcePool.Limits, oldSpec.ResourcePool.Limits = vmopv1.VirtualMachineResourceSpec{}, vmopv1.VirtualMachineResourceSpec{}
+
+	if !apiEquality.Semantic.DeepEqual(spec, oldSpec) {
 		validationErrs = append(validationErrs, messages.UpdatingImmutableFieldsNotAllowed)
 	}
 
 	return validationErrs
 }
 
+// vmOperatorAnnotationKeys are the annotations set by VM Operator. They name the vSphere objects
+// that VM Operator deletes or the settings it resets, so only VM Operator can change them.
+var vmOperatorAnnotationKeys = []string{
+	vmprovider.VMGroupsStatusAnnotationKey,
+	vmprovider.ResourcePoolCreatedParentsAnnotationKey,
+	vmprovider.ResourcePoolAppliedAllocationAnnotationKey,
+}
+
+// validateVMOperatorAnnotations denies the changes to the annotations set by VM Operator, unless
+// they are made by VM Operator. oldVMRP is nil on create.
+func (v validator) validateVMOperatorAnnotations(ctx *context.WebhookRequestContext, vmRP, oldVMRP *vmopv1.VirtualMachineSetResourcePolicy) []string {
+	var validationErrs []string
+
+	if ctx.IsPrivilegedAccount {
+		return validationErrs
+	}
+
+	for _, key := range vmOperatorAnnotationKeys {
+		value, ok := vmRP.Annotations[key]
+		oldValue, oldOk := "", false
+		if oldVMRP != nil {
+			oldValue, oldOk = oldVMRP.Annotations[key]
+		}
+		if ok != oldOk || value != oldValue {
+			validationErrs = append(validationErrs, fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, key))
+		}
+	}
+
+	return validationErrs
+}
+
 // vmRPFromUnstructured returns the VirtualMachineSetResourcePolicy from the unstructured object.
 func (v validator) vmRPFromUnstructured(obj runtime.Unstructured) (*vmopv1.VirtualMachineSetResourcePolicy, error) {
 	vmRP := &vmopv1.VirtualMachineSetResourcePolicy{}
@@ -92,9 +92,18 @@ func intgTestsValidateUpdate() {
 		ctx = nil
 	})
 
-	When("update is performed with changed cpu request", func() {
+	When("update is performed with changed memory request", func() {
 		BeforeEach(func() {
-			ctx.vmRP.Spec.ResourcePool.Reservations.Memory = resource.MustParse("10Gi")
+			ctx.vmRP.Spec.ResourcePool.Reservations.Memory = resource.MustParse("3Gi")
+		})
+		It("should allow the request", func() {
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
+	When("update is performed with changed resource pool name", func() {
+		BeforeEach(func() {
+			ctx.vmRP.Spec.ResourcePool.Name = "other-resource-pool"
 		})
 		It("should deny the request", func() {
 			Expect(err).To(HaveOccurred())
@@ -4,6 +4,8 @@
 package validation_test
 
 import (
+	"fmt"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -14,7 +16,11 @@ import (
 
 	vmopv1 "github.com/vmware-tanzu/vm-operator-api/api/v1alpha1"
 
+	pkgbuilder "github.com/vmware-tanzu/vm-operator/pkg/builder"
+	"github.com/vmware-tanzu/vm-operator/pkg/vmprovider"
 	"github.com/vmware-tanzu/vm-operator/test/builder"
+	"github.com/vmware-tanzu/vm-operator/webhooks/common"
+	"github.com/vmware-tanzu/vm-operator/webhooks/virtualmachinesetresourcepolicy/validation/messages"
 )
 
 func unitTests() {
@@ -56,10 +62,16 @@ func unitTestsValidateCreate() {
 	)
 
 	type createArgs struct {
-		noCpuLimit           bool
-		noMemoryLimit        bool
-		invalidCpuRequest    bool
-		invalidMemoryRequest bool
+		noCpuLimit                 bool
+		noMemoryLimit              bool
+		invalidCpuRequest          bool
+		invalidMemoryRequest       bool
+		vmGroups                   string
+		resourcePoolName           string
+		cpuShares                  string
+		vmGroupsStatus             string
+		privileged                 bool
+		resourcePoolCreatedParents string
 	}
 
 	validateCreate := func(args createArgs, expectedAllowed bool, expectedReason string, expectedErr error) {
@@ -79,6 +91,22 @@ func unitTestsValidateCreate() {
 			ctx.vmRP.Spec.ResourcePool.Reservations.Memory = resource.MustParse("2Gi")
 			ctx.vmRP.Spec.ResourcePool.Limits.Memory = resource.MustParse("1Gi")
 		}
+		if args.vmGroups != "" {
+			ctx.vmRP.Annotations = map[string]string{vmprovider.VMGroupsAnnotationKey: args.vmGroups}
+		}
+		if args.resourcePoolName != "" {
+			ctx.vmRP.Spec.ResourcePool.Name = args.resourcePoolName
+		}
+		if args.cpuShares != "" {
+			ctx.vmRP.Annotations = map[string]string{vmprovider.ResourcePoolCPUSharesAnnotationKey: args.cpuShares}
+		}
+		if args.vmGroupsStatus != "" {
+			ctx.vmRP.Annotations = map[string]string{vmprovider.VMGroupsStatusAnnotationKey: args.vmGroupsStatus}
+		}
+		if args.resourcePoolCreatedParents != "" {
+			ctx.vmRP.Annotations = map[string]string{vmprovider.ResourcePoolCreatedParentsAnnotationKey: args.resourcePoolCreatedParents}
+		}
+		ctx.IsPrivilegedAccount = args.privileged
 
 		ctx.WebhookRequestContext.Obj, err = builder.ToUnstructured(ctx.vmRP)
 		Expect(err).ToNot(HaveOccurred())
@@ -106,6 +134,26 @@ func unitTestsValidateCreate() {
 		Entry("should allow no memory limit", createArgs{noMemoryLimit: true}, true, nil, nil),
 		Entry("should deny invalid cpu reservation", createArgs{invalidCpuRequest: true}, false, "CPU reservation must not be larger than the CPU limit", nil),
 		Entry("should deny invalid memory reservation", createArgs{invalidMemoryRequest: true}, false, "memory reservation must not be larger than the memory limit", nil),
+		Entry("should allow VM groups", createArgs{vmGroups: `[{"name": "db", "policy": "AntiAffinity"}, {"name": "web", "policy": "Affinity", "mandatory": true}]`}, true, nil, nil),
+		Entry("should deny VM groups that are not JSON", createArgs{vmGroups: "{"}, false, "", nil),
+		Entry("should deny VM groups with duplicate names", createArgs{vmGroups: `[{"name": "db", "policy": "AntiAffinity"}, {"name": "db", "policy": "Affinity"}]`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.VMGroupsAnnotationKey, `group name "db" is not unique`), nil),
+		Entry("should deny an affinity VM group backed by a cluster module", createArgs{vmGroups: `[{"name": "db", "policy": "Affinity", "backing": "ClusterModule"}]`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.VMGroupsAnnotationKey, `group "db" with backing ClusterModule must have policy AntiAffinity`), nil),
+		Entry("should allow a host affinity VM group", createArgs{vmGroups: `[{"name": "licensed", "policy": "HostAffinity", "hostTag": "licensed", "mandatory": true}]`}, true, nil, nil),
+		Entry("should deny a host affinity VM group without a host tag", createArgs{vmGroups: `[{"name": "licensed", "policy": "HostAffinity"}]`}, false,
+			fmt.Sprintf(common.AnnotationInvalidFmt, vmprovider.VMGroupsAnnotationKey, `group "licensed" with policy HostAffinity must have a host tag`), nil),
+		Entry("should allow a nested resource pool", createArgs{resourcePoolName: "tenant/web"}, true, nil, nil),
+		Entry("should deny a nested resource pool with an empty name", createArgs{resourcePoolName: "tenant//web"}, false,
+			`resource pool name "tenant//web" must not have an empty nested resource pool name`, nil),
+		Entry("should allow a CPU shares level", createArgs{cpuShares: "High"}, true, nil, nil),
+		Entry("should allow custom CPU shares", createArgs{cpuShares: "8000"}, true, nil, nil),
+		Entry("should deny invalid CPU shares", createArgs{cpuShares: "-1"}, false, "", nil),
+		Entry("should deny VM groups status", createArgs{vmGroupsStatus: `[{"name": "db", "backing": "ClusterModule", "moduleUuid": "uuid"}]`}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.VMGroupsStatusAnnotationKey), nil),
+		Entry("should deny resource pool created parents", createArgs{resourcePoolCreatedParents: `{"resgroup-1": ["tenant"]}`}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.ResourcePoolCreatedParentsAnnotationKey), nil),
+		Entry("should allow VM groups status set by VM Operator", createArgs{vmGroupsStatus: `[{"name": "db", "backing": "ClusterModule", "moduleUuid": "uuid"}]`, privileged: true}, true, nil, nil),
 	)
 }
 
@@ -116,8 +164,14 @@ func unitTestsValidateUpdate() {
 	)
 
 	type updateArgs struct {
-		changeCpu    bool
-		changeMemory bool
+		changeCpu                  bool
+		changeMemory               bool
+		changeResourcePool         bool
+		invalidMemoryRequest       bool
+		vmGroupsStatus             string
+		privileged                 bool
+		resourcePoolCreatedParents string
+		appliedAllocation          string
 	}
 
 	validateUpdate := func(args updateArgs, expectedAllowed bool, expectedReason string, expectedErr error) {
@@ -131,6 +185,22 @@ func unitTestsValidateUpdate() {
 			ctx.vmRP.Spec.ResourcePool.Reservations.Memory = resource.MustParse("5Gi")
 			ctx.vmRP.Spec.ResourcePool.Limits.Memory = resource.MustParse("10Gi")
 		}
+		if args.changeResourcePool {
+			ctx.vmRP.Spec.ResourcePool.Name = "other-resource-pool"
+		}
+		if args.invalidMemoryRequest {
+			ctx.vmRP.Spec.ResourcePool.Reservations.Memory = resource.MustParse("10Gi")
+		}
+		if args.vmGroupsStatus != "" {
+			ctx.vmRP.Annotations = map[string]string{vmprovider.VMGroupsStatusAnnotationKey: args.vmGroupsStatus}
+		}
+		if args.resourcePoolCreatedParents != "" {
+			ctx.vmRP.Annotations = map[string]string{vmprovider.ResourcePoolCreatedParentsAnnotationKey: args.resourcePoolCreatedParents}
+		}
+		if args.appliedAllocation != "" {
+			ctx.vmRP.Annotations = map[string]string{vmprovider.ResourcePoolAppliedAllocationAnnotationKey: args.appliedAllocation}
+		}
+		ctx.IsPrivilegedAccount = args.privileged
 
 		ctx.WebhookRequestContext.Obj, err = builder.ToUnstructured(ctx.vmRP)
 		Expect(err).ToNot(HaveOccurred())
@@ -154,8 +224,18 @@ func unitTestsValidateUpdate() {
 
 	DescribeTable("update table", validateUpdate,
 		Entry("should allow", updateArgs{}, true, nil, nil),
-		Entry("should deny policy cpu change", updateArgs{changeCpu: true}, false, "updates to immutable fields are not allowed", nil),
-		Entry("should deny policy memory change", updateArgs{changeMemory: true}, false, "updates to immutable fields are not allowed", nil),
+		Entry("should allow policy cpu change", updateArgs{changeCpu: true}, true, nil, nil),
+		Entry("should allow policy memory change", updateArgs{changeMemory: true}, true, nil, nil),
+		Entry("should deny invalid memory reservation", updateArgs{invalidMemoryRequest: true}, false, "memory reservation must not be larger than the memory limit", nil),
+		Entry("should deny resource pool name change", updateArgs{changeResourcePool: true}, false, "updates to immutable fields are not allowed", nil),
+		Entry("should deny VM groups status change", updateArgs{vmGroupsStatus: `[{"name": "db", "backing": "DRSRule", "ruleName": "other"}]`}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.VMGroupsStatusAnnotationKey), nil),
+		Entry("should deny resource pool created parents change", updateArgs{resourcePoolCreatedParents: `{"resgroup-1": ["tenant"]}`}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.ResourcePoolCreatedParentsAnnotationKey), nil),
+		Entry("should deny resource pool applied allocation change", updateArgs{appliedAllocation: `{"reservations": {"memory": "1Gi"}}`}, false,
+			fmt.Sprintf(messages.UpdatingVMOperatorAnnotationNotAllowedFmt, vmprovider.ResourcePoolAppliedAllocationAnnotationKey), nil),
+		Entry("should allow resource pool applied allocation change by VM Operator", updateArgs{appliedAllocation: `{"reservations": {"memory": "1Gi"}}`, privileged: true}, true, nil, nil),
+		Entry("should allow VM groups status change by VM Operator", updateArgs{vmGroupsStatus: `[{"name": "db", "backing": "DRSRule"}]`, privileged: true}, true, nil, nil),
 	)
 
 	When("the update is performed while object deletion", func() {
@@ -170,6 +250,22 @@ func unitTestsValidateUpdate() {
 			Expect(response.Result).ToNot(BeNil())
 		})
 	})
+
+	When("the VM groups status is changed while object deletion", func() {
+		JustBeforeEach(func() {
+			var err error
+			t := metav1.Now()
+			ctx.vmRP.DeletionTimestamp = &t
+			ctx.vmRP.Annotations = map[string]string{vmprovider.VMGroupsStatusAnnotationKey: `[{"name": "db", "backing": "ClusterModule", "moduleUuid": "uuid"}]`}
+			ctx.WebhookRequestContext.Obj, err = builder.ToUnstructured(ctx.vmRP)
+			Expect(err).ToNot(HaveOccurred())
+			response = ctx.Validator.(pkgbuilder.DeletingObjectValidator).ValidateUpdateOnDeleting(&ctx.WebhookRequestContext)
+		})
+
+		It("should deny the request", func() {
+			Expect(response.Allowed).To(BeFalse())
+		})
+	})
 }
 
 func unitTestsValidateDelete() {